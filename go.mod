@@ -11,16 +11,19 @@ require (
 	github.com/dhowden/tag v0.0.0-20200828214007-46e57f75dbfc
 	github.com/diamondburned/audpl v0.0.0-20201107052523-20d1b6c126e7
 	github.com/diamondburned/gotk4/pkg v0.0.0-20220224183509-a424ccf7497a
+	github.com/fsnotify/fsnotify v1.5.4
 	github.com/go-test/deep v1.0.7
 	github.com/godbus/dbus/v5 v5.0.3
 	github.com/lithammer/fuzzysearch v1.1.1
 	github.com/pkg/errors v0.9.1
 	github.com/ushis/m3u v0.0.0-20150127162843-94396b784733
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/text v0.13.0
 )
 
 require (
 	go4.org/unsafe/assume-no-moving-gc v0.0.0-20201222180813-1025295fd063 // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
-	golang.org/x/text v0.3.2 // indirect
+	golang.org/x/sys v0.0.0-20220412211240-33da011f77ad // indirect
 	gopkg.in/natefinch/npipe.v2 v2.0.0-20160621034901-c1b8fa8bdcce // indirect
 )
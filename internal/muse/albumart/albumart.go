@@ -1,128 +1,155 @@
+// Package albumart finds the album art of tracks and caches scaled thumbnails
+// of it on disk.
 package albumart
 
 import (
-	"bytes"
 	"context"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
-	"sync"
 
 	"github.com/dhowden/tag"
+	"github.com/pkg/errors"
 )
 
-// Stolen from: mpv/blob/master/player/external_files.c#L45, which was
-// stolen from: vlc/blob/master/modules/meta_engine/folder.c#L40.
-// Sorted by priority.
-var coverFiles = []string{
-	"AlbumArt.jpg",
-	"Album.jpg",
-	"cover.jpg",
-	"cover.png",
-	"front.jpg",
-	"front.png",
-	"Cover.jpg",
-
-	"AlbumArtSmall.jpg",
-	"Folder.jpg",
-	"Folder.png",
-	"folder.jpg",
-	".folder.png",
-	"thumb.jpg",
-	"Thumb.jpg",
-
-	"front.bmp",
-	"front.gif",
-	"cover.gif",
+// ErrNotFound is returned if a track has no album art.
+var ErrNotFound = errors.New("no album art found")
+
+// imageExts are the extensions of the image files that may be album art.
+var imageExts = map[string]bool{
+	"jpeg": true,
+	"png":  true,
+	"webp": true,
+	"gif":  true,
+	"bmp":  true,
+}
+
+// coverNames are the names of cover files without their extensions, sorted by
+// priority. They're matched case-insensitively. The list is based on mpv's
+// player/external_files.c, which is based on VLC's folder.c.
+var coverNames = []string{
+	"albumart",
+	"album",
+	"cover",
+	"front",
+	"albumartsmall",
+	"folder",
+	".folder",
+	"thumb",
 }
 
-type File struct {
-	io.ReadCloser
-	Extension string // jpeg, ...
+// coverPrefixes are matched if no file has any of the coverNames. For example,
+// they match "cover-front.png" or "folder (1).jpg".
+var coverPrefixes = []string{
+	"cover",
+	"front",
+	"folder",
+}
+
+// Image is an image file.
+type Image struct {
+	Path      string
+	Extension string // jpeg, png, ...
+}
+
+// FindCover finds the cover file in the given directory. Image files whose
+// names are known cover names are preferred, then image files that start with
+// a known prefix, then any image file. Files with the same priority are sorted
+// by name. ErrNotFound is returned if the directory has no images.
+func FindCover(dir string) (*Image, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read directory")
+	}
+
+	var best string
+	bestPriority := -1
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		p := coverPriority(file.Name())
+		if p < 0 {
+			continue
+		}
+
+		if bestPriority < 0 || p < bestPriority || (p == bestPriority && file.Name() < best) {
+			best = file.Name()
+			bestPriority = p
+		}
+	}
+
+	if bestPriority < 0 {
+		return nil, ErrNotFound
+	}
+
+	return &Image{
+		Path:      filepath.Join(dir, best),
+		Extension: normalizeExt(filepath.Ext(best)),
+	}, nil
 }
 
-// AlbumArt queries for an album art. It returns an invalid File if there is no
-// album art. The function may read the album art into memory.
-//
-// The given context will directly control the returned file. If the context is
-// cancelled, then the file is also closed.
-func AlbumArt(ctx context.Context, path string) *File {
-	// Prioritize searching for external album arts over reading the album art
-	// into memory.
-	dir := filepath.Dir(path)
-
-	openCtx, cancelOpen := context.WithCancel(ctx)
-	defer cancelOpen()
-
-	waitGroup := sync.WaitGroup{}
-	waitGroup.Add(len(coverFiles))
-
-	go func() {
-		waitGroup.Wait()
-		cancelOpen()
-	}()
-
-	results := make(chan File)
-
-	for _, coverFile := range coverFiles {
-		go func(coverFile string) {
-			defer waitGroup.Done()
-
-			f, err := os.Open(filepath.Join(dir, coverFile))
-			if err != nil {
-				return
-			}
-
-			file := File{
-				ReadCloser: f,
-				Extension:  normalizeExt(filepath.Ext(coverFile)),
-			}
-
-			select {
-			case results <- file:
-				// Stop prematurely.
-				cancelOpen()
-				// Close the file when the context is done.
-				closeWhenDone(ctx, f)
-				// done
-			case <-openCtx.Done():
-				f.Close()
-			}
-		}(coverFile)
+// coverPriority returns the priority of the file with the given name, where
+// lower is better, or -1 if the file isn't an image.
+func coverPriority(name string) int {
+	ext := filepath.Ext(name)
+	if !imageExts[normalizeExt(ext)] {
+		return -1
+	}
+
+	base := strings.ToLower(strings.TrimSuffix(name, ext))
+
+	for i, cover := range coverNames {
+		if base == cover {
+			return i
+		}
 	}
 
-	select {
-	case file := <-results:
-		return &file
-	case <-openCtx.Done():
-		// continue
+	for i, prefix := range coverPrefixes {
+		if strings.HasPrefix(base, prefix) {
+			return len(coverNames) + i
+		}
 	}
 
+	return len(coverNames) + len(coverPrefixes)
+}
+
+// ReadEmbedded reads the picture embedded in the tags of the audio file at the
+// given path. ErrNotFound is returned if there's none.
+func ReadEmbedded(path string) ([]byte, string, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return nil
+		return nil, "", errors.Wrap(err, "failed to open file")
 	}
 	defer f.Close()
 
-	closeWhenDone(ctx, f)
-
 	m, err := tag.ReadFrom(f)
-	if err == nil {
-		if pic := m.Picture(); pic != nil {
-			return &File{
-				ReadCloser: ioutil.NopCloser(bytes.NewReader(pic.Data)),
-				Extension:  normalizeExt(pic.Ext),
-			}
+	if err != nil {
+		if errors.Is(err, tag.ErrNoTagsFound) {
+			return nil, "", ErrNotFound
 		}
+		return nil, "", errors.Wrap(err, "failed to read tags")
+	}
+
+	pic := m.Picture()
+	if pic == nil || len(pic.Data) == 0 {
+		return nil, "", ErrNotFound
+	}
+
+	ext := normalizeExt(pic.Ext)
+	if ext == "" {
+		ext = extFromMIME(pic.MIMEType)
 	}
 
-	return nil
+	return pic.Data, ext, nil
 }
 
-func closeWhenDone(ctx context.Context, f *os.File) {
-	go func() { <-ctx.Done(); f.Close() }()
+func extFromMIME(mime string) string {
+	return normalizeExt(strings.TrimPrefix(strings.ToLower(mime), "image/"))
 }
 
 func normalizeExt(ext string) string {
@@ -135,3 +162,32 @@ func normalizeExt(ext string) string {
 
 	return ext
 }
+
+// Sizes are the sizes of the cached thumbnails in ascending order.
+var Sizes = []int{64, 128, 256, 512}
+
+// thumbnailSize returns the smallest thumbnail size that is at least the given
+// size, or 0 if the size is larger than all of them.
+func thumbnailSize(size int) int {
+	i := sort.SearchInts(Sizes, size)
+	if i == len(Sizes) {
+		return 0
+	}
+	return Sizes[i]
+}
+
+var defaultCache *Cache
+
+func init() {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	defaultCache = NewCache(filepath.Join(dir, "aqours", "albumart"))
+}
+
+// Thumbnail returns the thumbnail of the track's album art from the default
+// cache, which is in the user's cache directory. See Cache.Thumbnail.
+func Thumbnail(ctx context.Context, path string, size int) (*Image, error) {
+	return defaultCache.Thumbnail(ctx, path, size)
+}
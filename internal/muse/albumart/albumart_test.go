@@ -0,0 +1,269 @@
+package albumart
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindCover(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  []string
+		expect string
+	}{
+		{
+			name:   "case-insensitive",
+			files:  []string{"01.flac", "COVER.JPG"},
+			expect: "COVER.JPG",
+		},
+		{
+			name:   "priority",
+			files:  []string{"folder.webp", "Front.png", "AlbumArt.jpeg"},
+			expect: "AlbumArt.jpeg",
+		},
+		{
+			name:   "prefix",
+			files:  []string{"scan.png", "Cover (Front).png"},
+			expect: "Cover (Front).png",
+		},
+		{
+			name:   "any image",
+			files:  []string{"b.png", "a.gif", "notes.txt"},
+			expect: "a.gif",
+		},
+		{
+			name:  "no images",
+			files: []string{"01.flac", "cover.txt"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			files := make(map[string]string, len(test.files))
+			for _, name := range test.files {
+				files[name] = name
+			}
+			writeFiles(t, dir, files)
+
+			img, err := FindCover(dir)
+			if test.expect == "" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Fatalf("expected ErrNotFound, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("failed to find cover:", err)
+			}
+
+			if base := filepath.Base(img.Path); base != test.expect {
+				t.Fatalf("found %q, expected %q", base, test.expect)
+			}
+		})
+	}
+}
+
+// stubScale replaces scale with a function that writes the size and the
+// content of the image, and counts its calls.
+func stubScale(t *testing.T) *int {
+	t.Helper()
+
+	var calls int
+	old := scale
+	scale = func(w io.Writer, path string, size int) error {
+		calls++
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append([]byte{byte(size / 64)}, b...))
+		return err
+	}
+	t.Cleanup(func() { scale = old })
+
+	return &calls
+}
+
+func TestCacheCover(t *testing.T) {
+	calls := stubScale(t)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"01.flac":    "",
+		"02.flac":    "",
+		"Folder.PNG": "cover",
+	})
+
+	cache := NewCache(t.TempDir())
+	ctx := context.Background()
+
+	thumb, err := cache.Thumbnail(ctx, filepath.Join(dir, "01.flac"), 100)
+	if err != nil {
+		t.Fatal("failed to get thumbnail:", err)
+	}
+
+	b, err := ioutil.ReadFile(thumb.Path)
+	if err != nil {
+		t.Fatal("failed to read thumbnail:", err)
+	}
+	if !bytes.Equal(b, []byte("\x02cover")) {
+		t.Fatalf("unexpected thumbnail %q", b)
+	}
+
+	// The other track in the same album shares the thumbnail.
+	other, err := cache.Thumbnail(ctx, filepath.Join(dir, "02.flac"), 128)
+	if err != nil {
+		t.Fatal("failed to get thumbnail:", err)
+	}
+	if other.Path != thumb.Path {
+		t.Fatalf("expected shared thumbnail %q, got %q", thumb.Path, other.Path)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 scale, got %d", *calls)
+	}
+
+	// A size larger than all thumbnails uses the original.
+	orig, err := cache.Thumbnail(ctx, filepath.Join(dir, "01.flac"), 4096)
+	if err != nil {
+		t.Fatal("failed to get original:", err)
+	}
+	if orig.Path != filepath.Join(dir, "Folder.PNG") || orig.Extension != "png" {
+		t.Fatalf("unexpected original %#v", orig)
+	}
+
+	// Changing the cover changes the thumbnail.
+	writeFiles(t, dir, map[string]string{"Folder.PNG": "new cover"})
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "Folder.PNG"), future, future)
+
+	thumb, err = cache.Thumbnail(ctx, filepath.Join(dir, "01.flac"), 100)
+	if err != nil {
+		t.Fatal("failed to get thumbnail:", err)
+	}
+
+	b, _ = ioutil.ReadFile(thumb.Path)
+	if !bytes.Equal(b, []byte("\x02new cover")) {
+		t.Fatalf("unexpected thumbnail after the change %q", b)
+	}
+}
+
+func TestCacheEmbedded(t *testing.T) {
+	stubScale(t)
+
+	dir := t.TempDir()
+	track := filepath.Join(dir, "01.mp3")
+
+	if err := os.WriteFile(track, id3WithPicture("image/png", "embedded"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	orig, err := NewCache(cacheDir).Original(track)
+	if err != nil {
+		t.Fatal("failed to get original:", err)
+	}
+	if orig.Extension != "png" {
+		t.Fatalf("unexpected extension %q", orig.Extension)
+	}
+
+	b, err := ioutil.ReadFile(orig.Path)
+	if err != nil || string(b) != "embedded" {
+		t.Fatalf("unexpected extracted album art %q (%v)", b, err)
+	}
+
+	// A new cache in the same directory doesn't extract the art again, so
+	// removing the picture from the tags isn't noticed while the file keeps its
+	// identity.
+	stat, _ := os.Stat(track)
+	if err := os.WriteFile(track, id3WithPicture("image/png", "EMBEDDED"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(track, stat.ModTime(), stat.ModTime())
+
+	thumb, err := NewCache(cacheDir).Thumbnail(ctx, track, 64)
+	if err != nil {
+		t.Fatal("failed to get thumbnail:", err)
+	}
+
+	b, _ = ioutil.ReadFile(thumb.Path)
+	if string(b) != "\x01embedded" {
+		t.Fatalf("unexpected thumbnail %q", b)
+	}
+}
+
+func TestCacheNotFound(t *testing.T) {
+	dir := t.TempDir()
+	track := filepath.Join(dir, "01.flac")
+	writeFiles(t, dir, map[string]string{"01.flac": strings.Repeat("not really FLAC ", 16)})
+
+	_, err := NewCache(t.TempDir()).Thumbnail(context.Background(), track, 64)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a file without tags, got %v", err)
+	}
+
+	if err := os.WriteFile(track, id3WithPicture("", ""), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewCache(t.TempDir()).Thumbnail(context.Background(), track, 64)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// id3WithPicture returns an ID3v2.3 tag with an APIC frame holding the given
+// picture. No frame is written if the picture is empty.
+func id3WithPicture(mime, data string) []byte {
+	var body bytes.Buffer
+
+	frame := func(id, content string) {
+		body.WriteString(id)
+		binary.Write(&body, binary.BigEndian, uint32(len(content)))
+		body.Write([]byte{0, 0}) // flags
+		body.WriteString(content)
+	}
+
+	frame("TIT2", "\x00Title")
+	if data != "" {
+		frame("APIC", "\x00"+mime+"\x00\x03\x00"+data)
+	}
+	body.Write(make([]byte, 16)) // padding
+
+	size := body.Len()
+
+	var b bytes.Buffer
+	b.WriteString("ID3\x03\x00\x00")
+	// The size is syncsafe.
+	b.Write([]byte{
+		byte(size >> 21 & 0x7F),
+		byte(size >> 14 & 0x7F),
+		byte(size >> 7 & 0x7F),
+		byte(size & 0x7F),
+	})
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
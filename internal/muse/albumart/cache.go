@@ -0,0 +1,276 @@
+package albumart
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/diamondburned/aqours/internal/muse/metadata/ffmpeg"
+	"github.com/pkg/errors"
+)
+
+// scale writes the image at the given path scaled to the given height as JPEG.
+// It's replaced in tests.
+var scale = ffmpeg.AlbumArt
+
+// Cache caches album art on disk. The directory has these files:
+//
+//	index/<source key>       the album art of a source file
+//	original/<hash>.<ext>    embedded album art extracted from audio files
+//	<size>/<hash>.jpeg       thumbnails
+//
+// A source is either a cover file or an audio file with embedded album art,
+// and its key is the hash of its path, size and modification time, so it's
+// looked up again once the file changes. Images are keyed by the hash of their
+// content, so albums with the same art share their thumbnails.
+type Cache struct {
+	Dir string
+
+	mu    sync.Mutex
+	index map[string]indexEntry
+}
+
+// indexEntry is the album art of a source. The hash is empty if the source has
+// no album art.
+type indexEntry struct {
+	Hash      string `json:"hash"`
+	Path      string `json:"path,omitempty"`
+	Extension string `json:"ext,omitempty"`
+}
+
+// NewCache creates a cache in the given directory, which is created once
+// something is cached.
+func NewCache(dir string) *Cache {
+	return &Cache{
+		Dir:   dir,
+		index: make(map[string]indexEntry),
+	}
+}
+
+// Thumbnail returns the thumbnail of the track's album art that is at least as
+// large as the given size. The thumbnail is made and cached if it's not cached
+// yet. If the size is larger than all thumbnail sizes, or if the thumbnail
+// can't be made, then the original image is returned. ErrNotFound is returned
+// if the track has no album art.
+func (c *Cache) Thumbnail(ctx context.Context, path string, size int) (*Image, error) {
+	orig, hash, err := c.original(path)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbSize := thumbnailSize(size)
+	if thumbSize == 0 {
+		return orig, nil
+	}
+
+	thumb := &Image{
+		Path:      filepath.Join(c.Dir, strconv.Itoa(thumbSize), hash+".jpeg"),
+		Extension: "jpeg",
+	}
+
+	if _, err := os.Stat(thumb.Path); err == nil {
+		return thumb, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := scale(&buf, orig.Path, thumbSize); err != nil || buf.Len() == 0 {
+		// ffmpeg may not be installed, but the original is still usable.
+		return orig, nil
+	}
+
+	if err := writeFile(thumb.Path, buf.Bytes()); err != nil {
+		return orig, nil
+	}
+
+	return thumb, nil
+}
+
+// Original returns the full album art of the track. Embedded album art is only
+// extracted the first time. ErrNotFound is returned if the track has no album
+// art.
+func (c *Cache) Original(path string) (*Image, error) {
+	img, _, err := c.original(path)
+	return img, err
+}
+
+func (c *Cache) original(path string) (*Image, string, error) {
+	source := path
+
+	cover, err := FindCover(filepath.Dir(path))
+	if err == nil {
+		source = cover.Path
+	}
+
+	key, err := sourceKey(source)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entry, ok := c.lookup(key)
+	if !ok {
+		if cover != nil {
+			entry, err = c.addCover(cover)
+		} else {
+			entry, err = c.addEmbedded(path)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		c.store(key, entry)
+	}
+
+	if entry.Hash == "" {
+		return nil, "", ErrNotFound
+	}
+
+	return &Image{Path: entry.Path, Extension: entry.Extension}, entry.Hash, nil
+}
+
+func (c *Cache) addCover(cover *Image) (indexEntry, error) {
+	f, err := os.Open(cover.Path)
+	if err != nil {
+		return indexEntry{}, errors.Wrap(err, "failed to open cover")
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return indexEntry{}, errors.Wrap(err, "failed to read cover")
+	}
+
+	return indexEntry{
+		Hash:      hex.EncodeToString(h.Sum(nil)),
+		Path:      cover.Path,
+		Extension: cover.Extension,
+	}, nil
+}
+
+func (c *Cache) addEmbedded(path string) (indexEntry, error) {
+	data, ext, err := ReadEmbedded(path)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return indexEntry{}, nil
+		}
+		return indexEntry{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	entry := indexEntry{
+		Hash:      hash,
+		Path:      filepath.Join(c.Dir, "original", hash+"."+ext),
+		Extension: ext,
+	}
+
+	if _, err := os.Stat(entry.Path); err != nil {
+		if err := writeFile(entry.Path, data); err != nil {
+			return indexEntry{}, errors.Wrap(err, "failed to cache embedded album art")
+		}
+	}
+
+	return entry, nil
+}
+
+// lookup returns the cached entry of the source with the given key. An entry
+// whose image has been removed is treated as missing.
+func (c *Cache) lookup(key string) (indexEntry, bool) {
+	c.mu.Lock()
+	entry, ok := c.index[key]
+	c.mu.Unlock()
+
+	if !ok {
+		b, err := ioutil.ReadFile(c.indexPath(key))
+		if err != nil {
+			return indexEntry{}, false
+		}
+		if err := json.Unmarshal(b, &entry); err != nil {
+			return indexEntry{}, false
+		}
+	}
+
+	if entry.Hash != "" {
+		if _, err := os.Stat(entry.Path); err != nil {
+			return indexEntry{}, false
+		}
+	}
+
+	c.mu.Lock()
+	c.index[key] = entry
+	c.mu.Unlock()
+
+	return entry, true
+}
+
+func (c *Cache) store(key string, entry indexEntry) {
+	c.mu.Lock()
+	c.index[key] = entry
+	c.mu.Unlock()
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	// The entry is only remembered in memory if it can't be written.
+	writeFile(c.indexPath(key), b)
+}
+
+func (c *Cache) indexPath(key string) string {
+	return filepath.Join(c.Dir, "index", key)
+}
+
+// sourceKey returns the key of the source file, which changes if the file is
+// modified.
+func sourceKey(path string) (string, error) {
+	s, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to stat file")
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf(
+		"%s\x00%d\x00%d", path, s.Size(), s.ModTime().UnixNano(),
+	)))
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeFile writes the file atomically, creating its directory if needed.
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return errors.Wrap(err, "failed to make directory")
+	}
+
+	f, err := ioutil.TempFile(dir, ".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write file")
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close file")
+	}
+
+	return os.Rename(f.Name(), path)
+}
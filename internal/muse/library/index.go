@@ -0,0 +1,193 @@
+// Package library implements the music library, which indexes all tracks found
+// in a set of root directories by their artists, albums and genres.
+package library
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+)
+
+// Names used for tracks with missing tags.
+const (
+	UnknownArtist = "Unknown Artist"
+	UnknownAlbum  = "Unknown Album"
+	UnknownGenre  = "Unknown Genre"
+)
+
+// Index is the library index. All tracks are referred to by their indices in
+// the slice given to Build.
+type Index struct {
+	Artists []*Artist
+	Genres  []*Genre
+}
+
+// Artist is an artist with all of their albums.
+type Artist struct {
+	Name   string
+	Albums []*Album
+}
+
+// Genre is a genre with all albums that have tracks of it.
+type Genre struct {
+	Name   string
+	Albums []*Album
+}
+
+// Album is an album of an artist, who is the album artist if the tracks have
+// one. Tracks are sorted by their disc and track numbers.
+type Album struct {
+	Name   string
+	Artist string
+	Date   string
+	Tracks []int
+}
+
+// Tracks returns the tracks of all the artist's albums in order.
+func (a *Artist) Tracks() []int {
+	return albumTracks(a.Albums)
+}
+
+// Tracks returns the tracks of all the genre's albums in order.
+func (g *Genre) Tracks() []int {
+	return albumTracks(g.Albums)
+}
+
+func albumTracks(albums []*Album) []int {
+	var tracks []int
+	for _, album := range albums {
+		tracks = append(tracks, album.Tracks...)
+	}
+	return tracks
+}
+
+type albumKey struct {
+	artist string
+	album  string
+}
+
+// Build builds an index of the given tracks.
+func Build(tracks []playlist.Track) *Index {
+	artists := make(map[string]*Artist)
+	albums := make(map[albumKey]*Album)
+
+	genres := make(map[string]*Genre)
+	genreAlbums := make(map[string]map[albumKey]*Album)
+
+	for i, track := range tracks {
+		// Group compilations by their album artist, so that they aren't split
+		// into an album per track artist.
+		key := albumKey{
+			artist: orUnknown(track.AlbumArtistOrArtist(), UnknownArtist),
+			album:  orUnknown(track.Album, UnknownAlbum),
+		}
+
+		artist, ok := artists[key.artist]
+		if !ok {
+			artist = &Artist{Name: key.artist}
+			artists[key.artist] = artist
+		}
+
+		album, ok := albums[key]
+		if !ok {
+			album = newAlbum(key, track)
+			albums[key] = album
+			artist.Albums = append(artist.Albums, album)
+		}
+		album.Tracks = append(album.Tracks, i)
+
+		genreName := orUnknown(track.Genre, UnknownGenre)
+
+		genre, ok := genres[genreName]
+		if !ok {
+			genre = &Genre{Name: genreName}
+			genres[genreName] = genre
+			genreAlbums[genreName] = make(map[albumKey]*Album)
+		}
+
+		// Albums in a genre only have the tracks of that genre, so they're
+		// separate from the artist's albums.
+		gAlbum, ok := genreAlbums[genreName][key]
+		if !ok {
+			gAlbum = newAlbum(key, track)
+			genreAlbums[genreName][key] = gAlbum
+			genre.Albums = append(genre.Albums, gAlbum)
+		}
+		gAlbum.Tracks = append(gAlbum.Tracks, i)
+	}
+
+	index := &Index{
+		Artists: make([]*Artist, 0, len(artists)),
+		Genres:  make([]*Genre, 0, len(genres)),
+	}
+
+	for _, artist := range artists {
+		sortAlbums(tracks, artist.Albums)
+		index.Artists = append(index.Artists, artist)
+	}
+
+	for _, genre := range genres {
+		sortAlbums(tracks, genre.Albums)
+		index.Genres = append(index.Genres, genre)
+	}
+
+	sort.Slice(index.Artists, func(i, j int) bool {
+		return lessName(index.Artists[i].Name, index.Artists[j].Name, UnknownArtist)
+	})
+	sort.Slice(index.Genres, func(i, j int) bool {
+		return lessName(index.Genres[i].Name, index.Genres[j].Name, UnknownGenre)
+	})
+
+	return index
+}
+
+func newAlbum(key albumKey, track playlist.Track) *Album {
+	return &Album{
+		Name:   key.album,
+		Artist: key.artist,
+		Date:   track.Date,
+	}
+}
+
+func orUnknown(name, unknown string) string {
+	if name = strings.TrimSpace(name); name == "" {
+		return unknown
+	}
+	return name
+}
+
+// lessName compares names case-insensitively while putting the unknown name
+// last.
+func lessName(a, b, unknown string) bool {
+	if (a == unknown) != (b == unknown) {
+		return b == unknown
+	}
+
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+	if la != lb {
+		return la < lb
+	}
+	return a < b
+}
+
+// sortAlbums sorts the albums by date then name, and their tracks by disc and
+// track number then path.
+func sortAlbums(tracks []playlist.Track, albums []*Album) {
+	for _, album := range albums {
+		sort.SliceStable(album.Tracks, func(i, j int) bool {
+			a, b := &tracks[album.Tracks[i]], &tracks[album.Tracks[j]]
+			if c := playlist.ComparePosition(a, b); c != 0 {
+				return c < 0
+			}
+			return a.Filepath < b.Filepath
+		})
+	}
+
+	sort.SliceStable(albums, func(i, j int) bool {
+		if albums[i].Date != albums[j].Date {
+			return albums[i].Date < albums[j].Date
+		}
+		return lessName(albums[i].Name, albums[j].Name, UnknownAlbum)
+	})
+}
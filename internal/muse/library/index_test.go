@@ -0,0 +1,76 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/go-test/deep"
+)
+
+func TestBuild(t *testing.T) {
+	tracks := []playlist.Track{
+		{Filepath: "0", Artist: "b", Album: "y", Genre: "rock", Date: "2001", Number: 2},
+		{Filepath: "1", Artist: "b", Album: "y", Genre: "pop", Date: "2001", Number: 1},
+		{Filepath: "2", Artist: "b", Album: "x", Genre: "rock", Date: "1999", Number: 1},
+		{Filepath: "3", Artist: "A", Album: "z", Genre: "rock", Number: 1},
+		{Filepath: "4"},
+	}
+
+	index := Build(tracks)
+
+	expect := &Index{
+		Artists: []*Artist{
+			{Name: "A", Albums: []*Album{
+				{Name: "z", Artist: "A", Tracks: []int{3}},
+			}},
+			{Name: "b", Albums: []*Album{
+				{Name: "x", Artist: "b", Date: "1999", Tracks: []int{2}},
+				{Name: "y", Artist: "b", Date: "2001", Tracks: []int{1, 0}},
+			}},
+			{Name: UnknownArtist, Albums: []*Album{
+				{Name: UnknownAlbum, Artist: UnknownArtist, Tracks: []int{4}},
+			}},
+		},
+		Genres: []*Genre{
+			{Name: "pop", Albums: []*Album{
+				{Name: "y", Artist: "b", Date: "2001", Tracks: []int{1}},
+			}},
+			{Name: "rock", Albums: []*Album{
+				{Name: "z", Artist: "A", Tracks: []int{3}},
+				{Name: "x", Artist: "b", Date: "1999", Tracks: []int{2}},
+				{Name: "y", Artist: "b", Date: "2001", Tracks: []int{0}},
+			}},
+			{Name: UnknownGenre, Albums: []*Album{
+				{Name: UnknownAlbum, Artist: UnknownArtist, Tracks: []int{4}},
+			}},
+		},
+	}
+
+	for _, ineq := range deep.Equal(index, expect) {
+		t.Error(ineq)
+	}
+
+	if tracks := index.Artists[1].Tracks(); deep.Equal(tracks, []int{2, 1, 0}) != nil {
+		t.Errorf("unexpected artist tracks %v", tracks)
+	}
+}
+
+func TestBuildAlbumArtist(t *testing.T) {
+	tracks := []playlist.Track{
+		{Filepath: "0", Artist: "a", AlbumArtist: "Various", Album: "x", Disc: 2, Number: 1},
+		{Filepath: "1", Artist: "b", AlbumArtist: "Various", Album: "x", Disc: 1, Number: 2},
+		{Filepath: "2", Artist: "c", AlbumArtist: "Various", Album: "x", Disc: 1, Number: 1},
+	}
+
+	index := Build(tracks)
+
+	expect := []*Artist{
+		{Name: "Various", Albums: []*Album{
+			{Name: "x", Artist: "Various", Tracks: []int{2, 1, 0}},
+		}},
+	}
+
+	for _, ineq := range deep.Equal(index.Artists, expect) {
+		t.Error(ineq)
+	}
+}
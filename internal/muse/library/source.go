@@ -0,0 +1,83 @@
+package library
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/muse/playlist/folder"
+	"github.com/pkg/errors"
+)
+
+// Source is the set of root directories that the library is kept in sync with.
+type Source struct {
+	Roots []string `json:"roots"`
+}
+
+var _ playlist.Source = (*Source)(nil)
+
+// Scan implements playlist.Source. Roots that cannot be scanned are skipped,
+// since a missing mount shouldn't empty the whole library.
+func (s *Source) Scan() ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+
+	for _, root := range s.Roots {
+		rootPaths, err := s.folder(root).Scan()
+		if err != nil {
+			log.Printf("skipping library root %q: %v\n", root, err)
+			continue
+		}
+
+		for _, path := range rootPaths {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Watch implements playlist.Source. It watches all roots until the context is
+// canceled. Roots that cannot be watched are skipped like in Scan, so an error
+// is only returned if every root fails.
+func (s *Source) Watch(ctx context.Context, changed func()) error {
+	if len(s.Roots) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(s.Roots))
+
+	for _, root := range s.Roots {
+		go func(root string) {
+			err := s.folder(root).Watch(ctx, changed)
+			if err == nil {
+				err = errors.New("watcher closed")
+			}
+			errs <- errors.Wrapf(err, "failed to watch %q", root)
+		}(root)
+	}
+
+	var err error
+
+	for range s.Roots {
+		if err = <-errs; ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Println("skipping library root:", err)
+	}
+
+	return errors.Wrap(err, "failed to watch any library root")
+}
+
+func (s *Source) folder(root string) *folder.Source {
+	return &folder.Source{Root: root}
+}
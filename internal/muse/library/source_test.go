@@ -0,0 +1,32 @@
+package library
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSourceWatch(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "unmounted")
+
+	t.Run("some roots fail", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		source := Source{Roots: []string{missing, t.TempDir()}}
+
+		// The root that is there is watched until the context is canceled.
+		if err := source.Watch(ctx, func() {}); err != context.DeadlineExceeded {
+			t.Fatalf("error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("all roots fail", func(t *testing.T) {
+		source := Source{Roots: []string{missing}}
+
+		if err := source.Watch(context.Background(), func() {}); err == nil {
+			t.Fatal("unexpected nil error")
+		}
+	})
+}
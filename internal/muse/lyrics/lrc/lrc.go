@@ -0,0 +1,179 @@
+// Package lrc parses lyrics in the LRC format, where each line is prefixed
+// with the times that it's sung at, such as [01:23.45]. Lyrics without any
+// timestamps are kept as unsynchronized lyrics.
+package lrc
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line is a line of lyrics.
+type Line struct {
+	// Time is when the line starts. It's 0 for unsynchronized lyrics.
+	Time time.Duration
+	Text string
+}
+
+// Lyrics are parsed lyrics.
+type Lyrics struct {
+	// Lines are sorted by time if the lyrics are synchronized. Otherwise,
+	// they're in the original order.
+	Lines []Line
+	// Synced is true if the lines have timestamps.
+	Synced bool
+	// Tags maps the lowercase names of the ID tags, such as ar or ti, to their
+	// values.
+	Tags map[string]string
+}
+
+// idTags are the known ID tags. Other lines that look like tags, such as
+// [Chorus: Ruby], are kept as lyrics.
+var idTags = map[string]bool{
+	"ar":     true, // artist
+	"al":     true, // album
+	"ti":     true, // title
+	"au":     true, // author
+	"by":     true, // creator of the LRC file
+	"length": true,
+	"offset": true,
+	"re":     true, // editor
+	"ve":     true, // editor version
+	"#":      true, // comment
+}
+
+var (
+	timeRegex = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	tagRegex  = regexp.MustCompile(`^\[([A-Za-z#]+):(.*)\]$`)
+	// wordRegex matches the word timestamps of the enhanced format.
+	wordRegex = regexp.MustCompile(`<\d+:\d{1,2}(?:[.:]\d{1,3})?>`)
+)
+
+// Parse parses the lyrics. Any text is valid: lines that aren't in the LRC
+// format are kept as unsynchronized lyrics, unless there are synchronized
+// lines, in which case they're dropped.
+func Parse(text string) *Lyrics {
+	text = strings.TrimPrefix(text, "\uFEFF")
+
+	lyrics := &Lyrics{Tags: make(map[string]string)}
+
+	var plain []string
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		times, rest := parseTimes(line)
+		if len(times) > 0 {
+			text := strings.TrimSpace(wordRegex.ReplaceAllString(rest, ""))
+			for _, t := range times {
+				lyrics.Lines = append(lyrics.Lines, Line{Time: t, Text: text})
+			}
+			continue
+		}
+
+		if match := tagRegex.FindStringSubmatch(line); match != nil {
+			if key := strings.ToLower(match[1]); idTags[key] {
+				lyrics.Tags[key] = strings.TrimSpace(match[2])
+				continue
+			}
+		}
+
+		plain = append(plain, line)
+	}
+
+	if len(lyrics.Lines) == 0 {
+		lyrics.Lines = plainLines(plain)
+		return lyrics
+	}
+
+	lyrics.Synced = true
+
+	// The offset is in milliseconds, and a positive offset shows the lines
+	// sooner.
+	if offset, err := strconv.Atoi(strings.TrimPrefix(lyrics.Tags["offset"], "+")); err == nil {
+		for i := range lyrics.Lines {
+			t := lyrics.Lines[i].Time - time.Duration(offset)*time.Millisecond
+			if t < 0 {
+				t = 0
+			}
+			lyrics.Lines[i].Time = t
+		}
+	}
+
+	// Lines with many timestamps are repeated, so they have to be put in order.
+	sort.SliceStable(lyrics.Lines, func(i, j int) bool {
+		return lyrics.Lines[i].Time < lyrics.Lines[j].Time
+	})
+
+	return lyrics
+}
+
+// plainLines returns the lines of unsynchronized lyrics without the blank lines
+// at the start and end.
+func plainLines(lines []string) []Line {
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	plain := make([]Line, len(lines))
+	for i, line := range lines {
+		plain[i] = Line{Text: line}
+	}
+
+	return plain
+}
+
+// parseTimes parses the timestamps at the start of the line and returns the
+// rest of it.
+func parseTimes(line string) ([]time.Duration, string) {
+	var times []time.Duration
+
+	for {
+		match := timeRegex.FindStringSubmatch(line)
+		if match == nil {
+			return times, line
+		}
+
+		minutes, _ := strconv.Atoi(match[1])
+		seconds, _ := strconv.Atoi(match[2])
+
+		t := time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+
+		// The fraction may be in tenths, hundredths or thousandths.
+		if frac := match[3]; frac != "" {
+			n, _ := strconv.Atoi(frac)
+			for i := len(frac); i < 3; i++ {
+				n *= 10
+			}
+			t += time.Duration(n) * time.Millisecond
+		}
+
+		times = append(times, t)
+		line = line[len(match[0]):]
+	}
+}
+
+// LineAt returns the index of the line that is sung at the given position, or
+// -1 if it's before the first line or the lyrics aren't synchronized.
+func (l *Lyrics) LineAt(pos time.Duration) int {
+	if !l.Synced {
+		return -1
+	}
+
+	// Find the first line after the position; the one before it is current.
+	i := sort.Search(len(l.Lines), func(i int) bool {
+		return l.Lines[i].Time > pos
+	})
+
+	return i - 1
+}
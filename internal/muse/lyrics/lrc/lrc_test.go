@@ -0,0 +1,148 @@
+package lrc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ms(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		lines  []Line
+		synced bool
+		tags   map[string]string
+	}{
+		{
+			name: "synced",
+			text: "\uFEFF[ti:Song]\r\n[ar:Aqours]\r\n\r\n[00:01.50]First\r\n[00:03.25] Second \r\n[01:02]Third\r\n",
+			lines: []Line{
+				{ms(1500), "First"},
+				{ms(3250), "Second"},
+				{ms(62000), "Third"},
+			},
+			synced: true,
+			tags:   map[string]string{"ti": "Song", "ar": "Aqours"},
+		},
+		{
+			name: "fractions",
+			text: "[00:01.5]Tenths\n[00:02.05]Hundredths\n[00:03.005]Thousandths\n[00:04:10]Colon",
+			lines: []Line{
+				{ms(1500), "Tenths"},
+				{ms(2050), "Hundredths"},
+				{ms(3005), "Thousandths"},
+				{ms(4100), "Colon"},
+			},
+			synced: true,
+		},
+		{
+			name: "many timestamps",
+			text: "[00:10.00][00:30.00]Chorus\n[00:20.00]Verse\n[00:40.00]",
+			lines: []Line{
+				{ms(10000), "Chorus"},
+				{ms(20000), "Verse"},
+				{ms(30000), "Chorus"},
+				{ms(40000), ""},
+			},
+			synced: true,
+		},
+		{
+			name: "offset",
+			text: "[offset:+500]\n[00:00.20]Clamped\n[00:02.00]Sooner",
+			lines: []Line{
+				{0, "Clamped"},
+				{ms(1500), "Sooner"},
+			},
+			synced: true,
+			tags:   map[string]string{"offset": "+500"},
+		},
+		{
+			name: "negative offset",
+			text: "[00:02.00]Later\n[offset:-250]",
+			lines: []Line{
+				{ms(2250), "Later"},
+			},
+			synced: true,
+			tags:   map[string]string{"offset": "-250"},
+		},
+		{
+			name: "enhanced",
+			text: "[00:01.00]<00:01.00>Word <00:01.50>by <00:02.00>word",
+			lines: []Line{
+				{ms(1000), "Word by word"},
+			},
+			synced: true,
+		},
+		{
+			name: "untimed lines dropped",
+			text: "[00:01.00]Timed\nUntimed\n[Chorus: Ruby]",
+			lines: []Line{
+				{ms(1000), "Timed"},
+			},
+			synced: true,
+		},
+		{
+			name: "plain",
+			text: "\n[ti:Song]\nFirst verse\n\n[Chorus: Ruby]\nSecond verse\n\n",
+			lines: []Line{
+				{0, "First verse"},
+				{0, ""},
+				{0, "[Chorus: Ruby]"},
+				{0, "Second verse"},
+			},
+			tags: map[string]string{"ti": "Song"},
+		},
+		{
+			name: "empty",
+			text: "  \n\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := Parse(test.text)
+
+			if !reflect.DeepEqual(l.Lines, test.lines) {
+				t.Errorf("unexpected lines:\n got %v\nwant %v", l.Lines, test.lines)
+			}
+			if l.Synced != test.synced {
+				t.Errorf("synced = %v, want %v", l.Synced, test.synced)
+			}
+
+			tags := test.tags
+			if tags == nil {
+				tags = map[string]string{}
+			}
+			if !reflect.DeepEqual(l.Tags, tags) {
+				t.Errorf("unexpected tags: %v", l.Tags)
+			}
+		})
+	}
+}
+
+func TestLineAt(t *testing.T) {
+	l := Parse("[00:01.00]One\n[00:02.00]Two\n[00:03.00]Three")
+
+	tests := map[time.Duration]int{
+		0:         -1,
+		ms(999):   -1,
+		ms(1000):  0,
+		ms(1999):  0,
+		ms(2500):  1,
+		ms(3000):  2,
+		time.Hour: 2,
+	}
+
+	for pos, i := range tests {
+		if got := l.LineAt(pos); got != i {
+			t.Errorf("LineAt(%v) = %d, want %d", pos, got, i)
+		}
+	}
+
+	if i := Parse("Plain").LineAt(time.Hour); i != -1 {
+		t.Errorf("LineAt of unsynchronized lyrics = %d, want -1", i)
+	}
+}
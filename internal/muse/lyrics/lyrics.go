@@ -0,0 +1,94 @@
+// Package lyrics finds the lyrics of audio files, either in a sidecar LRC file
+// next to the file or embedded in its tags.
+package lyrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/diamondburned/aqours/internal/muse/lyrics/lrc"
+	"github.com/diamondburned/aqours/internal/muse/metadata/native"
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned if the file has no lyrics.
+var ErrNotFound = errors.New("no lyrics found")
+
+// sidecarExts are the extensions of the sidecar files, in order of priority.
+var sidecarExts = []string{".lrc", ".LRC"}
+
+// Load loads the lyrics of the audio file at the given path. A sidecar LRC
+// file with the same name takes precedence over the synchronized lyrics
+// embedded in the file, which take precedence over the unsynchronized ones.
+// ErrNotFound is returned if there are no lyrics.
+func Load(path string) (*lrc.Lyrics, error) {
+	l, err := loadSidecar(path)
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return l, err
+	}
+
+	res, err := native.Probe(path)
+	if err != nil {
+		if errors.Is(err, native.ErrUnsupported) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return fromEmbedded(res.Lyrics)
+}
+
+// loadSidecar loads the LRC file next to the audio file at the given path.
+func loadSidecar(path string) (*lrc.Lyrics, error) {
+	base := path[:len(path)-len(filepath.Ext(path))]
+
+	for _, ext := range sidecarExts {
+		b, err := ioutil.ReadFile(base + ext)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Wrap(err, "failed to read LRC file")
+		}
+
+		if l := lrc.Parse(string(b)); len(l.Lines) > 0 {
+			return l, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// fromEmbedded converts the embedded lyrics.
+func fromEmbedded(embedded *native.Lyrics) (*lrc.Lyrics, error) {
+	if embedded == nil {
+		return nil, ErrNotFound
+	}
+
+	if len(embedded.Synced) > 0 {
+		l := &lrc.Lyrics{
+			Lines:  make([]lrc.Line, len(embedded.Synced)),
+			Synced: true,
+			Tags:   make(map[string]string),
+		}
+
+		for i, line := range embedded.Synced {
+			l.Lines[i] = lrc.Line{Time: line.Time, Text: line.Text}
+		}
+
+		sort.SliceStable(l.Lines, func(i, j int) bool {
+			return l.Lines[i].Time < l.Lines[j].Time
+		})
+
+		return l, nil
+	}
+
+	// Unsynchronized lyrics are often in the LRC format anyway.
+	if l := lrc.Parse(embedded.Text); len(l.Lines) > 0 {
+		return l, nil
+	}
+
+	return nil, ErrNotFound
+}
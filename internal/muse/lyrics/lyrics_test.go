@@ -0,0 +1,69 @@
+package lyrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/lyrics/lrc"
+	"github.com/diamondburned/aqours/internal/muse/metadata/native"
+	"github.com/pkg/errors"
+)
+
+func TestLoadSidecar(t *testing.T) {
+	dir := t.TempDir()
+
+	audio := filepath.Join(dir, "01 - Song.flac")
+	if err := os.WriteFile(audio, []byte("not really FLAC"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(audio); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound without lyrics, got %v", err)
+	}
+
+	lrcPath := filepath.Join(dir, "01 - Song.lrc")
+	if err := os.WriteFile(lrcPath, []byte("[00:01.00]Hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Load(audio)
+	if err != nil {
+		t.Fatal("failed to load:", err)
+	}
+
+	if !l.Synced || len(l.Lines) != 1 || l.Lines[0] != (lrc.Line{Time: time.Second, Text: "Hello"}) {
+		t.Errorf("unexpected lyrics: %#v", l)
+	}
+}
+
+func TestFromEmbedded(t *testing.T) {
+	if _, err := fromEmbedded(nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for no lyrics, got %v", err)
+	}
+
+	l, err := fromEmbedded(&native.Lyrics{
+		Text: "Unsynchronized",
+		Synced: []native.SyncedLine{
+			{Time: 2 * time.Second, Text: "Second"},
+			{Time: time.Second, Text: "First"},
+		},
+	})
+	if err != nil {
+		t.Fatal("failed to convert:", err)
+	}
+
+	if !l.Synced || len(l.Lines) != 2 || l.Lines[0].Text != "First" {
+		t.Errorf("expected sorted synchronized lyrics, got %#v", l)
+	}
+
+	l, err = fromEmbedded(&native.Lyrics{Text: "[00:01.00]Timed"})
+	if err != nil {
+		t.Fatal("failed to convert:", err)
+	}
+
+	if !l.Synced || l.Lines[0].Time != time.Second {
+		t.Errorf("expected LRC in unsynchronized lyrics to be parsed, got %#v", l)
+	}
+}
@@ -40,3 +40,39 @@ func AlbumArt(w io.Writer, path string, size int) error {
 
 	return nil
 }
+
+// Loudness runs the EBU R128 filter over the first audio stream of the file and
+// writes its log, which has the loudness of every 100ms block, to w. It stops
+// when the context is cancelled.
+func Loudness(ctx context.Context, w io.Writer, path string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Also stop with everything else.
+	go func() {
+		select {
+		case <-globalCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	cmd := exec.CommandContext(ctx,
+		"ffmpeg",
+		"-hide_banner", "-nostats", "-threads", "1",
+		"-i", path,
+		"-map", "0:a:0",
+		"-af", "ebur128=framelog=info:peak=true",
+		"-f", "null", "-",
+	)
+	cmd.Stderr = w
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	return nil
+}
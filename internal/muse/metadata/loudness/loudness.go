@@ -0,0 +1,291 @@
+// Package loudness measures the loudness of audio files with the EBU R128
+// filter of ffmpeg and computes their ReplayGain values.
+package loudness
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/diamondburned/aqours/internal/muse/metadata/ffmpeg"
+	"github.com/pkg/errors"
+)
+
+// Reference is the loudness in LUFS that ReplayGain 2.0 brings tracks to.
+const Reference = -18
+
+const (
+	absoluteGate = -70 // LUFS
+	relativeGate = -10 // LU
+)
+
+// Measurement is the measured loudness of a file.
+type Measurement struct {
+	// Blocks is the momentary loudness in LUFS of each 400ms block, which are
+	// 100ms apart.
+	Blocks []float64
+	// Peak is the linear sample peak, where 1 is full scale.
+	Peak float64
+}
+
+// Measure measures the loudness of the file at the given path.
+func Measure(ctx context.Context, path string) (Measurement, error) {
+	var buf bytes.Buffer
+
+	if err := ffmpeg.Loudness(ctx, &buf, path); err != nil {
+		return Measurement{}, errors.Wrap(err, "failed to run ffmpeg")
+	}
+
+	return parseLog(&buf)
+}
+
+var (
+	momentaryRegex = regexp.MustCompile(`\bM:\s*(\S+)`)
+	peakRegex      = regexp.MustCompile(`\bPeak:\s*(\S+)\s*dBFS`)
+)
+
+// parseLog parses the log of the ebur128 filter.
+func parseLog(r io.Reader) (Measurement, error) {
+	var m Measurement
+	var peak = math.Inf(-1)
+	var hasPeak bool
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	scanner.Split(scanLines)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if match := peakRegex.FindStringSubmatch(line); match != nil {
+			if db, err := strconv.ParseFloat(match[1], 64); err == nil {
+				// The summary comes last, so the last peak is kept.
+				peak = db
+				hasPeak = true
+			}
+			continue
+		}
+
+		if !strings.Contains(line, "Parsed_ebur128") {
+			continue
+		}
+
+		match := momentaryRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(match[1], 64)
+		if err != nil || math.IsNaN(v) {
+			continue
+		}
+
+		m.Blocks = append(m.Blocks, v)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return m, errors.Wrap(err, "failed to read log")
+	}
+
+	if len(m.Blocks) == 0 {
+		return m, errors.New("no loudness in ffmpeg output")
+	}
+
+	if hasPeak {
+		m.Peak = math.Pow(10, peak/20)
+	}
+
+	return m, nil
+}
+
+// scanLines splits lines on either \n or \r, since ffmpeg may end lines that it
+// overwrites with \r.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Integrated returns the gated integrated loudness in LUFS of the given
+// measurements as a whole, as defined by ITU-R BS.1770. False is returned if
+// they're all silent.
+func Integrated(ms ...Measurement) (float64, bool) {
+	var absolute []float64
+	for _, m := range ms {
+		for _, block := range m.Blocks {
+			if block >= absoluteGate {
+				absolute = append(absolute, block)
+			}
+		}
+	}
+
+	if len(absolute) == 0 {
+		return 0, false
+	}
+
+	gate := meanLoudness(absolute) + relativeGate
+
+	relative := absolute[:0]
+	for _, block := range absolute {
+		if block >= gate {
+			relative = append(relative, block)
+		}
+	}
+
+	return meanLoudness(relative), true
+}
+
+// meanLoudness averages the given loudness values by their power.
+func meanLoudness(blocks []float64) float64 {
+	var sum float64
+	for _, block := range blocks {
+		sum += math.Pow(10, (block+0.691)/10)
+	}
+	return -0.691 + 10*math.Log10(sum/float64(len(blocks)))
+}
+
+// Gain returns the ReplayGain gain in dB for the given integrated loudness.
+func Gain(lufs float64) float64 {
+	return Reference - lufs
+}
+
+// Result is the ReplayGain of a track. Gains are in dB and peaks are linear.
+type Result struct {
+	Path      string
+	TrackGain float64
+	TrackPeak float64
+	AlbumGain float64
+	AlbumPeak float64
+	// Err is not nil if the track couldn't be measured, in which case the
+	// other fields are zero.
+	Err error
+}
+
+// measure is replaced in tests.
+var measure = Measure
+
+// Analyze measures the tracks of the given albums in parallel and returns the
+// results of each track in the same order. The album gain and peak of each track
+// cover the tracks of its album that could be measured. progress, if not nil,
+// is called after each track with the number of tracks done. It's called from
+// any goroutine, but never concurrently.
+//
+// The error of the context is returned if it's cancelled.
+func Analyze(ctx context.Context, albums [][]string, progress func(done int)) ([][]Result, error) {
+	type job struct {
+		album, track int
+	}
+
+	results := make([][]Result, len(albums))
+	measurements := make([][]Measurement, len(albums))
+	jobs := make(chan job)
+
+	for i, album := range albums {
+		results[i] = make([]Result, len(album))
+		measurements[i] = make([]Measurement, len(album))
+	}
+
+	var wg sync.WaitGroup
+	var mut sync.Mutex
+	var done int
+
+	workers := runtime.GOMAXPROCS(0)
+	wg.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				path := albums[job.album][job.track]
+				m, err := measure(ctx, path)
+
+				results[job.album][job.track].Path = path
+				if err == nil {
+					measurements[job.album][job.track] = m
+				} else {
+					results[job.album][job.track].Err = err
+				}
+
+				mut.Lock()
+				done++
+				if progress != nil && ctx.Err() == nil {
+					progress(done)
+				}
+				mut.Unlock()
+			}
+		}()
+	}
+
+queue:
+	for i, album := range albums {
+		for j := range album {
+			select {
+			case jobs <- job{i, j}:
+			case <-ctx.Done():
+				break queue
+			}
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range albums {
+		computeAlbum(results[i], measurements[i])
+	}
+
+	return results, nil
+}
+
+// computeAlbum fills in the gains and peaks of the results of one album from
+// their measurements.
+func computeAlbum(results []Result, measurements []Measurement) {
+	var measured []Measurement
+	var albumPeak float64
+
+	for i, m := range measurements {
+		if results[i].Err != nil {
+			continue
+		}
+
+		lufs, ok := Integrated(m)
+		if !ok {
+			results[i].Err = errors.New("track is silent")
+			continue
+		}
+
+		results[i].TrackGain = Gain(lufs)
+		results[i].TrackPeak = m.Peak
+
+		measured = append(measured, m)
+		albumPeak = math.Max(albumPeak, m.Peak)
+	}
+
+	lufs, ok := Integrated(measured...)
+	if !ok {
+		return
+	}
+
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].AlbumGain = Gain(lufs)
+			results[i].AlbumPeak = albumPeak
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package loudness
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const testLog = "Input #0, flac, from 'test.flac':\n" +
+	"  Duration: 00:00:00.50, start: 0.000000, bitrate: 6 kb/s\n" +
+	"[Parsed_ebur128_0 @ 0x5580] t: 0.1      TARGET:-23 LUFS    M:-120.7 S:-120.7     I: -70.0 LUFS       LRA:   0.0 LU  SPK: -inf dBFS\r" +
+	"[Parsed_ebur128_0 @ 0x5580] t: 0.2      TARGET:-23 LUFS    M: -nan S:-120.7     I: -70.0 LUFS       LRA:   0.0 LU  SPK: -inf dBFS\r" +
+	"[Parsed_ebur128_0 @ 0x5580] t: 0.3      TARGET:-23 LUFS    M: -20.0 S:-120.7     I: -20.0 LUFS       LRA:   0.0 LU  SPK: -6.0 dBFS\n" +
+	"[Parsed_ebur128_0 @ 0x5580] t: 0.4      TARGET:-23 LUFS    M: -inf S:-120.7     I: -20.0 LUFS       LRA:   0.0 LU  SPK: -6.0 dBFS\n" +
+	"[Parsed_ebur128_0 @ 0x5580] Summary:\n" +
+	"\n" +
+	"  Integrated loudness:\n" +
+	"    I:         -20.0 LUFS\n" +
+	"    Threshold: -30.0 LUFS\n" +
+	"\n" +
+	"  Sample peak:\n" +
+	"    Peak:       -6.0 dBFS\n"
+
+func TestParseLog(t *testing.T) {
+	m, err := parseLog(strings.NewReader(testLog))
+	if err != nil {
+		t.Fatal("failed to parse log:", err)
+	}
+
+	blocks := []float64{-120.7, -20, math.Inf(-1)}
+	if len(m.Blocks) != len(blocks) {
+		t.Fatalf("expected blocks %v, got %v", blocks, m.Blocks)
+	}
+	for i, block := range blocks {
+		if m.Blocks[i] != block {
+			t.Fatalf("expected blocks %v, got %v", blocks, m.Blocks)
+		}
+	}
+
+	if !near(m.Peak, 0.501187) {
+		t.Errorf("expected peak 0.501187, got %f", m.Peak)
+	}
+
+	if _, err := parseLog(strings.NewReader("no such file\n")); err == nil {
+		t.Error("expected error for log without loudness")
+	}
+}
+
+func TestIntegrated(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks [][]float64
+		lufs   float64
+		ok     bool
+	}{
+		{"constant", [][]float64{{-20, -20, -20}}, -20, true},
+		{"absolute gate", [][]float64{{-20, -80, math.Inf(-1)}}, -20, true},
+		// -40 is more than 10 LU below the mean of -23.0 and is gated.
+		{"relative gate", [][]float64{{-20, -20, -40}}, -20, true},
+		{"mean power", [][]float64{{-20, -26}}, -22.03, true},
+		{"album", [][]float64{{-20}, {-26}}, -22.03, true},
+		{"silent", [][]float64{{-80}, {math.Inf(-1)}}, 0, false},
+		{"empty", nil, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ms := make([]Measurement, len(test.blocks))
+			for i, blocks := range test.blocks {
+				ms[i].Blocks = blocks
+			}
+
+			lufs, ok := Integrated(ms...)
+			if ok != test.ok {
+				t.Fatalf("expected ok %v, got %v", test.ok, ok)
+			}
+			if ok && math.Abs(lufs-test.lufs) > 0.01 {
+				t.Errorf("expected %.2f LUFS, got %.2f", test.lufs, lufs)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	measurements := map[string]Measurement{
+		"a1": {Blocks: []float64{-20}, Peak: 0.5},
+		"a2": {Blocks: []float64{-26}, Peak: 0.9},
+		"a3": {Blocks: []float64{-90}, Peak: 0.1},
+		"b1": {Blocks: []float64{-14}, Peak: 1},
+	}
+
+	defer func(old func(context.Context, string) (Measurement, error)) { measure = old }(measure)
+	measure = func(ctx context.Context, path string) (Measurement, error) {
+		m, ok := measurements[path]
+		if !ok {
+			return m, errors.New("no such file")
+		}
+		return m, nil
+	}
+
+	var progress int
+	results, err := Analyze(context.Background(), [][]string{
+		{"a1", "a2", "a3", "missing"},
+		{"b1"},
+	}, func(done int) {
+		progress++
+	})
+	if err != nil {
+		t.Fatal("failed to analyze:", err)
+	}
+
+	if progress != 5 {
+		t.Errorf("expected progress to be reported 5 times, got %d", progress)
+	}
+
+	a := results[0]
+	if !near(a[0].TrackGain, 2) || !near(a[1].TrackGain, 8) {
+		t.Errorf("unexpected track gains %f and %f", a[0].TrackGain, a[1].TrackGain)
+	}
+	if !near(a[0].AlbumGain, 4.03) || a[0].AlbumGain != a[1].AlbumGain {
+		t.Errorf("unexpected album gains %f and %f", a[0].AlbumGain, a[1].AlbumGain)
+	}
+	if a[0].AlbumPeak != 0.9 || a[0].TrackPeak != 0.5 {
+		t.Errorf("unexpected peaks %f and %f", a[0].TrackPeak, a[0].AlbumPeak)
+	}
+	if a[2].Err == nil || a[3].Err == nil {
+		t.Error("expected errors for silent and missing tracks")
+	}
+	if a[3].Path != "missing" {
+		t.Errorf("expected path of failed track, got %q", a[3].Path)
+	}
+
+	b := results[1][0]
+	if !near(b.TrackGain, -4) || b.AlbumGain != b.TrackGain || b.AlbumPeak != 1 {
+		t.Errorf("expected album of one track to have the track gain, got %+v", b)
+	}
+}
+
+func TestAnalyzeCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	defer func(old func(context.Context, string) (Measurement, error)) { measure = old }(measure)
+	measure = func(ctx context.Context, path string) (Measurement, error) {
+		return Measurement{}, ctx.Err()
+	}
+
+	if _, err := Analyze(ctx, [][]string{{"a", "b"}}, nil); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
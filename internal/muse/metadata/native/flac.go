@@ -0,0 +1,58 @@
+package native
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// probeFLAC reads the STREAMINFO block of the FLAC stream starting at the given
+// offset.
+func probeFLAC(r io.ReadSeeker, start, size int64, res *Result) error {
+	var info []byte
+
+	off := start + 4 // "fLaC"
+
+	for {
+		h, err := readAt(r, off, 4)
+		if err != nil {
+			return errors.Wrap(err, "failed to read FLAC block header")
+		}
+
+		blockLen := int64(h[1])<<16 | int64(h[2])<<8 | int64(h[3])
+
+		if h[0]&0x7F == 0 && info == nil {
+			info, err = readAt(r, off+4, 34)
+			if err != nil {
+				return errors.Wrap(err, "failed to read STREAMINFO")
+			}
+		}
+
+		off += 4 + blockLen
+
+		if h[0]&0x80 != 0 {
+			break
+		}
+	}
+
+	if info == nil {
+		return errors.New("FLAC stream has no STREAMINFO")
+	}
+
+	// The sample rate is 20 bits, then 3 bits of channels and 5 bits of bits
+	// per sample, then 36 bits of total samples.
+	rate := uint32(info[10])<<12 | uint32(info[11])<<4 | uint32(info[12])>>4
+	samples := uint64(info[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(info[14:18]))
+
+	if rate == 0 || samples == 0 {
+		return errors.New("FLAC stream has unknown length")
+	}
+
+	res.SampleRate = int(rate)
+	res.Codec = "flac"
+	res.Length = samplesDuration(samples, rate)
+	res.Bitrate = bitrate(size-off, res.Length)
+
+	return nil
+}
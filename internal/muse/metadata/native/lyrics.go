@@ -0,0 +1,151 @@
+package native
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Lyrics are the lyrics embedded in a file.
+type Lyrics struct {
+	// Text is the unsynchronized lyrics, which may be in the LRC format
+	// nonetheless.
+	Text string
+	// Synced are the lines of the synchronized lyrics of an ID3v2 SYLT frame.
+	Synced []SyncedLine
+}
+
+// SyncedLine is a line of synchronized lyrics.
+type SyncedLine struct {
+	Time time.Duration
+	Text string
+}
+
+// setLyrics sets the unsynchronized lyrics. The first lyrics win.
+func (res *Result) setLyrics(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	if res.Lyrics == nil {
+		res.Lyrics = &Lyrics{}
+	}
+
+	if res.Lyrics.Text == "" {
+		res.Lyrics.Text = text
+	}
+}
+
+// setSyncedLyrics sets the synchronized lyrics. The first lyrics win.
+func (res *Result) setSyncedLyrics(lines []SyncedLine) {
+	if len(lines) == 0 {
+		return
+	}
+
+	if res.Lyrics == nil {
+		res.Lyrics = &Lyrics{}
+	}
+
+	if res.Lyrics.Synced == nil {
+		res.Lyrics.Synced = lines
+	}
+}
+
+// parseSYLT parses the body of an ID3v2 SYLT frame. Nil is returned if the
+// frame is invalid or its timestamps aren't in milliseconds, since MPEG frame
+// timestamps are rarely used.
+func parseSYLT(b []byte) []SyncedLine {
+	// Text encoding, language, timestamp format and content type.
+	if len(b) < 6 || b[4] != 2 {
+		return nil
+	}
+
+	enc := b[0]
+	b = b[6:]
+
+	// Skip the content descriptor.
+	_, b, ok := readID3String(enc, b)
+	if !ok {
+		return nil
+	}
+
+	var lines []SyncedLine
+
+	for len(b) > 0 {
+		var text string
+
+		text, b, ok = readID3String(enc, b)
+		if !ok || len(b) < 4 {
+			break
+		}
+
+		ms := binary.BigEndian.Uint32(b)
+		b = b[4:]
+
+		// Lines usually start with a newline, since SYLT frames may also
+		// have a frame for each syllable.
+		lines = append(lines, SyncedLine{
+			Time: time.Duration(ms) * time.Millisecond,
+			Text: strings.Trim(text, "\r\n"),
+		})
+	}
+
+	return lines
+}
+
+// readID3String reads a string terminated by a null character in the given
+// ID3v2 text encoding and returns the bytes after it. False is returned if
+// there's no terminator.
+func readID3String(enc byte, b []byte) (string, []byte, bool) {
+	switch enc {
+	case 0, 3: // ISO-8859-1, UTF-8
+		i := strings.IndexByte(string(b), 0)
+		if i == -1 {
+			return "", nil, false
+		}
+
+		if enc == 3 {
+			return string(b[:i]), b[i+1:], true
+		}
+
+		runes := make([]rune, i)
+		for j, c := range b[:i] {
+			runes[j] = rune(c)
+		}
+
+		return string(runes), b[i+1:], true
+
+	case 1, 2: // UTF-16 with a BOM, UTF-16BE
+		end := -1
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				end = i
+				break
+			}
+		}
+		if end == -1 {
+			return "", nil, false
+		}
+
+		s := b[:end]
+
+		// Each string may have its own BOM.
+		order := binary.ByteOrder(binary.BigEndian)
+		if len(s) >= 2 && s[0] == 0xFF && s[1] == 0xFE {
+			order = binary.LittleEndian
+			s = s[2:]
+		} else if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+			s = s[2:]
+		}
+
+		units := make([]uint16, len(s)/2)
+		for i := range units {
+			units[i] = order.Uint16(s[i*2:])
+		}
+
+		return string(utf16.Decode(units)), b[end+2:], true
+	}
+
+	return "", nil, false
+}
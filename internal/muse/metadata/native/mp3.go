@@ -0,0 +1,222 @@
+package native
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// mp3SearchLen is the maximum number of bytes to search for the first frame.
+const mp3SearchLen = 64 * 1024
+
+// mpegVersion is an MPEG audio version.
+type mpegVersion uint8
+
+const (
+	mpeg25 mpegVersion = iota
+	_                  // reserved
+	mpeg2
+	mpeg1
+)
+
+// mpegBitrates contains the bitrates in kbps for MPEG-1 and MPEG-2/2.5 (first
+// index) for layers I, II and III (second index).
+var mpegBitrates = [2][3][15]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+var mpegSampleRates = [4][3]int{
+	mpeg25: {11025, 12000, 8000},
+	mpeg2:  {22050, 24000, 16000},
+	mpeg1:  {44100, 48000, 32000},
+}
+
+// mp3Frame is a parsed MPEG audio frame header.
+type mp3Frame struct {
+	version    mpegVersion
+	layer      int // 1, 2 or 3
+	bitrate    int // bits per second
+	sampleRate int
+	samples    int // per frame
+	length     int // in bytes, including the header
+	mono       bool
+}
+
+func parseMP3Frame(h []byte) (mp3Frame, bool) {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+
+	f := mp3Frame{
+		version: mpegVersion(h[1] >> 3 & 0x3),
+		layer:   4 - int(h[1]>>1&0x3),
+		mono:    h[3]>>6 == 0x3,
+	}
+
+	bitrateIx := int(h[2] >> 4)
+	rateIx := int(h[2] >> 2 & 0x3)
+	padding := int(h[2] >> 1 & 0x1)
+
+	// Reject reserved values as well as free-format frames, since we can't
+	// know their length.
+	if f.version == 1 || f.layer == 4 || bitrateIx == 0 || bitrateIx == 15 || rateIx == 3 {
+		return mp3Frame{}, false
+	}
+
+	table := 0
+	if f.version != mpeg1 {
+		table = 1
+	}
+
+	f.bitrate = mpegBitrates[table][f.layer-1][bitrateIx] * 1000
+	f.sampleRate = mpegSampleRates[f.version][rateIx]
+
+	switch {
+	case f.layer == 1:
+		f.samples = 384
+		f.length = (12*f.bitrate/f.sampleRate + padding) * 4
+	case f.layer == 3 && f.version != mpeg1:
+		f.samples = 576
+		f.length = 72*f.bitrate/f.sampleRate + padding
+	default:
+		f.samples = 1152
+		f.length = 144*f.bitrate/f.sampleRate + padding
+	}
+
+	return f, true
+}
+
+// sideInfoLen returns the length of the Layer III side information, which
+// comes after the header and before the Xing header.
+func (f mp3Frame) sideInfoLen() int {
+	switch {
+	case f.version == mpeg1 && f.mono:
+		return 17
+	case f.version == mpeg1:
+		return 32
+	case f.mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// probeMP3 estimates the duration of the MP3 stream starting at the given
+// offset. The Xing or VBRI header is used if the first frame has one,
+// otherwise the stream is assumed to be CBR.
+func probeMP3(r io.ReadSeeker, start, size int64, res *Result) error {
+	// The ID3v2 tag of a truncated or corrupt file may claim to be longer than
+	// the file.
+	if start >= size {
+		return errors.New("no MP3 stream after the ID3v2 tag")
+	}
+
+	n := size - start
+	if n > mp3SearchLen {
+		n = mp3SearchLen
+	}
+
+	b, err := readAt(r, start, int(n))
+	if err != nil {
+		return errors.Wrap(err, "failed to read MP3 stream")
+	}
+
+	frameIx := -1
+	var frame mp3Frame
+
+	for i := 0; i+4 <= len(b); i++ {
+		f, ok := parseMP3Frame(b[i:])
+		if !ok {
+			continue
+		}
+
+		// Validate against the next frame to avoid false syncs, unless it's
+		// outside of what we've read.
+		if next := i + f.length; next+4 <= len(b) {
+			if _, ok := parseMP3Frame(b[next:]); !ok {
+				continue
+			}
+		}
+
+		frameIx = i
+		frame = f
+		break
+	}
+
+	if frameIx == -1 {
+		return errors.New("no MP3 frame found")
+	}
+
+	res.SampleRate = frame.sampleRate
+	res.Codec = fmt.Sprintf("mp%d", frame.layer)
+
+	audioStart := start + int64(frameIx)
+	audioEnd := size
+
+	// Exclude the trailing ID3v1 tag.
+	if size-128 >= audioStart {
+		if t, err := readAt(r, size-128, 3); err == nil && string(t) == "TAG" {
+			audioEnd -= 128
+		}
+	}
+
+	frames, bytes := mp3VBRHeader(b[frameIx:], frame)
+	if frames > 0 {
+		if bytes == 0 {
+			bytes = audioEnd - audioStart
+		}
+
+		res.Length = samplesDuration(uint64(frames)*uint64(frame.samples), uint32(frame.sampleRate))
+		res.Bitrate = bitrate(bytes, res.Length)
+		return nil
+	}
+
+	res.Bitrate = frame.bitrate
+	res.Length = time.Duration(float64(audioEnd-audioStart) * 8 / float64(frame.bitrate) * float64(time.Second))
+	return nil
+}
+
+// mp3VBRHeader reads the frame and byte counts of the Xing, Info or VBRI header
+// in the given frame. Zeros are returned for the absent values.
+func mp3VBRHeader(b []byte, f mp3Frame) (frames uint32, bytes int64) {
+	if len(b) > f.length {
+		b = b[:f.length]
+	}
+
+	if x := 4 + f.sideInfoLen(); len(b) >= x+8 {
+		switch string(b[x : x+4]) {
+		case "Xing", "Info":
+			flags := binary.BigEndian.Uint32(b[x+4:])
+			x += 8
+
+			if flags&0x1 != 0 && len(b) >= x+4 {
+				frames = binary.BigEndian.Uint32(b[x:])
+				x += 4
+			}
+			if flags&0x2 != 0 && len(b) >= x+4 {
+				bytes = int64(binary.BigEndian.Uint32(b[x:]))
+			}
+
+			return frames, bytes
+		}
+	}
+
+	if x := 4 + 32; len(b) >= x+18 && string(b[x:x+4]) == "VBRI" {
+		bytes = int64(binary.BigEndian.Uint32(b[x+10:]))
+		frames = binary.BigEndian.Uint32(b[x+14:])
+	}
+
+	return frames, bytes
+}
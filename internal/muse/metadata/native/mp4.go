@@ -0,0 +1,223 @@
+package native
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// mp4Atom is the position of an MP4 atom.
+type mp4Atom struct {
+	typ  string
+	off  int64 // start of the data
+	size int64 // size of the data
+}
+
+// readMP4Atoms reads the headers of the atoms between the given offsets.
+func readMP4Atoms(r io.ReadSeeker, off, end int64) ([]mp4Atom, error) {
+	var atoms []mp4Atom
+
+	for off+8 <= end {
+		h, err := readAt(r, off, 8)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read atom header")
+		}
+
+		size := int64(binary.BigEndian.Uint32(h))
+		hlen := int64(8)
+
+		switch size {
+		case 0: // extends to the end
+			size = end - off
+		case 1: // 64-bit size
+			b, err := readAt(r, off+8, 8)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read atom size")
+			}
+			size = int64(binary.BigEndian.Uint64(b))
+			hlen = 16
+		}
+
+		if size < hlen || off+size > end {
+			return nil, errors.Errorf("invalid size for atom %q", h[4:])
+		}
+
+		atoms = append(atoms, mp4Atom{
+			typ:  string(h[4:]),
+			off:  off + hlen,
+			size: size - hlen,
+		})
+
+		off += size
+	}
+
+	return atoms, nil
+}
+
+func findMP4Atom(atoms []mp4Atom, typ string) (mp4Atom, bool) {
+	for _, atom := range atoms {
+		if atom.typ == typ {
+			return atom, true
+		}
+	}
+	return mp4Atom{}, false
+}
+
+// probeMP4 reads the duration from the movie header. The bitrate is estimated
+// from the size of the media data.
+func probeMP4(r io.ReadSeeker, size int64, res *Result) error {
+	atoms, err := readMP4Atoms(r, 0, size)
+	if err != nil {
+		return err
+	}
+
+	moov, ok := findMP4Atom(atoms, "moov")
+	if !ok {
+		return errors.New("missing moov atom")
+	}
+
+	children, err := readMP4Atoms(r, moov.off, moov.off+moov.size)
+	if err != nil {
+		return err
+	}
+
+	mvhd, ok := findMP4Atom(children, "mvhd")
+	if !ok || mvhd.size < 20 {
+		return errors.New("missing mvhd atom")
+	}
+
+	n := mvhd.size
+	if n > 32 {
+		n = 32
+	}
+
+	b, err := readAt(r, mvhd.off, int(n))
+	if err != nil {
+		return errors.Wrap(err, "failed to read mvhd")
+	}
+
+	var timescale uint32
+	var duration uint64
+
+	// The version determines whether the times are 32 or 64 bits.
+	switch b[0] {
+	case 0:
+		timescale = binary.BigEndian.Uint32(b[12:])
+		duration = uint64(binary.BigEndian.Uint32(b[16:]))
+	case 1:
+		if len(b) < 32 {
+			return errors.New("mvhd too short")
+		}
+		timescale = binary.BigEndian.Uint32(b[20:])
+		duration = binary.BigEndian.Uint64(b[24:])
+	default:
+		return errors.Errorf("unknown mvhd version %d", b[0])
+	}
+
+	if timescale == 0 || duration == 0 {
+		return errors.New("MP4 file has unknown length")
+	}
+
+	res.Length = samplesDuration(duration, timescale)
+
+	// The codec is nice to have, so don't fail if it can't be found.
+	probeMP4Audio(r, children, res)
+
+	if mdat, ok := findMP4Atom(atoms, "mdat"); ok {
+		res.Bitrate = bitrate(mdat.size, res.Length)
+	} else {
+		res.Bitrate = bitrate(size, res.Length)
+	}
+
+	return nil
+}
+
+// mp4Codecs maps the sample entry types of MP4 audio tracks to ffmpeg codec
+// names.
+var mp4Codecs = map[string]string{
+	"mp4a": "aac",
+	"alac": "alac",
+	"fLaC": "flac",
+	"Opus": "opus",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	".mp3": "mp3",
+}
+
+// probeMP4Audio reads the codec and the sample rate of the first audio track
+// out of the children of the moov atom.
+func probeMP4Audio(r io.ReadSeeker, moov []mp4Atom, res *Result) {
+	for _, trak := range moov {
+		if trak.typ != "trak" {
+			continue
+		}
+
+		mdia, ok := findMP4Path(r, trak, "mdia")
+		if !ok {
+			continue
+		}
+
+		children, err := readMP4Atoms(r, mdia.off, mdia.off+mdia.size)
+		if err != nil {
+			continue
+		}
+
+		// The handler type comes after the version, flags and a reserved
+		// field.
+		hdlr, ok := findMP4Atom(children, "hdlr")
+		if !ok || hdlr.size < 12 {
+			continue
+		}
+		if b, err := readAt(r, hdlr.off+8, 4); err != nil || string(b) != "soun" {
+			continue
+		}
+
+		// The timescale of an audio track is its sample rate.
+		if mdhd, ok := findMP4Atom(children, "mdhd"); ok && mdhd.size >= 24 {
+			if b, err := readAt(r, mdhd.off, 24); err == nil {
+				switch b[0] {
+				case 0:
+					res.SampleRate = int(binary.BigEndian.Uint32(b[12:]))
+				case 1:
+					res.SampleRate = int(binary.BigEndian.Uint32(b[20:]))
+				}
+			}
+		}
+
+		minf, ok := findMP4Atom(children, "minf")
+		if !ok {
+			return
+		}
+
+		stsd, ok := findMP4Path(r, minf, "stbl", "stsd")
+		if !ok || stsd.size < 16 {
+			return
+		}
+
+		// Skip the version, flags and entry count to get to the type of the
+		// first sample entry.
+		if b, err := readAt(r, stsd.off+12, 4); err == nil {
+			res.Codec = mp4Codecs[string(b)]
+		}
+
+		return
+	}
+}
+
+// findMP4Path finds the atom at the given path of types under the given atom.
+func findMP4Path(r io.ReadSeeker, atom mp4Atom, path ...string) (mp4Atom, bool) {
+	for _, typ := range path {
+		children, err := readMP4Atoms(r, atom.off, atom.off+atom.size)
+		if err != nil {
+			return mp4Atom{}, false
+		}
+
+		var ok bool
+		if atom, ok = findMP4Atom(children, typ); !ok {
+			return mp4Atom{}, false
+		}
+	}
+
+	return atom, true
+}
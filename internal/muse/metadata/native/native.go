@@ -0,0 +1,496 @@
+// Package native reads the metadata of audio files without spawning an external
+// process. Tags are read using github.com/dhowden/tag, while the duration and
+// bitrate are estimated from the codec headers of MP3, FLAC, Ogg Vorbis, Opus,
+// MP4 and WAV files.
+package native
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported is returned if the format of the file is not known. The
+// caller should fall back to a slower prober, such as ffprobe.
+var ErrUnsupported = errors.New("unsupported format")
+
+// Result is the result of probing a file.
+type Result struct {
+	Title  string
+	Artist string
+	Album  string
+	Genre  string
+	Date   string
+	Number int
+
+	AlbumArtist string
+	Composer    string
+	Disc        int
+
+	Length     time.Duration
+	Bitrate    int    // bits per second
+	SampleRate int    // Hz
+	Codec      string // named as in ffmpeg
+
+	// ReplayGain is nil if there are no ReplayGain tags.
+	ReplayGain *ReplayGain
+
+	MusicBrainzTrackID       string // recording
+	MusicBrainzAlbumID       string // release
+	MusicBrainzArtistID      string
+	MusicBrainzAlbumArtistID string
+
+	// Lyrics is nil if there are no embedded lyrics.
+	Lyrics *Lyrics
+
+	// Rating is from 1 to 100, or 0 if the file isn't rated.
+	Rating int
+
+	// r128 is the gain from Opus R128 tags, which is only used if there are
+	// no ReplayGain tags.
+	r128 *ReplayGain
+}
+
+// ReplayGain contains the ReplayGain values of a file. Gains are in dB, and
+// peaks are linear.
+type ReplayGain struct {
+	TrackGain float64
+	TrackPeak float64
+	AlbumGain float64
+	AlbumPeak float64
+}
+
+var escaper = strings.NewReplacer("\n", `↵`)
+
+func (res *Result) escape() {
+	res.Title = escaper.Replace(res.Title)
+	res.Artist = escaper.Replace(res.Artist)
+	res.Album = escaper.Replace(res.Album)
+	res.Genre = escaper.Replace(res.Genre)
+	res.Date = escaper.Replace(res.Date)
+	res.AlbumArtist = escaper.Replace(res.AlbumArtist)
+	res.Composer = escaper.Replace(res.Composer)
+}
+
+// Probe probes the file at the given path.
+func Probe(path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
+	defer f.Close()
+
+	s, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat file")
+	}
+
+	return ProbeReader(f, s.Size())
+}
+
+// ProbeReader probes the given reader, which has the given size. An error
+// wrapping ErrUnsupported is returned if the format is not known.
+func ProbeReader(r io.ReadSeeker, size int64) (*Result, error) {
+	format, start, err := sniff(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var res Result
+
+	switch format {
+	case formatWAV:
+		// WAV files have their own INFO tags that dhowden/tag can't read.
+		err = probeWAV(r, size, &res)
+	case formatOgg:
+		// dhowden/tag can only read Vorbis comments from Vorbis streams, so we
+		// read them ourselves for Opus as well.
+		err = probeOgg(r, start, size, &res)
+	default:
+		if err := readTags(r, &res); err != nil {
+			return nil, err
+		}
+
+		switch format {
+		case formatMP3:
+			err = probeMP3(r, start, size, &res)
+		case formatFLAC:
+			err = probeFLAC(r, start, size, &res)
+		case formatMP4:
+			err = probeMP4(r, size, &res)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.ReplayGain == nil {
+		res.ReplayGain = res.r128
+	}
+	res.r128 = nil
+
+	res.escape()
+	return &res, nil
+}
+
+type format uint8
+
+const (
+	formatMP3 format = iota
+	formatFLAC
+	formatOgg
+	formatMP4
+	formatWAV
+)
+
+// sniff detects the format of the file. The returned offset is where the
+// stream starts after an ID3v2 tag, if any.
+func sniff(r io.ReadSeeker) (format, int64, error) {
+	b, err := readAt(r, 0, 12)
+	if err != nil {
+		return 0, 0, errors.Wrap(ErrUnsupported, "file too short")
+	}
+
+	var start int64
+	var hasID3 bool
+
+	// Some encoders prepend an ID3v2 tag to FLAC files as well, so skip it
+	// before looking at the magic bytes.
+	if string(b[:3]) == "ID3" {
+		start = 10 + syncsafe(b[6:10])
+		if b[5]&0x10 != 0 {
+			start += 10 // footer
+		}
+		hasID3 = true
+
+		if b, err = readAt(r, start, 12); err != nil {
+			// Assume that the rest of the file is MP3 and let the frame
+			// search fail instead.
+			return formatMP3, start, nil
+		}
+	}
+
+	switch {
+	case string(b[:4]) == "fLaC":
+		return formatFLAC, start, nil
+	case string(b[:4]) == "OggS":
+		return formatOgg, start, nil
+	case string(b[4:8]) == "ftyp":
+		return formatMP4, start, nil
+	case string(b[:4]) == "RIFF" && string(b[8:12]) == "WAVE":
+		return formatWAV, start, nil
+	case hasID3, b[0] == 0xFF && b[1]&0xE0 == 0xE0:
+		return formatMP3, start, nil
+	}
+
+	return 0, 0, ErrUnsupported
+}
+
+// dateKeys are the raw tag names that may contain the full release date, in
+// order of priority.
+var dateKeys = []string{
+	"TDRC",    // ID3v2.4
+	"TYER",    // ID3v2.3
+	"TYE",     // ID3v2.2
+	"\xa9day", // MP4
+	"date",    // Vorbis
+	"year",    // Vorbis, nonstandard
+}
+
+func readTags(r io.ReadSeeker, res *Result) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek to start")
+	}
+
+	m, err := tag.ReadFrom(r)
+	if err != nil {
+		if errors.Is(err, tag.ErrNoTagsFound) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to read tags")
+	}
+
+	res.Title = m.Title()
+	res.Artist = m.Artist()
+	res.Album = m.Album()
+	res.Genre = m.Genre()
+	res.AlbumArtist = m.AlbumArtist()
+	res.Composer = m.Composer()
+	res.Number, _ = m.Track()
+	res.Disc, _ = m.Disc()
+	res.setLyrics(m.Lyrics())
+
+	raw := m.Raw()
+
+	// Vorbis comments may have the total in the track number.
+	if v, ok := raw["tracknumber"].(string); ok && res.Number == 0 {
+		res.Number = trackNumber(v)
+	}
+
+	for _, key := range dateKeys {
+		if v, ok := raw[key].(string); ok && v != "" {
+			res.Date = v
+			break
+		}
+	}
+
+	if res.Date == "" && m.Year() > 0 {
+		res.Date = strconv.Itoa(m.Year())
+	}
+
+	// ReplayGain and MusicBrainz tags are user-defined, so dhowden/tag only
+	// has them as raw tags.
+	for key, v := range raw {
+		switch v := v.(type) {
+		case string:
+			// Vorbis comments and MP4 freeform atoms. dhowden/tag keeps the
+			// zero locale of freeform data atoms before the value.
+			res.setComment(commentKey(key), strings.TrimLeft(v, "\x00"))
+		case *tag.Comm:
+			// ID3v2 TXXX frames; there may be many, suffixed with a number.
+			if strings.HasPrefix(key, "TXX") {
+				res.setComment(commentKey(v.Description), v.Text)
+			}
+		case []byte:
+			// ID3v2 frames that dhowden/tag doesn't parse.
+			if strings.HasPrefix(key, "SYLT") || strings.HasPrefix(key, "SLT") {
+				res.setSyncedLyrics(parseSYLT(v))
+			}
+			if strings.HasPrefix(key, "POPM") || strings.HasPrefix(key, "POP") {
+				if rating := parsePOPM(v); res.Rating == 0 {
+					res.Rating = rating
+				}
+			}
+		case *tag.UFID:
+			if v.Provider == musicBrainzUFID && res.MusicBrainzTrackID == "" {
+				res.MusicBrainzTrackID = string(v.Identifier)
+			}
+		}
+	}
+
+	return nil
+}
+
+// musicBrainzUFID is the owner of the ID3v2 UFID frame containing the
+// MusicBrainz recording ID.
+const musicBrainzUFID = "http://musicbrainz.org"
+
+// commentAliases maps the names of ID3v2 and MP4 user-defined tags written by
+// MusicBrainz Picard to their Vorbis comment names.
+var commentAliases = map[string]string{
+	"musicbrainz track id":        "musicbrainz_trackid",
+	"musicbrainz album id":        "musicbrainz_albumid",
+	"musicbrainz artist id":       "musicbrainz_artistid",
+	"musicbrainz album artist id": "musicbrainz_albumartistid",
+}
+
+// commentKey returns the Vorbis comment name of the given user-defined tag.
+func commentKey(name string) string {
+	name = strings.ToLower(name)
+	if alias, ok := commentAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// setComment sets the field of the result corresponding to the given Vorbis
+// comment or RIFF INFO key. The first value of a field wins.
+func (res *Result) setComment(key, value string) {
+	var field *string
+
+	switch key {
+	case "title", "INAM":
+		field = &res.Title
+	case "artist", "IART":
+		field = &res.Artist
+	case "album", "IPRD":
+		field = &res.Album
+	case "genre", "IGNR":
+		field = &res.Genre
+	case "date", "year", "ICRD":
+		field = &res.Date
+	case "albumartist", "album artist", "album_artist":
+		field = &res.AlbumArtist
+	case "composer", "IMUS":
+		field = &res.Composer
+	case "musicbrainz_trackid":
+		field = &res.MusicBrainzTrackID
+	case "musicbrainz_albumid":
+		field = &res.MusicBrainzAlbumID
+	case "musicbrainz_artistid":
+		field = &res.MusicBrainzArtistID
+	case "musicbrainz_albumartistid":
+		field = &res.MusicBrainzAlbumArtistID
+	case "tracknumber", "ITRK", "IPRT":
+		if res.Number == 0 {
+			res.Number = trackNumber(value)
+		}
+		return
+	case "discnumber":
+		if res.Disc == 0 {
+			res.Disc = trackNumber(value)
+		}
+		return
+	case "replaygain_track_gain", "replaygain_track_peak",
+		"replaygain_album_gain", "replaygain_album_peak":
+		res.setReplayGain(key, value)
+		return
+	case "lyrics", "unsyncedlyrics":
+		res.setLyrics(value)
+		return
+	case "rating":
+		if res.Rating == 0 {
+			res.Rating, _ = ParseRating(value)
+		}
+		return
+	case "r128_track_gain", "r128_album_gain":
+		res.setR128Gain(key, value)
+		return
+	default:
+		return
+	}
+
+	if *field == "" {
+		*field = value
+	}
+}
+
+// setReplayGain sets the ReplayGain value of the given Vorbis comment key.
+func (res *Result) setReplayGain(key, value string) {
+	v, ok := ParseReplayGain(value)
+	if !ok {
+		return
+	}
+
+	if res.ReplayGain == nil {
+		res.ReplayGain = &ReplayGain{}
+	}
+
+	switch key {
+	case "replaygain_track_gain":
+		res.ReplayGain.TrackGain = v
+	case "replaygain_track_peak":
+		res.ReplayGain.TrackPeak = v
+	case "replaygain_album_gain":
+		res.ReplayGain.AlbumGain = v
+	case "replaygain_album_peak":
+		res.ReplayGain.AlbumPeak = v
+	}
+}
+
+// setR128Gain sets the gain of an Opus R128 tag, which is a Q7.8 number
+// relative to -23 LUFS instead of ReplayGain's -18 LUFS.
+func (res *Result) setR128Gain(key, value string) {
+	q, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return
+	}
+
+	if res.r128 == nil {
+		res.r128 = &ReplayGain{}
+	}
+
+	gain := float64(q)/256 + 5
+
+	switch key {
+	case "r128_track_gain":
+		res.r128.TrackGain = gain
+	case "r128_album_gain":
+		res.r128.AlbumGain = gain
+	}
+}
+
+// ParseReplayGain parses a ReplayGain gain, such as "-6.5 dB", or a peak, such
+// as "0.98".
+func ParseReplayGain(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) > 2 && strings.EqualFold(value[len(value)-2:], "dB") {
+		value = strings.TrimSpace(value[:len(value)-2])
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// ParseRating parses a rating tag, which is either a number of stars from 1 to
+// 5 or a percentage. The rating is returned from 1 to 100.
+func ParseRating(value string) (int, bool) {
+	v, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || v < 1 {
+		return 0, false
+	}
+
+	switch {
+	case v <= 5:
+		return v * 20, true
+	case v > 100:
+		return 100, true
+	default:
+		return v, true
+	}
+}
+
+// parsePOPM parses the rating from 1 to 255 of an ID3v2 POPM frame, which comes
+// after the email address of the user, to a rating from 1 to 100.
+func parsePOPM(b []byte) int {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 || i+1 >= len(b) || b[i+1] == 0 {
+		return 0
+	}
+	return (int(b[i+1])*100 + 254) / 255
+}
+
+// trackNumber parses the track number, which may be followed by a slash and
+// the total, such as 1/12.
+func trackNumber(v string) int {
+	n, _ := strconv.Atoi(strings.SplitN(v, "/", 2)[0])
+	return n
+}
+
+func readAt(r io.ReadSeeker, off int64, n int) ([]byte, error) {
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func syncsafe(b []byte) int64 {
+	var n int64
+	for _, x := range b {
+		n = n<<7 | int64(x&0x7F)
+	}
+	return n
+}
+
+// samplesDuration returns the duration of the given number of samples at the
+// given sample rate.
+func samplesDuration(samples uint64, rate uint32) time.Duration {
+	s := samples / uint64(rate)
+	r := samples % uint64(rate)
+	return time.Duration(s)*time.Second + time.Duration(r)*time.Second/time.Duration(rate)
+}
+
+// bitrate returns the average bitrate in bits per second.
+func bitrate(bytes int64, length time.Duration) int {
+	if length <= 0 || bytes <= 0 {
+		return 0
+	}
+	return int(float64(bytes) * 8 / length.Seconds())
+}
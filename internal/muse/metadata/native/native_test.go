@@ -0,0 +1,625 @@
+package native
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/metadata/ffprobe"
+	"github.com/pkg/errors"
+)
+
+var testTags = map[string]string{
+	"title":       "Title",
+	"artist":      "Artist",
+	"album":       "Album",
+	"genre":       "Jazz",
+	"date":        "2000-01-02",
+	"track":       "3/12",
+	"albumartist": "Album Artist",
+	"composer":    "Composer",
+	"disc":        "2/2",
+	"trackgain":   "-6.50 dB",
+	"trackpeak":   "0.988547",
+	"albumid":     "0b4e1a5f-4f3b-4a8c-9a64-8e0b5cdb7c2a",
+	"trackid":     "5e1c2d3f-7a6b-4c0d-8e9f-0a1b2c3d4e5f",
+}
+
+// testResult is the result expected from the tags in testTags.
+var testResult = Result{
+	Title:              "Title",
+	Artist:             "Artist",
+	Album:              "Album",
+	Genre:              "Jazz",
+	Date:               "2000-01-02",
+	Number:             3,
+	AlbumArtist:        "Album Artist",
+	Composer:           "Composer",
+	Disc:               2,
+	MusicBrainzTrackID: "5e1c2d3f-7a6b-4c0d-8e9f-0a1b2c3d4e5f",
+	MusicBrainzAlbumID: "0b4e1a5f-4f3b-4a8c-9a64-8e0b5cdb7c2a",
+}
+
+var testReplayGain = &ReplayGain{
+	TrackGain: -6.5,
+	TrackPeak: 0.988547,
+}
+
+// testInfoResult is the result expected from RIFF INFO tags, which have no
+// album artist, disc, ReplayGain or MusicBrainz IDs.
+var testInfoResult = Result{
+	Title:    "Title",
+	Artist:   "Artist",
+	Album:    "Album",
+	Genre:    "Jazz",
+	Date:     "2000-01-02",
+	Number:   3,
+	Composer: "Composer",
+}
+
+type testFile struct {
+	name   string
+	ext    string
+	data   []byte
+	length time.Duration
+	// bitrate is the expected bitrate, or 0 to skip checking it.
+	bitrate    int
+	sampleRate int
+	codec      string
+	tags       Result
+	replayGain *ReplayGain
+}
+
+func testFiles() []testFile {
+	const seconds = 10
+
+	cbr, cbrLength := makeMP3(seconds, false)
+	vbr, vbrLength := makeMP3(seconds, true)
+
+	return []testFile{
+		{"mp3_cbr", ".mp3", cbr, cbrLength, 128000, 44100, "mp3", testResult, testReplayGain},
+		{"mp3_xing", ".mp3", vbr, vbrLength, 0, 44100, "mp3", testResult, testReplayGain},
+		{"flac", ".flac", makeFLAC(seconds), seconds * time.Second, 0, 44100, "flac", testResult, testReplayGain},
+		{"vorbis", ".ogg", makeOgg(seconds, false), seconds * time.Second, 0, 44100, "vorbis", testResult, testReplayGain},
+		{"opus", ".opus", makeOgg(seconds, true), seconds * time.Second, 0, 48000, "opus", testResult, testReplayGain},
+		{"wav", ".wav", makeWAV(seconds), seconds * time.Second, 44100 * 4 * 8, 44100, "pcm_s16le", testInfoResult, nil},
+	}
+}
+
+func TestProbe(t *testing.T) {
+	for _, file := range testFiles() {
+		t.Run(file.name, func(t *testing.T) {
+			res, err := ProbeReader(bytes.NewReader(file.data), int64(len(file.data)))
+			if err != nil {
+				t.Fatal("failed to probe:", err)
+			}
+
+			tags := *res
+			tags.Length = 0
+			tags.Bitrate = 0
+			tags.SampleRate = 0
+			tags.Codec = ""
+			tags.ReplayGain = nil
+
+			if tags != file.tags {
+				t.Errorf("unexpected tags:\n got %#v\nwant %#v", tags, file.tags)
+			}
+
+			if !equalReplayGain(res.ReplayGain, file.replayGain) {
+				t.Errorf("ReplayGain = %+v, want %+v", res.ReplayGain, file.replayGain)
+			}
+
+			if diff := res.Length - file.length; diff < -10*time.Millisecond || diff > 10*time.Millisecond {
+				t.Errorf("length = %v, want %v", res.Length, file.length)
+			}
+
+			if res.Bitrate <= 0 {
+				t.Errorf("bitrate = %d, want > 0", res.Bitrate)
+			}
+
+			if file.bitrate > 0 && res.Bitrate != file.bitrate {
+				t.Errorf("bitrate = %d, want %d", res.Bitrate, file.bitrate)
+			}
+
+			if res.SampleRate != file.sampleRate {
+				t.Errorf("sample rate = %d, want %d", res.SampleRate, file.sampleRate)
+			}
+
+			if res.Codec != file.codec {
+				t.Errorf("codec = %q, want %q", res.Codec, file.codec)
+			}
+		})
+	}
+}
+
+func TestProbeR128(t *testing.T) {
+	data := makeOggWithComment(10, true, vorbisComment("R128_TRACK_GAIN=-1280"))
+
+	res, err := ProbeReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal("failed to probe:", err)
+	}
+
+	// -1280/256 = -5 dB relative to -23 LUFS is 0 dB relative to -18 LUFS.
+	if want := (&ReplayGain{TrackGain: 0}); !equalReplayGain(res.ReplayGain, want) {
+		t.Errorf("ReplayGain = %+v, want %+v", res.ReplayGain, want)
+	}
+}
+
+func TestProbeLyrics(t *testing.T) {
+	const text = "First line\nSecond line"
+
+	// A SYLT frame in UTF-16 with a BOM in each string.
+	utf16 := func(s string) string {
+		b := []byte{0xFF, 0xFE}
+		for _, r := range s {
+			b = append(b, byte(r), byte(r>>8))
+		}
+		return string(append(b, 0, 0))
+	}
+	sylt := "\x01eng\x02\x01" + utf16("") +
+		utf16("\nFirst") + "\x00\x00\x03\xe8" +
+		utf16("\nSecond") + "\x00\x00\x07\xd0"
+
+	id3 := id3v2Frames([][2]string{
+		{"TIT2", "\x00Title"},
+		{"USLT", "\x00eng\x00" + text},
+		{"SYLT", sylt},
+	})
+
+	var res Result
+	if err := readTags(bytes.NewReader(id3), &res); err != nil {
+		t.Fatal("failed to read tags:", err)
+	}
+
+	want := &Lyrics{
+		Text: text,
+		Synced: []SyncedLine{
+			{Time: time.Second, Text: "First"},
+			{Time: 2 * time.Second, Text: "Second"},
+		},
+	}
+
+	if !reflect.DeepEqual(res.Lyrics, want) {
+		t.Errorf("unexpected ID3v2 lyrics:\n got %#v\nwant %#v", res.Lyrics, want)
+	}
+
+	opus := makeOggWithComment(10, true, vorbisComment("TITLE=Title", "LYRICS="+text))
+
+	o, err := ProbeReader(bytes.NewReader(opus), int64(len(opus)))
+	if err != nil {
+		t.Fatal("failed to probe:", err)
+	}
+
+	if o.Lyrics == nil || o.Lyrics.Text != text || o.Lyrics.Synced != nil {
+		t.Errorf("unexpected Opus lyrics: %#v", o.Lyrics)
+	}
+}
+
+func TestProbeRating(t *testing.T) {
+	id3 := id3v2Frames([][2]string{
+		{"TIT2", "\x00Title"},
+		{"POPM", "user@example.com\x00\xc4\x00\x00\x00\x01"},
+	})
+
+	var res Result
+	if err := readTags(bytes.NewReader(id3), &res); err != nil {
+		t.Fatal("failed to read tags:", err)
+	}
+
+	if res.Rating != 77 {
+		t.Errorf("ID3v2 rating = %d, want 77", res.Rating)
+	}
+
+	opus := makeOggWithComment(10, true, vorbisComment("TITLE=Title", "RATING=4"))
+
+	o, err := ProbeReader(bytes.NewReader(opus), int64(len(opus)))
+	if err != nil {
+		t.Fatal("failed to probe:", err)
+	}
+
+	if o.Rating != 80 {
+		t.Errorf("Vorbis rating = %d, want 80", o.Rating)
+	}
+}
+
+func TestParseRating(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"3", 60, true},
+		{"85", 85, true},
+		{" 255 ", 100, true},
+		{"0", 0, false},
+		{"great", 0, false},
+	}
+
+	for _, test := range tests {
+		v, ok := ParseRating(test.in)
+		if v != test.want || ok != test.ok {
+			t.Errorf("ParseRating(%q) = (%d, %v), want (%d, %v)", test.in, v, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestParseReplayGain(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"-6.50 dB", -6.5, true},
+		{"+2.1dB", 2.1, true},
+		{" 0.988547 ", 0.988547, true},
+		{"loud", 0, false},
+		{"", 0, false},
+	}
+
+	for _, test := range tests {
+		v, ok := ParseReplayGain(test.in)
+		if v != test.want || ok != test.ok {
+			t.Errorf("ParseReplayGain(%q) = (%v, %v), want (%v, %v)", test.in, v, ok, test.want, test.ok)
+		}
+	}
+}
+
+func equalReplayGain(a, b *ReplayGain) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestProbeMP4Length(t *testing.T) {
+	var mvhd bytes.Buffer
+	mvhd.Write(make([]byte, 12))                        // version, flags, times
+	binary.Write(&mvhd, binary.BigEndian, uint32(1000)) // timescale
+	binary.Write(&mvhd, binary.BigEndian, uint32(9500)) // duration
+	mvhd.Write(make([]byte, 80))
+
+	var mdhd bytes.Buffer
+	mdhd.Write(make([]byte, 12))                         // version, flags, times
+	binary.Write(&mdhd, binary.BigEndian, uint32(48000)) // timescale
+	mdhd.Write(make([]byte, 12))
+
+	hdlr := []byte("\x00\x00\x00\x00\x00\x00\x00\x00soun\x00\x00\x00\x00")
+
+	var stsd bytes.Buffer
+	stsd.Write([]byte{0, 0, 0, 0, 0, 0, 0, 1}) // version, flags, entry count
+	stsd.Write(makeAtom("alac", make([]byte, 28)))
+
+	stbl := makeAtom("stbl", makeAtom("stsd", stsd.Bytes()))
+	mdia := makeAtom("mdia", concat(
+		makeAtom("mdhd", mdhd.Bytes()),
+		makeAtom("hdlr", hdlr),
+		makeAtom("minf", stbl),
+	))
+
+	var b bytes.Buffer
+	b.Write(makeAtom("ftyp", []byte("M4A \x00\x00\x00\x00")))
+	b.Write(makeAtom("moov", concat(
+		makeAtom("mvhd", mvhd.Bytes()),
+		makeAtom("trak", mdia),
+	)))
+	b.Write(makeAtom("mdat", make([]byte, 1000)))
+
+	var res Result
+	if err := probeMP4(bytes.NewReader(b.Bytes()), int64(b.Len()), &res); err != nil {
+		t.Fatal("failed to probe:", err)
+	}
+
+	if res.Length != 9500*time.Millisecond {
+		t.Errorf("length = %v, want 9.5s", res.Length)
+	}
+
+	if want := 8000 * 1000 / 9500; res.Bitrate != want {
+		t.Errorf("bitrate = %d, want %d", res.Bitrate, want)
+	}
+
+	if res.SampleRate != 48000 || res.Codec != "alac" {
+		t.Errorf("sample rate = %d, codec = %q, want 48000 and alac", res.SampleRate, res.Codec)
+	}
+}
+
+func TestProbeUnsupported(t *testing.T) {
+	data := []byte("this is definitely not an audio file")
+
+	_, err := ProbeReader(bytes.NewReader(data), int64(len(data)))
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestProbeTruncated(t *testing.T) {
+	// The ID3v2 tag claims to be longer than the file.
+	data := []byte("ID3\x0400\x00\x00\x0000000000000")
+
+	if _, err := ProbeReader(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Fatal("unexpected nil error")
+	}
+}
+
+// BenchmarkProbe compares probing natively against running ffprobe.
+func BenchmarkProbe(b *testing.B) {
+	dir := b.TempDir()
+
+	_, ffprobeErr := exec.LookPath("ffprobe")
+
+	for _, file := range testFiles() {
+		path := filepath.Join(dir, file.name+file.ext)
+
+		if err := os.WriteFile(path, file.data, 0644); err != nil {
+			b.Fatal("failed to write file:", err)
+		}
+
+		b.Run(file.name+"/native", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := Probe(path); err != nil {
+					b.Fatal("failed to probe:", err)
+				}
+			}
+		})
+
+		b.Run(file.name+"/ffprobe", func(b *testing.B) {
+			if ffprobeErr != nil {
+				b.Skip("ffprobe not found:", ffprobeErr)
+			}
+
+			for i := 0; i < b.N; i++ {
+				if _, err := ffprobe.Probe(path); err != nil {
+					b.Fatal("failed to probe:", err)
+				}
+			}
+		})
+	}
+}
+
+// id3v2 returns an ID3v2.3 tag containing testTags.
+func id3v2() []byte {
+	frames := [][2]string{
+		{"TIT2", "\x00" + testTags["title"]}, // ISO-8859-1
+		{"TPE1", "\x00" + testTags["artist"]},
+		{"TALB", "\x00" + testTags["album"]},
+		{"TCON", "\x00" + testTags["genre"]},
+		{"TYER", "\x00" + testTags["date"]},
+		{"TRCK", "\x00" + testTags["track"]},
+		{"TPE2", "\x00" + testTags["albumartist"]},
+		{"TCOM", "\x00" + testTags["composer"]},
+		{"TPOS", "\x00" + testTags["disc"]},
+		{"TXXX", "\x00replaygain_track_gain\x00" + testTags["trackgain"]},
+		{"TXXX", "\x00REPLAYGAIN_TRACK_PEAK\x00" + testTags["trackpeak"]},
+		{"TXXX", "\x00MusicBrainz Album Id\x00" + testTags["albumid"]},
+		{"UFID", "http://musicbrainz.org\x00" + testTags["trackid"]},
+	}
+
+	return id3v2Frames(frames)
+}
+
+// id3v2Frames returns an ID3v2.3 tag containing the given frames.
+func id3v2Frames(frames [][2]string) []byte {
+	var body bytes.Buffer
+	for _, frame := range frames {
+		body.WriteString(frame[0])
+		binary.Write(&body, binary.BigEndian, uint32(len(frame[1])))
+		body.Write([]byte{0, 0}) // flags
+		body.WriteString(frame[1])
+	}
+
+	n := body.Len()
+
+	var b bytes.Buffer
+	b.WriteString("ID3\x03\x00\x00")
+	b.Write([]byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)})
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+// testComments are the Vorbis comments containing testTags.
+func testComments() []string {
+	return []string{
+		"TITLE=" + testTags["title"],
+		"ARTIST=" + testTags["artist"],
+		"ALBUM=" + testTags["album"],
+		"GENRE=" + testTags["genre"],
+		"DATE=" + testTags["date"],
+		"TRACKNUMBER=" + testTags["track"],
+		"ALBUMARTIST=" + testTags["albumartist"],
+		"COMPOSER=" + testTags["composer"],
+		"DISCNUMBER=" + testTags["disc"],
+		"REPLAYGAIN_TRACK_GAIN=" + testTags["trackgain"],
+		"REPLAYGAIN_TRACK_PEAK=" + testTags["trackpeak"],
+		"MUSICBRAINZ_ALBUMID=" + testTags["albumid"],
+		"MUSICBRAINZ_TRACKID=" + testTags["trackid"],
+	}
+}
+
+// vorbisComment returns a Vorbis comment packet containing the given
+// comments.
+func vorbisComment(comments ...string) []byte {
+	var b bytes.Buffer
+	vendor := "aqours"
+	binary.Write(&b, binary.LittleEndian, uint32(len(vendor)))
+	b.WriteString(vendor)
+	binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&b, binary.LittleEndian, uint32(len(c)))
+		b.WriteString(c)
+	}
+	return b.Bytes()
+}
+
+// makeMP3 makes an MPEG-1 Layer III file at 128kbps and 44.1kHz with empty
+// frames. If vbr is true, then the first frame contains a Xing header.
+func makeMP3(seconds int, vbr bool) ([]byte, time.Duration) {
+	const frameLen = 417 // 144 * 128000 / 44100
+	frames := seconds * 44100 / 1152
+
+	var b bytes.Buffer
+	b.Write(id3v2())
+
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, frameLen)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+
+		if i == 0 && vbr {
+			x := frame[4+32:]
+			copy(x, "Xing")
+			binary.BigEndian.PutUint32(x[4:], 0x3)
+			binary.BigEndian.PutUint32(x[8:], uint32(frames-1))
+			binary.BigEndian.PutUint32(x[12:], uint32(frames*frameLen))
+		}
+
+		b.Write(frame)
+	}
+
+	if vbr {
+		frames--
+	}
+
+	length := samplesDuration(uint64(frames)*1152, 44100)
+	if !vbr {
+		length = time.Duration(float64(frames*frameLen*8) / 128000 * float64(time.Second))
+	}
+
+	return b.Bytes(), length
+}
+
+// makeFLAC makes a 44.1kHz FLAC file with no audio frames.
+func makeFLAC(seconds int) []byte {
+	info := make([]byte, 34)
+	rate := uint64(44100)
+	samples := uint64(seconds) * rate
+	// 20 bits of sample rate, 3 bits of channels - 1, 5 bits of bits per
+	// sample - 1, 36 bits of samples.
+	binary.BigEndian.PutUint64(info[10:], rate<<44|1<<41|15<<36|samples)
+
+	comment := vorbisComment(testComments()...)
+
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	b.Write([]byte{0x00, 0, 0, byte(len(info))})
+	b.Write(info)
+	b.Write([]byte{0x84, byte(len(comment) >> 16), byte(len(comment) >> 8), byte(len(comment))})
+	b.Write(comment)
+	b.Write(make([]byte, 4096))
+	return b.Bytes()
+}
+
+// makeOgg makes an Ogg Vorbis or Opus file with the header pages and a final
+// page.
+func makeOgg(seconds int, opus bool) []byte {
+	return makeOggWithComment(seconds, opus, vorbisComment(testComments()...))
+}
+
+// makeOggWithComment makes an Ogg file like makeOgg with the given Vorbis
+// comment packet.
+func makeOggWithComment(seconds int, opus bool, vorbisComment []byte) []byte {
+	var id, comment []byte
+	var granule uint64
+
+	if opus {
+		const preskip = 312
+		id = make([]byte, 19)
+		copy(id, "OpusHead\x01\x02")
+		binary.LittleEndian.PutUint16(id[10:], preskip)
+		binary.LittleEndian.PutUint32(id[12:], 44100)
+		comment = append([]byte("OpusTags"), vorbisComment...)
+		granule = uint64(seconds)*opusRate + preskip
+	} else {
+		id = make([]byte, 30)
+		copy(id, "\x01vorbis\x00\x00\x00\x00\x02")
+		binary.LittleEndian.PutUint32(id[12:], 44100)
+		comment = append([]byte("\x03vorbis"), vorbisComment...)
+		comment = append(comment, 1) // framing bit
+		granule = uint64(seconds) * 44100
+	}
+
+	var b bytes.Buffer
+	b.Write(oggPage(0x02, 0, 0, id))
+	b.Write(oggPage(0x00, 0, 1, comment))
+	b.Write(oggPage(0x00, 1000, 2, make([]byte, 4000)))
+	b.Write(oggPage(0x04, granule, 3, make([]byte, 100)))
+	return b.Bytes()
+}
+
+func oggPage(typ byte, granule uint64, seq uint32, packet []byte) []byte {
+	var segments []byte
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			segments = append(segments, byte(n))
+			break
+		}
+		segments = append(segments, 255)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("OggS\x00")
+	b.WriteByte(typ)
+	binary.Write(&b, binary.LittleEndian, granule)
+	binary.Write(&b, binary.LittleEndian, uint32(0x1234)) // serial
+	binary.Write(&b, binary.LittleEndian, seq)
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // CRC
+	b.WriteByte(byte(len(segments)))
+	b.Write(segments)
+	b.Write(packet)
+	return b.Bytes()
+}
+
+// makeWAV makes a 16-bit stereo 44.1kHz WAV file of silence.
+func makeWAV(seconds int) []byte {
+	var fmtChunk bytes.Buffer
+	binary.Write(&fmtChunk, binary.LittleEndian, []uint16{1, 2})
+	binary.Write(&fmtChunk, binary.LittleEndian, []uint32{44100, 44100 * 4})
+	binary.Write(&fmtChunk, binary.LittleEndian, []uint16{4, 16})
+
+	info := bytes.NewBufferString("INFO")
+	for _, sub := range [][2]string{
+		{"INAM", testTags["title"]},
+		{"IART", testTags["artist"]},
+		{"IPRD", testTags["album"]},
+		{"IGNR", testTags["genre"]},
+		{"ICRD", testTags["date"]},
+		{"ITRK", testTags["track"]},
+		{"IMUS", testTags["composer"]},
+	} {
+		info.Write(riffChunk(sub[0], []byte(sub[1]+"\x00")))
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	body.Write(riffChunk("fmt ", fmtChunk.Bytes()))
+	body.Write(riffChunk("LIST", info.Bytes()))
+	body.Write(riffChunk("data", make([]byte, seconds*44100*4)))
+
+	return riffChunk("RIFF", body.Bytes())
+}
+
+func riffChunk(id string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	if len(data)%2 == 1 {
+		b.WriteByte(0)
+	}
+	return b.Bytes()
+}
+
+func makeAtom(typ string, data []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(8+len(data)))
+	b.WriteString(typ)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func concat(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
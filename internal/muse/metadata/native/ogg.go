@@ -0,0 +1,225 @@
+package native
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	oggHeaderLen = 27
+	// oggTailLen is the number of bytes at the end of the file to search for
+	// the last page. The maximum page size is slightly under 64KB.
+	oggTailLen = 65307
+	// oggMaxPacket is the maximum size of the header packets to read. Comment
+	// packets may contain embedded pictures.
+	oggMaxPacket = 32 << 20
+)
+
+// opusRate is the rate of Opus granule positions, regardless of the input
+// sample rate.
+const opusRate = 48000
+
+// probeOgg reads the identification and comment headers of the first logical
+// stream in the Ogg file and estimates the duration from the granule position
+// of its last page.
+func probeOgg(r io.ReadSeeker, start, size int64, res *Result) error {
+	packets, serial, err := readOggPackets(r, start, 2)
+	if err != nil {
+		return err
+	}
+
+	id, comment := packets[0], packets[1]
+
+	var rate uint32
+	var preskip uint64
+
+	switch {
+	case len(id) >= 30 && string(id[:7]) == "\x01vorbis":
+		rate = binary.LittleEndian.Uint32(id[12:])
+		res.Codec = "vorbis"
+		if !strings.HasPrefix(string(comment), "\x03vorbis") {
+			return errors.New("missing Vorbis comment header")
+		}
+		comment = comment[7:]
+
+	case len(id) >= 19 && string(id[:8]) == "OpusHead":
+		rate = opusRate
+		res.Codec = "opus"
+		preskip = uint64(binary.LittleEndian.Uint16(id[10:]))
+		if !strings.HasPrefix(string(comment), "OpusTags") {
+			return errors.New("missing Opus comment header")
+		}
+		comment = comment[8:]
+
+	default:
+		return errors.Wrap(ErrUnsupported, "unknown Ogg codec")
+	}
+
+	if err := readVorbisComment(comment, res); err != nil {
+		return errors.Wrap(err, "failed to read comments")
+	}
+
+	granule, err := lastOggGranule(r, size, serial)
+	if err != nil {
+		return err
+	}
+
+	if rate == 0 || granule <= preskip {
+		return errors.New("Ogg stream has unknown length")
+	}
+
+	// Opus is always decoded at 48kHz, regardless of the input sample rate.
+	res.SampleRate = int(rate)
+	res.Length = samplesDuration(granule-preskip, rate)
+	res.Bitrate = bitrate(size-start, res.Length)
+
+	return nil
+}
+
+// readOggPackets reads the first n packets of the logical stream of the first
+// page.
+func readOggPackets(r io.ReadSeeker, off int64, n int) ([][]byte, uint32, error) {
+	var serial uint32
+	var packets [][]byte
+	var packet []byte
+
+	for first := true; len(packets) < n; first = false {
+		h, err := readAt(r, off, oggHeaderLen)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to read Ogg page header")
+		}
+
+		if string(h[:4]) != "OggS" {
+			return nil, 0, errors.New("invalid Ogg page")
+		}
+
+		pageSerial := binary.LittleEndian.Uint32(h[14:])
+		if first {
+			serial = pageSerial
+		}
+
+		segments := make([]byte, h[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to read Ogg segment table")
+		}
+
+		var dataLen int64
+		for _, s := range segments {
+			dataLen += int64(s)
+		}
+
+		if pageSerial != serial {
+			// Skip pages of other multiplexed streams.
+			off += oggHeaderLen + int64(len(segments)) + dataLen
+			continue
+		}
+
+		data := make([]byte, dataLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to read Ogg page")
+		}
+
+		for _, s := range segments {
+			packet = append(packet, data[:s]...)
+			data = data[s:]
+
+			if len(packet) > oggMaxPacket {
+				return nil, 0, errors.New("Ogg header packet too large")
+			}
+
+			// A lacing value under 255 terminates the packet.
+			if s < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+
+		off += oggHeaderLen + int64(len(segments)) + dataLen
+	}
+
+	return packets[:n], serial, nil
+}
+
+// lastOggGranule returns the granule position of the last page of the given
+// stream.
+func lastOggGranule(r io.ReadSeeker, size int64, serial uint32) (uint64, error) {
+	n := size
+	if n > oggTailLen {
+		n = oggTailLen
+	}
+
+	b, err := readAt(r, size-n, int(n))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read the end of Ogg file")
+	}
+
+	for end := len(b); end > 0; {
+		i := bytes.LastIndex(b[:end], []byte("OggS"))
+		if i == -1 {
+			break
+		}
+
+		end = i
+
+		h := b[i:]
+		if len(h) < oggHeaderLen {
+			continue
+		}
+
+		// Pages with no finished packets have a granule position of -1.
+		granule := binary.LittleEndian.Uint64(h[6:])
+		if binary.LittleEndian.Uint32(h[14:]) == serial && granule != ^uint64(0) {
+			return granule, nil
+		}
+	}
+
+	return 0, errors.New("no last Ogg page found")
+}
+
+// readVorbisComment reads the Vorbis comment packet without the header type.
+func readVorbisComment(b []byte, res *Result) error {
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, false
+		}
+
+		v := b[4 : 4+n]
+		b = b[4+n:]
+		return v, true
+	}
+
+	// Vendor string.
+	if _, ok := next(); !ok {
+		return errors.New("invalid vendor string")
+	}
+
+	if len(b) < 4 {
+		return errors.New("missing comment count")
+	}
+
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+
+	for i := uint32(0); i < count; i++ {
+		c, ok := next()
+		if !ok {
+			return errors.New("invalid comment")
+		}
+
+		parts := strings.SplitN(string(c), "=", 2)
+		if len(parts) == 2 {
+			res.setComment(strings.ToLower(parts[0]), parts[1])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package native
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// probeWAV reads the format, data and INFO chunks of the RIFF WAVE file.
+func probeWAV(r io.ReadSeeker, size int64, res *Result) error {
+	var byteRate uint32
+	var dataLen int64 = -1
+
+	off := int64(12) // "RIFF", size, "WAVE"
+
+	for off+8 <= size {
+		h, err := readAt(r, off, 8)
+		if err != nil {
+			return errors.Wrap(err, "failed to read chunk header")
+		}
+
+		chunkLen := int64(binary.LittleEndian.Uint32(h[4:]))
+		off += 8
+
+		switch string(h[:4]) {
+		case "fmt ":
+			b, err := readAt(r, off, 16)
+			if err != nil {
+				return errors.Wrap(err, "failed to read fmt chunk")
+			}
+			byteRate = binary.LittleEndian.Uint32(b[8:])
+			res.SampleRate = int(binary.LittleEndian.Uint32(b[4:]))
+			res.Codec = wavCodec(binary.LittleEndian.Uint16(b), binary.LittleEndian.Uint16(b[14:]))
+
+		case "data":
+			// Streamed files may have a bogus data length.
+			if chunkLen > size-off {
+				chunkLen = size - off
+			}
+			dataLen = chunkLen
+
+		case "LIST":
+			if chunkLen > size-off {
+				return errors.New("LIST chunk too large")
+			}
+
+			b, err := readAt(r, off, int(chunkLen))
+			if err != nil {
+				return errors.Wrap(err, "failed to read LIST chunk")
+			}
+
+			if bytes.HasPrefix(b, []byte("INFO")) {
+				readRIFFInfo(b[4:], res)
+			}
+		}
+
+		// Chunks are padded to an even length.
+		off += chunkLen + chunkLen&1
+	}
+
+	if byteRate == 0 || dataLen < 0 {
+		return errors.New("WAV file has no format or data")
+	}
+
+	res.Length = samplesDuration(uint64(dataLen), byteRate)
+	res.Bitrate = int(byteRate) * 8
+
+	return nil
+}
+
+// readRIFFInfo reads the subchunks of an INFO list.
+func readRIFFInfo(b []byte, res *Result) {
+	for len(b) >= 8 {
+		id := string(b[:4])
+		n := int(binary.LittleEndian.Uint32(b[4:]))
+		b = b[8:]
+
+		if n > len(b) {
+			return
+		}
+
+		// Values are NUL-terminated.
+		value := string(bytes.TrimRight(b[:n], "\x00"))
+		res.setComment(id, value)
+
+		n += n & 1
+		if n > len(b) {
+			return
+		}
+		b = b[n:]
+	}
+}
+
+// wavCodec returns the ffmpeg name of the codec with the given WAVE format tag
+// and bits per sample. An empty string is returned for unknown codecs.
+func wavCodec(format, bits uint16) string {
+	switch format {
+	case 0x0001, 0xFFFE: // PCM, extensible (assumed to be PCM)
+		if bits == 8 {
+			return "pcm_u8"
+		}
+		return fmt.Sprintf("pcm_s%dle", bits)
+	case 0x0003:
+		return fmt.Sprintf("pcm_f%dle", bits)
+	case 0x0006:
+		return "pcm_alaw"
+	case 0x0007:
+		return "pcm_mulaw"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,179 @@
+// Package pathguess guesses the metadata of untagged files from their paths
+// using patterns such as %artist%/%album%/%number% - %title%.
+package pathguess
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Fields are the fields that patterns may contain. %ignore% matches anything
+// without guessing from it, and %% matches a literal %.
+var Fields = []string{
+	"title",
+	"artist",
+	"album",
+	"albumartist",
+	"genre",
+	"date",
+	"number",
+	"disc",
+	"ignore",
+}
+
+// Guess is the metadata guessed from a path. Fields that the pattern doesn't
+// have are empty.
+type Guess struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Genre       string
+	Date        string
+	Number      int
+	Disc        int
+}
+
+// Pattern is a parsed pattern. Each slash-separated part of the pattern
+// matches a part of the path, from the file name backwards. The extension of
+// the file name is ignored.
+type Pattern struct {
+	source string
+	re     *regexp.Regexp
+	fields []string // of each submatch
+	parts  int
+}
+
+// Parse parses the given pattern.
+func Parse(pattern string) (*Pattern, error) {
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return nil, errors.New("empty pattern")
+	}
+
+	p := &Pattern{
+		source: pattern,
+		parts:  strings.Count(pattern, "/") + 1,
+	}
+
+	var re strings.Builder
+	re.WriteByte('^')
+
+	for rest := pattern; rest != ""; {
+		i := strings.IndexByte(rest, '%')
+		if i == -1 {
+			re.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+
+		re.WriteString(regexp.QuoteMeta(rest[:i]))
+		rest = rest[i+1:]
+
+		j := strings.IndexByte(rest, '%')
+		if j == -1 {
+			return nil, errors.New("unterminated %")
+		}
+
+		field := strings.ToLower(rest[:j])
+		rest = rest[j+1:]
+
+		switch field {
+		case "":
+			re.WriteString("%")
+		case "ignore":
+			re.WriteString("[^/]*?")
+		case "number", "disc":
+			re.WriteString(`0*(\d+)`)
+			p.fields = append(p.fields, field)
+		case "title", "artist", "album", "albumartist", "genre", "date":
+			re.WriteString("([^/]+?)")
+			p.fields = append(p.fields, field)
+		default:
+			return nil, errors.Errorf("unknown field %%%s%%", field)
+		}
+	}
+
+	if len(p.fields) == 0 {
+		return nil, errors.New("pattern has no fields")
+	}
+
+	re.WriteByte('$')
+
+	r, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid pattern")
+	}
+	p.re = r
+
+	return p, nil
+}
+
+// String returns the pattern.
+func (p *Pattern) String() string {
+	return p.source
+}
+
+// Guess guesses the metadata from the given path. False is returned if the
+// path doesn't match the pattern.
+func (p *Pattern) Guess(path string) (Guess, bool) {
+	path = filepath.ToSlash(path)
+	path = strings.TrimSuffix(path, filepath.Ext(path))
+
+	parts := strings.Split(path, "/")
+	if len(parts) < p.parts {
+		return Guess{}, false
+	}
+
+	matches := p.re.FindStringSubmatch(strings.Join(parts[len(parts)-p.parts:], "/"))
+	if matches == nil {
+		return Guess{}, false
+	}
+
+	var g Guess
+
+	for i, field := range p.fields {
+		value := strings.TrimSpace(matches[i+1])
+
+		switch field {
+		case "title":
+			g.Title = stringOr(g.Title, value)
+		case "artist":
+			g.Artist = stringOr(g.Artist, value)
+		case "album":
+			g.Album = stringOr(g.Album, value)
+		case "albumartist":
+			g.AlbumArtist = stringOr(g.AlbumArtist, value)
+		case "genre":
+			g.Genre = stringOr(g.Genre, value)
+		case "date":
+			g.Date = stringOr(g.Date, value)
+		case "number":
+			g.Number = intOr(g.Number, value)
+		case "disc":
+			g.Disc = intOr(g.Disc, value)
+		}
+	}
+
+	return g, true
+}
+
+// stringOr returns the first value that isn't empty, so that the first match
+// of a field is kept.
+func stringOr(str, or string) string {
+	if str != "" {
+		return str
+	}
+	return or
+}
+
+func intOr(n int, str string) int {
+	if n != 0 {
+		return n
+	}
+	v, _ := strconv.Atoi(str)
+	return v
+}
@@ -0,0 +1,105 @@
+package pathguess
+
+import "testing"
+
+func TestGuess(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		guess   Guess
+		ok      bool
+	}{
+		{
+			name:    "folders",
+			pattern: "%artist%/%album%/%number% - %title%",
+			path:    "/music/Aqours/Aozora Jumping Heart/01 - Aozora Jumping Heart.flac",
+			guess: Guess{
+				Title:  "Aozora Jumping Heart",
+				Artist: "Aqours",
+				Album:  "Aozora Jumping Heart",
+				Number: 1,
+			},
+			ok: true,
+		},
+		{
+			name:    "separator in title",
+			pattern: "%number% - %title%",
+			path:    "/music/003 - Mijuku DREAMER - Off Vocal.mp3",
+			guess:   Guess{Title: "Mijuku DREAMER - Off Vocal", Number: 3},
+			ok:      true,
+		},
+		{
+			name:    "disc and date",
+			pattern: "%albumartist%/%album% (%date%)/%disc%-%number% %title%",
+			path:    "/music/Aqours/Best (2019)/2-05 Song.ogg",
+			guess: Guess{
+				Title:       "Song",
+				AlbumArtist: "Aqours",
+				Album:       "Best",
+				Date:        "2019",
+				Number:      5,
+				Disc:        2,
+			},
+			ok: true,
+		},
+		{
+			name:    "ignore and literal percent",
+			pattern: "%ignore%/100%% %title%",
+			path:    "/music/junk/100% Song.wav",
+			guess:   Guess{Title: "Song"},
+			ok:      true,
+		},
+		{
+			name:    "first value kept",
+			pattern: "%artist%/%artist% - %title%",
+			path:    "/music/A/B - Song.mp3",
+			guess:   Guess{Title: "Song", Artist: "A"},
+			ok:      true,
+		},
+		{
+			name:    "number mismatch",
+			pattern: "%number% - %title%",
+			path:    "/music/Intro - Song.mp3",
+		},
+		{
+			name:    "too few parts",
+			pattern: "%artist%/%album%/%title%",
+			path:    "album/song.mp3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := Parse(test.pattern)
+			if err != nil {
+				t.Fatal("failed to parse:", err)
+			}
+
+			g, ok := p.Guess(test.path)
+			if ok != test.ok {
+				t.Fatalf("ok = %v, want %v", ok, test.ok)
+			}
+			if g != test.guess {
+				t.Errorf("unexpected guess:\n got %#v\nwant %#v", g, test.guess)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	patterns := []string{
+		"",
+		"/",
+		"%title",
+		"%unknown%",
+		"no fields",
+		"%ignore% - %%",
+	}
+
+	for _, pattern := range patterns {
+		if _, err := Parse(pattern); err == nil {
+			t.Errorf("pattern %q parsed without error", pattern)
+		}
+	}
+}
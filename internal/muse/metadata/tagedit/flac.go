@@ -0,0 +1,134 @@
+package tagedit
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// FLAC metadata block types.
+const (
+	flacStreamInfo    = 0
+	flacPadding       = 1
+	flacVorbisComment = 4
+	flacPictureBlock  = 6
+)
+
+// flacMaxBlock is the maximum size of a metadata block.
+const flacMaxBlock = 1<<24 - 1
+
+type flacBlock struct {
+	typ  byte
+	data []byte
+}
+
+// writeFLAC rewrites the metadata blocks of the FLAC stream starting at the
+// given offset. An ID3v2 tag before the stream is dropped, since readers would
+// prefer it over the Vorbis comments that are edited.
+func writeFLAC(w io.Writer, r io.ReadSeeker, start int64, edit Edit) error {
+	var blocks []flacBlock
+
+	off := start + 4 // "fLaC"
+
+	for {
+		h, err := readAt(r, off, 4)
+		if err != nil {
+			return errors.Wrap(err, "failed to read FLAC block header")
+		}
+
+		blockLen := int(h[1])<<16 | int(h[2])<<8 | int(h[3])
+
+		data := make([]byte, blockLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return errors.Wrap(err, "failed to read FLAC block")
+		}
+
+		blocks = append(blocks, flacBlock{typ: h[0] & 0x7F, data: data})
+		off += 4 + int64(blockLen)
+
+		if h[0]&0x80 != 0 {
+			break
+		}
+	}
+
+	if len(blocks) == 0 || blocks[0].typ != flacStreamInfo {
+		return errors.New("FLAC stream has no STREAMINFO")
+	}
+
+	edited := make([]flacBlock, 0, len(blocks)+2)
+	edited = append(edited, blocks[0])
+
+	var comment *vorbisComment
+
+	for _, block := range blocks[1:] {
+		switch block.typ {
+		case flacPadding:
+			// Added back at the end.
+			continue
+		case flacPictureBlock:
+			if edit.Picture != nil {
+				continue
+			}
+		case flacVorbisComment:
+			if comment != nil {
+				return errors.New("FLAC stream has multiple Vorbis comments")
+			}
+
+			c, _, err := parseVorbisComment(block.data)
+			if err != nil {
+				return errors.Wrap(err, "failed to read Vorbis comment")
+			}
+			comment = &c
+		}
+
+		edited = append(edited, block)
+	}
+
+	if comment == nil {
+		comment = &vorbisComment{vendor: "aqours"}
+		// Put the new block right after STREAMINFO, where it usually is.
+		edited = append(edited[:1], append([]flacBlock{{typ: flacVorbisComment}}, edited[1:]...)...)
+	}
+
+	comment.apply(edit, false)
+	comment.setReplayGain(edit.ReplayGain, false)
+
+	for i := range edited {
+		if edited[i].typ == flacVorbisComment {
+			edited[i].data = comment.bytes()
+		}
+	}
+
+	if edit.Picture != nil {
+		edited = append(edited, flacBlock{typ: flacPictureBlock, data: flacPicture(edit.Picture)})
+	}
+
+	edited = append(edited, flacBlock{typ: flacPadding, data: make([]byte, paddingLen)})
+
+	if _, err := io.WriteString(w, "fLaC"); err != nil {
+		return errors.Wrap(err, "failed to write FLAC header")
+	}
+
+	for i, block := range edited {
+		if len(block.data) > flacMaxBlock {
+			return errors.Errorf("FLAC block of type %d is too large", block.typ)
+		}
+
+		typ := block.typ
+		if i == len(edited)-1 {
+			typ |= 0x80 // last block
+		}
+
+		n := len(block.data)
+		h := []byte{typ, byte(n >> 16), byte(n >> 8), byte(n)}
+
+		if _, err := w.Write(h); err != nil {
+			return errors.Wrap(err, "failed to write FLAC block header")
+		}
+		if _, err := w.Write(block.data); err != nil {
+			return errors.Wrap(err, "failed to write FLAC block")
+		}
+	}
+
+	return copyFrom(w, r, off)
+}
@@ -0,0 +1,325 @@
+package tagedit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// id3Frames maps the fields to their ID3v2 frame IDs. The first ID is written,
+// and all of them are removed when the field is changed.
+var id3Frames = [fieldCount][]string{
+	Title:       {"TIT2"},
+	Artist:      {"TPE1"},
+	Album:       {"TALB"},
+	AlbumArtist: {"TPE2"},
+	Composer:    {"TCOM"},
+	Genre:       {"TCON"},
+	Date:        {"TDRC", "TYER", "TDAT", "TIME", "TRDA"},
+	Number:      {"TRCK"},
+	Disc:        {"TPOS"},
+}
+
+// id3v23Date are the frames of the date in ID3v2.3 tags, which has no TDRC
+// frame and only the year in TYER.
+var id3v23Date = []string{"TYER", "TDAT", "TIME", "TRDA", "TDRC"}
+
+// id3MaxSize is the maximum size of an ID3v2 tag, which is a 28-bit syncsafe
+// integer.
+const id3MaxSize = 1<<28 - 1
+
+type id3Frame struct {
+	id    string
+	flags [2]byte
+	data  []byte
+}
+
+// discard returns true if the frame should be dropped once the tag is changed.
+func (f id3Frame) discard(version byte) bool {
+	if version == 3 {
+		return f.flags[0]&0x80 != 0
+	}
+	return f.flags[0]&0x40 != 0
+}
+
+// text returns the first value of the text frame. An empty string is returned
+// if the frame is compressed or encrypted.
+func (f id3Frame) text() string {
+	if len(f.data) == 0 || f.flags[1] != 0 {
+		return ""
+	}
+
+	var s string
+	b := f.data[1:]
+
+	switch f.data[0] {
+	case 0: // ISO-8859-1
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		s = string(runes)
+	case 1, 2: // UTF-16 with a BOM, UTF-16BE
+		order := binary.ByteOrder(binary.BigEndian)
+		if len(b) >= 2 && b[0] == 0xFF && b[1] == 0xFE {
+			order = binary.LittleEndian
+		}
+		if len(b) >= 2 && f.data[0] == 1 {
+			b = b[2:]
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[i*2:])
+		}
+		s = string(utf16.Decode(units))
+	case 3: // UTF-8
+		s = string(b)
+	}
+
+	if i := strings.IndexByte(s, 0); i != -1 {
+		s = s[:i]
+	}
+
+	return s
+}
+
+// readID3 reads the frames of the ID3v2 tag at the start of the file. The
+// version is 0 if there is no tag.
+func readID3(r io.ReadSeeker) (byte, []id3Frame, error) {
+	h, err := readAt(r, 0, 10)
+	if err != nil || string(h[:3]) != "ID3" {
+		return 0, nil, nil
+	}
+
+	version := h[3]
+	if version != 3 && version != 4 {
+		return 0, nil, errors.Wrapf(ErrUnsupported, "ID3v2.%d tags can't be written", version)
+	}
+
+	if h[5]&0x80 != 0 {
+		return 0, nil, errors.Wrap(ErrUnsupported, "unsynchronised ID3v2 tags can't be written")
+	}
+
+	body := make([]byte, syncsafe(h[6:10]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, errors.Wrap(err, "failed to read ID3v2 tag")
+	}
+
+	// Skip the extended header, which isn't written back.
+	if h[5]&0x40 != 0 {
+		if len(body) < 4 {
+			return 0, nil, errors.New("invalid ID3v2 extended header")
+		}
+
+		// The size excludes itself in ID3v2.3 but not in ID3v2.4.
+		n := syncsafe(body[:4])
+		if version == 3 {
+			n = 4 + int64(binary.BigEndian.Uint32(body))
+		}
+
+		if n > int64(len(body)) {
+			return 0, nil, errors.New("invalid ID3v2 extended header size")
+		}
+		body = body[n:]
+	}
+
+	var frames []id3Frame
+
+	// Frames end at the padding.
+	for len(body) >= 10 && body[0] != 0 {
+		size := int64(binary.BigEndian.Uint32(body[4:]))
+		if version == 4 {
+			size = syncsafe(body[4:8])
+		}
+
+		if size > int64(len(body)-10) {
+			return 0, nil, errors.Errorf("invalid size for ID3v2 frame %q", body[:4])
+		}
+
+		frames = append(frames, id3Frame{
+			id:    string(body[:4]),
+			flags: [2]byte{body[8], body[9]},
+			data:  body[10 : 10+size],
+		})
+
+		body = body[10+size:]
+	}
+
+	return version, frames, nil
+}
+
+// writeMP3 writes a new ID3v2 tag in place of the one that ends at the given
+// offset. The version of the old tag is kept, and new tags are ID3v2.4.
+func writeMP3(w io.Writer, r io.ReadSeeker, start int64, edit Edit) error {
+	version, frames, err := readID3(r)
+	if err != nil {
+		return err
+	}
+
+	if version == 0 {
+		version = 4
+	}
+
+	kept := frames[:0]
+	for _, frame := range frames {
+		if !frame.discard(version) {
+			kept = append(kept, frame)
+		}
+	}
+	frames = kept
+
+	edit.fields(func(field Field, value string) error {
+		ids := id3Frames[field]
+		if field == Date && version == 3 {
+			ids = id3v23Date
+			// TYER only has the year.
+			if len(value) > 4 {
+				value = value[:4]
+			}
+		}
+
+		var old string
+		frames, old = removeID3Frames(frames, ids)
+
+		if field.isNumber() {
+			value = keepTotal(old, value)
+		}
+
+		if value != "" {
+			frames = append(frames, id3TextFrame(version, ids[0], value))
+		}
+
+		return nil
+	})
+
+	if edit.Picture != nil {
+		frames, _ = removeID3Frames(frames, []string{"APIC"})
+		frames = append(frames, id3PictureFrame(edit.Picture))
+	}
+
+	if edit.ReplayGain != nil {
+		frames = removeID3UserFrames(frames, replayGainKeys)
+		for _, tag := range edit.ReplayGain.tags() {
+			// TXXX frames have a description before the value.
+			frames = append(frames, id3TextFrame(version, "TXXX", tag[0]+"\x00"+tag[1]))
+		}
+	}
+
+	var body bytes.Buffer
+	for _, frame := range frames {
+		body.WriteString(frame.id)
+		if version == 4 {
+			body.Write(syncsafeBytes(len(frame.data)))
+		} else {
+			binary.Write(&body, binary.BigEndian, uint32(len(frame.data)))
+		}
+		body.Write(frame.flags[:])
+		body.Write(frame.data)
+	}
+	body.Write(make([]byte, paddingLen))
+
+	if body.Len() > id3MaxSize {
+		return errors.New("ID3v2 tag is too large")
+	}
+
+	h := append([]byte{'I', 'D', '3', version, 0, 0}, syncsafeBytes(body.Len())...)
+
+	if _, err := w.Write(h); err != nil {
+		return errors.Wrap(err, "failed to write ID3v2 header")
+	}
+	if _, err := body.WriteTo(w); err != nil {
+		return errors.Wrap(err, "failed to write ID3v2 tag")
+	}
+
+	return copyFrom(w, r, start)
+}
+
+// removeID3Frames removes the frames with any of the given IDs and returns the
+// text of the first one.
+func removeID3Frames(frames []id3Frame, ids []string) ([]id3Frame, string) {
+	var first string
+	var found bool
+
+	kept := frames[:0]
+
+	for _, frame := range frames {
+		if !containsFold(ids, frame.id) {
+			kept = append(kept, frame)
+			continue
+		}
+
+		if !found {
+			first = frame.text()
+			found = true
+		}
+	}
+
+	return kept, first
+}
+
+// removeID3UserFrames removes the TXXX frames with any of the given
+// descriptions.
+func removeID3UserFrames(frames []id3Frame, descs []string) []id3Frame {
+	kept := frames[:0]
+
+	for _, frame := range frames {
+		// The description is the first value of the frame.
+		if frame.id != "TXXX" || !containsFold(descs, frame.text()) {
+			kept = append(kept, frame)
+		}
+	}
+
+	return kept
+}
+
+// id3TextFrame creates a text frame. ID3v2.4 tags are written in UTF-8, while
+// ID3v2.3 tags, which don't support it, are written in UTF-16 unless the text
+// is ASCII.
+func id3TextFrame(version byte, id, value string) id3Frame {
+	var data []byte
+
+	switch {
+	case version == 4:
+		data = append([]byte{3}, value...)
+	case isASCII(value):
+		data = append([]byte{0}, value...)
+	default:
+		data = []byte{1, 0xFF, 0xFE} // UTF-16 with a little-endian BOM
+		for _, u := range utf16.Encode([]rune(value)) {
+			data = append(data, byte(u), byte(u>>8))
+		}
+	}
+
+	return id3Frame{id: id, data: data}
+}
+
+// id3PictureFrame creates an APIC frame of the front cover with no
+// description.
+func id3PictureFrame(p *Picture) id3Frame {
+	var data bytes.Buffer
+	data.WriteByte(0) // ISO-8859-1
+	data.WriteString(p.MIMEType)
+	data.WriteByte(0)
+	data.WriteByte(pictureFront)
+	data.WriteByte(0) // empty description
+	data.Write(p.Data)
+
+	return id3Frame{id: "APIC", data: data.Bytes()}
+}
+
+func syncsafeBytes(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
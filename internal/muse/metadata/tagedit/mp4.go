@@ -0,0 +1,545 @@
+package tagedit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// mp4Items maps the fields to their iTunes item types. The first type is
+// written, and all of them are removed when the field is changed.
+var mp4Items = [fieldCount][]string{
+	Title:       {"\xa9nam"},
+	Artist:      {"\xa9ART"},
+	Album:       {"\xa9alb"},
+	AlbumArtist: {"aART"},
+	Composer:    {"\xa9wrt"},
+	Genre:       {"\xa9gen", "gnre"},
+	Date:        {"\xa9day"},
+	Number:      {"trkn"},
+	Disc:        {"disk"},
+}
+
+// Types of the data atoms of iTunes items.
+const (
+	mp4Implicit = 0
+	mp4UTF8     = 1
+	mp4JPEG     = 13
+	mp4PNG      = 14
+)
+
+// mp4Box is an MP4 atom. Containers that are edited are parsed into their
+// children, while other atoms are kept as raw data.
+type mp4Box struct {
+	typ  string
+	data []byte
+	// prefix is the data before the children of a container, such as the
+	// version and flags of meta atoms.
+	prefix   []byte
+	children []*mp4Box
+	parsed   bool
+}
+
+// parseMP4Boxes parses the atoms in b.
+func parseMP4Boxes(b []byte) ([]*mp4Box, error) {
+	var boxes []*mp4Box
+
+	for len(b) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(b))
+		hlen := uint64(8)
+
+		switch size {
+		case 0: // extends to the end
+			size = uint64(len(b))
+		case 1: // 64-bit size
+			if len(b) < 16 {
+				return nil, errors.New("invalid atom header")
+			}
+			size = binary.BigEndian.Uint64(b[8:])
+			hlen = 16
+		}
+
+		if size < hlen || size > uint64(len(b)) {
+			return nil, errors.Errorf("invalid size for atom %q", b[4:8])
+		}
+
+		boxes = append(boxes, &mp4Box{
+			typ:  string(b[4:8]),
+			data: b[hlen:size],
+		})
+
+		b = b[size:]
+	}
+
+	return boxes, nil
+}
+
+// parse parses the children of the container, which come after prefixLen
+// bytes.
+func (box *mp4Box) parse(prefixLen int) error {
+	if box.parsed {
+		return nil
+	}
+
+	if len(box.data) < prefixLen {
+		return errors.Errorf("atom %q too short", box.typ)
+	}
+
+	children, err := parseMP4Boxes(box.data[prefixLen:])
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse %q", box.typ)
+	}
+
+	box.prefix = box.data[:prefixLen]
+	box.children = children
+	box.parsed = true
+	return nil
+}
+
+// child returns the first child of the given type, or nil if there is none.
+// The container must be parsed.
+func (box *mp4Box) child(typ string) *mp4Box {
+	for _, child := range box.children {
+		if child.typ == typ {
+			return child
+		}
+	}
+	return nil
+}
+
+// path parses the containers on the given path of types and returns the last
+// one, or nil if any is missing. Containers named meta have a prefix.
+func (box *mp4Box) path(types ...string) (*mp4Box, error) {
+	for _, typ := range types {
+		prefix := 0
+		if box.typ == "meta" {
+			prefix = 4
+		}
+
+		if err := box.parse(prefix); err != nil {
+			return nil, err
+		}
+
+		if box = box.child(typ); box == nil {
+			return nil, nil
+		}
+	}
+
+	return box, nil
+}
+
+func (box *mp4Box) bytes() []byte {
+	var b bytes.Buffer
+	box.writeTo(&b)
+	return b.Bytes()
+}
+
+func (box *mp4Box) writeTo(b *bytes.Buffer) {
+	start := b.Len()
+	b.Write([]byte{0, 0, 0, 0})
+	b.WriteString(box.typ)
+
+	if !box.parsed {
+		b.Write(box.data)
+	} else {
+		b.Write(box.prefix)
+		for _, child := range box.children {
+			child.writeTo(b)
+		}
+	}
+
+	binary.BigEndian.PutUint32(b.Bytes()[start:], uint32(b.Len()-start))
+}
+
+// mp4Atom is the position of a top-level atom in the file.
+type mp4Atom struct {
+	typ  string
+	off  int64 // start of the header
+	size int64 // size including the header
+}
+
+// readMP4Atoms reads the headers of the top-level atoms.
+func readMP4Atoms(r io.ReadSeeker, size int64) ([]mp4Atom, error) {
+	var atoms []mp4Atom
+
+	for off := int64(0); off+8 <= size; {
+		h, err := readAt(r, off, 8)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read atom header")
+		}
+
+		atomSize := int64(binary.BigEndian.Uint32(h))
+		hlen := int64(8)
+
+		switch atomSize {
+		case 0:
+			atomSize = size - off
+		case 1:
+			b, err := readAt(r, off+8, 8)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read atom size")
+			}
+			atomSize = int64(binary.BigEndian.Uint64(b))
+			hlen = 16
+		}
+
+		if atomSize < hlen || off+atomSize > size {
+			return nil, errors.Errorf("invalid size for atom %q", h[4:])
+		}
+
+		atoms = append(atoms, mp4Atom{typ: string(h[4:]), off: off, size: atomSize})
+		off += atomSize
+	}
+
+	return atoms, nil
+}
+
+// writeMP4 rewrites the moov atom with the edited ilst atom. If the media data
+// comes after the moov atom, then the chunk offsets are shifted by the change
+// in its size.
+func writeMP4(w io.Writer, r io.ReadSeeker, size int64, edit Edit) error {
+	atoms, err := readMP4Atoms(r, size)
+	if err != nil {
+		return err
+	}
+
+	var moovAtom mp4Atom
+	for _, atom := range atoms {
+		switch atom.typ {
+		case "moov":
+			moovAtom = atom
+		case "moof":
+			return errors.Wrap(ErrUnsupported, "fragmented MP4 files can't be written")
+		}
+	}
+
+	if moovAtom.typ == "" {
+		return errors.New("missing moov atom")
+	}
+
+	b, err := readAt(r, moovAtom.off, int(moovAtom.size))
+	if err != nil {
+		return errors.Wrap(err, "failed to read moov atom")
+	}
+
+	boxes, err := parseMP4Boxes(b)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse moov atom")
+	}
+	if len(boxes) != 1 {
+		return errors.New("invalid moov atom")
+	}
+
+	moov := boxes[0]
+
+	if err := editMP4(moov, edit); err != nil {
+		return err
+	}
+
+	newMoov := moov.bytes()
+
+	if delta := int64(len(newMoov)) - moovAtom.size; delta != 0 {
+		moovEnd := moovAtom.off + moovAtom.size
+
+		if err := shiftMP4Offsets(moov, moovEnd, delta); err != nil {
+			return err
+		}
+
+		newMoov = moov.bytes()
+	}
+
+	for _, atom := range atoms {
+		if atom.typ == "moov" {
+			if _, err := w.Write(newMoov); err != nil {
+				return errors.Wrap(err, "failed to write moov atom")
+			}
+			continue
+		}
+
+		if _, err := r.Seek(atom.off, io.SeekStart); err != nil {
+			return errors.Wrap(err, "failed to seek")
+		}
+
+		if _, err := io.CopyN(w, r, atom.size); err != nil {
+			return errors.Wrapf(err, "failed to copy atom %q", atom.typ)
+		}
+	}
+
+	return nil
+}
+
+// editMP4 applies the edit to the ilst atom in the moov atom, creating it if
+// needed.
+func editMP4(moov *mp4Box, edit Edit) error {
+	udta, err := moov.path("udta")
+	if err != nil {
+		return err
+	}
+	if udta == nil {
+		udta = &mp4Box{typ: "udta", parsed: true}
+		moov.children = append(moov.children, udta)
+	}
+
+	meta, err := udta.path("meta")
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		meta = &mp4Box{
+			typ:    "meta",
+			prefix: []byte{0, 0, 0, 0}, // version and flags
+			children: []*mp4Box{{
+				typ: "hdlr",
+				// Version and flags, predefined, handler type, reserved and an
+				// empty name.
+				data: []byte("\x00\x00\x00\x00\x00\x00\x00\x00mdirappl\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+			}},
+			parsed: true,
+		}
+		udta.children = append(udta.children, meta)
+	}
+
+	ilst, err := meta.path("ilst")
+	if err != nil {
+		return err
+	}
+	if ilst == nil {
+		ilst = &mp4Box{typ: "ilst", parsed: true}
+		meta.children = append(meta.children, ilst)
+	}
+
+	if err := ilst.parse(0); err != nil {
+		return err
+	}
+
+	err = edit.fields(func(field Field, value string) error {
+		var old []byte
+		ilst.children, old = removeMP4Items(ilst.children, mp4Items[field])
+
+		if value == "" {
+			return nil
+		}
+
+		typ := mp4Items[field][0]
+
+		if !field.isNumber() {
+			ilst.children = append(ilst.children, mp4Item(typ, mp4UTF8, []byte(value)))
+			return nil
+		}
+
+		n, total, _ := parseNumber(value)
+		if total == 0 && len(old) >= 6 {
+			total = int(binary.BigEndian.Uint16(old[4:]))
+		}
+
+		// Both start with 2 reserved bytes, and trkn ends with 2 more.
+		data := make([]byte, 6, 8)
+		binary.BigEndian.PutUint16(data[2:], uint16(n))
+		binary.BigEndian.PutUint16(data[4:], uint16(total))
+		if field == Number {
+			data = append(data, 0, 0)
+		}
+
+		ilst.children = append(ilst.children, mp4Item(typ, mp4Implicit, data))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if p := edit.Picture; p != nil {
+		var typ uint32
+		switch p.MIMEType {
+		case "image/jpeg":
+			typ = mp4JPEG
+		case "image/png":
+			typ = mp4PNG
+		default:
+			return errors.Errorf("MP4 files can't embed pictures of type %q", p.MIMEType)
+		}
+
+		ilst.children, _ = removeMP4Items(ilst.children, []string{"covr"})
+		ilst.children = append(ilst.children, mp4Item("covr", typ, p.Data))
+	}
+
+	if edit.ReplayGain != nil {
+		ilst.children = removeMP4Freeform(ilst.children, replayGainKeys)
+		for _, tag := range edit.ReplayGain.tags() {
+			// Other taggers write the names in lowercase.
+			name := strings.ToLower(tag[0])
+			ilst.children = append(ilst.children, mp4Freeform(name, tag[1]))
+		}
+	}
+
+	return nil
+}
+
+// removeMP4Items removes the items of the given types and returns the value of
+// the first one.
+func removeMP4Items(items []*mp4Box, types []string) ([]*mp4Box, []byte) {
+	var first []byte
+	var found bool
+
+	kept := items[:0]
+
+	for _, item := range items {
+		if !containsString(types, item.typ) {
+			kept = append(kept, item)
+			continue
+		}
+
+		if !found && item.parse(0) == nil {
+			// Skip the type and locale of the data atom.
+			if data := item.child("data"); data != nil && len(data.data) >= 8 {
+				first = data.data[8:]
+			}
+			found = true
+		}
+	}
+
+	return kept, first
+}
+
+// mp4Item creates an iTunes item with a single data atom.
+func mp4Item(typ string, dataType uint32, value []byte) *mp4Box {
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint32(data, dataType) // version 0 and type
+	data = append(data, value...)              // after the locale
+
+	return &mp4Box{
+		typ:      typ,
+		children: []*mp4Box{{typ: "data", data: data}},
+		parsed:   true,
+	}
+}
+
+// mp4FreeformMean is the namespace of the freeform items written by iTunes and
+// most other taggers.
+const mp4FreeformMean = "com.apple.iTunes"
+
+// removeMP4Freeform removes the freeform items with any of the given names.
+func removeMP4Freeform(items []*mp4Box, names []string) []*mp4Box {
+	kept := items[:0]
+
+	for _, item := range items {
+		if item.typ != "----" || item.parse(0) != nil {
+			kept = append(kept, item)
+			continue
+		}
+
+		// Skip the version and flags of the name atom.
+		name := item.child("name")
+		if name == nil || len(name.data) < 4 || !containsFold(names, string(name.data[4:])) {
+			kept = append(kept, item)
+		}
+	}
+
+	return kept
+}
+
+// mp4Freeform creates a freeform item with the given name and text.
+func mp4Freeform(name, value string) *mp4Box {
+	item := mp4Item("----", mp4UTF8, []byte(value))
+	item.children = append([]*mp4Box{
+		{typ: "mean", data: append(make([]byte, 4), mp4FreeformMean...)},
+		{typ: "name", data: append(make([]byte, 4), name...)},
+	}, item.children...)
+
+	return item
+}
+
+// shiftMP4Offsets shifts the chunk offsets at or after the given offset by
+// delta.
+func shiftMP4Offsets(moov *mp4Box, after, delta int64) error {
+	if err := moov.parse(0); err != nil {
+		return err
+	}
+
+	for _, trak := range moov.children {
+		if trak.typ != "trak" {
+			continue
+		}
+
+		stbl, err := trak.path("mdia", "minf", "stbl")
+		if err != nil {
+			return err
+		}
+		if stbl == nil {
+			continue
+		}
+
+		if err := stbl.parse(0); err != nil {
+			return err
+		}
+
+		for _, box := range stbl.children {
+			var err error
+
+			switch box.typ {
+			case "stco":
+				box.data, err = shiftChunkOffsets(box.data, 4, after, delta)
+			case "co64":
+				box.data, err = shiftChunkOffsets(box.data, 8, after, delta)
+			}
+
+			if err != nil {
+				return errors.Wrapf(err, "failed to shift %q", box.typ)
+			}
+		}
+	}
+
+	return nil
+}
+
+// shiftChunkOffsets shifts the offsets of an stco or co64 atom, whose entries
+// are of the given size, and returns a copy.
+func shiftChunkOffsets(data []byte, entryLen int, after, delta int64) ([]byte, error) {
+	if len(data) < 8 {
+		return nil, errors.New("atom too short")
+	}
+
+	count := int(binary.BigEndian.Uint32(data[4:]))
+	if count > (len(data)-8)/entryLen {
+		return nil, errors.New("invalid entry count")
+	}
+
+	shifted := append([]byte(nil), data...)
+	entries := shifted[8:]
+
+	for i := 0; i < count; i++ {
+		entry := entries[i*entryLen:]
+
+		if entryLen == 4 {
+			off := int64(binary.BigEndian.Uint32(entry))
+			if off < after {
+				continue
+			}
+			off += delta
+			if off < 0 || off > math.MaxUint32 {
+				return nil, errors.New("chunk offset out of range")
+			}
+			binary.BigEndian.PutUint32(entry, uint32(off))
+		} else {
+			off := int64(binary.BigEndian.Uint64(entry))
+			if off < after {
+				continue
+			}
+			binary.BigEndian.PutUint64(entry, uint64(off+delta))
+		}
+	}
+
+	return shifted, nil
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
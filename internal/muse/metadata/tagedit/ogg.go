@@ -0,0 +1,339 @@
+package tagedit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const oggHeaderLen = 27
+
+// oggMaxHeaders is the maximum size of the header packets to read. Comment
+// packets may contain embedded pictures.
+const oggMaxHeaders = 64 << 20
+
+// Ogg page header flags.
+const (
+	oggContinued = 0x01
+	oggFirst     = 0x02
+)
+
+// oggPage is a parsed Ogg page.
+type oggPage struct {
+	header   []byte
+	segments []byte
+	data     []byte
+}
+
+func (p *oggPage) flags() byte      { return p.header[5] }
+func (p *oggPage) serial() uint32   { return binary.LittleEndian.Uint32(p.header[14:]) }
+func (p *oggPage) sequence() uint32 { return binary.LittleEndian.Uint32(p.header[18:]) }
+
+func (p *oggPage) setSequence(seq uint32) {
+	binary.LittleEndian.PutUint32(p.header[18:], seq)
+	p.updateCRC()
+}
+
+func (p *oggPage) updateCRC() {
+	crc := p.header[22:26]
+	copy(crc, []byte{0, 0, 0, 0})
+
+	var sum uint32
+	sum = oggCRC(sum, p.header)
+	sum = oggCRC(sum, p.segments)
+	sum = oggCRC(sum, p.data)
+
+	binary.LittleEndian.PutUint32(crc, sum)
+}
+
+func (p *oggPage) writeTo(w io.Writer) error {
+	for _, b := range [][]byte{p.header, p.segments, p.data} {
+		if _, err := w.Write(b); err != nil {
+			return errors.Wrap(err, "failed to write Ogg page")
+		}
+	}
+	return nil
+}
+
+// readOggPage reads the next page. io.EOF is returned if there are no more
+// pages.
+func readOggPage(r io.Reader) (*oggPage, error) {
+	h := make([]byte, oggHeaderLen)
+	if _, err := io.ReadFull(r, h); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errors.Wrap(err, "failed to read Ogg page header")
+	}
+
+	if string(h[:4]) != "OggS" {
+		return nil, errors.New("invalid Ogg page")
+	}
+
+	p := &oggPage{
+		header:   h,
+		segments: make([]byte, h[26]),
+	}
+
+	if _, err := io.ReadFull(r, p.segments); err != nil {
+		return nil, errors.Wrap(err, "failed to read Ogg segment table")
+	}
+
+	var dataLen int
+	for _, s := range p.segments {
+		dataLen += int(s)
+	}
+
+	p.data = make([]byte, dataLen)
+	if _, err := io.ReadFull(r, p.data); err != nil {
+		return nil, errors.Wrap(err, "failed to read Ogg page")
+	}
+
+	return p, nil
+}
+
+// writeOgg rewrites the header pages of the first logical stream of the Ogg
+// file with the edited comment packet. The pages after them are renumbered if
+// the number of header pages changes.
+func writeOgg(w io.Writer, r io.ReadSeeker, start int64, edit Edit) error {
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek to Ogg stream")
+	}
+
+	br := bufio.NewReader(r)
+
+	first, err := readOggPage(br)
+	if err != nil {
+		return err
+	}
+
+	serial := first.serial()
+	template := append([]byte(nil), first.header...)
+
+	var packets [][]byte
+	var packet []byte
+	var headerLen int
+	// nHeaders is the number of header packets, which is known once the
+	// identification header is read.
+	nHeaders := 1
+	oldPages := 0
+
+	for page := first; ; {
+		if page.serial() != serial {
+			return errors.Wrap(ErrUnsupported, "multiplexed Ogg streams can't be written")
+		}
+
+		oldPages++
+		data := page.data
+
+		for _, s := range page.segments {
+			packet = append(packet, data[:s]...)
+			data = data[s:]
+
+			// A lacing value under 255 terminates the packet.
+			if s < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+
+		headerLen += len(page.data)
+		if headerLen > oggMaxHeaders {
+			return errors.New("Ogg header packets too large")
+		}
+
+		if len(packets) > 0 && nHeaders == 1 {
+			switch id := packets[0]; {
+			case bytes.HasPrefix(id, []byte("\x01vorbis")):
+				nHeaders = 3 // identification, comment and setup
+			case bytes.HasPrefix(id, []byte("OpusHead")):
+				nHeaders = 2 // identification and comment
+			default:
+				return errors.Wrap(ErrUnsupported, "unknown Ogg codec")
+			}
+		}
+
+		if len(packets) >= nHeaders {
+			break
+		}
+
+		if page, err = readOggPage(br); err != nil {
+			if err == io.EOF {
+				return errors.New("missing Ogg header packets")
+			}
+			return err
+		}
+	}
+
+	// Audio packets must start on a new page.
+	if len(packets) > nHeaders || packet != nil {
+		return errors.New("Ogg header packets don't end on a page")
+	}
+
+	comment, err := editOggComment(packets[1], edit)
+	if err != nil {
+		return err
+	}
+	packets[1] = comment
+
+	pages := oggPaginate(template, packets[:1], 0, oggFirst)
+	pages = append(pages, oggPaginate(template, packets[1:], uint32(len(pages)), 0)...)
+
+	for _, page := range pages {
+		if err := page.writeTo(w); err != nil {
+			return err
+		}
+	}
+
+	if len(pages) == oldPages {
+		_, err := br.WriteTo(w)
+		return errors.Wrap(err, "failed to copy audio data")
+	}
+
+	delta := uint32(len(pages) - oldPages)
+
+	for {
+		page, err := readOggPage(br)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if page.serial() == serial {
+			page.setSequence(page.sequence() + delta)
+		}
+
+		if err := page.writeTo(w); err != nil {
+			return err
+		}
+	}
+}
+
+// editOggComment applies the edit to the comment packet of a Vorbis or Opus
+// stream.
+func editOggComment(packet []byte, edit Edit) ([]byte, error) {
+	var prefix string
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		prefix = "\x03vorbis"
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		prefix = "OpusTags"
+	default:
+		return nil, errors.New("missing Ogg comment header")
+	}
+
+	c, rest, err := parseVorbisComment(packet[len(prefix):])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read comments")
+	}
+
+	c.apply(edit, true)
+	c.setReplayGain(edit.ReplayGain, prefix == "OpusTags")
+
+	var b bytes.Buffer
+	b.WriteString(prefix)
+	b.Write(c.bytes())
+	// Keep the framing bit of Vorbis and the binary data of Opus.
+	b.Write(rest)
+
+	return b.Bytes(), nil
+}
+
+// oggPaginate splits the header packets into pages with the given first
+// sequence number and flags. The template is the header of a page of the
+// stream.
+func oggPaginate(template []byte, packets [][]byte, seq uint32, flags byte) []*oggPage {
+	var pages []*oggPage
+	var page *oggPage
+	var finished bool
+
+	flush := func() {
+		if page == nil {
+			return
+		}
+
+		// Pages with no finished packets have a granule position of -1, and
+		// header packets have 0.
+		granule := ^uint64(0)
+		if finished {
+			granule = 0
+		}
+
+		binary.LittleEndian.PutUint64(page.header[6:], granule)
+		page.header[26] = byte(len(page.segments))
+		page.updateCRC()
+
+		pages = append(pages, page)
+		page = nil
+		finished = false
+	}
+
+	for _, packet := range packets {
+		for off := 0; ; {
+			if page == nil {
+				page = &oggPage{header: append([]byte(nil), template...)}
+				page.header[5] = flags
+				if off > 0 {
+					page.header[5] |= oggContinued
+				}
+				binary.LittleEndian.PutUint32(page.header[18:], seq)
+				seq++
+				flags = 0
+			}
+
+			n := len(packet) - off
+			if n > 255 {
+				n = 255
+			}
+
+			page.segments = append(page.segments, byte(n))
+			page.data = append(page.data, packet[off:off+n]...)
+			off += n
+
+			done := n < 255
+			if done {
+				finished = true
+			}
+
+			if len(page.segments) == 255 {
+				flush()
+			}
+
+			if done {
+				break
+			}
+		}
+	}
+
+	flush()
+	return pages
+}
+
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04C11DB7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return
+}()
+
+// oggCRC updates the CRC-32 of Ogg pages, which is unreflected with no final
+// XOR, unlike the one in hash/crc32.
+func oggCRC(crc uint32, b []byte) uint32 {
+	for _, c := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^c]
+	}
+	return crc
+}
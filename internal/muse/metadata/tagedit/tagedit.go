@@ -0,0 +1,362 @@
+// Package tagedit writes tags to audio files. ID3v2 tags of MP3 files, Vorbis
+// comments of FLAC, Ogg Vorbis and Opus files, and iTunes tags of MP4 files are
+// supported. Tags that aren't edited are kept as they are.
+//
+// Files are never written in place: the edited file is written next to the
+// original, which it then replaces, so a failed write leaves the original file
+// untouched.
+package tagedit
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported is returned if tags can't be written to the format of the
+// file.
+var ErrUnsupported = errors.New("unsupported format")
+
+// Field is a tag that can be edited.
+type Field uint8
+
+const (
+	Title Field = iota
+	Artist
+	Album
+	AlbumArtist
+	Composer
+	Genre
+	Date
+	Number
+	Disc
+	fieldCount
+)
+
+var fieldNames = [fieldCount]string{
+	Title:       "title",
+	Artist:      "artist",
+	Album:       "album",
+	AlbumArtist: "album artist",
+	Composer:    "composer",
+	Genre:       "genre",
+	Date:        "date",
+	Number:      "track number",
+	Disc:        "disc number",
+}
+
+func (f Field) String() string {
+	if f < fieldCount {
+		return fieldNames[f]
+	}
+	return "Field(" + strconv.Itoa(int(f)) + ")"
+}
+
+// isNumber returns true if the field is a number, which may be followed by a
+// slash and the total, such as 1/12.
+func (f Field) isNumber() bool {
+	return f == Number || f == Disc
+}
+
+// Edit is a set of changes to the tags of a file.
+type Edit struct {
+	// Fields maps the fields to change to their new values. Fields that aren't
+	// in the map are left alone, and fields that are set to an empty string
+	// are removed.
+	Fields map[Field]string
+	// Picture, if not nil, replaces all embedded pictures with a front cover.
+	Picture *Picture
+	// ReplayGain, if not nil, replaces all ReplayGain tags.
+	ReplayGain *ReplayGain
+}
+
+// IsEmpty returns true if the edit changes nothing.
+func (edit Edit) IsEmpty() bool {
+	return len(edit.Fields) == 0 && edit.Picture == nil && edit.ReplayGain == nil
+}
+
+// fields calls f for each changed field in a stable order.
+func (edit Edit) fields(f func(field Field, value string) error) error {
+	for field := Field(0); field < fieldCount; field++ {
+		value, ok := edit.Fields[field]
+		if !ok {
+			continue
+		}
+		if err := f(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (edit Edit) validate() error {
+	for field, value := range edit.Fields {
+		if field >= fieldCount {
+			return errors.Errorf("unknown field %v", field)
+		}
+
+		if field.isNumber() && value != "" {
+			if _, _, err := parseNumber(value); err != nil {
+				return errors.Wrapf(err, "invalid %v", field)
+			}
+		}
+	}
+
+	if edit.Picture != nil && len(edit.Picture.Data) == 0 {
+		return errors.New("picture is empty")
+	}
+
+	if rg := edit.ReplayGain; rg != nil {
+		for _, v := range []float64{rg.TrackGain, rg.TrackPeak, rg.AlbumGain, rg.AlbumPeak} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return errors.New("invalid ReplayGain value")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Picture is an embedded picture.
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+// ReplayGain contains the ReplayGain values to write. Gains are in dB and peaks
+// are linear, where 1 is full scale.
+type ReplayGain struct {
+	TrackGain float64
+	TrackPeak float64
+	AlbumGain float64
+	AlbumPeak float64
+}
+
+// replayGainKeys are the names of the ReplayGain tags in Vorbis comments, ID3v2
+// TXXX frames and MP4 freeform atoms, where they're matched case-insensitively.
+var replayGainKeys = []string{
+	"REPLAYGAIN_TRACK_GAIN",
+	"REPLAYGAIN_TRACK_PEAK",
+	"REPLAYGAIN_ALBUM_GAIN",
+	"REPLAYGAIN_ALBUM_PEAK",
+	"REPLAYGAIN_REFERENCE_LOUDNESS",
+}
+
+// tags returns the ReplayGain tags to write as pairs of names and values, which
+// are formatted the way other ReplayGain scanners do.
+func (rg *ReplayGain) tags() [][2]string {
+	gain := func(db float64) string { return strconv.FormatFloat(db, 'f', 2, 64) + " dB" }
+	peak := func(v float64) string { return strconv.FormatFloat(v, 'f', 6, 64) }
+
+	return [][2]string{
+		{replayGainKeys[0], gain(rg.TrackGain)},
+		{replayGainKeys[1], peak(rg.TrackPeak)},
+		{replayGainKeys[2], gain(rg.AlbumGain)},
+		{replayGainKeys[3], peak(rg.AlbumPeak)},
+	}
+}
+
+// pictureFront is the ID3v2 and FLAC picture type of the front cover.
+const pictureFront = 3
+
+// paddingLen is the size of the padding added to ID3v2 tags and FLAC metadata,
+// which lets other editors change tags without rewriting the whole file.
+const paddingLen = 1024
+
+// Write writes the edit to the file at the given path. An error wrapping
+// ErrUnsupported is returned if the format of the file isn't supported.
+func Write(path string, edit Edit) error {
+	if err := edit.validate(); err != nil {
+		return err
+	}
+
+	// Replace the file that a symlink points to instead of the symlink.
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve path")
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open file")
+	}
+	defer src.Close()
+
+	s, err := src.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to stat file")
+	}
+
+	format, start, err := sniff(src)
+	if err != nil {
+		return err
+	}
+
+	dst, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+	// Both are no-ops once the file is renamed.
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+
+	buf := bufio.NewWriter(dst)
+
+	switch format {
+	case formatMP3:
+		err = writeMP3(buf, src, start, edit)
+	case formatFLAC:
+		err = writeFLAC(buf, src, start, edit)
+	case formatOgg:
+		err = writeOgg(buf, src, start, edit)
+	case formatMP4:
+		err = writeMP4(buf, src, s.Size(), edit)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := buf.Flush(); err != nil {
+		return errors.Wrap(err, "failed to write file")
+	}
+
+	if err := dst.Chmod(s.Mode().Perm()); err != nil {
+		return errors.Wrap(err, "failed to set file mode")
+	}
+
+	if err := dst.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync file")
+	}
+
+	if err := dst.Close(); err != nil {
+		return errors.Wrap(err, "failed to close file")
+	}
+
+	if err := os.Rename(dst.Name(), path); err != nil {
+		return errors.Wrap(err, "failed to replace file")
+	}
+
+	return nil
+}
+
+type format uint8
+
+const (
+	formatMP3 format = iota
+	formatFLAC
+	formatOgg
+	formatMP4
+)
+
+// sniff detects the format of the file. The returned offset is where the
+// stream starts after an ID3v2 tag, if any.
+func sniff(r io.ReadSeeker) (format, int64, error) {
+	b, err := readAt(r, 0, 12)
+	if err != nil {
+		return 0, 0, errors.Wrap(ErrUnsupported, "file too short")
+	}
+
+	var start int64
+	var hasID3 bool
+
+	if string(b[:3]) == "ID3" {
+		start = 10 + syncsafe(b[6:10])
+		if b[5]&0x10 != 0 {
+			start += 10 // footer
+		}
+		hasID3 = true
+
+		if b, err = readAt(r, start, 12); err != nil {
+			return formatMP3, start, nil
+		}
+	}
+
+	switch {
+	case string(b[:4]) == "fLaC":
+		return formatFLAC, start, nil
+	case string(b[:4]) == "OggS":
+		return formatOgg, start, nil
+	case string(b[4:8]) == "ftyp" && !hasID3:
+		return formatMP4, start, nil
+	case hasID3, b[0] == 0xFF && b[1]&0xE0 == 0xE0:
+		return formatMP3, start, nil
+	}
+
+	return 0, 0, ErrUnsupported
+}
+
+// parseNumber parses a track or disc number, which may be followed by a slash
+// and the total, such as 1/12. The total is 0 if there is none.
+func parseNumber(v string) (n, total int, err error) {
+	parts := strings.SplitN(v, "/", 2)
+
+	n, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || n < 0 || n > 0xFFFF {
+		return 0, 0, errors.Errorf("%q is not a number", v)
+	}
+
+	if len(parts) == 2 {
+		total, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || total < 0 || total > 0xFFFF {
+			return 0, 0, errors.Errorf("%q has an invalid total", v)
+		}
+	}
+
+	return n, total, nil
+}
+
+// keepTotal returns the new number with the total of the old one if the new
+// number has none, so changing the track number of 1/12 to 2 gives 2/12.
+func keepTotal(old, v string) string {
+	if v == "" || strings.Contains(v, "/") {
+		return v
+	}
+
+	if i := strings.Index(old, "/"); i != -1 {
+		return v + old[i:]
+	}
+
+	return v
+}
+
+func readAt(r io.ReadSeeker, off int64, n int) ([]byte, error) {
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// copyFrom copies the rest of r from the given offset to w.
+func copyFrom(w io.Writer, r io.ReadSeeker, off int64) error {
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek")
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return errors.Wrap(err, "failed to copy audio data")
+	}
+
+	return nil
+}
+
+func syncsafe(b []byte) int64 {
+	var n int64
+	for _, x := range b {
+		n = n<<7 | int64(x&0x7F)
+	}
+	return n
+}
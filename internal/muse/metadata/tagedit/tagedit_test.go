@@ -0,0 +1,607 @@
+package tagedit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhowden/tag"
+	"github.com/diamondburned/aqours/internal/muse/metadata/native"
+	"github.com/pkg/errors"
+)
+
+// audioData is recognizable data standing in for the audio of test files, which
+// must be kept as is.
+var audioData = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+// testPicture is large enough to span many Ogg pages.
+var testPicture = &Picture{
+	MIMEType: "image/png",
+	Data:     append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0x42}, 100_000)...),
+}
+
+var testEdit = Edit{
+	Fields: map[Field]string{
+		Title:       "New Title",
+		Artist:      "Ünïcödé Artist",
+		AlbumArtist: "New Album Artist",
+		Number:      "5",
+		Genre:       "", // removed
+	},
+	Picture: testPicture,
+}
+
+type testFile struct {
+	name string
+	ext  string
+	data []byte
+	// album is the album that must be kept.
+	album string
+	// picture is true if dhowden/tag can read the picture back.
+	picture bool
+}
+
+func testFiles() []testFile {
+	return []testFile{
+		{"mp3_id3v23", ".mp3", concat(id3v23(), makeMP3()), "Album", true},
+		{"mp3_untagged", ".mp3", makeMP3(), "", true},
+		{"flac", ".flac", makeFLAC(), "Album", true},
+		{"vorbis", ".ogg", makeOgg(false), "Album", true},
+		{"opus", ".opus", makeOgg(true), "Album", false},
+		{"mp4", ".m4a", makeMP4(), "Album", true},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, file := range testFiles() {
+		t.Run(file.name, func(t *testing.T) {
+			path := filepath.Join(dir, file.name+file.ext)
+			if err := os.WriteFile(path, file.data, 0640); err != nil {
+				t.Fatal("failed to write file:", err)
+			}
+
+			if err := Write(path, testEdit); err != nil {
+				t.Fatal("failed to write tags:", err)
+			}
+
+			s, err := os.Stat(path)
+			if err != nil {
+				t.Fatal("failed to stat:", err)
+			}
+			if s.Mode().Perm() != 0640 {
+				t.Errorf("mode = %v, want 0640", s.Mode().Perm())
+			}
+
+			res, err := native.Probe(path)
+			if err != nil {
+				t.Fatal("failed to probe:", err)
+			}
+
+			expect := [][2]string{
+				{res.Title, "New Title"},
+				{res.Artist, "Ünïcödé Artist"},
+				{res.AlbumArtist, "New Album Artist"},
+				{res.Album, file.album},
+				{res.Genre, ""},
+			}
+
+			for _, e := range expect {
+				if e[0] != e[1] {
+					t.Errorf("got %q, want %q", e[0], e[1])
+				}
+			}
+
+			if res.Number != 5 {
+				t.Errorf("number = %d, want 5", res.Number)
+			}
+
+			if file.picture {
+				checkPicture(t, path)
+			}
+
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal("failed to read file:", err)
+			}
+
+			if file.ext == ".ogg" || file.ext == ".opus" {
+				checkOggPages(t, b)
+			} else if !bytes.Contains(b, audioData) {
+				t.Error("audio data was not kept")
+			}
+
+			if file.ext == ".m4a" {
+				checkMP4Offset(t, b)
+			}
+
+			// Writing the same edit again must give the same file.
+			if err := Write(path, testEdit); err != nil {
+				t.Fatal("failed to write tags again:", err)
+			}
+
+			again, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal("failed to read file:", err)
+			}
+
+			if !bytes.Equal(b, again) {
+				t.Error("writing the same edit again changed the file")
+			}
+		})
+	}
+}
+
+func TestWriteReplayGain(t *testing.T) {
+	dir := t.TempDir()
+
+	old := &ReplayGain{TrackGain: 1, TrackPeak: 0.5, AlbumGain: 2, AlbumPeak: 0.6}
+	rg := &ReplayGain{TrackGain: -6.5, TrackPeak: 0.988547, AlbumGain: -7.25, AlbumPeak: 1.02}
+
+	for _, file := range testFiles() {
+		t.Run(file.name, func(t *testing.T) {
+			path := filepath.Join(dir, file.name+file.ext)
+			if err := os.WriteFile(path, file.data, 0640); err != nil {
+				t.Fatal("failed to write file:", err)
+			}
+
+			// The old tags must be replaced rather than duplicated.
+			for _, rg := range []*ReplayGain{old, rg} {
+				if err := Write(path, Edit{ReplayGain: rg}); err != nil {
+					t.Fatal("failed to write tags:", err)
+				}
+			}
+
+			res, err := native.Probe(path)
+			if err != nil {
+				t.Fatal("failed to probe:", err)
+			}
+
+			if res.Album != file.album {
+				t.Errorf("album = %q, want %q", res.Album, file.album)
+			}
+
+			got := res.ReplayGain
+			if got == nil {
+				t.Fatal("no ReplayGain read back")
+			}
+
+			expect := *rg
+			if file.ext == ".opus" {
+				// R128 tags have no peaks.
+				expect.TrackPeak = 0
+				expect.AlbumPeak = 0
+			}
+
+			values := [][2]float64{
+				{got.TrackGain, expect.TrackGain},
+				{got.TrackPeak, expect.TrackPeak},
+				{got.AlbumGain, expect.AlbumGain},
+				{got.AlbumPeak, expect.AlbumPeak},
+			}
+
+			for _, v := range values {
+				if math.Abs(v[0]-v[1]) > 0.01 {
+					t.Errorf("got ReplayGain %+v, want %+v", *got, expect)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestR128Gain(t *testing.T) {
+	tests := map[float64]int{
+		5:     0,
+		-6.5:  -2944,
+		0:     -1280,
+		1000:  math.MaxInt16,
+		-1000: math.MinInt16,
+	}
+
+	for db, q := range tests {
+		if got := r128Gain(db); got != q {
+			t.Errorf("r128Gain(%v) = %d, want %d", db, got, q)
+		}
+	}
+}
+
+func checkPicture(t *testing.T, path string) {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal("failed to open:", err)
+	}
+	defer f.Close()
+
+	m, err := tag.ReadFrom(f)
+	if err != nil {
+		t.Fatal("failed to read tags:", err)
+	}
+
+	p := m.Picture()
+	if p == nil {
+		t.Fatal("missing picture")
+	}
+
+	if !bytes.Equal(p.Data, testPicture.Data) {
+		t.Error("picture data differs")
+	}
+}
+
+// checkOggPages checks that the pages of the only stream are numbered in order
+// and have valid checksums, and that the audio pages are kept.
+func checkOggPages(t *testing.T, b []byte) {
+	t.Helper()
+
+	r := bytes.NewReader(b)
+
+	var audio []byte
+
+	for seq := uint32(0); ; seq++ {
+		page, err := readOggPage(r)
+		if err != nil {
+			if err != io.EOF {
+				t.Fatal("failed to read page:", err)
+			}
+			break
+		}
+
+		// Header pages have a granule position of 0 or -1.
+		if granule := binary.LittleEndian.Uint64(page.header[6:]); granule != 0 && granule != ^uint64(0) {
+			audio = append(audio, page.data...)
+		}
+
+		if page.sequence() != seq {
+			t.Errorf("page %d has sequence number %d", seq, page.sequence())
+		}
+
+		crc := binary.LittleEndian.Uint32(page.header[22:])
+		page.updateCRC()
+
+		if sum := binary.LittleEndian.Uint32(page.header[22:]); sum != crc {
+			t.Errorf("page %d has CRC %08x, want %08x", seq, crc, sum)
+		}
+	}
+
+	if !bytes.Equal(audio, audioData) {
+		t.Error("audio pages were not kept")
+	}
+}
+
+// checkMP4Offset checks that the chunk offset still points to the audio data.
+func checkMP4Offset(t *testing.T, b []byte) {
+	t.Helper()
+
+	i := bytes.Index(b, []byte("stco"))
+	if i == -1 {
+		t.Fatal("missing stco")
+	}
+
+	off := binary.BigEndian.Uint32(b[i+12:])
+	if !bytes.HasPrefix(b[off:], audioData) {
+		t.Errorf("chunk offset %d doesn't point to the audio data", off)
+	}
+}
+
+func TestWriteKeepsTotal(t *testing.T) {
+	for _, file := range []struct {
+		name string
+		ext  string
+		data []byte
+		// raw is the raw tag of the track number, which dhowden/tag doesn't
+		// split in Vorbis comments.
+		raw string
+	}{
+		{"mp3", ".mp3", concat(id3v23(), makeMP3()), ""},
+		{"flac", ".flac", makeFLAC(), "tracknumber"},
+		{"mp4", ".m4a", makeMP4(), ""},
+	} {
+		t.Run(file.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), file.name+file.ext)
+			if err := os.WriteFile(path, file.data, 0644); err != nil {
+				t.Fatal("failed to write file:", err)
+			}
+
+			edit := Edit{Fields: map[Field]string{Number: "7"}}
+			if err := Write(path, edit); err != nil {
+				t.Fatal("failed to write tags:", err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal("failed to open:", err)
+			}
+			defer f.Close()
+
+			m, err := tag.ReadFrom(f)
+			if err != nil {
+				t.Fatal("failed to read tags:", err)
+			}
+
+			if file.raw != "" {
+				if v := m.Raw()[file.raw]; v != "7/12" {
+					t.Errorf("%s = %q, want 7/12", file.raw, v)
+				}
+				return
+			}
+
+			if n, total := m.Track(); n != 7 || total != 12 {
+				t.Errorf("track = %d/%d, want 7/12", n, total)
+			}
+		})
+	}
+}
+
+func TestWriteInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.flac")
+	data := makeFLAC()
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal("failed to write file:", err)
+	}
+
+	edit := Edit{Fields: map[Field]string{Number: "three"}}
+	if err := Write(path, edit); err == nil {
+		t.Error("expected an error for an invalid number")
+	}
+
+	edit = Edit{Picture: &Picture{MIMEType: "image/gif", Data: []byte("GIF89a")}}
+	mp4 := filepath.Join(t.TempDir(), "file.m4a")
+	if err := os.WriteFile(mp4, makeMP4(), 0644); err != nil {
+		t.Fatal("failed to write file:", err)
+	}
+	if err := Write(mp4, edit); err == nil {
+		t.Error("expected an error for a GIF in an MP4 file")
+	}
+
+	// Failed writes must leave the files and their directories alone.
+	if b, _ := os.ReadFile(path); !bytes.Equal(b, data) {
+		t.Error("file was changed by a failed write")
+	}
+
+	for _, dir := range []string{filepath.Dir(path), filepath.Dir(mp4)} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal("failed to read dir:", err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("temporary files left in %s: %d entries", dir, len(entries))
+		}
+	}
+}
+
+func TestWriteUnsupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("this is definitely not an audio file"), 0644); err != nil {
+		t.Fatal("failed to write file:", err)
+	}
+
+	err := Write(path, Edit{Fields: map[Field]string{Title: "Title"}})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestKeepTotal(t *testing.T) {
+	tests := []struct {
+		old, v, expect string
+	}{
+		{"3/12", "5", "5/12"},
+		{"3/12", "5/10", "5/10"},
+		{"3", "5", "5"},
+		{"3/12", "", ""},
+		{"", "5", "5"},
+	}
+
+	for _, test := range tests {
+		if got := keepTotal(test.old, test.v); got != test.expect {
+			t.Errorf("keepTotal(%q, %q) = %q, want %q", test.old, test.v, got, test.expect)
+		}
+	}
+}
+
+// id3v23 returns an ID3v2.3 tag.
+func id3v23() []byte {
+	frames := [][2]string{
+		{"TIT2", "\x00Title"},
+		{"TPE1", "\x00Artist"},
+		{"TALB", "\x00Album"},
+		{"TCON", "\x00Jazz"},
+		{"TRCK", "\x003/12"},
+		{"APIC", "\x00image/jpeg\x00\x03\x00old picture"},
+	}
+
+	var body bytes.Buffer
+	for _, frame := range frames {
+		body.WriteString(frame[0])
+		binary.Write(&body, binary.BigEndian, uint32(len(frame[1])))
+		body.Write([]byte{0, 0}) // flags
+		body.WriteString(frame[1])
+	}
+	body.Write(make([]byte, 100)) // padding
+
+	var b bytes.Buffer
+	b.WriteString("ID3\x03\x00\x00")
+	b.Write(syncsafeBytes(body.Len()))
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+// makeMP3 makes two MPEG-1 Layer III frames followed by the audio data.
+func makeMP3() []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	return concat(frame, frame, audioData)
+}
+
+func vorbisCommentPacket(comments ...string) []byte {
+	c := vorbisComment{vendor: "test", comments: comments}
+	return c.bytes()
+}
+
+var testComments = []string{
+	"TITLE=Title",
+	"ARTIST=Artist",
+	"ALBUM=Album",
+	"GENRE=Jazz",
+	"TRACKNUMBER=3/12",
+}
+
+// makeFLAC makes a FLAC file with a picture and padding.
+func makeFLAC() []byte {
+	info := make([]byte, 34)
+	rate := uint64(44100)
+	binary.BigEndian.PutUint64(info[10:], rate<<44|1<<41|15<<36|10*rate)
+
+	comment := vorbisCommentPacket(testComments...)
+	picture := flacPicture(&Picture{MIMEType: "image/jpeg", Data: []byte("old picture")})
+
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	b.Write([]byte{flacStreamInfo, 0, 0, byte(len(info))})
+	b.Write(info)
+	b.Write([]byte{flacVorbisComment, 0, byte(len(comment) >> 8), byte(len(comment))})
+	b.Write(comment)
+	b.Write([]byte{flacPictureBlock, 0, byte(len(picture) >> 8), byte(len(picture))})
+	b.Write(picture)
+	b.Write([]byte{0x80 | flacPadding, 0, 0, 10})
+	b.Write(make([]byte, 10))
+	b.Write(audioData)
+	return b.Bytes()
+}
+
+// makeOgg makes an Ogg Vorbis or Opus file with the audio data in pages after
+// the headers.
+func makeOgg(opus bool) []byte {
+	var headers [][]byte
+
+	if opus {
+		id := make([]byte, 19)
+		copy(id, "OpusHead\x01\x02")
+		binary.LittleEndian.PutUint16(id[10:], 312)
+		binary.LittleEndian.PutUint32(id[12:], 44100)
+		headers = [][]byte{
+			id,
+			concat([]byte("OpusTags"), vorbisCommentPacket(testComments...)),
+		}
+	} else {
+		id := make([]byte, 30)
+		copy(id, "\x01vorbis\x00\x00\x00\x00\x02")
+		binary.LittleEndian.PutUint32(id[12:], 44100)
+		headers = [][]byte{
+			id,
+			concat([]byte("\x03vorbis"), vorbisCommentPacket(testComments...), []byte{1}),
+			[]byte("\x05vorbis setup"),
+		}
+	}
+
+	var b bytes.Buffer
+	b.Write(oggTestPage(0x02, 0, 0, headers[0]))
+	b.Write(oggTestPage(0x00, 0, 1, concat(headers[1:]...), headers[1:]...))
+
+	// Split the audio data into pages of 4000 bytes.
+	seq := uint32(2)
+	for data := audioData; len(data) > 0; seq++ {
+		n := 4000
+		if n > len(data) {
+			n = len(data)
+		}
+
+		typ := byte(0)
+		if n == len(data) {
+			typ = 0x04 // last page
+		}
+
+		b.Write(oggTestPage(typ, uint64(seq)*1000, seq, data[:n]))
+		data = data[n:]
+	}
+
+	return b.Bytes()
+}
+
+// oggTestPage makes a page of the given data. If packets are given, then the
+// data is laced as those packets.
+func oggTestPage(typ byte, granule uint64, seq uint32, data []byte, packets ...[]byte) []byte {
+	if packets == nil {
+		packets = [][]byte{data}
+	}
+
+	var segments []byte
+	for _, packet := range packets {
+		for n := len(packet); ; n -= 255 {
+			if n < 255 {
+				segments = append(segments, byte(n))
+				break
+			}
+			segments = append(segments, 255)
+		}
+	}
+
+	header := make([]byte, oggHeaderLen)
+	copy(header, "OggS")
+	header[5] = typ
+	binary.LittleEndian.PutUint64(header[6:], granule)
+	binary.LittleEndian.PutUint32(header[14:], 0x1234)
+	binary.LittleEndian.PutUint32(header[18:], seq)
+	header[26] = byte(len(segments))
+
+	page := oggPage{header: header, segments: segments, data: data}
+	page.updateCRC()
+
+	return concat(page.header, page.segments, page.data)
+}
+
+// makeMP4 makes an MP4 file with the moov atom before the media data, so the
+// chunk offsets must be shifted when the tags change.
+func makeMP4() []byte {
+	var mvhd bytes.Buffer
+	mvhd.Write(make([]byte, 12))                        // version, flags, times
+	binary.Write(&mvhd, binary.BigEndian, uint32(1000)) // timescale
+	binary.Write(&mvhd, binary.BigEndian, uint32(9500)) // duration
+	mvhd.Write(make([]byte, 80))
+
+	ilst := makeAtom("ilst", concat(
+		makeAtom("\xa9nam", makeAtom("data", concat([]byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("Title")))),
+		makeAtom("\xa9ART", makeAtom("data", concat([]byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("Artist")))),
+		makeAtom("\xa9alb", makeAtom("data", concat([]byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("Album")))),
+		makeAtom("\xa9gen", makeAtom("data", concat([]byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("Jazz")))),
+		makeAtom("trkn", makeAtom("data", []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 0, 12, 0, 0})),
+	))
+
+	hdlr := []byte("\x00\x00\x00\x00\x00\x00\x00\x00mdirappl\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	udta := makeAtom("udta", makeAtom("meta", concat([]byte{0, 0, 0, 0}, makeAtom("hdlr", hdlr), ilst)))
+
+	ftyp := makeAtom("ftyp", []byte("M4A \x00\x00\x00\x00"))
+
+	// The offset is patched in once the size of moov is known.
+	stco := makeAtom("stco", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0})
+	trak := makeAtom("trak", makeAtom("mdia", makeAtom("minf", makeAtom("stbl", stco))))
+
+	moov := makeAtom("moov", concat(makeAtom("mvhd", mvhd.Bytes()), trak, udta))
+
+	b := concat(ftyp, moov, makeAtom("mdat", audioData))
+
+	i := bytes.Index(b, []byte("stco"))
+	binary.BigEndian.PutUint32(b[i+12:], uint32(len(ftyp)+len(moov)+8))
+
+	return b
+}
+
+func makeAtom(typ string, data []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(8+len(data)))
+	b.WriteString(typ)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func concat(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
@@ -0,0 +1,198 @@
+package tagedit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// vorbisKeys maps the fields to their Vorbis comment names. The first name is
+// written, and all of them are removed when the field is changed.
+var vorbisKeys = [fieldCount][]string{
+	Title:       {"TITLE"},
+	Artist:      {"ARTIST"},
+	Album:       {"ALBUM"},
+	AlbumArtist: {"ALBUMARTIST", "ALBUM ARTIST", "ALBUM_ARTIST"},
+	Composer:    {"COMPOSER"},
+	Genre:       {"GENRE"},
+	Date:        {"DATE", "YEAR"},
+	Number:      {"TRACKNUMBER"},
+	Disc:        {"DISCNUMBER"},
+}
+
+// vorbisPictureKeys are the comments that contain embedded pictures in Ogg
+// files.
+var vorbisPictureKeys = []string{"METADATA_BLOCK_PICTURE", "COVERART", "COVERARTMIME"}
+
+// vorbisComment is a parsed Vorbis comment packet without the header type.
+type vorbisComment struct {
+	vendor   string
+	comments []string
+}
+
+// parseVorbisComment parses the Vorbis comment packet. The bytes after the
+// comments, such as the framing bit of Vorbis streams, are returned.
+func parseVorbisComment(b []byte) (vorbisComment, []byte, error) {
+	next := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return "", false
+		}
+
+		v := b[4 : 4+n]
+		b = b[4+n:]
+		return string(v), true
+	}
+
+	var c vorbisComment
+	var ok bool
+
+	if c.vendor, ok = next(); !ok {
+		return c, nil, errors.New("invalid vendor string")
+	}
+
+	if len(b) < 4 {
+		return c, nil, errors.New("missing comment count")
+	}
+
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+
+	for i := uint32(0); i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			return c, nil, errors.New("invalid comment")
+		}
+		c.comments = append(c.comments, comment)
+	}
+
+	return c, b, nil
+}
+
+// apply applies the edit to the comments. If pictures is true, then the picture
+// is embedded as a comment, which is how Ogg files embed pictures.
+func (c *vorbisComment) apply(edit Edit, pictures bool) {
+	edit.fields(func(field Field, value string) error {
+		old := c.remove(vorbisKeys[field])
+		if field.isNumber() {
+			value = keepTotal(old, value)
+		}
+		if value != "" {
+			c.comments = append(c.comments, vorbisKeys[field][0]+"="+value)
+		}
+		return nil
+	})
+
+	if pictures && edit.Picture != nil {
+		c.remove(vorbisPictureKeys)
+		block := base64.StdEncoding.EncodeToString(flacPicture(edit.Picture))
+		c.comments = append(c.comments, vorbisPictureKeys[0]+"="+block)
+	}
+}
+
+// r128Keys are the comments of Opus files that contain the gains relative to
+// the output gain in the header.
+var r128Keys = []string{"R128_TRACK_GAIN", "R128_ALBUM_GAIN"}
+
+// setReplayGain replaces the ReplayGain comments if rg isn't nil. If opus is
+// true, then the gains are written as R128 comments instead, which is what Opus
+// files use. The peaks are dropped then, since Opus has no tags for them.
+func (c *vorbisComment) setReplayGain(rg *ReplayGain, opus bool) {
+	if rg == nil {
+		return
+	}
+
+	c.remove(replayGainKeys)
+	c.remove(r128Keys)
+
+	if opus {
+		c.comments = append(c.comments,
+			r128Keys[0]+"="+strconv.Itoa(r128Gain(rg.TrackGain)),
+			r128Keys[1]+"="+strconv.Itoa(r128Gain(rg.AlbumGain)),
+		)
+		return
+	}
+
+	for _, tag := range rg.tags() {
+		c.comments = append(c.comments, tag[0]+"="+tag[1])
+	}
+}
+
+// r128Gain converts the ReplayGain gain to an R128 gain, which is a Q7.8 number
+// relative to -23 LUFS instead of -18 LUFS.
+func r128Gain(db float64) int {
+	q := math.Round((db - 5) * 256)
+	return int(math.Max(math.MinInt16, math.Min(math.MaxInt16, q)))
+}
+
+// remove removes the comments with any of the given names and returns the
+// value of the first one.
+func (c *vorbisComment) remove(keys []string) string {
+	var first string
+	var found bool
+
+	comments := c.comments[:0]
+
+	for _, comment := range c.comments {
+		parts := strings.SplitN(comment, "=", 2)
+		if len(parts) == 2 && containsFold(keys, parts[0]) {
+			if !found {
+				first = parts[1]
+				found = true
+			}
+			continue
+		}
+		comments = append(comments, comment)
+	}
+
+	c.comments = comments
+	return first
+}
+
+func (c *vorbisComment) bytes() []byte {
+	var b bytes.Buffer
+	writeString := func(s string) {
+		binary.Write(&b, binary.LittleEndian, uint32(len(s)))
+		b.WriteString(s)
+	}
+
+	writeString(c.vendor)
+	binary.Write(&b, binary.LittleEndian, uint32(len(c.comments)))
+	for _, comment := range c.comments {
+		writeString(comment)
+	}
+
+	return b.Bytes()
+}
+
+// flacPicture returns the picture as a FLAC PICTURE block without the block
+// header. The dimensions are left unknown.
+func flacPicture(p *Picture) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(pictureFront))
+	binary.Write(&b, binary.BigEndian, uint32(len(p.MIMEType)))
+	b.WriteString(p.MIMEType)
+	binary.Write(&b, binary.BigEndian, uint32(0)) // description
+	b.Write(make([]byte, 16))                     // width, height, depth, colors
+	binary.Write(&b, binary.BigEndian, uint32(len(p.Data)))
+	b.Write(p.Data)
+	return b.Bytes()
+}
+
+func containsFold(strs []string, str string) bool {
+	for _, s := range strs {
+		if strings.EqualFold(s, str) {
+			return true
+		}
+	}
+	return false
+}
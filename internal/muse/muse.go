@@ -8,7 +8,9 @@ import (
 	"github.com/pkg/errors"
 
 	_ "github.com/diamondburned/aqours/internal/muse/playlist/audpl"
+	_ "github.com/diamondburned/aqours/internal/muse/playlist/folder"
 	_ "github.com/diamondburned/aqours/internal/muse/playlist/m3u"
+	_ "github.com/diamondburned/aqours/internal/muse/playlist/smart"
 )
 
 var ErrNoPlaylistLoaded = errors.New("no playlist loaded")
@@ -93,3 +95,9 @@ func (s *Session) SetVolume(perc float64) error {
 func (s *Session) SetMute(muted bool) error {
 	return s.Playback.SetAsync("mute", muted, s.OnAsyncError)
 }
+
+// SetReplayGainFallback sets the gain in dB that is applied to files without
+// ReplayGain tags, such as the gain found by the loudness scanner.
+func (s *Session) SetReplayGainFallback(db float64) error {
+	return s.Playback.SetAsync("replaygain-fallback", db, s.OnAsyncError)
+}
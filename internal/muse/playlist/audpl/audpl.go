@@ -51,19 +51,53 @@ func Parse(path string) (*playlist.Playlist, error) {
 		bitrateKbit, _ := strconv.Atoi(track.Bitrate)
 
 		playlistCopy.Tracks = append(playlistCopy.Tracks, playlist.Track{
-			Title:    track.Title,
-			Artist:   track.Artist,
-			Album:    track.Album,
-			Number:   trackNum,
-			Length:   time.Duration(lengthMs) * time.Millisecond,
-			Bitrate:  bitrateKbit * 1000,
-			Filepath: path,
+			Title:       track.Title,
+			Artist:      track.Artist,
+			Album:       track.Album,
+			AlbumArtist: track.AlbumArtist,
+			Genre:       track.Genre,
+			Date:        track.Year,
+			Number:      trackNum,
+			Length:      time.Duration(lengthMs) * time.Millisecond,
+			Bitrate:     bitrateKbit * 1000,
+			SampleRate:  parseQuality(track.Quality),
+			Codec:       track.Codec,
+			Filepath:    path,
 		})
 	}
 
 	return &playlistCopy, nil
 }
 
+// year returns the year of the given date, since audpl only has the year.
+func year(date string) string {
+	if len(date) > 4 {
+		return date[:4]
+	}
+	return date
+}
+
+// quality formats the sample rate like Audacious does in the quality field,
+// which is otherwise free-form.
+func quality(sampleRate int) string {
+	if sampleRate <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d Hz", sampleRate)
+}
+
+// parseQuality parses the sample rate out of the quality field, which looks
+// like "Stereo, 44100 Hz". 0 is returned if there is none.
+func parseQuality(quality string) int {
+	for _, part := range strings.Split(quality, ",") {
+		var rate int
+		if _, err := fmt.Sscanf(strings.TrimSpace(part), "%d Hz", &rate); err == nil {
+			return rate
+		}
+	}
+	return 0
+}
+
 func Write(p *playlist.Playlist, done func(error)) error {
 	plist := audpl.Playlist{
 		Name:   p.Name,
@@ -75,9 +109,14 @@ func Write(p *playlist.Playlist, done func(error)) error {
 			Title:       track.Title,
 			Artist:      track.Artist,
 			Album:       track.Album,
+			AlbumArtist: track.AlbumArtist,
+			Genre:       track.Genre,
+			Year:        year(track.Date),
 			TrackNumber: strconv.Itoa(track.Number),
 			Length:      strconv.Itoa(int(track.Length / time.Millisecond)),
 			Bitrate:     strconv.Itoa(int(track.Bitrate / 1000)),
+			Codec:       track.Codec,
+			Quality:     quality(track.SampleRate),
 			URI:         fmt.Sprintf("file://%s", track.Filepath),
 		}
 	}
@@ -0,0 +1,96 @@
+// Package folder implements folder playlists, which are playlists that are kept
+// in sync with the audio files inside a directory tree.
+package folder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/pkg/errors"
+)
+
+// Extension is the file extension of folder playlists.
+const Extension = ".aqfolder"
+
+func init() {
+	playlist.Register(Extension, Parse, Write)
+}
+
+// file is the JSON structure of a folder playlist file.
+type file struct {
+	Name   string  `json:"name"`
+	Source *Source `json:"source"`
+}
+
+func Parse(path string) (*playlist.Playlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	f.SetDeadline(time.Now().Add(15 * time.Second))
+
+	var folder file
+	if err := json.NewDecoder(f).Decode(&folder); err != nil {
+		return nil, errors.Wrap(err, "failed to decode folder playlist")
+	}
+
+	if folder.Source == nil || folder.Source.Root == "" {
+		return nil, errors.New("folder playlist has no root directory")
+	}
+
+	if folder.Name == "" {
+		folder.Name = playlist.TitleFromPath(path)
+	}
+
+	paths, err := folder.Source.Scan()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan folder")
+	}
+
+	tracks := make([]playlist.Track, len(paths))
+	for i, path := range paths {
+		tracks[i] = playlist.Track{
+			Title:    playlist.TitleFromPath(path),
+			Filepath: path,
+		}
+	}
+
+	return &playlist.Playlist{
+		Name:   folder.Name,
+		Path:   path,
+		Tracks: tracks,
+		Source: folder.Source,
+	}, nil
+}
+
+func Write(p *playlist.Playlist, done func(error)) error {
+	source, ok := p.Source.(*Source)
+	if !ok {
+		return errors.New("playlist is not a folder playlist")
+	}
+
+	b, err := json.MarshalIndent(file{
+		Name:   p.Name,
+		Source: source,
+	}, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode folder playlist")
+	}
+
+	playlist.WriteFile(p.Path, b, done)
+	return nil
+}
+
+var slashesc = strings.NewReplacer("/", "∕", `\`, "⧵").Replace
+
+// PathFromName returns the path to a new folder playlist with the given name
+// inside the given directory.
+func PathFromName(dir, name string) string {
+	return filepath.Join(dir, slashesc(name)+Extension)
+}
@@ -0,0 +1,223 @@
+package folder
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// DefaultExtensions is the list of file extensions that are used if a Source
+// has none.
+var DefaultExtensions = []string{
+	".aac", ".aiff", ".alac", ".ape", ".flac", ".m4a", ".mka", ".mp3",
+	".mpc", ".oga", ".ogg", ".opus", ".tak", ".wav", ".wma", ".wv",
+}
+
+// SortOrder is the order of the tracks inside a folder playlist.
+type SortOrder string
+
+const (
+	// SortPath sorts tracks by their full path, which keeps tracks in the same
+	// directory together.
+	SortPath SortOrder = "path"
+	// SortName sorts tracks by their file name only.
+	SortName SortOrder = "name"
+	// SortModified sorts tracks by their modification time.
+	SortModified SortOrder = "modified"
+)
+
+// SortOrders is the list of all sort orders.
+var SortOrders = []SortOrder{SortPath, SortName, SortModified}
+
+// debounce is the duration to wait after a file change before rescanning.
+// Copying an album creates many events at once, so we only want one rescan.
+const debounce = time.Second
+
+// Source is a directory tree that a folder playlist is kept in sync with.
+type Source struct {
+	// Root is the root directory.
+	Root string `json:"root"`
+	// Extensions is the list of file extensions to include, including the
+	// dot. DefaultExtensions is used if this is empty.
+	Extensions []string `json:"extensions,omitempty"`
+	// Sort is the order of the tracks. SortPath is used if this is empty.
+	Sort SortOrder `json:"sort,omitempty"`
+	// Descending reverses the sort order.
+	Descending bool `json:"descending,omitempty"`
+}
+
+var _ playlist.Source = (*Source)(nil)
+
+// Match returns true if the file at the given path should be included.
+func (s *Source) Match(path string) bool {
+	exts := s.Extensions
+	if len(exts) == 0 {
+		exts = DefaultExtensions
+	}
+
+	ext := filepath.Ext(path)
+	for _, e := range exts {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scan implements playlist.Source.
+func (s *Source) Scan() ([]string, error) {
+	if _, err := os.Stat(s.Root); err != nil {
+		return nil, errors.Wrap(err, "cannot stat root")
+	}
+
+	all := Walk(s.Root)
+	paths := all[:0]
+
+	for _, path := range all {
+		if s.Match(path) {
+			paths = append(paths, path)
+		}
+	}
+
+	s.sort(paths)
+	return paths, nil
+}
+
+func (s *Source) sort(paths []string) {
+	var less func(i, j int) bool
+
+	switch s.Sort {
+	case SortName:
+		less = func(i, j int) bool {
+			return filepath.Base(paths[i]) < filepath.Base(paths[j])
+		}
+	case SortModified:
+		modTimes := make(map[string]time.Time, len(paths))
+		for _, path := range paths {
+			if s, err := os.Stat(path); err == nil {
+				modTimes[path] = s.ModTime()
+			}
+		}
+		less = func(i, j int) bool {
+			return modTimes[paths[i]].Before(modTimes[paths[j]])
+		}
+	default:
+		less = func(i, j int) bool { return paths[i] < paths[j] }
+	}
+
+	if s.Descending {
+		sort.SliceStable(paths, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(paths, less)
+	}
+}
+
+// Watch implements playlist.Source. It watches the whole tree using inotify.
+func (s *Source) Watch(ctx context.Context, changed func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "failed to create watcher")
+	}
+	defer w.Close()
+
+	if err := watchTree(w, s.Root); err != nil {
+		return errors.Wrap(err, "failed to watch root")
+	}
+
+	var rescan <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+
+			if ev.Op&fsnotify.Create != 0 {
+				// Watch new directories. Removed directories are unwatched
+				// automatically.
+				if s, err := os.Stat(ev.Name); err == nil && s.IsDir() {
+					if err := watchTree(w, ev.Name); err != nil {
+						log.Println("failed to watch new directory:", err)
+					}
+				}
+			}
+
+			rescan = time.After(debounce)
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			log.Println("folder watcher error:", err)
+
+		case <-rescan:
+			rescan = nil
+			changed()
+		}
+	}
+}
+
+// watchTree adds all directories in the given tree into the watcher.
+func watchTree(w *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.Add(path)
+		}
+		return nil
+	})
+}
+
+// Walk walks the given paths recursively and returns all the files found.
+// Paths that are files are returned as-is. It does blocking IO.
+func Walk(paths ...string) []string {
+	walkedPaths := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		s, err := os.Stat(path)
+		if err != nil {
+			log.Println("cannot stat adding path:", err)
+			continue
+		}
+
+		if !s.IsDir() {
+			walkedPaths = append(walkedPaths, path)
+			continue
+		}
+
+		err = fs.WalkDir(
+			os.DirFS("/"), strings.TrimPrefix(path, "/"), // fs to os
+			func(path string, s fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !s.IsDir() {
+					walkedPaths = append(walkedPaths, "/"+path)
+				}
+				return nil
+			},
+		)
+		if err != nil {
+			log.Println("cannot walk adding path:", err)
+			continue
+		}
+	}
+
+	return walkedPaths
+}
@@ -0,0 +1,92 @@
+package folder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSourceScan(t *testing.T) {
+	root := t.TempDir()
+
+	files := []string{
+		"b/02.flac",
+		"b/01.MP3",
+		"a/cover.jpg",
+		"a/03.opus",
+		"00.ogg",
+	}
+
+	now := time.Now()
+
+	for i, file := range files {
+		path := filepath.Join(root, file)
+
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Make the modification times follow the order above.
+		mtime := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		source Source
+		expect []string
+	}{
+		{
+			name:   "path",
+			source: Source{},
+			expect: []string{"00.ogg", "a/03.opus", "b/01.MP3", "b/02.flac"},
+		},
+		{
+			name:   "path descending",
+			source: Source{Descending: true},
+			expect: []string{"b/02.flac", "b/01.MP3", "a/03.opus", "00.ogg"},
+		},
+		{
+			name:   "name",
+			source: Source{Sort: SortName},
+			expect: []string{"00.ogg", "b/01.MP3", "b/02.flac", "a/03.opus"},
+		},
+		{
+			name:   "modified",
+			source: Source{Sort: SortModified},
+			expect: []string{"b/02.flac", "b/01.MP3", "a/03.opus", "00.ogg"},
+		},
+		{
+			name:   "extensions",
+			source: Source{Extensions: []string{".mp3", ".jpg"}},
+			expect: []string{"a/cover.jpg", "b/01.MP3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.source.Root = root
+
+			paths, err := test.source.Scan()
+			if err != nil {
+				t.Fatal("failed to scan:", err)
+			}
+
+			for i, path := range paths {
+				paths[i] = strings.TrimPrefix(path, root+"/")
+			}
+
+			if strings.Join(paths, " ") != strings.Join(test.expect, " ") {
+				t.Errorf("got      %q", paths)
+				t.Errorf("expected %q", test.expect)
+			}
+		})
+	}
+}
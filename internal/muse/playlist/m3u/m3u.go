@@ -110,6 +110,8 @@ func Write(p *playlist.Playlist, done func(error)) error {
 		}
 	}
 
+	// Extended M3U only has the title and the length of each track, so the
+	// rest of the metadata is left to the metadata store.
 	var plist = make(m3u.Playlist, len(p.Tracks))
 
 	for i, track := range p.Tracks {
@@ -1,6 +1,7 @@
 package playlist
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"path/filepath"
@@ -51,6 +52,33 @@ type Playlist struct {
 	Name   string
 	Path   string
 	Tracks []Track
+
+	// Generator, if not nil, generates the playlist's tracks instead of
+	// Tracks. Writers of generated playlists don't write any track.
+	Generator Generator
+	// Source, if not nil, is the source that the playlist's tracks are kept in
+	// sync with. Writers of these playlists don't write any track.
+	Source Source
+}
+
+// Source is an external source of tracks that a playlist is kept in sync with,
+// such as a directory.
+type Source interface {
+	// Scan returns the paths of all tracks in the source in order. It does
+	// blocking IO.
+	Scan() ([]string, error)
+	// Watch watches the source until ctx is cancelled. changed is called in an
+	// arbitrary goroutine when the source might have changed, after which
+	// Scan should be called again.
+	Watch(ctx context.Context, changed func()) error
+}
+
+// Generator generates a playlist's tracks out of all known tracks, such as a
+// smart playlist that matches tracks by their metadata.
+type Generator interface {
+	// Generate returns the tracks that belong to the playlist in order. The
+	// given slice may be modified.
+	Generate(tracks []Track) []Track
 }
 
 // Save saves the playlist. The function must not be called in another
@@ -2,7 +2,9 @@ package playlist
 
 import (
 	"encoding/binary"
+	"math"
 	"math/rand"
+	"sort"
 	"time"
 
 	cryptorand "crypto/rand"
@@ -21,15 +23,186 @@ func trueRandSeed() (seed int64) {
 	return time.Now().UnixNano()
 }
 
-// TODO: stateful shuffler
+// Shuffler shuffles a play queue, which is a list of indices into tracks. All
+// randomness comes from rng, so a shuffle is deterministic for a given seed.
+type Shuffler interface {
+	Shuffle(rng *rand.Rand, queue []int, tracks []Track)
+}
+
+// UniformShuffler shuffles the tracks uniformly.
+type UniformShuffler struct{}
 
-// ShuffleQueue shuffles the given list of track indices.
-func ShuffleQueue(queue []int) {
-	rand.Shuffle(len(queue), func(i, j int) {
+func (UniformShuffler) Shuffle(rng *rand.Rand, queue []int, tracks []Track) {
+	rng.Shuffle(len(queue), func(i, j int) {
 		queue[i], queue[j] = queue[j], queue[i]
 	})
 }
 
+// AlbumShuffler shuffles the albums, and the tracks of each album are played
+// in order. Tracks without an album are shuffled as albums of their own.
+type AlbumShuffler struct{}
+
+func (AlbumShuffler) Shuffle(rng *rand.Rand, queue []int, tracks []Track) {
+	var albums [][]int
+	albumIxs := make(map[[2]string]int)
+
+	for _, ix := range queue {
+		t := &tracks[ix]
+		if t.Album == "" {
+			albums = append(albums, []int{ix})
+			continue
+		}
+
+		key := [2]string{t.AlbumArtistOrArtist(), t.Album}
+
+		i, ok := albumIxs[key]
+		if !ok {
+			i = len(albums)
+			albumIxs[key] = i
+			albums = append(albums, nil)
+		}
+
+		albums[i] = append(albums[i], ix)
+	}
+
+	for _, album := range albums {
+		sortAlbum(album, tracks)
+	}
+
+	rng.Shuffle(len(albums), func(i, j int) {
+		albums[i], albums[j] = albums[j], albums[i]
+	})
+
+	queue = queue[:0]
+	for _, album := range albums {
+		queue = append(queue, album...)
+	}
+}
+
+// sortAlbum sorts the tracks of an album by their disc and track numbers. The
+// tracks are kept in their order if any of them has no track number.
+func sortAlbum(album []int, tracks []Track) {
+	for _, ix := range album {
+		if tracks[ix].Number == 0 {
+			return
+		}
+	}
+
+	sort.SliceStable(album, func(i, j int) bool {
+		a := &tracks[album[i]]
+		b := &tracks[album[j]]
+		if a.Disc != b.Disc {
+			return a.Disc < b.Disc
+		}
+		return a.Number < b.Number
+	})
+}
+
+// ArtistSpreader shuffles the tracks while spreading out the tracks of each
+// artist, so the same artist is never played twice in a row unless there are
+// too few other artists left.
+type ArtistSpreader struct{}
+
+func (ArtistSpreader) Shuffle(rng *rand.Rand, queue []int, tracks []Track) {
+	var artists [][]int
+	artistIxs := make(map[string]int)
+
+	for _, ix := range queue {
+		artist := tracks[ix].Artist
+
+		i, ok := artistIxs[artist]
+		// Tracks without an artist are by anyone.
+		if !ok || artist == "" {
+			i = len(artists)
+			artistIxs[artist] = i
+			artists = append(artists, nil)
+		}
+
+		artists[i] = append(artists[i], ix)
+	}
+
+	for _, artist := range artists {
+		UniformShuffler{}.Shuffle(rng, artist, tracks)
+	}
+
+	last := -1
+	left := len(queue)
+	queue = queue[:0]
+
+	for ; left > 0; left-- {
+		next := pickArtist(rng, artists, last, left)
+		queue = append(queue, artists[next][0])
+		artists[next] = artists[next][1:]
+		last = next
+	}
+}
+
+// pickArtist picks the artist of the next track, which isn't the last artist if
+// possible. An artist with more than half of the tracks left is picked first,
+// so their tracks don't end up played in a row at the end. Otherwise, artists
+// are picked by how many tracks they have left.
+func pickArtist(rng *rand.Rand, artists [][]int, last, left int) int {
+	total := 0
+	for i, artist := range artists {
+		if i == last {
+			continue
+		}
+		if 2*len(artist) > left {
+			return i
+		}
+		total += len(artist)
+	}
+
+	// Only the last artist has tracks left.
+	if total == 0 {
+		return last
+	}
+
+	n := rng.Intn(total)
+	for i, artist := range artists {
+		if i == last {
+			continue
+		}
+		if n < len(artist) {
+			return i
+		}
+		n -= len(artist)
+	}
+
+	return last
+}
+
+// WeightedShuffler shuffles the tracks so that tracks that were played fewer
+// times or are rated higher are more likely to be played earlier.
+type WeightedShuffler struct{}
+
+// weight returns the weight of the track in the weighted shuffle. Unrated
+// tracks weigh as much as tracks rated in the middle, so that they aren't
+// played later than tracks rated lower.
+func (WeightedShuffler) weight(t *Track) float64 {
+	rating := t.Rating
+	if rating == 0 {
+		rating = 50
+	}
+	// A rating of 100 weighs as much as 5 times a rating of 1.
+	return (1 + float64(rating)/25) / float64(1+t.PlayCount)
+}
+
+func (s WeightedShuffler) Shuffle(rng *rand.Rand, queue []int, tracks []Track) {
+	// Each track gets the key u^(1/w) for a uniform u in (0, 1], which orders
+	// the tracks as if they were drawn one by one with the probability of
+	// their weight w. The keys are compared as ln(u)/w instead.
+	keys := make(map[int]float64, len(queue))
+	for _, ix := range queue {
+		w := s.weight(&tracks[ix])
+		keys[ix] = math.Log(1-rng.Float64()) / w
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		return keys[queue[i]] > keys[queue[j]]
+	})
+}
+
 // ResetQueue resets the queue to the usual incremental order.
 func ResetQueue(queue []int) {
 	for i := 0; i < len(queue); i++ {
@@ -0,0 +1,162 @@
+package playlist
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func newQueue(n int) []int {
+	queue := make([]int, n)
+	ResetQueue(queue)
+	return queue
+}
+
+func assertPermutation(t *testing.T, queue []int) {
+	t.Helper()
+
+	sorted := append([]int(nil), queue...)
+	sort.Ints(sorted)
+
+	if !reflect.DeepEqual(sorted, newQueue(len(queue))) {
+		t.Fatal("queue is not a permutation:", queue)
+	}
+}
+
+func TestShufflerDeterministic(t *testing.T) {
+	tracks := []Track{
+		{Artist: "a", Album: "x", Number: 1},
+		{Artist: "a", Album: "x", Number: 2},
+		{Artist: "b", Album: "y", Number: 1},
+		{Artist: "c", Album: "z", Number: 1},
+		{Artist: "b", PlayCount: 3},
+		{Artist: "c", PlayCount: 1},
+	}
+
+	shufflers := []Shuffler{
+		UniformShuffler{},
+		AlbumShuffler{},
+		ArtistSpreader{},
+		WeightedShuffler{},
+	}
+
+	for _, shuffler := range shufflers {
+		a := newQueue(len(tracks))
+		shuffler.Shuffle(rand.New(rand.NewSource(42)), a, tracks)
+		assertPermutation(t, a)
+
+		b := newQueue(len(tracks))
+		shuffler.Shuffle(rand.New(rand.NewSource(42)), b, tracks)
+
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("%T isn't deterministic: %v != %v", shuffler, a, b)
+		}
+	}
+}
+
+func TestAlbumShuffler(t *testing.T) {
+	tracks := []Track{
+		{AlbumArtist: "Aqours", Album: "A", Number: 2},
+		{AlbumArtist: "Aqours", Album: "B", Number: 1},
+		{AlbumArtist: "Aqours", Album: "A", Number: 1},
+		{Title: "single"},
+		{AlbumArtist: "Aqours", Album: "B", Number: 2},
+		{AlbumArtist: "Aqours", Album: "A", Disc: 2, Number: 1},
+	}
+
+	for seed := int64(0); seed < 20; seed++ {
+		queue := newQueue(len(tracks))
+		AlbumShuffler{}.Shuffle(rand.New(rand.NewSource(seed)), queue, tracks)
+		assertPermutation(t, queue)
+
+		albums := map[string][]int{}
+		var order []string
+
+		for _, ix := range queue {
+			album := tracks[ix].Album
+			if len(order) == 0 || order[len(order)-1] != album {
+				order = append(order, album)
+			}
+			albums[album] = append(albums[album], ix)
+		}
+
+		// Each album is played at once.
+		if len(order) != 3 {
+			t.Fatalf("albums are split up: %v", queue)
+		}
+
+		if !reflect.DeepEqual(albums["A"], []int{2, 0, 5}) {
+			t.Fatalf("album A isn't in track order: %v", albums["A"])
+		}
+		if !reflect.DeepEqual(albums["B"], []int{1, 4}) {
+			t.Fatalf("album B isn't in track order: %v", albums["B"])
+		}
+	}
+}
+
+func TestArtistSpreader(t *testing.T) {
+	var tracks []Track
+	for _, artist := range []string{"a", "a", "a", "a", "b", "b", "b", "c", "c", "d"} {
+		tracks = append(tracks, Track{Artist: artist})
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		queue := newQueue(len(tracks))
+		ArtistSpreader{}.Shuffle(rand.New(rand.NewSource(seed)), queue, tracks)
+		assertPermutation(t, queue)
+
+		for i := 1; i < len(queue); i++ {
+			if tracks[queue[i]].Artist == tracks[queue[i-1]].Artist {
+				t.Fatalf("seed %d: artist %q is played twice in a row: %v",
+					seed, tracks[queue[i]].Artist, queue)
+			}
+		}
+	}
+}
+
+func TestWeightedShuffler(t *testing.T) {
+	tracks := []Track{
+		{Title: "played", PlayCount: 50},
+		{Title: "new"},
+	}
+
+	var newFirst int
+
+	for seed := int64(0); seed < 200; seed++ {
+		queue := newQueue(len(tracks))
+		WeightedShuffler{}.Shuffle(rand.New(rand.NewSource(seed)), queue, tracks)
+		assertPermutation(t, queue)
+
+		if queue[0] == 1 {
+			newFirst++
+		}
+	}
+
+	// The new track has 51 times the weight, so it should almost always be
+	// first.
+	if newFirst < 180 {
+		t.Fatalf("new track is first %d of 200 times", newFirst)
+	}
+
+	tracks = []Track{
+		{Title: "disliked", Rating: 1},
+		{Title: "favorite", Rating: 100},
+	}
+
+	var favoriteFirst int
+
+	for seed := int64(0); seed < 200; seed++ {
+		queue := newQueue(len(tracks))
+		WeightedShuffler{}.Shuffle(rand.New(rand.NewSource(seed)), queue, tracks)
+
+		if queue[0] == 1 {
+			favoriteFirst++
+		}
+	}
+
+	// The favorite track has about 5 times the weight.
+	if favoriteFirst < 140 {
+		t.Fatalf("favorite track is first %d of 200 times", favoriteFirst)
+	}
+}
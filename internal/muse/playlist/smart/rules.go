@@ -0,0 +1,337 @@
+package smart
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+)
+
+var slashesc = strings.NewReplacer("/", "∕", `\`, "⧵").Replace
+
+// Rules is a set of rules that tracks are matched against. The zero value
+// matches every track.
+type Rules struct {
+	// MatchAny, if true, matches tracks that satisfy any of the conditions
+	// instead of all of them.
+	MatchAny bool `json:"match_any,omitempty"`
+
+	Fields     []FieldRule      `json:"fields,omitempty"`
+	Length     *DurationRange   `json:"length,omitempty"`
+	PlayCount  *PlayCountRange  `json:"play_count,omitempty"`
+	LastPlayed *LastPlayedRange `json:"last_played,omitempty"`
+
+	// Sort is the list of keys to sort the matched tracks with, with the first
+	// one having the highest priority. Tracks are sorted by path otherwise.
+	Sort []SortKey `json:"sort,omitempty"`
+	// Limit limits the number of tracks if it's more than 0.
+	Limit int `json:"limit,omitempty"`
+}
+
+var _ playlist.Generator = (*Rules)(nil)
+
+// Field is a string field of a track.
+type Field string
+
+const (
+	FieldTitle  Field = "title"
+	FieldArtist Field = "artist"
+	FieldAlbum  Field = "album"
+	FieldGenre  Field = "genre"
+	FieldDate   Field = "date"
+)
+
+// Fields is the list of all string fields.
+var Fields = []Field{FieldTitle, FieldArtist, FieldAlbum, FieldGenre, FieldDate}
+
+// Value returns the value of the field from the given track.
+func (f Field) Value(t *playlist.Track) string {
+	switch f {
+	case FieldTitle:
+		return t.Title
+	case FieldArtist:
+		return t.Artist
+	case FieldAlbum:
+		return t.Album
+	case FieldGenre:
+		return t.Genre
+	case FieldDate:
+		return t.Date
+	default:
+		return ""
+	}
+}
+
+// Op is a string comparison operator. All comparisons are case-insensitive.
+type Op string
+
+const (
+	OpIs          Op = "is"
+	OpIsNot       Op = "is_not"
+	OpContains    Op = "contains"
+	OpNotContains Op = "not_contains"
+	OpStartsWith  Op = "starts_with"
+)
+
+// Ops is the list of all operators.
+var Ops = []Op{OpIs, OpIsNot, OpContains, OpNotContains, OpStartsWith}
+
+// FieldRule matches a string field of the track.
+type FieldRule struct {
+	Field Field  `json:"field"`
+	Op    Op     `json:"op"`
+	Value string `json:"value"`
+}
+
+// Match returns true if the track matches the rule.
+func (r FieldRule) Match(t *playlist.Track) bool {
+	v := strings.ToLower(r.Field.Value(t))
+	m := strings.ToLower(r.Value)
+
+	switch r.Op {
+	case OpIs:
+		return v == m
+	case OpIsNot:
+		return v != m
+	case OpContains:
+		return strings.Contains(v, m)
+	case OpNotContains:
+		return !strings.Contains(v, m)
+	case OpStartsWith:
+		return strings.HasPrefix(v, m)
+	default:
+		return false
+	}
+}
+
+// Duration is a time.Duration that is encoded as a string in JSON, such as
+// "3m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// DurationRange matches the track length. A zero bound is unbounded.
+type DurationRange struct {
+	Min Duration `json:"min,omitempty"`
+	Max Duration `json:"max,omitempty"`
+}
+
+// Match returns true if the track length is within the range.
+func (r DurationRange) Match(t *playlist.Track) bool {
+	if r.Min > 0 && t.Length < time.Duration(r.Min) {
+		return false
+	}
+	if r.Max > 0 && t.Length > time.Duration(r.Max) {
+		return false
+	}
+	return true
+}
+
+// PlayCountRange matches the play count. A nil bound is unbounded.
+type PlayCountRange struct {
+	Min *int `json:"min,omitempty"`
+	Max *int `json:"max,omitempty"`
+}
+
+// Match returns true if the play count is within the range.
+func (r PlayCountRange) Match(t *playlist.Track) bool {
+	if r.Min != nil && t.PlayCount < *r.Min {
+		return false
+	}
+	if r.Max != nil && t.PlayCount > *r.Max {
+		return false
+	}
+	return true
+}
+
+// LastPlayedRange matches the time since the track was last played. Tracks that
+// were never played are considered played infinitely long ago. A zero bound is
+// unbounded.
+type LastPlayedRange struct {
+	// Within matches tracks played within the duration.
+	Within Duration `json:"within,omitempty"`
+	// NotWithin matches tracks not played within the duration.
+	NotWithin Duration `json:"not_within,omitempty"`
+}
+
+// Match returns true if the track was last played within the range.
+func (r LastPlayedRange) Match(t *playlist.Track, now time.Time) bool {
+	played := t.LastPlayedTime()
+
+	if r.Within > 0 {
+		if played.IsZero() || now.Sub(played) > time.Duration(r.Within) {
+			return false
+		}
+	}
+	if r.NotWithin > 0 {
+		if !played.IsZero() && now.Sub(played) <= time.Duration(r.NotWithin) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SortField is a field that tracks can be sorted with.
+type SortField string
+
+const (
+	SortTitle      SortField = "title"
+	SortArtist     SortField = "artist"
+	SortAlbum      SortField = "album"
+	SortGenre      SortField = "genre"
+	SortDate       SortField = "date"
+	SortNumber     SortField = "number"
+	SortLength     SortField = "length"
+	SortPlayCount  SortField = "play_count"
+	SortLastPlayed SortField = "last_played"
+)
+
+// SortFields is the list of all sort fields.
+var SortFields = []SortField{
+	SortTitle, SortArtist, SortAlbum, SortGenre, SortDate,
+	SortNumber, SortLength, SortPlayCount, SortLastPlayed,
+}
+
+// SortKey is a single sort key.
+type SortKey struct {
+	Field      SortField `json:"field"`
+	Descending bool      `json:"descending,omitempty"`
+}
+
+// compare compares the two tracks by the key. It returns a negative number if
+// a comes before b, a positive number if after, and 0 if equal.
+func (k SortKey) compare(a, b *playlist.Track) int {
+	var c int
+
+	switch k.Field {
+	case SortTitle:
+		c = compareFold(a.Title, b.Title)
+	case SortArtist:
+		c = compareFold(a.Artist, b.Artist)
+	case SortAlbum:
+		c = compareFold(a.Album, b.Album)
+	case SortGenre:
+		c = compareFold(a.Genre, b.Genre)
+	case SortDate:
+		c = compareFold(a.Date, b.Date)
+	case SortNumber:
+		c = playlist.ComparePosition(a, b)
+	case SortLength:
+		c = compareInt(int64(a.Length), int64(b.Length))
+	case SortPlayCount:
+		c = compareInt(int64(a.PlayCount), int64(b.PlayCount))
+	case SortLastPlayed:
+		c = compareInt(a.LastPlayed, b.LastPlayed)
+	}
+
+	if k.Descending {
+		c = -c
+	}
+
+	return c
+}
+
+func compareFold(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Match returns true if the track matches the rules at the given time.
+func (r *Rules) Match(t *playlist.Track, now time.Time) bool {
+	// matches is called for each condition. It returns true if the matching
+	// should stop, which is when the result is already known.
+	var matched bool
+	var tested bool
+
+	matches := func(ok bool) (stop bool) {
+		tested = true
+		matched = ok
+		// Stop on the first match if MatchAny, else stop on the first
+		// mismatch.
+		return ok == r.MatchAny
+	}
+
+	for _, field := range r.Fields {
+		if matches(field.Match(t)) {
+			return matched
+		}
+	}
+
+	if r.Length != nil && matches(r.Length.Match(t)) {
+		return matched
+	}
+
+	if r.PlayCount != nil && matches(r.PlayCount.Match(t)) {
+		return matched
+	}
+
+	if r.LastPlayed != nil && matches(r.LastPlayed.Match(t, now)) {
+		return matched
+	}
+
+	// Match everything if there are no conditions.
+	return !tested || matched
+}
+
+// Generate implements playlist.Generator.
+func (r *Rules) Generate(tracks []playlist.Track) []playlist.Track {
+	return r.generate(tracks, time.Now())
+}
+
+func (r *Rules) generate(tracks []playlist.Track, now time.Time) []playlist.Track {
+	matched := tracks[:0]
+
+	for i := range tracks {
+		if r.Match(&tracks[i], now) {
+			matched = append(matched, tracks[i])
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := &matched[i], &matched[j]
+
+		for _, key := range r.Sort {
+			if c := key.compare(a, b); c != 0 {
+				return c < 0
+			}
+		}
+
+		return a.Filepath < b.Filepath
+	})
+
+	if r.Limit > 0 && len(matched) > r.Limit {
+		matched = matched[:r.Limit]
+	}
+
+	return matched
+}
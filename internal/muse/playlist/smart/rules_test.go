@@ -0,0 +1,154 @@
+package smart
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/go-test/deep"
+)
+
+var testNow = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var testTracks = []playlist.Track{
+	{
+		Filepath: "/a", Title: "Aqours", Artist: "Aqours", Album: "Mijuku Dreamer",
+		Genre: "J-Pop", Date: "2016", Number: 2, Length: 4 * time.Minute,
+		PlayCount: 10, LastPlayed: testNow.Add(-time.Hour).Unix(),
+	},
+	{
+		Filepath: "/b", Title: "Snow halation", Artist: "μ's", Album: "Snow halation",
+		Genre: "J-Pop", Date: "2010", Number: 1, Length: 5 * time.Minute,
+		PlayCount: 3, LastPlayed: testNow.Add(-30 * 24 * time.Hour).Unix(),
+	},
+	{
+		Filepath: "/c", Title: "So What", Artist: "Miles Davis", Album: "Kind of Blue",
+		Genre: "Jazz", Date: "1959", Number: 1, Length: 9 * time.Minute,
+	},
+}
+
+func intPtr(i int) *int { return &i }
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  Rules
+		expect []string
+	}{
+		{
+			name:   "empty",
+			rules:  Rules{},
+			expect: []string{"/a", "/b", "/c"},
+		},
+		{
+			name: "field",
+			rules: Rules{Fields: []FieldRule{
+				{Field: FieldGenre, Op: OpIs, Value: "j-pop"},
+			}},
+			expect: []string{"/a", "/b"},
+		},
+		{
+			name: "fields all",
+			rules: Rules{Fields: []FieldRule{
+				{Field: FieldGenre, Op: OpIs, Value: "j-pop"},
+				{Field: FieldDate, Op: OpStartsWith, Value: "201"},
+				{Field: FieldArtist, Op: OpNotContains, Value: "aqours"},
+			}},
+			expect: []string{"/b"},
+		},
+		{
+			name: "fields any",
+			rules: Rules{
+				MatchAny: true,
+				Fields: []FieldRule{
+					{Field: FieldAlbum, Op: OpContains, Value: "blue"},
+					{Field: FieldTitle, Op: OpIs, Value: "aqours"},
+				},
+			},
+			expect: []string{"/a", "/c"},
+		},
+		{
+			name: "length",
+			rules: Rules{Length: &DurationRange{
+				Min: Duration(4*time.Minute + 30*time.Second),
+			}},
+			expect: []string{"/b", "/c"},
+		},
+		{
+			name:   "never played",
+			rules:  Rules{PlayCount: &PlayCountRange{Max: intPtr(0)}},
+			expect: []string{"/c"},
+		},
+		{
+			name: "played this week",
+			rules: Rules{LastPlayed: &LastPlayedRange{
+				Within: Duration(7 * 24 * time.Hour),
+			}},
+			expect: []string{"/a"},
+		},
+		{
+			name: "not played this week",
+			rules: Rules{LastPlayed: &LastPlayedRange{
+				NotWithin: Duration(7 * 24 * time.Hour),
+			}},
+			expect: []string{"/b", "/c"},
+		},
+		{
+			name: "sort and limit",
+			rules: Rules{
+				Sort:  []SortKey{{Field: SortLength, Descending: true}},
+				Limit: 2,
+			},
+			expect: []string{"/c", "/b"},
+		},
+		{
+			name: "multiple sort keys",
+			rules: Rules{
+				Sort: []SortKey{{Field: SortNumber}, {Field: SortDate}},
+			},
+			expect: []string{"/c", "/b", "/a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracks := append([]playlist.Track(nil), testTracks...)
+			tracks = test.rules.generate(tracks, testNow)
+
+			paths := make([]string, len(tracks))
+			for i, track := range tracks {
+				paths[i] = track.Filepath
+			}
+
+			if ineqs := deep.Equal(paths, test.expect); ineqs != nil {
+				t.Errorf("got %q, expected %q", paths, test.expect)
+			}
+		})
+	}
+}
+
+func TestRulesJSON(t *testing.T) {
+	rules := Rules{
+		Fields:     []FieldRule{{Field: FieldArtist, Op: OpIs, Value: "Aqours"}},
+		Length:     &DurationRange{Max: Duration(3*time.Minute + 30*time.Second)},
+		PlayCount:  &PlayCountRange{Min: intPtr(0)},
+		LastPlayed: &LastPlayedRange{NotWithin: Duration(24 * time.Hour)},
+		Sort:       []SortKey{{Field: SortPlayCount, Descending: true}},
+		Limit:      25,
+	}
+
+	b, err := json.Marshal(rules)
+	if err != nil {
+		t.Fatal("failed to marshal:", err)
+	}
+
+	var got Rules
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal("failed to unmarshal:", err)
+	}
+
+	if ineqs := deep.Equal(got, rules); ineqs != nil {
+		t.Errorf("rules mismatch after round trip: %v", ineqs)
+	}
+}
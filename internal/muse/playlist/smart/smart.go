@@ -0,0 +1,79 @@
+// Package smart implements smart playlists, which are playlists whose tracks
+// are generated by matching rules against all known tracks.
+package smart
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/pkg/errors"
+)
+
+// Extension is the file extension of smart playlists.
+const Extension = ".aqsmart"
+
+func init() {
+	playlist.Register(Extension, Parse, Write)
+}
+
+// file is the JSON structure of a smart playlist file.
+type file struct {
+	Name  string `json:"name"`
+	Rules *Rules `json:"rules"`
+}
+
+func Parse(path string) (*playlist.Playlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	f.SetDeadline(time.Now().Add(15 * time.Second))
+
+	var smart file
+	if err := json.NewDecoder(f).Decode(&smart); err != nil {
+		return nil, errors.Wrap(err, "failed to decode smart playlist")
+	}
+
+	if smart.Name == "" {
+		smart.Name = playlist.TitleFromPath(path)
+	}
+
+	if smart.Rules == nil {
+		smart.Rules = &Rules{}
+	}
+
+	return &playlist.Playlist{
+		Name:      smart.Name,
+		Path:      path,
+		Generator: smart.Rules,
+	}, nil
+}
+
+func Write(p *playlist.Playlist, done func(error)) error {
+	rules, ok := p.Generator.(*Rules)
+	if !ok {
+		return errors.New("playlist is not a smart playlist")
+	}
+
+	b, err := json.MarshalIndent(file{
+		Name:  p.Name,
+		Rules: rules,
+	}, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode smart playlist")
+	}
+
+	playlist.WriteFile(p.Path, b, done)
+	return nil
+}
+
+// PathFromName returns the path to a new smart playlist with the given name
+// inside the given directory.
+func PathFromName(dir, name string) string {
+	return filepath.Join(dir, slashesc(name)+Extension)
+}
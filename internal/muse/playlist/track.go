@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/diamondburned/aqours/internal/muse/metadata/ffprobe"
+	"github.com/diamondburned/aqours/internal/muse/metadata/native"
+	"github.com/diamondburned/aqours/internal/muse/metadata/pathguess"
 )
 
 type Track struct {
@@ -21,8 +23,108 @@ type Track struct {
 	Length  time.Duration
 	Bitrate int
 
+	AlbumArtist string `json:"album_artist,omitempty"`
+	Composer    string `json:"composer,omitempty"`
+	Disc        int    `json:"disc,omitempty"`
+
+	// SampleRate is in Hz. Codec is the short name of the codec as ffmpeg
+	// names it, such as flac or opus.
+	SampleRate int    `json:"sample_rate,omitempty"`
+	Codec      string `json:"codec,omitempty"`
+
+	// ReplayGain is nil if the track has no ReplayGain tags.
+	ReplayGain *ReplayGain `json:"replay_gain,omitempty"`
+
+	// MusicBrainz identifiers of the recording, release, artist and release
+	// artist.
+	MusicBrainzTrackID       string `json:"musicbrainz_track_id,omitempty"`
+	MusicBrainzAlbumID       string `json:"musicbrainz_album_id,omitempty"`
+	MusicBrainzArtistID      string `json:"musicbrainz_artist_id,omitempty"`
+	MusicBrainzAlbumArtistID string `json:"musicbrainz_album_artist_id,omitempty"`
+
+	// Rating is from 1 to 100, or 0 if the track isn't rated.
+	Rating int `json:"rating,omitempty"`
+
 	// Unprobeable is true if the Track cannot be probed.
 	Unprobeable bool `json:"unprobeable,omitempty"`
+	// ProbeVersion is the ProbeVersion that the track was last probed with.
+	ProbeVersion int `json:"probe_version,omitempty"`
+
+	// PlayCount and LastPlayed (in Unix seconds) are the playback statistics of
+	// the track. They're kept by the state and never probed.
+	PlayCount  int   `json:"play_count,omitempty"`
+	LastPlayed int64 `json:"last_played,omitempty"`
+}
+
+// ProbeVersion is incremented every time the probers learn to read more
+// metadata, so that tracks probed by an older version are probed again.
+const ProbeVersion = 2
+
+// ReplayGain contains the ReplayGain values of a track. Gains are in dB and
+// peaks are linear, where 1 is full scale. A zero peak is unknown.
+type ReplayGain struct {
+	TrackGain float64 `json:"track_gain"`
+	TrackPeak float64 `json:"track_peak,omitempty"`
+	AlbumGain float64 `json:"album_gain,omitempty"`
+	AlbumPeak float64 `json:"album_peak,omitempty"`
+}
+
+// Overrides are metadata values set by the user in place of the probed ones,
+// such as for files that can't be written. Empty values aren't overridden.
+type Overrides struct {
+	Title  string `json:"title,omitempty"`
+	Artist string `json:"artist,omitempty"`
+	Album  string `json:"album,omitempty"`
+	Number int    `json:"number,omitempty"`
+}
+
+// IsZero returns true if nothing is overridden.
+func (o Overrides) IsZero() bool {
+	return o == Overrides{}
+}
+
+// Apply overrides the metadata of the given track.
+func (o Overrides) Apply(t *Track) {
+	if o.Title != "" {
+		t.Title = o.Title
+	}
+	if o.Artist != "" {
+		t.Artist = o.Artist
+	}
+	if o.Album != "" {
+		t.Album = o.Album
+	}
+	if o.Number != 0 {
+		t.Number = o.Number
+	}
+}
+
+// AlbumArtistOrArtist returns the album artist, or the artist if the track has
+// none.
+func (t Track) AlbumArtistOrArtist() string {
+	if t.AlbumArtist != "" {
+		return t.AlbumArtist
+	}
+	return t.Artist
+}
+
+// ComparePosition compares the positions of the given tracks within their
+// album by the disc number, then the track number. It returns a negative number
+// if a comes first, a positive number if b does, and 0 if they're equal.
+func ComparePosition(a, b *Track) int {
+	if a.Disc != b.Disc {
+		return a.Disc - b.Disc
+	}
+	return a.Number - b.Number
+}
+
+// LastPlayedTime returns LastPlayed as a time. The zero value is returned if the
+// track has never been played.
+func (t Track) LastPlayedTime() time.Time {
+	if t.LastPlayed == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t.LastPlayed, 0)
 }
 
 // IsProbed returns true if the track is probed.
@@ -44,7 +146,95 @@ func (t *Track) Probe() error {
 	return t.ForceProbe()
 }
 
+// ForceProbe probes the track regardless of whether or not it's already
+// probed. The file is read natively if possible; ffprobe is only used for
+// formats that can't be.
 func (t *Track) ForceProbe() error {
+	// Don't probe again with the same version even if probing fails, since it
+	// would only fail again until the file changes.
+	t.ProbeVersion = ProbeVersion
+
+	p, err := native.Probe(t.Filepath)
+	if err != nil {
+		return t.ffprobe()
+	}
+
+	// Untagged files still have a duration.
+	t.Bitrate = p.Bitrate
+	t.Length = p.Length
+	t.SampleRate = p.SampleRate
+	t.Codec = p.Codec
+
+	// Try and keep the old metadata the same, as playlist loaders might somehow
+	// derive it.
+	if p.Title == "" {
+		t.Unprobeable = true
+		return nil
+	}
+
+	t.Title = p.Title
+	t.Artist = p.Artist
+	t.Album = p.Album
+	t.Genre = p.Genre
+	t.Date = p.Date
+	t.AlbumArtist = p.AlbumArtist
+	t.Composer = p.Composer
+	t.Disc = p.Disc
+	t.MusicBrainzTrackID = p.MusicBrainzTrackID
+	t.MusicBrainzAlbumID = p.MusicBrainzAlbumID
+	t.MusicBrainzArtistID = p.MusicBrainzArtistID
+	t.MusicBrainzAlbumArtistID = p.MusicBrainzAlbumArtistID
+	t.Rating = p.Rating
+
+	t.ReplayGain = nil
+	if p.ReplayGain != nil {
+		rg := ReplayGain(*p.ReplayGain)
+		t.ReplayGain = &rg
+	}
+
+	if p.Number > 0 {
+		t.Number = p.Number
+	}
+
+	return nil
+}
+
+// GuessFromPath fills in the metadata that the file doesn't have with the
+// metadata guessed from its path by the given pattern. If the file has no tags
+// at all, then the guessed metadata replaces the placeholder metadata. False is
+// returned if the path doesn't match.
+func (t *Track) GuessFromPath(p *pathguess.Pattern) bool {
+	g, ok := p.Guess(t.Filepath)
+	if !ok {
+		return false
+	}
+
+	// Unprobeable tracks only have a title made from the file name and
+	// whatever was guessed before.
+	fill := func(dst *string, guessed string) {
+		if guessed != "" && (t.Unprobeable || *dst == "") {
+			*dst = guessed
+		}
+	}
+	fillInt := func(dst *int, guessed int) {
+		if guessed != 0 && (t.Unprobeable || *dst == 0) {
+			*dst = guessed
+		}
+	}
+
+	fill(&t.Title, g.Title)
+	fill(&t.Artist, g.Artist)
+	fill(&t.Album, g.Album)
+	fill(&t.AlbumArtist, g.AlbumArtist)
+	fill(&t.Genre, g.Genre)
+	fill(&t.Date, g.Date)
+	fillInt(&t.Number, g.Number)
+	fillInt(&t.Disc, g.Disc)
+
+	return true
+}
+
+func (t *Track) ffprobe() error {
 	p, err := ffprobe.Probe(t.Filepath)
 	if err != nil {
 		// We can still reset the title and try to guess it. We might want to do
@@ -54,6 +244,17 @@ func (t *Track) ForceProbe() error {
 		return err
 	}
 
+	// Untagged files still have a duration.
+	t.Bitrate = p.Format.BitRate
+	t.Length = time.Duration(p.Format.Duration * float64(time.Second))
+
+	t.SampleRate = 0
+	t.Codec = ""
+	if len(p.Streams) > 0 {
+		t.SampleRate = p.Streams[0].SampleRate
+		t.Codec = p.Streams[0].CodecName
+	}
+
 	title := p.TagValue("title")
 
 	// Try and keep the old metadata the same, as playlist loaders might somehow
@@ -66,14 +267,40 @@ func (t *Track) ForceProbe() error {
 	t.Title = title
 	t.Artist = p.TagValue("artist")
 	t.Album = p.TagValue("album")
+	t.Genre = p.TagValue("genre")
 	t.Number = p.TagValueInt("track", t.Number)
-	t.Bitrate = p.Format.BitRate
-	t.Length = time.Duration(p.Format.Duration * float64(time.Second))
 	t.Date = p.TagValue("date")
+	t.AlbumArtist = p.TagValue("album_artist")
+	t.Composer = p.TagValue("composer")
+	t.Disc = p.TagValueInt("disc", 0)
+	t.MusicBrainzTrackID = ffprobeTag(p, "musicbrainz_trackid", "musicbrainz track id")
+	t.MusicBrainzAlbumID = ffprobeTag(p, "musicbrainz_albumid", "musicbrainz album id")
+	t.MusicBrainzArtistID = ffprobeTag(p, "musicbrainz_artistid", "musicbrainz artist id")
+	t.MusicBrainzAlbumArtistID = ffprobeTag(p, "musicbrainz_albumartistid", "musicbrainz album artist id")
+	t.Rating, _ = native.ParseRating(p.TagValue("rating"))
+
+	t.ReplayGain = nil
+	if gain, ok := native.ParseReplayGain(p.TagValue("replaygain_track_gain")); ok {
+		t.ReplayGain = &ReplayGain{TrackGain: gain}
+		t.ReplayGain.TrackPeak, _ = native.ParseReplayGain(p.TagValue("replaygain_track_peak"))
+		t.ReplayGain.AlbumGain, _ = native.ParseReplayGain(p.TagValue("replaygain_album_gain"))
+		t.ReplayGain.AlbumPeak, _ = native.ParseReplayGain(p.TagValue("replaygain_album_peak"))
+	}
 
 	return nil
 }
 
+// ffprobeTag returns the value of the first of the given tags that is set.
+// Vorbis comments and ID3 or MP4 user tags name the same value differently.
+func ffprobeTag(p *ffprobe.ProbeResult, names ...string) string {
+	for _, name := range names {
+		if v := p.TagValue(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 // TitleFromPath grabs the file basename from the given path, which could be
 // used as a title placeholder.
 func TitleFromPath(path string) string {
@@ -0,0 +1,67 @@
+package playlist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/metadata/pathguess"
+)
+
+func TestForceProbeUntagged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Artist", "01 - Song.wav")
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, untaggedWAV(1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	track := Track{Filepath: path, Title: TitleFromPath(path)}
+	if err := track.ForceProbe(); err != nil {
+		t.Fatal("failed to probe:", err)
+	}
+
+	if !track.Unprobeable {
+		t.Error("untagged track isn't marked as unprobeable")
+	}
+	if track.Length != time.Second || track.Bitrate == 0 || track.SampleRate != 44100 {
+		t.Errorf("untagged track has no duration: %#v", track)
+	}
+
+	pattern, err := pathguess.Parse("%artist%/%number% - %title%")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !track.GuessFromPath(pattern) || track.Title != "Song" || track.Artist != "Artist" {
+		t.Errorf("unexpected guessed metadata: %#v", track)
+	}
+}
+
+// untaggedWAV returns a silent 16-bit stereo WAV file without an INFO chunk.
+func untaggedWAV(seconds int) []byte {
+	var fmtChunk bytes.Buffer
+	binary.Write(&fmtChunk, binary.LittleEndian, []uint16{1, 2})
+	binary.Write(&fmtChunk, binary.LittleEndian, []uint32{44100, 44100 * 4})
+	binary.Write(&fmtChunk, binary.LittleEndian, []uint16{4, 16})
+
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	body.Write(riffChunk("fmt ", fmtChunk.Bytes()))
+	body.Write(riffChunk("data", make([]byte, seconds*44100*4)))
+
+	return riffChunk("RIFF", body.Bytes())
+}
+
+func riffChunk(id string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
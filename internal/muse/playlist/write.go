@@ -0,0 +1,39 @@
+package playlist
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// WriteFile writes the encoded playlist to the given path in a goroutine, then
+// calls done with the error, if any. The file is written to a temporary file
+// that replaces it, so a failed write never leaves a truncated playlist.
+func WriteFile(path string, b []byte, done func(error)) {
+	go func() {
+		done(writeFile(path, b))
+	}()
+}
+
+func writeFile(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".*"+filepath.Ext(path))
+	if err != nil {
+		return errors.Wrap(err, "failed to create playlist file")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write playlist")
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return errors.Wrap(err, "failed to replace playlist file")
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package playlist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.aqsmart")
+
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error)
+	WriteFile(path, []byte("new"), func(err error) { errs <- err })
+
+	if err := <-errs; err != nil {
+		t.Fatal("failed to write:", err)
+	}
+
+	if b, _ := os.ReadFile(path); string(b) != "new" {
+		t.Errorf("file = %q, want %q", b, "new")
+	}
+
+	// The temporary file is gone.
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("unexpected files left: %v", entries)
+	}
+}
@@ -0,0 +1,414 @@
+// Package query implements the search query language. A query is a list of
+// whitespace-separated terms that all have to match a track:
+//
+//	love                free text, fuzzily matched against the title, artist,
+//	                    album and path
+//	"love live"         quoted text, matched as a case-insensitive substring
+//	artist:aqours       field text, matched as a case-insensitive substring
+//	artist:="Aqours"    field text, matched exactly but case-insensitively
+//	year:1990..1999     numeric range, inclusive; either side may be omitted
+//	length:>5m          numeric comparison using >, >=, < or <=
+//	-genre:rock         negation; ! also works
+//
+// Text fields are title, artist, album, albumartist, composer, genre, date,
+// codec and path. Numeric fields are year, length, number, disc, plays, bitrate
+// (in kbps) and samplerate (in Hz). Lengths are durations
+// such as 5m, 3m30s or 3:30; plain numbers are seconds. Terms with unknown
+// fields are treated as free text.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+)
+
+// Query is a parsed query.
+type Query struct {
+	terms []term
+}
+
+type term struct {
+	negate bool
+	match  func(t *playlist.Track) bool
+}
+
+// Error is a query parsing error.
+type Error struct {
+	Term string
+	Err  string
+}
+
+// Error implements error.
+func (err *Error) Error() string {
+	return fmt.Sprintf("invalid term %q: %s", err.Term, err.Err)
+}
+
+// IsEmpty returns true if the query has no terms.
+func (q *Query) IsEmpty() bool {
+	return len(q.terms) == 0
+}
+
+// Match returns true if the track matches all terms of the query.
+func (q *Query) Match(t playlist.Track) bool {
+	for _, term := range q.terms {
+		if term.match(&t) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+type textField func(t *playlist.Track) string
+
+var textFields = map[string]textField{
+	"title":  func(t *playlist.Track) string { return t.Title },
+	"artist": func(t *playlist.Track) string { return t.Artist },
+	"album":  func(t *playlist.Track) string { return t.Album },
+	"genre":  func(t *playlist.Track) string { return t.Genre },
+	"date":   func(t *playlist.Track) string { return t.Date },
+	"path":   func(t *playlist.Track) string { return t.Filepath },
+
+	"albumartist": func(t *playlist.Track) string { return t.AlbumArtist },
+	"composer":    func(t *playlist.Track) string { return t.Composer },
+	"codec":       func(t *playlist.Track) string { return t.Codec },
+}
+
+// numField returns the numeric value of a track's field. It returns false if
+// the track doesn't have the value.
+type numField struct {
+	value func(t *playlist.Track) (float64, bool)
+	parse func(s string) (float64, error)
+}
+
+var numFields = map[string]numField{
+	"year": {
+		value: func(t *playlist.Track) (float64, bool) {
+			y, ok := Year(t.Date)
+			return float64(y), ok
+		},
+		parse: parseNumber,
+	},
+	"length": {
+		value: func(t *playlist.Track) (float64, bool) {
+			return t.Length.Seconds(), t.Length > 0
+		},
+		parse: parseDuration,
+	},
+	"number": {
+		value: func(t *playlist.Track) (float64, bool) {
+			return float64(t.Number), t.Number > 0
+		},
+		parse: parseNumber,
+	},
+	"plays": {
+		value: func(t *playlist.Track) (float64, bool) {
+			return float64(t.PlayCount), true
+		},
+		parse: parseNumber,
+	},
+	"bitrate": {
+		value: func(t *playlist.Track) (float64, bool) {
+			return float64(t.Bitrate) / 1000, t.Bitrate > 0
+		},
+		parse: parseNumber,
+	},
+	"disc": {
+		value: func(t *playlist.Track) (float64, bool) {
+			return float64(t.Disc), t.Disc > 0
+		},
+		parse: parseNumber,
+	},
+	"samplerate": {
+		value: func(t *playlist.Track) (float64, bool) {
+			return float64(t.SampleRate), t.SampleRate > 0
+		},
+		parse: parseNumber,
+	},
+}
+
+var aliases = map[string]string{
+	"len":   "length",
+	"track": "number",
+	"file":  "path",
+	"name":  "title",
+	"aa":    "albumartist",
+	"rate":  "samplerate",
+}
+
+// Year returns the year of the given date, which is assumed to start with the
+// year, such as "1999" or "1999-09-09".
+func Year(date string) (int, bool) {
+	if len(date) < 4 {
+		return 0, false
+	}
+
+	y, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0, false
+	}
+
+	return y, true
+}
+
+// Parse parses the given query.
+func Parse(query string) (*Query, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{terms: make([]term, 0, len(tokens))}
+
+	for _, token := range tokens {
+		t, err := parseTerm(token)
+		if err != nil {
+			return nil, err
+		}
+		q.terms = append(q.terms, t)
+	}
+
+	return q, nil
+}
+
+type token struct {
+	raw    string // for errors
+	negate bool
+	field  string // empty if free text
+	value  string
+	quoted bool
+}
+
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		tok := token{}
+
+		if runes[i] == '-' || runes[i] == '!' {
+			tok.negate = true
+			i++
+		}
+
+		// Read the field name if there's one.
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j])) {
+			j++
+		}
+		if j < len(runes) && j > i && runes[j] == ':' {
+			field := strings.ToLower(string(runes[i:j]))
+			if alias, ok := aliases[field]; ok {
+				field = alias
+			}
+			_, isText := textFields[field]
+			_, isNum := numFields[field]
+			if isText || isNum {
+				tok.field = field
+				i = j + 1
+			}
+		}
+
+		if i < len(runes) && runes[i] == '"' || (i+1 < len(runes) && runes[i] == '=' && runes[i+1] == '"') {
+			prefix := ""
+			if runes[i] == '=' {
+				prefix = "="
+				i++
+			}
+
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &Error{Term: string(runes[start:]), Err: "missing closing quote"}
+			}
+
+			tok.value = prefix + string(runes[i+1:end])
+			tok.quoted = true
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+
+			tok.value = string(runes[i:end])
+			i = end
+		}
+
+		tok.raw = string(runes[start:i])
+
+		// A lone dash is just text.
+		if tok.negate && tok.field == "" && tok.value == "" {
+			tok.negate = false
+			tok.value = tok.raw
+		}
+
+		tokens = append(tokens, tok)
+	}
+
+	return tokens, nil
+}
+
+func parseTerm(tok token) (term, error) {
+	t := term{negate: tok.negate}
+
+	if tok.field == "" {
+		t.match = textMatcher(tok.value, tok.quoted)
+		return t, nil
+	}
+
+	if field, ok := textFields[tok.field]; ok {
+		value := strings.ToLower(tok.value)
+
+		if strings.HasPrefix(value, "=") {
+			value = strings.TrimPrefix(value, "=")
+			t.match = func(t *playlist.Track) bool {
+				return strings.EqualFold(field(t), value)
+			}
+		} else {
+			t.match = func(t *playlist.Track) bool {
+				return strings.Contains(strings.ToLower(field(t)), value)
+			}
+		}
+
+		return t, nil
+	}
+
+	field := numFields[tok.field]
+
+	cmp, err := parseComparison(tok.value, field.parse)
+	if err != nil {
+		return t, &Error{Term: tok.raw, Err: err.Error()}
+	}
+
+	t.match = func(t *playlist.Track) bool {
+		v, ok := field.value(t)
+		return ok && cmp(v)
+	}
+
+	return t, nil
+}
+
+func textMatcher(value string, quoted bool) func(t *playlist.Track) bool {
+	if quoted {
+		value = strings.ToLower(value)
+		return func(t *playlist.Track) bool {
+			return false ||
+				strings.Contains(strings.ToLower(t.Title), value) ||
+				strings.Contains(strings.ToLower(t.Artist), value) ||
+				strings.Contains(strings.ToLower(t.Album), value) ||
+				strings.Contains(strings.ToLower(t.Filepath), value)
+		}
+	}
+
+	return func(t *playlist.Track) bool {
+		return false ||
+			fuzzy.MatchNormalizedFold(value, t.Title) ||
+			fuzzy.MatchNormalizedFold(value, t.Artist) ||
+			fuzzy.MatchNormalizedFold(value, t.Album) ||
+			fuzzy.MatchNormalizedFold(value, t.Filepath)
+	}
+}
+
+// parseComparison parses a numeric comparison or range.
+func parseComparison(s string, parse func(string) (float64, error)) (func(float64) bool, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	if parts := strings.SplitN(s, "..", 2); len(parts) == 2 {
+		if parts[0] == "" && parts[1] == "" {
+			return nil, fmt.Errorf("empty range")
+		}
+
+		min, max := -1.0, -1.0
+		var err error
+
+		if parts[0] != "" {
+			if min, err = parse(parts[0]); err != nil {
+				return nil, err
+			}
+		}
+		if parts[1] != "" {
+			if max, err = parse(parts[1]); err != nil {
+				return nil, err
+			}
+		}
+
+		return func(v float64) bool {
+			return (parts[0] == "" || v >= min) && (parts[1] == "" || v <= max)
+		}, nil
+	}
+
+	ops := []struct {
+		prefix string
+		cmp    func(a, b float64) bool
+	}{
+		{">=", func(a, b float64) bool { return a >= b }},
+		{"<=", func(a, b float64) bool { return a <= b }},
+		{">", func(a, b float64) bool { return a > b }},
+		{"<", func(a, b float64) bool { return a < b }},
+		{"=", func(a, b float64) bool { return a == b }},
+		{"", func(a, b float64) bool { return a == b }},
+	}
+
+	for _, op := range ops {
+		if !strings.HasPrefix(s, op.prefix) {
+			continue
+		}
+
+		n, err := parse(strings.TrimPrefix(s, op.prefix))
+		if err != nil {
+			return nil, err
+		}
+
+		cmp := op.cmp
+		return func(v float64) bool { return cmp(v, n) }, nil
+	}
+
+	panic("unreachable")
+}
+
+func parseNumber(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return f, nil
+}
+
+// parseDuration parses a duration into seconds.
+func parseDuration(s string) (float64, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return d.Seconds(), nil
+	}
+
+	// Try the clock format, such as 3:30 or 1:02:03.
+	var secs float64
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		secs = secs*60 + float64(n)
+	}
+
+	return secs, nil
+}
@@ -0,0 +1,151 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+)
+
+var testTracks = []playlist.Track{
+	{
+		Title:    "Koi ni Naritai AQUARIUM",
+		Artist:   "Aqours",
+		Album:    "Koi ni Naritai AQUARIUM",
+		Genre:    "Anime",
+		Date:     "2016-11-09",
+		Filepath: "/music/aqours/koi.flac",
+		Number:   1,
+		Disc:     2,
+		Length:   4*time.Minute + 20*time.Second,
+
+		AlbumArtist: "Aqours",
+		Codec:       "flac",
+		SampleRate:  48000,
+	},
+	{
+		Title:    "Stairway to Heaven",
+		Artist:   "Led Zeppelin",
+		Album:    "Led Zeppelin IV",
+		Genre:    "Rock",
+		Date:     "1971",
+		Filepath: "/music/led zeppelin/stairway.mp3",
+		Number:   4,
+		Length:   8 * time.Minute,
+	},
+	{
+		Title:     "Smells Like Teen Spirit",
+		Artist:    "Nirvana",
+		Album:     "Nevermind",
+		Genre:     "Rock",
+		Date:      "1991-09-24",
+		Filepath:  "/music/nirvana/teen spirit.mp3",
+		Number:    1,
+		Length:    5*time.Minute + 1*time.Second,
+		PlayCount: 3,
+
+		Composer:   "Kurt Cobain",
+		Codec:      "mp3",
+		SampleRate: 44100,
+	},
+	{
+		Title:    "untitled",
+		Filepath: "/music/untitled.ogg",
+	},
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		query  string
+		expect []int // indices into testTracks
+	}{
+		{"", []int{0, 1, 2, 3}},
+		{"aqours", []int{0}},
+		{"zpln", []int{1}},
+		{`"teen spirit"`, []int{2}},
+		{`"tnspirit"`, nil},
+		{"artist:zeppelin", []int{1}},
+		{"ARTIST:Zeppelin", []int{1}},
+		{`artist:="led zeppelin"`, []int{1}},
+		{"artist:=led", nil},
+		{`album:"led zeppelin"`, []int{1}},
+		{"genre:rock", []int{1, 2}},
+		{"-genre:rock", []int{0, 3}},
+		{"!genre:rock", []int{0, 3}},
+		{"genre:rock -nirvana", []int{1}},
+		{"year:1990..1999", []int{2}},
+		{"year:..1999", []int{1, 2}},
+		{"year:2000..", []int{0}},
+		{"year:1971", []int{1}},
+		{"year:>=1991", []int{0, 2}},
+		{"-year:1971", []int{0, 2, 3}},
+		{"length:>5m", []int{1, 2}},
+		{"len:<5m", []int{0}},
+		{"length:4:20", []int{0}},
+		{"length:4m..5m30s", []int{0, 2}},
+		{"length:300..", []int{1, 2}},
+		{"number:1", []int{0, 2}},
+		{"plays:>0", []int{2}},
+		{"path:.mp3", []int{1, 2}},
+		{"albumartist:aqours", []int{0}},
+		{"aa:aqours", []int{0}},
+		{"composer:cobain", []int{2}},
+		{"codec:flac", []int{0}},
+		{"disc:2", []int{0}},
+		{"samplerate:>44100", []int{0}},
+		{"rate:44100", []int{2}},
+		{"foo:bar", nil},
+		{"re:", nil},
+		{"-", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q, err := Parse(test.query)
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+
+			var got []int
+			for i, track := range testTracks {
+				if q.Match(track) {
+					got = append(got, i)
+				}
+			}
+
+			if !equalInts(got, test.expect) {
+				t.Errorf("got %v, expected %v", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	queries := []string{
+		`"unterminated`,
+		`artist:"unterminated`,
+		"year:",
+		"year:abc",
+		"year:..",
+		"length:5min",
+		"length:>x",
+	}
+
+	for _, query := range queries {
+		if _, err := Parse(query); err == nil {
+			t.Errorf("expected error for %q", query)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
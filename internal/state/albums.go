@@ -0,0 +1,105 @@
+package state
+
+import "time"
+
+// Album is a group of tracks in a playlist that share their album artist and
+// album.
+type Album struct {
+	Name string
+	// Artist is the album artist, or the artist if the tracks have none.
+	Artist string
+	// Indices are the indices of the album's tracks in the playlist.
+	Indices []int
+}
+
+// Albums groups the tracks of the playlist into albums, which are in the order
+// that they first appear in. Tracks without an album are grouped by their
+// artist into albums without a name.
+func (pl *Playlist) Albums() []Album {
+	var albums []Album
+	indices := make(map[[2]string]int)
+
+	for i, track := range pl.Tracks {
+		md := track.Metadata()
+		key := [2]string{md.AlbumArtistOrArtist(), md.Album}
+
+		ix, ok := indices[key]
+		if !ok {
+			ix = len(albums)
+			indices[key] = ix
+			albums = append(albums, Album{Name: key[1], Artist: key[0]})
+		}
+
+		albums[ix].Indices = append(albums[ix].Indices, i)
+	}
+
+	return albums
+}
+
+// AlbumRun is a run of consecutive tracks in a playlist that share their album
+// artist and album.
+type AlbumRun struct {
+	Name string
+	// Artist is the album artist, or the artist if the tracks have none.
+	Artist string
+	// Year is the year of the first track that has a date, or empty if none
+	// has.
+	Year string
+	// Start and End are the indices of the first track and of the track after
+	// the last one.
+	Start, End int
+	// Length is the total length of the tracks.
+	Length time.Duration
+}
+
+// Len returns the number of tracks in the run.
+func (run AlbumRun) Len() int {
+	return run.End - run.Start
+}
+
+// AlbumRuns splits the tracks of the playlist into runs of the same album. A
+// new run starts whenever the album changes between consecutive tracks, so an
+// album can have many runs.
+func (pl *Playlist) AlbumRuns() []AlbumRun {
+	var runs []AlbumRun
+	var run *AlbumRun
+
+	for i, track := range pl.Tracks {
+		md := track.Metadata()
+		artist := md.AlbumArtistOrArtist()
+
+		if run == nil || run.Name != md.Album || run.Artist != artist {
+			runs = append(runs, AlbumRun{
+				Name:   md.Album,
+				Artist: artist,
+				Start:  i,
+			})
+			run = &runs[len(runs)-1]
+		}
+
+		if run.Year == "" {
+			run.Year = yearOf(md.Date)
+		}
+
+		run.End = i + 1
+		run.Length += md.Length
+	}
+
+	return runs
+}
+
+// yearOf returns the year of a date such as 2006-01-02, or an empty string if
+// the date doesn't start with one.
+func yearOf(date string) string {
+	if len(date) < 4 {
+		return ""
+	}
+
+	for _, r := range date[:4] {
+		if r < '0' || r > '9' {
+			return ""
+		}
+	}
+
+	return date[:4]
+}
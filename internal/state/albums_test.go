@@ -0,0 +1,60 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/go-test/deep"
+)
+
+func TestAlbums(t *testing.T) {
+	s := NewState()
+	pl := s.AddPlaylist(&playlist.Playlist{
+		Name: "mixed",
+		Tracks: []playlist.Track{
+			{Filepath: "/a/1", Album: "A", Artist: "Aqours", Title: "1"},
+			{Filepath: "/b/1", Album: "B", Artist: "Ruby", AlbumArtist: "Guilty Kiss"},
+			{Filepath: "/a/2", Album: "A", Artist: "Aqours", Title: "2"},
+			{Filepath: "/x/1", Artist: "Aqours"},
+			{Filepath: "/b/2", Album: "B", Artist: "Riko", AlbumArtist: "Guilty Kiss"},
+			{Filepath: "/x/2", Artist: "Aqours"},
+			{Filepath: "/c/1", Album: "A", Artist: "Saint Snow"},
+		},
+	})
+
+	expect := []Album{
+		{Name: "A", Artist: "Aqours", Indices: []int{0, 2}},
+		{Name: "B", Artist: "Guilty Kiss", Indices: []int{1, 4}},
+		{Name: "", Artist: "Aqours", Indices: []int{3, 5}},
+		{Name: "A", Artist: "Saint Snow", Indices: []int{6}},
+	}
+
+	if ineqs := deep.Equal(pl.Albums(), expect); ineqs != nil {
+		t.Fatal("unexpected albums:", ineqs)
+	}
+}
+
+func TestAlbumRuns(t *testing.T) {
+	s := NewState()
+	pl := s.AddPlaylist(&playlist.Playlist{
+		Name: "mixed",
+		Tracks: []playlist.Track{
+			{Filepath: "/a/1", Album: "A", Artist: "Aqours", Length: time.Minute},
+			{Filepath: "/a/2", Album: "A", Artist: "Aqours", Date: "2017-09-27", Length: time.Minute},
+			{Filepath: "/b/1", Album: "B", Artist: "Ruby", AlbumArtist: "Guilty Kiss", Date: "2018"},
+			{Filepath: "/b/2", Album: "B", Artist: "Riko", AlbumArtist: "Guilty Kiss", Date: "unknown"},
+			{Filepath: "/a/3", Album: "A", Artist: "Aqours", Length: time.Second},
+		},
+	})
+
+	expect := []AlbumRun{
+		{Name: "A", Artist: "Aqours", Year: "2017", Start: 0, End: 2, Length: 2 * time.Minute},
+		{Name: "B", Artist: "Guilty Kiss", Year: "2018", Start: 2, End: 4},
+		{Name: "A", Artist: "Aqours", Start: 4, End: 5, Length: time.Second},
+	}
+
+	if ineqs := deep.Equal(pl.AlbumRuns(), expect); ineqs != nil {
+		t.Fatal("unexpected album runs:", ineqs)
+	}
+}
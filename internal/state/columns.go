@@ -0,0 +1,117 @@
+package state
+
+// ColumnLayout is the layout of the columns of a track list.
+type ColumnLayout struct {
+	// Columns are the columns in their order. Columns that aren't in it keep
+	// their default layout.
+	Columns []ColumnState `json:"columns,omitempty"`
+	// Sort is the name of the column that the rows are sorted by, or empty if
+	// they're in the order of the playlist. Sorting only changes the view.
+	Sort           string `json:"sort,omitempty"`
+	SortDescending bool   `json:"sort_descending,omitempty"`
+	// Grouped is true if the tracks are grouped by album under header rows.
+	// Grouped rows are always in the order of the playlist.
+	Grouped bool `json:"grouped,omitempty"`
+}
+
+// ColumnState is the layout of a column of a track list.
+type ColumnState struct {
+	Name    string `json:"name"`
+	Visible bool   `json:"visible"`
+	// Width is the width of the column in pixels, or 0 for the default width.
+	Width int `json:"width,omitempty"`
+}
+
+// IsZero returns true if the layout is the default layout.
+func (l ColumnLayout) IsZero() bool {
+	return len(l.Columns) == 0 && l.Sort == "" && !l.Grouped
+}
+
+// Apply applies the layout to the given default columns. The columns of the
+// layout come first in their order, followed by the other default columns in
+// theirs. Columns of the layout that aren't in defaults are dropped.
+func (l ColumnLayout) Apply(defaults []ColumnState) []ColumnState {
+	known := make(map[string]ColumnState, len(defaults))
+	for _, col := range defaults {
+		known[col.Name] = col
+	}
+
+	columns := make([]ColumnState, 0, len(defaults))
+	added := make(map[string]bool, len(defaults))
+
+	for _, col := range l.Columns {
+		def, ok := known[col.Name]
+		if !ok || added[col.Name] {
+			continue
+		}
+
+		if col.Width <= 0 {
+			col.Width = def.Width
+		}
+
+		columns = append(columns, col)
+		added[col.Name] = true
+	}
+
+	for _, col := range defaults {
+		if !added[col.Name] {
+			columns = append(columns, col)
+		}
+	}
+
+	return columns
+}
+
+func (l ColumnLayout) copy() ColumnLayout {
+	l.Columns = append([]ColumnState(nil), l.Columns...)
+	return l
+}
+
+// ColumnLayout returns the default layout of the columns of the track lists.
+func (s *State) ColumnLayout() ColumnLayout {
+	return s.columns.copy()
+}
+
+// SetColumnLayout sets the default layout of the columns of the track lists.
+// Playlists with their own layouts aren't affected.
+func (s *State) SetColumnLayout(layout ColumnLayout) {
+	s.columns = layout.copy()
+	s.MarkChanged()
+}
+
+// ColumnLayout returns the layout of the columns of the playlist's track list.
+// The default layout is returned if the playlist has none of its own.
+func (pl *Playlist) ColumnLayout() ColumnLayout {
+	if pl.columns != nil {
+		return pl.columns.copy()
+	}
+	return pl.state.ColumnLayout()
+}
+
+// HasColumnLayout returns true if the playlist has its own column layout.
+func (pl *Playlist) HasColumnLayout() bool {
+	return pl.columns != nil
+}
+
+// SetColumnLayout sets the playlist's own column layout. A nil layout makes the
+// playlist use the default layout again.
+func (pl *Playlist) SetColumnLayout(layout *ColumnLayout) {
+	if layout == nil {
+		pl.columns = nil
+	} else {
+		l := layout.copy()
+		pl.columns = &l
+	}
+
+	pl.state.MarkChanged()
+}
+
+// UpdateColumnLayout changes the layout that the playlist uses, which is its
+// own layout if it has one or the default layout otherwise.
+func (pl *Playlist) UpdateColumnLayout(layout ColumnLayout) {
+	if pl.columns != nil {
+		pl.SetColumnLayout(&layout)
+	} else {
+		pl.state.SetColumnLayout(layout)
+	}
+}
@@ -0,0 +1,72 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/go-test/deep"
+)
+
+func TestColumnLayoutApply(t *testing.T) {
+	defaults := []ColumnState{
+		{Name: "title", Visible: true, Width: 150},
+		{Name: "artist", Visible: true, Width: 150},
+		{Name: "genre", Visible: false, Width: 100},
+		{Name: "time", Visible: true, Width: 50},
+	}
+
+	layout := ColumnLayout{
+		Columns: []ColumnState{
+			{Name: "genre", Visible: true},
+			{Name: "removed", Visible: true, Width: 10},
+			{Name: "title", Visible: true, Width: 300},
+			{Name: "genre", Visible: false},
+		},
+	}
+
+	expect := []ColumnState{
+		{Name: "genre", Visible: true, Width: 100},
+		{Name: "title", Visible: true, Width: 300},
+		{Name: "artist", Visible: true, Width: 150},
+		{Name: "time", Visible: true, Width: 50},
+	}
+
+	if diff := deep.Equal(expect, layout.Apply(defaults)); diff != nil {
+		t.Fatal("unexpected columns:", diff)
+	}
+
+	if diff := deep.Equal(defaults, ColumnLayout{}.Apply(defaults)); diff != nil {
+		t.Fatal("unexpected default columns:", diff)
+	}
+}
+
+func TestPlaylistColumnLayout(t *testing.T) {
+	s := NewState()
+	a := s.AddPlaylist(&playlist.Playlist{Name: "a"})
+	b := s.AddPlaylist(&playlist.Playlist{Name: "b"})
+
+	a.UpdateColumnLayout(ColumnLayout{Sort: "title"})
+
+	if l := b.ColumnLayout(); l.Sort != "title" {
+		t.Fatalf("expected the default layout to be shared, got %+v", l)
+	}
+
+	b.SetColumnLayout(&ColumnLayout{Sort: "artist"})
+	a.UpdateColumnLayout(ColumnLayout{Sort: "album"})
+
+	if l := b.ColumnLayout(); l.Sort != "artist" {
+		t.Fatalf("expected the playlist's own layout, got %+v", l)
+	}
+
+	b.UpdateColumnLayout(ColumnLayout{Sort: "time"})
+
+	if l := s.ColumnLayout(); l.Sort != "album" {
+		t.Fatalf("own layout changed the default layout: %+v", l)
+	}
+
+	b.SetColumnLayout(nil)
+
+	if l := b.ColumnLayout(); l.Sort != "album" {
+		t.Fatalf("expected the default layout again, got %+v", l)
+	}
+}
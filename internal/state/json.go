@@ -2,85 +2,230 @@ package state
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
 	"sync"
 	"time"
 
 	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/pkg/errors"
 )
 
 type jsonPlaylist struct {
-	Name PlaylistName
-	Path string
+	Name        PlaylistName `json:"name"`
+	Path        string       `json:"path"`
+	NamePattern string       `json:"name_pattern,omitempty"`
+	// Columns is the playlist's own column layout.
+	Columns *ColumnLayout `json:"columns,omitempty"`
 }
 
+// jsonQueuedTrack is a track in the user's play queue.
+type jsonQueuedTrack struct {
+	Playlist PlaylistName `json:"playlist"`
+	Path     string       `json:"path"`
+}
+
+type jsonLibrary struct {
+	Roots []string `json:"roots"`
+	Paths []string `json:"paths"`
+	// NamePatterns maps roots to their name patterns.
+	NamePatterns map[string]string `json:"name_patterns,omitempty"`
+}
+
+// jsonState is the saved state. New fields may be added freely as long as their
+// zero values keep the old behavior, since older states just don't have them.
+// Any incompatible change, such as renaming a field or changing its type, must
+// bump the version by adding a migration to migrations, along with a sample of
+// the old shape in testdata/migrate.
 type jsonState struct {
-	Playlists []jsonPlaylist `json:"playlist_names"`
-	Metadata  metadataMap    `json:"metadata"`
+	Version int `json:"version"`
+
+	Playlists []jsonPlaylist `json:"playlists"`
+	Metadata  metadataMap    `json:"metadata,omitempty"`
+	Library   *jsonLibrary   `json:"library,omitempty"`
+	// Columns is the default column layout of the track lists.
+	Columns *ColumnLayout `json:"columns,omitempty"`
 
 	PlayingPlaylist  string `json:"playing_playlist,omitempty"`   // playlist name
 	PlayingSongIndex int    `json:"playing_song_index,omitempty"` // song index
-
-	Shuffling bool       `json:"shuffling"`
-	Repeating RepeatMode `json:"repeating"`
-	Volume    float64    `json:"volume"`
-	Muted     bool       `json:"muted"`
+	// PlayingOrder is the paths of the playing playlist's tracks in the order
+	// that they're played in. It's only saved while shuffling, so the shuffle
+	// continues after a restart.
+	PlayingOrder []string `json:"playing_order,omitempty"`
+	// PlayingQueuePos is the position of the playing track in PlayingOrder.
+	PlayingQueuePos int `json:"playing_queue_pos,omitempty"`
+	// PlayingQueued is the playing track if it was taken from the queue.
+	PlayingQueued *jsonQueuedTrack `json:"playing_queued,omitempty"`
+	// Queue is the user's play queue.
+	Queue []jsonQueuedTrack `json:"queue,omitempty"`
+
+	Shuffling   bool        `json:"shuffling"`
+	ShuffleMode ShuffleMode `json:"shuffle_mode,omitempty"`
+	// ShuffleSeed seeds the next shuffle, so shuffling is deterministic.
+	ShuffleSeed int64      `json:"shuffle_seed,omitempty"`
+	Repeating   RepeatMode `json:"repeating"`
+	Volume      float64    `json:"volume"`
+	Muted       bool       `json:"muted"`
 }
 
-// MarshalJSON marshals State to JSON.
+// MarshalJSON marshals State to JSON. The metadata of all tracks is included.
 func (s *State) MarshalJSON() ([]byte, error) {
-	return json.Marshal(makeJSONState(s))
+	return json.Marshal(makeJSONState(s, true))
 }
 
+// fileJSONState reads the JSON state file, migrating it to the current version
+// if needed. The original file is backed up before it's migrated.
 func fileJSONState(file string) (jsonState, error) {
-	var jsonState jsonState
-
 	f, err := os.Open(file)
 	if err != nil {
-		return jsonState, err
+		return jsonState{}, err
 	}
 	f.SetDeadline(time.Now().Add(10 * time.Second))
 	defer f.Close()
 
-	if err := json.NewDecoder(f).Decode(&jsonState); err != nil {
-		return jsonState, err
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return jsonState{}, err
+	}
+
+	migrated, version, err := migrateState(b)
+	if err != nil {
+		return jsonState{}, err
+	}
+
+	if version < stateVersion {
+		backup := backupName(file, version)
+		if err := writeBackup(backup, b); err != nil {
+			return jsonState{}, errors.Wrap(err, "failed to back up state file")
+		}
+
+		log.Printf("migrated %s from version %d, backup at %s\n", file, version, backup)
+	}
+
+	return decodeState(migrated)
+}
+
+// writeBackup writes the backup file unless it already exists, so the backup of
+// the original file isn't overwritten if migrating is attempted again.
+func writeBackup(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
 	}
 
-	return jsonState, nil
+	return f.Close()
 }
 
-func makeJSONState(s *State) jsonState {
+// makeJSONState makes a JSON state from the state. The metadata is only
+// included if withMetadata is true, since it's otherwise kept in the database.
+func makeJSONState(s *State, withMetadata bool) jsonState {
 	var playlists = make([]jsonPlaylist, len(s.playlistNames))
 	for i, name := range s.playlistNames {
 		playlists[i] = jsonPlaylist{
-			Name: name,
-			Path: s.playlists[name].Path,
+			Name:        name,
+			Path:        s.playlists[name].Path,
+			NamePattern: s.playlists[name].NamePattern,
+			Columns:     s.playlists[name].columns,
+		}
+	}
+
+	var library *jsonLibrary
+	if roots := s.LibraryRoots(); len(roots) > 0 {
+		library = &jsonLibrary{
+			Roots: roots,
+			Paths: make([]string, len(s.library.Tracks)),
+		}
+		if len(s.namePatterns) > 0 {
+			library.NamePatterns = s.namePatterns
+		}
+		for i, track := range s.library.Tracks {
+			library.Paths[i] = track.Filepath
 		}
 	}
 
 	playingPlaylist := s.PlayingPlaylistName()
 	playingSongIndex := 0
 
-	if len(s.playing.Queue) > 0 {
-		playingSongIndex = s.playing.Queue[s.playing.QueuePos]
+	if ix, track := s.playlistPlaying(); track != nil {
+		playingSongIndex = ix
+	}
+
+	var playingQueuePos int
+	playingOrder := s.playingOrder()
+	if playingOrder != nil {
+		playingQueuePos = s.playing.QueuePos
+	}
+
+	var playingQueued *jsonQueuedTrack
+	if s.playing.Queued != nil {
+		queued := makeJSONQueuedTrack(s.playing.Queued)
+		playingQueued = &queued
+	}
+
+	var queue []jsonQueuedTrack
+	if tracks := s.Queue(); len(tracks) > 0 {
+		queue = make([]jsonQueuedTrack, len(tracks))
+		for i, track := range tracks {
+			queue[i] = makeJSONQueuedTrack(track)
+		}
+	}
+
+	var columns *ColumnLayout
+	if !s.columns.IsZero() {
+		columns = &s.columns
+	}
+
+	var metadata metadataMap
+	if withMetadata {
+		metadata = s.metadata
 	}
 
 	return jsonState{
+		Version:          stateVersion,
 		Playlists:        playlists,
-		Metadata:         s.metadata,
+		Metadata:         metadata,
+		Library:          library,
+		Columns:          columns,
 		Shuffling:        s.shuffling,
+		ShuffleMode:      s.shuffleMode,
+		ShuffleSeed:      s.shuffleSeed,
 		Repeating:        s.repeating,
 		PlayingPlaylist:  playingPlaylist,
 		PlayingSongIndex: playingSongIndex,
+		PlayingOrder:     playingOrder,
+		PlayingQueuePos:  playingQueuePos,
+		PlayingQueued:    playingQueued,
+		Queue:            queue,
 		Volume:           s.volume,
 		Muted:            s.muted,
 	}
 }
 
+func makeJSONQueuedTrack(track *Track) jsonQueuedTrack {
+	return jsonQueuedTrack{
+		Playlist: track.playlist.Name,
+		Path:     track.Filepath,
+	}
+}
+
 func (s *State) UnmarshalJSON(b []byte) error {
-	var state jsonState
-	if err := json.Unmarshal(b, &state); err != nil {
+	b, _, err := migrateState(b)
+	if err != nil {
+		return err
+	}
+
+	state, err := decodeState(b)
+	if err != nil {
 		return err
 	}
 
@@ -89,17 +234,42 @@ func (s *State) UnmarshalJSON(b []byte) error {
 }
 
 func makeStateFromJSON(jsonState jsonState, intern *stateIntern) *State {
+	if jsonState.Metadata == nil {
+		jsonState.Metadata = make(metadataMap)
+	}
+
+	// Metadata is only in the JSON state if it's being imported, so it's
+	// newer than what's in the database. Mark all of it as unsaved to move it
+	// into the database.
+	if intern.db != nil {
+		for path := range jsonState.Metadata {
+			intern.markDirty(path)
+		}
+	}
+
 	state := &State{
 		intern:        intern,
 		metadata:      jsonState.Metadata,
 		playlists:     make(map[PlaylistName]*Playlist, len(jsonState.Playlists)),
 		playlistNames: make([]PlaylistName, 0, len(jsonState.Playlists)),
+		namePatterns:  make(map[string]string),
 		shuffling:     jsonState.Shuffling,
+		shuffleMode:   jsonState.ShuffleMode,
+		shuffleSeed:   jsonState.ShuffleSeed,
 		repeating:     jsonState.Repeating,
 		volume:        jsonState.Volume,
 		muted:         jsonState.Muted,
 	}
 
+	if jsonState.Columns != nil {
+		state.columns = *jsonState.Columns
+	}
+
+	// States saved before the seed was saved shuffle randomly.
+	if state.shuffleSeed == 0 {
+		state.shuffleSeed = rand.Int63()
+	}
+
 	// Load playlists concurrently.
 	playlists := make([]*playlist.Playlist, len(jsonState.Playlists))
 	waitGroup := sync.WaitGroup{}
@@ -121,17 +291,48 @@ func makeStateFromJSON(jsonState jsonState, intern *stateIntern) *State {
 
 	waitGroup.Wait()
 
-	for _, pl := range playlists {
+	for i, pl := range playlists {
 		if pl == nil {
 			continue
 		}
 
 		playlist := convertPlaylist(state, pl)
+		playlist.NamePattern = jsonState.Playlists[i].NamePattern
+		playlist.columns = jsonState.Playlists[i].Columns
 
 		state.playlistNames = append(state.playlistNames, playlist.Name)
 		state.playlists[playlist.Name] = playlist
 	}
 
+	// The library's name is reserved, but states saved before there was a
+	// library may have a playlist with the same name, so rename it.
+	if pl, ok := state.playlists[LibraryName]; ok {
+		delete(state.playlists, LibraryName)
+		pl.Name = state.freeName(LibraryName)
+		state.playlists[pl.Name] = pl
+
+		for i, name := range state.playlistNames {
+			if name == LibraryName {
+				state.playlistNames[i] = pl.Name
+			}
+		}
+
+		if jsonState.Library == nil && jsonState.PlayingPlaylist == LibraryName {
+			jsonState.PlayingPlaylist = pl.Name
+		}
+
+		log.Printf("Renamed playlist %q to %q, since the name is reserved\n", LibraryName, pl.Name)
+	}
+
+	if jsonState.Library != nil {
+		state.library = newLibrary(state, jsonState.Library.Roots, jsonState.Library.Paths)
+		for root, pattern := range jsonState.Library.NamePatterns {
+			state.namePatterns[root] = pattern
+		}
+	} else {
+		state.library = newLibrary(state, nil, nil)
+	}
+
 	// Drop metadata with no references.
 	for k, metadata := range state.metadata {
 		if metadata.reference < 1 {
@@ -139,19 +340,44 @@ func makeStateFromJSON(jsonState jsonState, intern *stateIntern) *State {
 		}
 	}
 
+	// Generate the generated playlists only after all the metadata has been
+	// loaded.
+	for _, pl := range state.playlists {
+		if pl.IsGenerated() {
+			pl.regenerate()
+		}
+	}
+
+	// Restore the queue. Tracks that are gone are dropped.
+	for _, queued := range jsonState.Queue {
+		if track := state.queueTrack(queued.Playlist, queued.Path); track != nil {
+			state.queue = append(state.queue, track)
+		}
+	}
+
 	// Attempt to restore the currently playing states.
 
+	if queued := jsonState.PlayingQueued; queued != nil {
+		state.playing.Queued = state.queueTrack(queued.Playlist, queued.Path)
+	}
+
 	if jsonState.PlayingPlaylist == "" {
 		return state
 	}
 
-	pl, ok := state.playlists[jsonState.PlayingPlaylist]
+	pl, ok := state.Playlist(jsonState.PlayingPlaylist)
 	if !ok {
 		return state
 	}
 
 	state.SetPlayingPlaylist(pl)
 
+	// Continue the saved shuffle instead of the new one.
+	if state.shuffling && len(jsonState.PlayingOrder) > 0 {
+		state.restoreOrder(jsonState.PlayingOrder, jsonState.PlayingQueuePos)
+		return state
+	}
+
 	// Attempt to find the right position by value from the queue position.
 	for i, ix := range state.playing.Queue {
 		if ix == jsonState.PlayingSongIndex {
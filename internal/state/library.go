@@ -0,0 +1,74 @@
+package state
+
+import (
+	"github.com/diamondburned/aqours/internal/muse/library"
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+)
+
+// LibraryName is the reserved name of the library playlist.
+const LibraryName PlaylistName = "Library"
+
+// newLibrary creates the library playlist with the given root directories and
+// the last known track paths.
+func newLibrary(s *State, roots, paths []string) *Playlist {
+	tracks := make([]playlist.Track, len(paths))
+	for i, path := range paths {
+		tracks[i] = playlist.Track{
+			Title:    playlist.TitleFromPath(path),
+			Filepath: path,
+		}
+	}
+
+	return convertPlaylist(s, &playlist.Playlist{
+		Name:   LibraryName,
+		Tracks: tracks,
+		Source: &library.Source{Roots: roots},
+	})
+}
+
+// Library returns the library playlist, which contains all tracks inside the
+// library roots sorted by path. It is a synced playlist that is never saved to
+// a file and isn't listed in PlaylistNames.
+func (s *State) Library() *Playlist {
+	return s.library
+}
+
+// LibraryRoots returns the root directories of the library.
+func (s *State) LibraryRoots() []string {
+	return s.library.Source.(*library.Source).Roots
+}
+
+// SetLibraryRoots sets the root directories of the library. The caller should
+// rescan the library and call SyncPlaylist afterwards.
+func (s *State) SetLibraryRoots(roots []string) {
+	s.library.Source = &library.Source{Roots: roots}
+
+	// Forget the name patterns of the removed roots.
+	for root := range s.namePatterns {
+		if !containsString(roots, root) {
+			delete(s.namePatterns, root)
+		}
+	}
+
+	s.MarkChanged()
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// LibraryIndex builds an index of the library tracks. The indices in the index
+// are the indices of the library playlist's tracks.
+func (s *State) LibraryIndex() *library.Index {
+	tracks := make([]playlist.Track, len(s.library.Tracks))
+	for i, track := range s.library.Tracks {
+		tracks[i] = track.Metadata()
+	}
+
+	return library.Build(tracks)
+}
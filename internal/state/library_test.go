@@ -0,0 +1,71 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	_ "github.com/diamondburned/aqours/internal/muse/playlist/m3u"
+	"github.com/go-test/deep"
+)
+
+func TestLibraryJSON(t *testing.T) {
+	s := NewState()
+	s.SetLibraryRoots([]string{"/music"})
+	s.SyncPlaylist(s.Library(), []string{"/music/a.flac", "/music/b.flac"})
+
+	restored := makeStateFromJSON(makeJSONState(s, true), newStateIntern())
+
+	if ineqs := deep.Equal(restored.LibraryRoots(), []string{"/music"}); ineqs != nil {
+		t.Error("unexpected roots:", ineqs)
+	}
+
+	assertTracks(t, restored.Library().Tracks, emptyTracks("/music/a.flac", "/music/b.flac"))
+
+	if _, ok := restored.Playlist(LibraryName); !ok {
+		t.Error("library is not found by its name")
+	}
+	if len(restored.PlaylistNames()) != 0 {
+		t.Error("library is listed in the playlist names")
+	}
+}
+
+func TestLibraryNameReserved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.m3u")
+	if err := os.WriteFile(path, []byte("/music/a.flac\n"), 0644); err != nil {
+		t.Fatal("failed to write playlist:", err)
+	}
+
+	// The playlist was named "Library" before there was a library.
+	s := makeStateFromJSON(jsonState{
+		Playlists:       []jsonPlaylist{{Name: LibraryName, Path: path}},
+		PlayingPlaylist: LibraryName,
+	}, newStateIntern())
+
+	if diff := deep.Equal(s.PlaylistNames(), []PlaylistName{LibraryName + "~1"}); diff != nil {
+		t.Fatal("playlist isn't renamed:", diff)
+	}
+
+	pl, ok := s.Playlist(LibraryName + "~1")
+	if !ok || pl == s.Library() || pl.Name != LibraryName+"~1" {
+		t.Fatal("renamed playlist isn't found")
+	}
+
+	assertTracks(t, pl.Tracks, emptyTracks("/music/a.flac"))
+
+	if s.PlayingPlaylistName() != pl.Name {
+		t.Errorf("playing playlist = %q, want %q", s.PlayingPlaylistName(), pl.Name)
+	}
+
+	other := s.AddPlaylist(&playlist.Playlist{Name: "other"})
+	other.Name = LibraryName
+	s.RenamePlaylist(other, "other")
+
+	if other.Name != "other" {
+		t.Error("playlist is renamed to the library's name")
+	}
+	if _, ok := s.Playlist("other"); !ok {
+		t.Error("playlist isn't found by its old name")
+	}
+}
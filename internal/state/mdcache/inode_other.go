@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package mdcache
+
+import "os"
+
+// inode returns 0, since there are no inodes on this platform.
+func inode(s os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,123 @@
+// Package mdcache implements a persistent cache of track metadata keyed by file
+// path. Each entry records the identity of the file at the time it was probed,
+// so stale entries can be detected once the file changes.
+package mdcache
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// Identity identifies the content of a file. If it changes, then the file has
+// most likely been modified.
+type Identity struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // Unix nanoseconds
+	Inode   uint64 `json:"inode,omitempty"`
+}
+
+// IsZero returns true if the identity is unknown.
+func (id Identity) IsZero() bool {
+	return id == Identity{}
+}
+
+// Stat returns the identity of the file at the given path.
+func Stat(path string) (Identity, error) {
+	s, err := os.Stat(path)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	return FileIdentity(s), nil
+}
+
+// FileIdentity returns the identity of the file with the given info.
+func FileIdentity(s os.FileInfo) Identity {
+	return Identity{
+		Size:    s.Size(),
+		ModTime: s.ModTime().UnixNano(),
+		Inode:   inode(s),
+	}
+}
+
+// Entry is a cache entry. Overrides and the scanned ReplayGain are kept apart
+// from the probed track, so probing again doesn't replace them.
+type Entry struct {
+	Track       playlist.Track       `json:"track"`
+	Identity    Identity             `json:"identity"`
+	Overrides   *playlist.Overrides  `json:"overrides,omitempty"`
+	ScannedGain *playlist.ReplayGain `json:"scanned_gain,omitempty"`
+}
+
+var bucketName = []byte("metadata")
+
+// Cache is a metadata cache stored in a bucket of a database. It is safe to use
+// concurrently.
+type Cache struct {
+	db *bbolt.DB
+}
+
+// New creates a new cache in the given database, creating its bucket if it
+// doesn't exist yet. The cache doesn't own the database.
+func New(db *bbolt.DB) (*Cache, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create bucket")
+	}
+
+	return &Cache{db}, nil
+}
+
+// Get returns the entry of the given path. False is returned if there's none.
+func (c *Cache) Get(path string) (Entry, bool) {
+	var entry Entry
+	var found bool
+
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketName).Get([]byte(path))
+		if b == nil {
+			return nil
+		}
+
+		found = true
+		return json.Unmarshal(b, &entry)
+	})
+	if err != nil {
+		return Entry{}, false
+	}
+
+	return entry, found
+}
+
+// Put writes the given entries in a single transaction.
+func (c *Cache) Put(entries map[string]Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+
+		for path, entry := range entries {
+			entry.Track.Filepath = ""
+
+			b, err := json.Marshal(entry)
+			if err != nil {
+				return errors.Wrapf(err, "failed to marshal %q", path)
+			}
+
+			if err := bucket.Put([]byte(path), b); err != nil {
+				return errors.Wrapf(err, "failed to put %q", path)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,97 @@
+package mdcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"go.etcd.io/bbolt"
+)
+
+func TestCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.db")
+
+	c, db := openCache(t, path)
+
+	entry := Entry{
+		Track:    playlist.Track{Title: "Title", Artist: "Artist", PlayCount: 2},
+		Identity: Identity{Size: 1, ModTime: 2, Inode: 3},
+	}
+
+	if err := c.Put(map[string]Entry{"/a.mp3": entry}); err != nil {
+		t.Fatal("failed to put:", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal("failed to close:", err)
+	}
+
+	// Reopen to make sure the entry is persisted.
+	c, db = openCache(t, path)
+	defer db.Close()
+
+	got, ok := c.Get("/a.mp3")
+	if !ok {
+		t.Fatal("entry not found")
+	}
+	if got != entry {
+		t.Fatalf("unexpected entry:\n got %#v\nwant %#v", got, entry)
+	}
+
+	if _, ok := c.Get("/b.mp3"); ok {
+		t.Fatal("unexpected entry for unknown path")
+	}
+}
+
+func openCache(t *testing.T, path string) (*Cache, *bbolt.DB) {
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal("failed to open database:", err)
+	}
+
+	c, err := New(db)
+	if err != nil {
+		db.Close()
+		t.Fatal("failed to create cache:", err)
+	}
+
+	return c, db
+}
+
+func TestStat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.mp3")
+
+	if err := os.WriteFile(path, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	id1, err := Stat(path)
+	if err != nil {
+		t.Fatal("failed to stat:", err)
+	}
+	if id1.IsZero() {
+		t.Fatal("identity is zero")
+	}
+
+	id2, _ := Stat(path)
+	if id1 != id2 {
+		t.Fatalf("identity changed without modification: %v != %v", id1, id2)
+	}
+
+	if err := os.WriteFile(path, []byte("ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make sure the modification time changes even on coarse filesystems.
+	later := time.Unix(0, id1.ModTime).Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	id3, _ := Stat(path)
+	if id1 == id3 {
+		t.Fatal("identity unchanged after modification")
+	}
+}
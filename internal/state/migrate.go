@@ -0,0 +1,157 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// migration migrates a state object from one version to the next. The object
+// is modified in place.
+type migration func(object map[string]json.RawMessage) error
+
+// migrations is the ordered chain of migrations. The migration at index i
+// migrates the state from version i to version i+1, so the current version is
+// the number of migrations. Migrations must never be changed or removed once
+// released; add a new one instead.
+var migrations = []migration{
+	migrateV0,
+}
+
+// stateVersion is the current version of the state schema.
+var stateVersion = len(migrations)
+
+// ErrTooNew is returned if the state was saved by a newer version of aqours. The
+// state must not be overwritten in that case.
+var ErrTooNew = errors.New("state was saved by a newer version of aqours")
+
+// stateObjectVersion returns the version of the given state object. States
+// without a version predate versioning and are version 0.
+func stateObjectVersion(object map[string]json.RawMessage) (int, error) {
+	v, ok := object["version"]
+	if !ok {
+		return 0, nil
+	}
+
+	var version int
+	if err := json.Unmarshal(v, &version); err != nil {
+		return 0, errors.Wrap(err, "invalid version")
+	}
+
+	if version < 0 {
+		return 0, errors.Errorf("invalid version %d", version)
+	}
+
+	return version, nil
+}
+
+// migrateState migrates the given state JSON object to the current version and
+// returns it along with the version it was in. The returned state is the input
+// itself if it's already up to date. An error wrapping ErrTooNew is returned if
+// the state is newer than what's supported.
+func migrateState(b []byte) ([]byte, int, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(b, &object); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to unmarshal state")
+	}
+
+	version, err := stateObjectVersion(object)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if version > stateVersion {
+		return nil, version, errors.Wrapf(ErrTooNew, "version %d > %d", version, stateVersion)
+	}
+
+	if version == stateVersion {
+		return b, version, nil
+	}
+
+	for v := version; v < stateVersion; v++ {
+		if err := migrations[v](object); err != nil {
+			return nil, version, errors.Wrapf(err, "failed to migrate state from version %d", v)
+		}
+	}
+
+	object["version"] = json.RawMessage(fmt.Sprint(stateVersion))
+
+	b, err = json.Marshal(object)
+	if err != nil {
+		return nil, version, errors.Wrap(err, "failed to marshal migrated state")
+	}
+
+	return b, version, nil
+}
+
+// decodeState decodes the given state, which must be of the current version.
+// Fields that aren't understood are logged, since they'd otherwise be dropped
+// silently on the next save.
+func decodeState(b []byte) (jsonState, error) {
+	var s jsonState
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(new(jsonState)); err != nil {
+		log.Println("state has data that will be dropped:", err)
+	}
+
+	return s, nil
+}
+
+// backupName returns the name of the backup of the given file made before
+// migrating it away from the given version.
+func backupName(path string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", path, version)
+}
+
+// v0RepeatModes maps the numeric repeat modes of version 0 to their names.
+var v0RepeatModes = []string{"none", "all", "single"}
+
+// migrateV0 stores the repeat mode by name instead of by number, so the order
+// of the RepeatMode constants no longer matters, and renames playlist_names to
+// playlists with lowercase keys.
+func migrateV0(object map[string]json.RawMessage) error {
+	if v, ok := object["repeating"]; ok {
+		var mode int
+		if err := json.Unmarshal(v, &mode); err != nil {
+			return errors.Wrap(err, "invalid repeating")
+		}
+
+		if mode < 0 || mode >= len(v0RepeatModes) {
+			return errors.Errorf("unknown repeat mode %d", mode)
+		}
+
+		object["repeating"], _ = json.Marshal(v0RepeatModes[mode])
+	}
+
+	if v, ok := object["playlist_names"]; ok {
+		var playlists []struct {
+			Name string `json:"name"`
+			Path string `json:"path"`
+		}
+
+		// Field names are matched case-insensitively, so the old Name and Path
+		// keys are read just fine.
+		if err := json.Unmarshal(v, &playlists); err != nil {
+			return errors.Wrap(err, "invalid playlist_names")
+		}
+
+		b, err := json.Marshal(playlists)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal playlists")
+		}
+
+		object["playlists"] = b
+		delete(object, "playlist_names")
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files")
+
+// TestMigrateGolden migrates every released state shape in testdata/migrate and
+// compares the result with its golden file. v0-released.json is written by the
+// last release before versioning.
+func TestMigrateGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "migrate", "v*.json"))
+	if err != nil {
+		t.Fatal("failed to glob:", err)
+	}
+
+	for _, input := range inputs {
+		if strings.HasSuffix(input, ".golden.json") {
+			continue
+		}
+
+		input := input
+		name := strings.TrimSuffix(filepath.Base(input), ".json")
+
+		t.Run(name, func(t *testing.T) {
+			b, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal("failed to read input:", err)
+			}
+
+			migrated, _, err := migrateState(b)
+			if err != nil {
+				t.Fatal("failed to migrate:", err)
+			}
+
+			var got bytes.Buffer
+			if err := json.Indent(&got, migrated, "", "\t"); err != nil {
+				t.Fatal("failed to indent:", err)
+			}
+			got.WriteByte('\n')
+
+			golden := strings.TrimSuffix(input, ".json") + ".golden.json"
+
+			if *updateGolden {
+				if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatal("failed to update golden file:", err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal("failed to read golden file:", err)
+			}
+
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("migrated state differs from %s:\n%s", golden, got.Bytes())
+			}
+
+			// The migrated state must be fully understood by the current
+			// version.
+			dec := json.NewDecoder(bytes.NewReader(migrated))
+			dec.DisallowUnknownFields()
+
+			var s jsonState
+			if err := dec.Decode(&s); err != nil {
+				t.Fatal("migrated state has unknown fields:", err)
+			}
+
+			if s.Version != stateVersion {
+				t.Errorf("version = %d, want %d", s.Version, stateVersion)
+			}
+
+			// Migrating an up-to-date state should do nothing.
+			again, version, err := migrateState(migrated)
+			if err != nil {
+				t.Fatal("failed to migrate again:", err)
+			}
+			if version != stateVersion || !bytes.Equal(again, migrated) {
+				t.Errorf("migrating again changed the state: %s", again)
+			}
+		})
+	}
+}
+
+func TestMigrateRepeatMode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want RepeatMode
+	}{
+		{`{"repeating": 0}`, RepeatNone},
+		{`{"repeating": 1}`, RepeatAll},
+		{`{"repeating": 2}`, RepeatSingle},
+	}
+
+	for _, test := range tests {
+		b, _, err := migrateState([]byte(test.in))
+		if err != nil {
+			t.Fatalf("failed to migrate %s: %v", test.in, err)
+		}
+
+		s, err := decodeState(b)
+		if err != nil {
+			t.Fatalf("failed to decode %s: %v", b, err)
+		}
+
+		if s.Repeating != test.want {
+			t.Errorf("%s: repeating = %v, want %v", test.in, s.Repeating, test.want)
+		}
+	}
+
+	if _, _, err := migrateState([]byte(`{"repeating": 3}`)); err == nil {
+		t.Error("unexpected success migrating an unknown repeat mode")
+	}
+}
+
+func TestMigrateTooNew(t *testing.T) {
+	b, err := json.Marshal(map[string]int{"version": stateVersion + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := migrateState(b); !errors.Is(err, ErrTooNew) {
+		t.Fatalf("error = %v, want ErrTooNew", err)
+	}
+}
+
+func TestReadFromFileBackup(t *testing.T) {
+	oldDir := stateDir
+	setStateDir(t.TempDir())
+	t.Cleanup(func() { setStateDir(oldDir) })
+
+	const v0 = `{"playlist_names": [], "repeating": 1, "volume": 42}`
+
+	if err := os.WriteFile(stateFile, []byte(v0), 0644); err != nil {
+		t.Fatal("failed to write state file:", err)
+	}
+
+	s, err := ReadFromFile()
+	if err != nil {
+		t.Fatal("failed to read state:", err)
+	}
+
+	if s.RepeatMode() != RepeatAll || s.Volume() != 42 {
+		t.Errorf("unexpected state: repeat %v, volume %v", s.RepeatMode(), s.Volume())
+	}
+
+	b, err := os.ReadFile(backupName(stateFile, 0))
+	if err != nil {
+		t.Fatal("failed to read backup:", err)
+	}
+	if string(b) != v0 {
+		t.Errorf("backup = %s, want the original state", b)
+	}
+
+	// Migrate the saved state in the database back to version 0 to check
+	// that the database is backed up as well.
+	s.SaveState()
+	s.WaitUntilSaved()
+
+	if err := s.intern.db.PutState([]byte(v0)); err != nil {
+		t.Fatal("failed to put old state:", err)
+	}
+	s.Close()
+
+	s, err = ReadFromFile()
+	if err != nil {
+		t.Fatal("failed to read migrated database:", err)
+	}
+	defer s.Close()
+
+	if s.RepeatMode() != RepeatAll {
+		t.Errorf("repeat mode = %v, want RepeatAll", s.RepeatMode())
+	}
+
+	if _, err := os.Stat(backupName(dbFile, 0)); err != nil {
+		t.Error("database wasn't backed up:", err)
+	}
+}
@@ -0,0 +1,94 @@
+package state
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/diamondburned/aqours/internal/muse/metadata/pathguess"
+)
+
+// SetNamePattern sets the pattern that guesses the metadata of the playlist's
+// untagged tracks from their paths. An empty pattern removes it. The caller
+// should probe the playlist's tracks again with Force afterwards.
+func (pl *Playlist) SetNamePattern(pattern string) {
+	pl.NamePattern = pattern
+	pl.state.MarkChanged()
+}
+
+// LibraryNamePattern returns the name pattern of the given library root, or an
+// empty string if it has none.
+func (s *State) LibraryNamePattern(root string) string {
+	return s.namePatterns[root]
+}
+
+// SetLibraryNamePattern sets the pattern that guesses the metadata of the
+// untagged tracks in the given library root from their paths. An empty pattern
+// removes it. The caller should probe the root's tracks again with Force
+// afterwards.
+func (s *State) SetLibraryNamePattern(root, pattern string) {
+	if pattern == "" {
+		delete(s.namePatterns, root)
+	} else {
+		s.namePatterns[root] = pattern
+	}
+
+	s.MarkChanged()
+}
+
+// LibraryRootOf returns the library root that contains the given path. The
+// deepest root is returned if the roots are nested. False is returned if the
+// path isn't in the library.
+func (s *State) LibraryRootOf(path string) (string, bool) {
+	var found string
+
+	for _, root := range s.LibraryRoots() {
+		if len(root) > len(found) && inDir(root, path) {
+			found = root
+		}
+	}
+
+	return found, found != ""
+}
+
+func inDir(dir, path string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// NamePattern returns the pattern that guesses the metadata of the track from
+// its path. The pattern of the track's playlist is used if it has one.
+// Otherwise, the pattern of the library root that has the track is used. Nil
+// is returned if there's none.
+func (t *Track) NamePattern() *pathguess.Pattern {
+	s := t.playlist.state
+
+	pattern := t.playlist.NamePattern
+	if pattern == "" {
+		if root, ok := s.LibraryRootOf(t.Filepath); ok {
+			pattern = s.namePatterns[root]
+		}
+	}
+
+	if pattern == "" {
+		return nil
+	}
+
+	return s.intern.parsePattern(pattern)
+}
+
+// parsePattern parses the given name pattern once. Nil is returned if it's
+// invalid.
+func (intern *stateIntern) parsePattern(pattern string) *pathguess.Pattern {
+	p, ok := intern.patterns[pattern]
+	if ok {
+		return p
+	}
+
+	p, err := pathguess.Parse(pattern)
+	if err != nil {
+		log.Printf("invalid name pattern %q: %v", pattern, err)
+	}
+
+	intern.patterns[pattern] = p
+	return p
+}
@@ -14,17 +14,34 @@ type Playlist struct {
 	Path   string
 	Tracks []*Track
 
+	// Generator generates the playlist's tracks if it's not nil. Generated
+	// playlists are read-only.
+	Generator playlist.Generator
+	// Source is the source that the playlist's tracks are kept in sync with if
+	// it's not nil. Synced playlists are read-only.
+	Source playlist.Source
+	// NamePattern is the pattern that guesses the metadata of untagged tracks
+	// from their paths. It's kept in the state, since playlist files can't
+	// store it.
+	NamePattern string
+
+	// columns is the playlist's own column layout, or nil if it uses the
+	// default one.
+	columns *ColumnLayout
+
 	state   *State
 	unsaved uint32 // atomic
 }
 
 func convertPlaylist(state *State, orig *playlist.Playlist) *Playlist {
 	playlist := &Playlist{
-		Name:    orig.Name,
-		Path:    orig.Path,
-		Tracks:  make([]*Track, len(orig.Tracks)),
-		state:   state,
-		unsaved: 0, // fresh state
+		Name:      orig.Name,
+		Path:      orig.Path,
+		Tracks:    make([]*Track, len(orig.Tracks)),
+		Generator: orig.Generator,
+		Source:    orig.Source,
+		state:     state,
+		unsaved:   0, // fresh state
 	}
 
 	for i, track := range orig.Tracks {
@@ -34,17 +51,132 @@ func convertPlaylist(state *State, orig *playlist.Playlist) *Playlist {
 		}
 
 		// Reincrement reference.
-		md, ok := state.metadata[track.Filepath]
-		if !ok {
-			md = newMetadata(track)
-			state.metadata[track.Filepath] = md
-			state.intern.unsaved = true
+		state.metadataFor(track.Filepath, track).reference++
+	}
+
+	return playlist
+}
+
+// IsGenerated returns true if the playlist's tracks are generated, such as a
+// smart playlist. Tracks cannot be added to or removed from these playlists.
+func (pl *Playlist) IsGenerated() bool {
+	return pl.Generator != nil
+}
+
+// IsReadOnly returns true if the user cannot add or remove tracks from the
+// playlist, which is the case for generated and synced playlists.
+func (pl *Playlist) IsReadOnly() bool {
+	return pl.Generator != nil || pl.Source != nil
+}
+
+// SetSource sets the playlist's source. It marks the playlist as unsaved. The
+// caller should rescan the source and call SyncPlaylist afterwards. The
+// playlist must already be synced.
+func (pl *Playlist) SetSource(src playlist.Source) {
+	assert(pl.Source == nil, "SetSource called on static playlist")
+	assert(src == nil, "SetSource called with nil source")
+
+	pl.Source = src
+	pl.SetUnsaved()
+}
+
+// SetGenerator sets the playlist's generator and regenerates the playlist. It
+// marks the playlist as unsaved. The playlist must already be generated.
+func (pl *Playlist) SetGenerator(gen playlist.Generator) {
+	assert(!pl.IsGenerated(), "SetGenerator called on static playlist")
+	assert(gen == nil, "SetGenerator called with nil generator")
+
+	pl.Generator = gen
+	pl.SetUnsaved()
+	pl.state.RegeneratePlaylist(pl)
+}
+
+// regenerate regenerates the tracks of a generated playlist from the tracks of
+// the playlists that aren't generated. Tracks that are still in the playlist
+// keep their pointers. Like other tracks, the generated tracks reference their
+// metadata. It returns false if the playlist is unchanged.
+func (pl *Playlist) regenerate() bool {
+	generated := pl.Generator.Generate(pl.state.generatorTracks())
+
+	if len(generated) == len(pl.Tracks) {
+		changed := false
+		for i, track := range generated {
+			if pl.Tracks[i].Filepath != track.Filepath {
+				changed = true
+				break
+			}
 		}
+		if !changed {
+			return false
+		}
+	}
 
-		md.reference++
+	old := make(map[string]*Track, len(pl.Tracks))
+	for _, track := range pl.Tracks {
+		old[track.Filepath] = track
 	}
 
-	return playlist
+	tracks := make([]*Track, len(generated))
+
+	for i, track := range generated {
+		t, ok := old[track.Filepath]
+		if ok {
+			delete(old, track.Filepath)
+		} else {
+			t = &Track{
+				Filepath: track.Filepath,
+				playlist: pl,
+			}
+			pl.state.metadata.ref(track.Filepath)
+		}
+		tracks[i] = t
+	}
+
+	// Unreference the removed tracks only after the new tracks have been
+	// referenced.
+	for path := range old {
+		pl.state.metadata.unref(pl.state, path)
+	}
+
+	pl.Tracks = tracks
+	return true
+}
+
+// generatorTracks returns the tracks that generated playlists are generated
+// from, which are the tracks of the library and of the playlists that aren't
+// generated. Generated playlists aren't included, since they would otherwise
+// keep their own tracks. The tracks are sorted by path, so the order given to
+// the generators is deterministic.
+func (s *State) generatorTracks() []playlist.Track {
+	var all []playlist.Track
+	seen := make(map[string]bool, len(s.metadata))
+
+	add := func(pl *Playlist) {
+		for _, t := range pl.Tracks {
+			md, ok := s.metadata[t.Filepath]
+			if !ok || seen[t.Filepath] {
+				continue
+			}
+			seen[t.Filepath] = true
+
+			track := md.track()
+			track.Filepath = t.Filepath
+			all = append(all, track)
+		}
+	}
+
+	if s.library != nil {
+		add(s.library)
+	}
+
+	for _, pl := range s.playlists {
+		if !pl.IsGenerated() {
+			add(pl)
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].Filepath < all[j].Filepath })
+	return all
 }
 
 // SetUnsaved marks the playlist as unsaved.
@@ -61,24 +193,16 @@ func (pl *Playlist) IsUnsaved() bool {
 // playlist as unsaved. If before is false, then the track is appended after the
 // index. If before is true, then the track is appended before the index. The
 // returned integers are the positions of the inserted tracks. If len(paths) is
-// 0, then ix is returned for both.
+// 0 or the playlist is read-only, then ix is returned for both.
 func (pl *Playlist) Add(ix int, before bool, paths ...string) (start, end int) {
-	if len(paths) == 0 {
+	if len(paths) == 0 || pl.IsReadOnly() {
 		return ix, ix
 	}
 
-	pl.SetUnsaved()
-
-	if !before {
-		ix++
-	}
-
-	// https://github.com/golang/go/wiki/SliceTricks
-	pl.Tracks = append(pl.Tracks, make([]*Track, len(paths))...)
-	copy(pl.Tracks[ix+len(paths):], pl.Tracks[ix:])
+	start, end = pl.insert(ix, before, len(paths))
 
 	for i, path := range paths {
-		pl.Tracks[ix+i] = &Track{
+		pl.Tracks[start+i] = &Track{
 			Filepath: path,
 			playlist: pl,
 		}
@@ -86,18 +210,70 @@ func (pl *Playlist) Add(ix int, before bool, paths ...string) (start, end int) {
 		pl.state.metadata.ref(path)
 	}
 
-	return ix, ix + len(paths)
+	return start, end
+}
+
+// AddTracks adds the given tracks similarly to Add, except the metadata of the
+// given tracks are used if the global metadata store doesn't have them yet.
+// Existing metadata is always reused, so tracks that were already probed
+// elsewhere don't need to be probed again.
+func (pl *Playlist) AddTracks(ix int, before bool, tracks ...playlist.Track) (start, end int) {
+	if len(tracks) == 0 || pl.IsReadOnly() {
+		return ix, ix
+	}
+
+	start, end = pl.insert(ix, before, len(tracks))
+
+	for i, track := range tracks {
+		pl.Tracks[start+i] = &Track{
+			Filepath: track.Filepath,
+			playlist: pl,
+		}
+
+		pl.state.metadataFor(track.Filepath, track).reference++
+	}
+
+	return start, end
+}
+
+// insert grows the track slice by n nil tracks at the position described by ix
+// and before. It returns the range of the new tracks.
+func (pl *Playlist) insert(ix int, before bool, n int) (start, end int) {
+	pl.SetUnsaved()
+
+	if !before {
+		ix++
+	}
+
+	// Clamp the index, since inserting after the last track or into an empty
+	// playlist is valid.
+	if ix > len(pl.Tracks) {
+		ix = len(pl.Tracks)
+	}
+	if ix < 0 {
+		ix = 0
+	}
+
+	// https://github.com/golang/go/wiki/SliceTricks
+	pl.Tracks = append(pl.Tracks, make([]*Track, n)...)
+	copy(pl.Tracks[ix+n:], pl.Tracks[ix:])
+
+	pl.state.invalidateGenerated()
+
+	return ix, ix + n
 }
 
 // Remove removes the tracks with the given indices. The function guarantees
 // that the delete will never touch tracks that didn't have the given indices
-// before removal; it does this by sorting the internal array of ixs.
+// before removal; it does this by sorting the internal array of ixs. It does
+// nothing if the playlist is read-only.
 func (pl *Playlist) Remove(ixs ...int) {
-	if len(ixs) == 0 {
+	if len(ixs) == 0 || pl.IsReadOnly() {
 		return
 	}
 
 	pl.SetUnsaved()
+	pl.state.invalidateGenerated()
 
 	// Sort indices from largest to smallest so we could pop the last track off
 	// first to preserve order.
@@ -112,6 +288,8 @@ func (pl *Playlist) Remove(ixs ...int) {
 		pl.Tracks[len(pl.Tracks)-1] = nil        // nil last
 		pl.Tracks = pl.Tracks[:len(pl.Tracks)-1] // omit last
 	}
+
+	pl.state.pruneQueue(pl)
 }
 
 // Save saves the playlist. The function must not be called in another
@@ -125,13 +303,19 @@ func (pl *Playlist) Save(done func(error)) {
 	}
 
 	playlistCopy := playlist.Playlist{
-		Name:   pl.Name,
-		Path:   pl.Path,
-		Tracks: make([]playlist.Track, len(pl.Tracks)),
+		Name:      pl.Name,
+		Path:      pl.Path,
+		Generator: pl.Generator,
+		Source:    pl.Source,
 	}
 
-	for i, track := range pl.Tracks {
-		playlistCopy.Tracks[i] = track.Metadata()
+	// Generated and synced playlists don't store their tracks.
+	if !pl.IsReadOnly() {
+		playlistCopy.Tracks = make([]playlist.Track, len(pl.Tracks))
+
+		for i, track := range pl.Tracks {
+			playlistCopy.Tracks[i] = track.Metadata()
+		}
 	}
 
 	go playlistCopy.Save(func(err error) {
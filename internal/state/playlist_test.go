@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/diamondburned/aqours/internal/muse/playlist"
 	"github.com/go-test/deep"
 )
 
@@ -64,6 +65,55 @@ func TestAdd(t *testing.T) {
 	})
 }
 
+func TestAddTracks(t *testing.T) {
+	testRunPlaylistTests(t, []playlistTest{
+		{
+			name: "empty playlist after",
+			apply: func(t *testing.T, pl *Playlist) {
+				addTracksAndAssert(t, pl, 0, false, "0", "1")
+			},
+			expect: emptyTracks("0", "1"),
+		},
+		{
+			name: "after last",
+			apply: func(t *testing.T, pl *Playlist) {
+				pl.Tracks = emptyTracks("0", "1")
+				addTracksAndAssert(t, pl, 1, false, "2")
+			},
+			expect: emptyTracks("0", "1", "2"),
+		},
+		{
+			name: "reuse metadata",
+			apply: func(t *testing.T, pl *Playlist) {
+				pl.state.metadata["0"] = newMetadata(playlist.Track{Title: "zero"})
+				pl.state.metadata["0"].reference = 1
+
+				addTracksAndAssert(t, pl, 0, true, "0", "1")
+
+				if md := pl.state.metadata["0"]; md.Title != "zero" || md.reference != 2 {
+					t.Errorf("unexpected metadata for 0: %q (%d refs)", md.Title, md.reference)
+				}
+				if md := pl.state.metadata["1"]; md.Title != "1" || md.reference != 1 {
+					t.Errorf("unexpected metadata for 1: %q (%d refs)", md.Title, md.reference)
+				}
+			},
+			expect: emptyTracks("0", "1"),
+		},
+	})
+}
+
+func addTracksAndAssert(t *testing.T, pl *Playlist, ix int, before bool, paths ...string) {
+	t.Helper()
+
+	tracks := make([]playlist.Track, len(paths))
+	for i, path := range paths {
+		tracks[i] = playlist.Track{Title: path, Filepath: path}
+	}
+
+	i, j := pl.AddTracks(ix, before, tracks...)
+	assertTracks(t, pl.Tracks[i:j], emptyTracks(paths...))
+}
+
 func addAndAssert(t *testing.T, pl *Playlist, ix int, before bool, paths ...string) {
 	t.Helper()
 
@@ -124,13 +174,87 @@ func TestRemove(t *testing.T) {
 	})
 }
 
+func TestRegenerateReferences(t *testing.T) {
+	s := NewState()
+
+	static := s.AddPlaylist(&playlist.Playlist{Name: "static"})
+	static.AddTracks(0, true,
+		playlist.Track{Filepath: "/a", Title: "Match"},
+		playlist.Track{Filepath: "/b", Title: "Other"},
+	)
+
+	gen := s.AddPlaylist(&playlist.Playlist{Name: "generated", Generator: titleGenerator("Match")})
+	assertTracks(t, gen.Tracks, emptyTracks("/a"))
+
+	if md := s.metadata["/a"]; md == nil || md.reference != 2 {
+		t.Fatalf("unexpected metadata %v", md)
+	}
+
+	s.DeletePlaylist("static")
+
+	// The generated track keeps its metadata until it's regenerated.
+	if md := gen.Tracks[0].Metadata(); md.Title != "Match" {
+		t.Errorf("generated track lost its metadata: %#v", md)
+	}
+
+	s.RegeneratePlaylists()
+	assertTracks(t, gen.Tracks, emptyTracks())
+
+	if len(s.metadata) != 0 {
+		t.Errorf("unexpected metadata left: %v", s.metadata)
+	}
+}
+
+func TestRegeneratePlayingRemoved(t *testing.T) {
+	s := NewState()
+
+	static := s.AddPlaylist(&playlist.Playlist{Name: "static"})
+	static.AddTracks(0, true,
+		playlist.Track{Filepath: "/1", Title: "Match"},
+		playlist.Track{Filepath: "/2", Title: "Match"},
+		playlist.Track{Filepath: "/3", Title: "Match"},
+	)
+
+	gen := s.AddPlaylist(&playlist.Playlist{Name: "generated", Generator: titleGenerator("Match")})
+
+	s.SetPlayingPlaylist(gen)
+	s.Next()
+
+	_, playing := s.NowPlaying()
+	if playing == nil || playing.Filepath != "/2" {
+		t.Fatalf("playing track = %v, want /2", playing)
+	}
+
+	// The playing track doesn't match anymore.
+	static.Tracks[1].UpdateMetadata(playlist.Track{Title: "Other"})
+	s.RegeneratePlaylists()
+
+	assertTracks(t, gen.Tracks, emptyTracks("/1", "/3"))
+
+	// The removed track keeps playing, then the playlist continues after it.
+	if _, track := s.NowPlaying(); track != playing {
+		t.Errorf("playing track = %v, want /2", track)
+	}
+
+	if _, track := s.Next(); track == nil || track.Filepath != "/3" {
+		t.Errorf("next track = %v, want /3", track)
+	}
+
+	if _, track := s.Previous(); track == nil || track.Filepath != "/1" {
+		t.Errorf("previous track = %v, want /1", track)
+	}
+}
+
 func testRunPlaylistTests(t *testing.T, tests []playlistTest) {
 	t.Helper()
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			pl := Playlist{
-				state: &State{metadata: make(metadataMap)},
+				state: &State{
+					intern:   newStateIntern(),
+					metadata: make(metadataMap),
+				},
 			}
 			test.apply(t, &pl)
 
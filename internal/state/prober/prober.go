@@ -1,123 +1,147 @@
+// Package prober probes the metadata of tracks in the background. Jobs are
+// probed in order of priority, jobs of the same file are merged, and jobs are
+// dropped once their context is cancelled. The number of workers adapts to how
+// fast files are probed.
 package prober
 
 import (
+	"context"
 	"log"
-	"sync"
 
+	"github.com/diamondburned/aqours/internal/muse/metadata/pathguess"
 	"github.com/diamondburned/aqours/internal/muse/playlist"
 	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/state/mdcache"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 )
 
+// Priority is the priority of a job. Jobs of higher priorities are probed
+// first.
+type Priority int
+
+const (
+	// PriorityBackground is for tracks that aren't shown, such as the
+	// library's.
+	PriorityBackground Priority = iota
+	// PriorityNormal is for the tracks of an opened track list.
+	PriorityNormal
+	// PriorityVisible is for tracks on screen.
+	PriorityVisible
+	// PriorityPlaying is for the track being played.
+	PriorityPlaying
+)
+
 // Job is an internal type that allows a track to be copied in a thread-safe way
 // for probing.
 type Job struct {
-	done func() // called in glib
-	ptr  *state.Track
-	cpy  playlist.Track
+	ctx   context.Context
+	done  func() // called in glib
+	ptr   *state.Track
+	cpy   playlist.Track
+	ident mdcache.Identity
+	// pattern guesses the metadata that the file doesn't have if it's not
+	// nil.
+	pattern *pathguess.Pattern
 	// Force, if true, forces a reprobe.
 	Force bool
 }
 
-// NewJob creates a new job. done will be called in the glib main thread.
+// NewJob creates a new job. The track is only probed if it's not probed yet, if
+// its file has changed since it was last probed or if it was probed by an older
+// ProbeVersion. done will be called in the glib main thread only if the track
+// is probed.
 func NewJob(track *state.Track, done func()) Job {
 	return Job{
-		ptr:  track,
-		done: done,
-		cpy:  track.Metadata(),
+		ptr:     track,
+		done:    done,
+		cpy:     track.ProbedMetadata(),
+		ident:   track.Identity(),
+		pattern: track.NamePattern(),
 	}
 }
 
-// This is quite arbitrary, but it should be fast enough on a local disk and
-// doesn't clog much on a remote mount.
-var maxJobs = 4
+// cancelled returns true if the job's context is done.
+func (job *Job) cancelled() bool {
+	return job.ctx != nil && job.ctx.Err() != nil
+}
 
-// Variables needed for dynamically scaling workers.
-var (
-	runningMut   sync.Mutex
-	probeQueue   chan Job
-	probingGroup sync.WaitGroup
-)
+// probe probes the job's track if needed. It returns false if the track isn't
+// probed.
+func (job *Job) probe() bool {
+	ident, statErr := mdcache.Stat(job.cpy.Filepath)
+	stale := statErr == nil && ident != job.ident
 
-func ensureRunning() {
-	// log.Println("worker group++")
-	probingGroup.Add(1)
+	// Tracks probed by an older version may be missing metadata that the
+	// probers have since learned to read.
+	if !job.ident.IsZero() && job.cpy.ProbeVersion < playlist.ProbeVersion {
+		stale = true
+	}
 
-	runningMut.Lock()
-	defer runningMut.Unlock()
+	if !job.Force && !stale && job.cpy.IsProbed() {
+		return false
+	}
 
-	if probeQueue != nil {
-		return
+	if err := job.cpy.ForceProbe(); err != nil {
+		log.Printf("error probing %q: %v", job.cpy.Filepath, err)
 	}
 
-	probeQueue = make(chan Job)
-	startRunning(probeQueue)
-}
+	// Keep the old identity if the file can't be read, so that it's probed
+	// again once it can be.
+	if statErr == nil {
+		job.ident = ident
+	}
 
-func stopRunning() {
-	// log.Println("worker group--")
-	probingGroup.Done()
+	return true
 }
 
-func startRunning(queue <-chan Job) {
-	// log.Println("starting prober workers")
+// guess returns the given probed metadata with the metadata that the file
+// doesn't have guessed by the job's own name pattern, since the merged jobs of
+// a file may be from playlists with different patterns.
+func (job *Job) guess(probed playlist.Track) playlist.Track {
+	if job.pattern != nil {
+		probed.GuessFromPath(job.pattern)
+	}
+	return probed
+}
 
-	go func() {
-		probingGroup.Wait()
+// probeEntry probes the file of the entry once for all of its jobs, then
+// updates the tracks of the jobs that are still wanted in the main thread.
+func probeEntry(e *entry) {
+	job := e.jobs[0]
+	job.Force = e.force
 
-		runningMut.Lock()
-		defer runningMut.Unlock()
+	if !job.probe() {
+		return
+	}
 
-		// Kill all current workers.
-		if queue == probeQueue {
-			close(probeQueue)
-			probeQueue = nil
-		}
-	}()
-
-	// Go is probably efficient enough to make this a minor issue.
-	for i := 0; i < maxJobs; i++ {
-		go func() {
-			// log.Println("worker started")
-			// defer log.Println("worker stopped")
-
-			for job := range queue {
-				job := job // copy for IdleAdd
-
-				var err error
-				if job.Force {
-					// Probe and update the copy.
-					err = job.cpy.ForceProbe()
-				} else {
-					err = job.cpy.Probe()
-				}
-
-				if err != nil {
-					log.Printf("error probing %q: %v", job.cpy.Filepath, err)
-				}
-
-				glib.IdleAdd(func() {
-					// Update the original track with the copy.
-					job.ptr.UpdateMetadata(job.cpy)
-					job.done()
-				})
+	glib.IdleAdd(func() {
+		for _, j := range e.jobs {
+			if j.cancelled() {
+				continue
 			}
-		}()
-	}
+			// Update the original track with the copy.
+			j.ptr.UpdateProbedMetadata(j.guess(job.cpy), job.ident)
+			j.done()
+		}
+	})
 }
 
-// Queue queues multiple probeJobs. It is thread-safe and non-blocking.
-func Queue(jobs ...Job) {
-	if len(jobs) == 0 {
-		return
-	}
+var defaultScheduler = newScheduler(probeEntry)
 
-	go func() {
-		ensureRunning()
-		defer stopRunning()
+// Queue queues the given jobs with the given priority. Jobs are dropped once
+// ctx is cancelled, and their done callbacks are no longer called. It is
+// thread-safe and non-blocking.
+func Queue(ctx context.Context, priority Priority, jobs ...Job) {
+	defaultScheduler.queue(ctx, priority, jobs)
+}
 
-		for _, job := range jobs {
-			probeQueue <- job
-		}
-	}()
+// Prioritize raises the priority of the queued jobs of the given tracks to the
+// given priority. Jobs that already have a higher priority are left alone.
+func Prioritize(priority Priority, tracks ...*state.Track) {
+	paths := make([]string, len(tracks))
+	for i, track := range tracks {
+		paths[i] = track.Filepath
+	}
+
+	defaultScheduler.prioritize(priority, paths)
 }
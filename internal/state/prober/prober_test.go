@@ -0,0 +1,220 @@
+package prober
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/metadata/pathguess"
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/go-test/deep"
+)
+
+func testJob(path string, force bool) Job {
+	return Job{
+		cpy:   playlist.Track{Filepath: path},
+		Force: force,
+	}
+}
+
+// testScheduler is a scheduler with a single worker whose probes are recorded.
+// The probe of the path "block" blocks until unblock is called.
+type testScheduler struct {
+	*scheduler
+	started chan struct{}
+	gate    chan struct{}
+	probed  chan *entry
+}
+
+func newTestScheduler() *testScheduler {
+	s := &testScheduler{
+		started: make(chan struct{}),
+		gate:    make(chan struct{}),
+		probed:  make(chan *entry, 100),
+	}
+
+	s.scheduler = newScheduler(func(e *entry) {
+		if e.path == "block" {
+			s.started <- struct{}{}
+			<-s.gate
+		}
+		s.probed <- e
+	})
+	s.tuner = newTuner(1, 1)
+
+	return s
+}
+
+// block queues a job that blocks the worker until unblock is called.
+func (s *testScheduler) block() {
+	s.queue(context.Background(), PriorityPlaying, []Job{testJob("block", false)})
+	<-s.started
+}
+
+// unblock unblocks the worker and returns the next n probed entries.
+func (s *testScheduler) unblock(t *testing.T, n int) []*entry {
+	close(s.gate)
+
+	entries := make([]*entry, 0, n)
+	for len(entries) < n {
+		select {
+		case e := <-s.probed:
+			entries = append(entries, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %d entries", len(entries))
+		}
+	}
+
+	select {
+	case e := <-s.probed:
+		t.Errorf("unexpected probe of %q", e.path)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	return entries
+}
+
+func entryPaths(entries []*entry) []string {
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.path
+	}
+	return paths
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s := newTestScheduler()
+	s.block()
+
+	ctx := context.Background()
+	s.queue(ctx, PriorityBackground, []Job{testJob("a", false)})
+	s.queue(ctx, PriorityNormal, []Job{testJob("b", false), testJob("c", false)})
+	s.queue(ctx, PriorityVisible, []Job{testJob("d", false)})
+	s.prioritize(PriorityPlaying, []string{"c", "unknown"})
+
+	paths := entryPaths(s.unblock(t, 5))
+	expect := []string{"block", "c", "d", "b", "a"}
+
+	if ineqs := deep.Equal(paths, expect); ineqs != nil {
+		t.Errorf("probed %q, expected %q", paths, expect)
+	}
+}
+
+func TestSchedulerDedupe(t *testing.T) {
+	s := newTestScheduler()
+	s.block()
+
+	ctx := context.Background()
+	s.queue(ctx, PriorityBackground, []Job{testJob("a", false)})
+	s.queue(ctx, PriorityNormal, []Job{testJob("b", false)})
+	s.queue(ctx, PriorityVisible, []Job{testJob("a", true)})
+
+	entries := s.unblock(t, 3)
+
+	if paths := entryPaths(entries); deep.Equal(paths, []string{"block", "a", "b"}) != nil {
+		t.Fatalf("unexpected probe order %q", paths)
+	}
+
+	if a := entries[1]; len(a.jobs) != 2 || !a.force {
+		t.Errorf("entry has %d jobs and force %v, expected 2 jobs and force", len(a.jobs), a.force)
+	}
+}
+
+func TestJobGuess(t *testing.T) {
+	probed := playlist.Track{Filepath: "/music/A/B/01 - C.flac", Title: "01 - C", Unprobeable: true}
+
+	byArtist := testJob(probed.Filepath, false)
+	byArtist.pattern, _ = pathguess.Parse("%artist%/%album%/%number% - %title%")
+
+	byAlbum := testJob(probed.Filepath, false)
+	byAlbum.pattern, _ = pathguess.Parse("%album%/%genre%/%number% - %title%")
+
+	// Each merged job guesses with its own pattern.
+	if g := byArtist.guess(probed); g.Artist != "A" || g.Album != "B" || g.Title != "C" {
+		t.Errorf("unexpected guess by artist pattern: %#v", g)
+	}
+	if g := byAlbum.guess(probed); g.Album != "A" || g.Genre != "B" || g.Artist != "" {
+		t.Errorf("unexpected guess by album pattern: %#v", g)
+	}
+	if probed.Artist != "" || probed.Title != "01 - C" {
+		t.Errorf("probed metadata was changed: %#v", probed)
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s := newTestScheduler()
+	s.block()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	live := context.Background()
+
+	s.queue(cancelled, PriorityVisible, []Job{testJob("a", false), testJob("b", false)})
+	s.queue(live, PriorityNormal, []Job{testJob("c", false)})
+	// b is still wanted by a live job.
+	s.queue(live, PriorityBackground, []Job{testJob("b", false)})
+
+	paths := entryPaths(s.unblock(t, 3))
+	expect := []string{"block", "b", "c"}
+
+	if ineqs := deep.Equal(paths, expect); ineqs != nil {
+		t.Errorf("probed %q, expected %q", paths, expect)
+	}
+}
+
+// simulateTuner runs the tuner against the given throughput model for the
+// given number of windows and returns the final number of workers.
+func simulateTuner(tn *tuner, windows int, rate func(workers int) float64) int {
+	now := time.Unix(0, 0)
+	tn.observe(now)
+
+	for i := 0; i < windows*tuneWindow; i++ {
+		now = now.Add(time.Duration(float64(time.Second) / rate(tn.workers)))
+		tn.observe(now)
+	}
+
+	return tn.workers
+}
+
+func TestTunerPeak(t *testing.T) {
+	// Throughput scales with the number of workers until 8, after which the
+	// workers contend with each other.
+	rate := func(workers int) float64 {
+		if workers <= 8 {
+			return float64(workers) * 10
+		}
+		return 80 - float64(workers-8)*5
+	}
+
+	tn := newTuner(minWorkers, maxWorkers)
+	if workers := simulateTuner(&tn, 100, rate); workers < 7 || workers > 9 {
+		t.Errorf("workers = %d, expected around 8", workers)
+	}
+}
+
+func TestTunerPlateau(t *testing.T) {
+	// Throughput doesn't improve past 3 workers, so more are a waste.
+	rate := func(workers int) float64 {
+		if workers <= 3 {
+			return float64(workers) * 10
+		}
+		return 30
+	}
+
+	tn := newTuner(minWorkers, maxWorkers)
+	tn.workers = 20
+
+	if workers := simulateTuner(&tn, 100, rate); workers < 2 || workers > 4 {
+		t.Errorf("workers = %d, expected around 3", workers)
+	}
+}
+
+func TestTunerBounds(t *testing.T) {
+	tn := newTuner(minWorkers, maxWorkers)
+
+	// Throughput keeps improving, but the workers must stay bounded.
+	if workers := simulateTuner(&tn, 100, func(w int) float64 { return float64(w) }); workers > maxWorkers {
+		t.Errorf("workers = %d, expected at most %d", workers, maxWorkers)
+	}
+}
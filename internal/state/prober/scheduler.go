@@ -0,0 +1,186 @@
+package prober
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// entry is a queued file to be probed. Jobs of the same file are merged into
+// one entry.
+type entry struct {
+	path     string
+	priority Priority
+	seq      uint64 // for FIFO order within the same priority
+	index    int    // in the heap
+	force    bool
+	jobs     []Job
+}
+
+// cancelled returns true if all of the entry's jobs are cancelled.
+func (e *entry) cancelled() bool {
+	for i := range e.jobs {
+		if !e.jobs[i].cancelled() {
+			return false
+		}
+	}
+	return true
+}
+
+// entryHeap is a max-heap of entries by priority, then by the order they were
+// queued.
+type entryHeap []*entry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// scheduler runs the workers that probe the queued entries.
+type scheduler struct {
+	probe func(*entry)
+
+	mutex   sync.Mutex
+	heap    entryHeap
+	pending map[string]*entry // by path
+	seq     uint64
+	running int
+	tuner   tuner
+}
+
+func newScheduler(probe func(*entry)) *scheduler {
+	return &scheduler{
+		probe:   probe,
+		pending: make(map[string]*entry),
+		tuner:   newTuner(minWorkers, maxWorkers),
+	}
+}
+
+func (s *scheduler) queue(ctx context.Context, priority Priority, jobs []Job) {
+	if len(jobs) == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, job := range jobs {
+		job.ctx = ctx
+		path := job.cpy.Filepath
+
+		if e, ok := s.pending[path]; ok {
+			e.jobs = append(e.jobs, job)
+			e.force = e.force || job.Force
+			if priority > e.priority {
+				e.priority = priority
+				heap.Fix(&s.heap, e.index)
+			}
+			continue
+		}
+
+		s.seq++
+		e := &entry{
+			path:     path,
+			priority: priority,
+			seq:      s.seq,
+			force:    job.Force,
+			jobs:     []Job{job},
+		}
+
+		s.pending[path] = e
+		heap.Push(&s.heap, e)
+	}
+
+	s.spawn()
+}
+
+func (s *scheduler) prioritize(priority Priority, paths []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, path := range paths {
+		e, ok := s.pending[path]
+		if ok && priority > e.priority {
+			e.priority = priority
+			heap.Fix(&s.heap, e.index)
+		}
+	}
+}
+
+// spawn starts as many workers as needed. It must be called with the mutex
+// held.
+func (s *scheduler) spawn() {
+	for s.running < s.tuner.workers && s.running < len(s.heap) {
+		if s.running == 0 {
+			// The workers were idle, so the last measurement is stale.
+			s.tuner.reset()
+		}
+		s.running++
+		go s.work()
+	}
+}
+
+// next pops the next entry that isn't cancelled. Nil is returned if there are
+// none. It must be called with the mutex held.
+func (s *scheduler) next() *entry {
+	for len(s.heap) > 0 {
+		e := heap.Pop(&s.heap).(*entry)
+		delete(s.pending, e.path)
+
+		if !e.cancelled() {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *scheduler) work() {
+	s.mutex.Lock()
+
+	for {
+		// Stop if there are too many workers now.
+		if s.running > s.tuner.workers {
+			break
+		}
+
+		e := s.next()
+		if e == nil {
+			break
+		}
+
+		s.mutex.Unlock()
+		s.probe(e)
+		s.mutex.Lock()
+
+		s.tuner.observe(time.Now())
+		s.spawn()
+	}
+
+	s.running--
+	s.mutex.Unlock()
+}
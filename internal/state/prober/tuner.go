@@ -0,0 +1,108 @@
+package prober
+
+import "time"
+
+const (
+	// minWorkers and maxWorkers bound the number of workers. Local disks are
+	// usually saturated by a few workers, while remote mounts with a high
+	// latency need more of them to stay busy.
+	minWorkers = 2
+	maxWorkers = 32
+	// startWorkers is the number of workers to start with.
+	startWorkers = 4
+	// tuneWindow is the number of probes to measure the throughput over
+	// before adjusting the number of workers.
+	tuneWindow = 16
+	// tuneTolerance is the relative change in throughput that is considered
+	// noise.
+	tuneTolerance = 0.05
+)
+
+// tuner adjusts the number of workers by hill climbing: the throughput of each
+// window of probes is compared with the last one. Workers keep being added for
+// as long as the throughput improves, and keep being removed for as long as it
+// doesn't get worse, so the fewest workers that reach the best throughput are
+// used. If files are slow to probe because of I/O latency, more workers improve
+// the throughput until the disk or the network is saturated.
+type tuner struct {
+	min, max int
+	workers  int
+	step     int // +1 or -1
+
+	start    time.Time
+	count    int
+	lastRate float64 // probes per second
+}
+
+func newTuner(min, max int) tuner {
+	workers := startWorkers
+	if workers < min {
+		workers = min
+	}
+	if workers > max {
+		workers = max
+	}
+
+	return tuner{
+		min:     min,
+		max:     max,
+		workers: workers,
+		step:    1,
+	}
+}
+
+// reset discards the current measurement. It's called when the workers were
+// idle, since the idle time would count against the throughput.
+func (t *tuner) reset() {
+	t.start = time.Time{}
+	t.count = 0
+	t.lastRate = 0
+}
+
+// observe records a finished probe at the given time.
+func (t *tuner) observe(now time.Time) {
+	if t.start.IsZero() {
+		t.start = now
+		return
+	}
+
+	t.count++
+	if t.count < tuneWindow {
+		return
+	}
+
+	elapsed := now.Sub(t.start)
+	t.start = now
+	t.count = 0
+
+	if elapsed <= 0 {
+		return
+	}
+
+	rate := float64(tuneWindow) / elapsed.Seconds()
+
+	if t.lastRate > 0 {
+		var keep bool
+		if t.step > 0 {
+			keep = rate > t.lastRate*(1+tuneTolerance)
+		} else {
+			keep = rate >= t.lastRate*(1-tuneTolerance)
+		}
+
+		if !keep {
+			t.step = -t.step
+		}
+	}
+	t.lastRate = rate
+
+	t.workers += t.step
+
+	switch {
+	case t.workers > t.max:
+		t.workers = t.max
+		t.step = -1
+	case t.workers < t.min:
+		t.workers = t.min
+		t.step = 1
+	}
+}
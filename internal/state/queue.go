@@ -0,0 +1,192 @@
+package state
+
+// Playlist returns the playlist that the track is in.
+func (t *Track) Playlist() *Playlist {
+	return t.playlist
+}
+
+// Queue returns the tracks that the user has queued, in the order that they'll
+// be played. Queued tracks may be from any playlist, and they're played before
+// the rest of the playing playlist.
+func (s *State) Queue() []*Track {
+	return append([]*Track(nil), s.queue...)
+}
+
+// PlayNext queues the given tracks to be played right after the current track,
+// before the tracks that are already queued.
+func (s *State) PlayNext(tracks ...*Track) {
+	if len(tracks) == 0 {
+		return
+	}
+
+	queue := make([]*Track, 0, len(tracks)+len(s.queue))
+	queue = append(queue, tracks...)
+	queue = append(queue, s.queue...)
+	s.queue = queue
+
+	s.MarkChanged()
+}
+
+// Enqueue adds the given tracks to the end of the queue.
+func (s *State) Enqueue(tracks ...*Track) {
+	if len(tracks) == 0 {
+		return
+	}
+
+	s.queue = append(s.queue, tracks...)
+	s.MarkChanged()
+}
+
+// Dequeue removes the queued track at the given position of the queue. The
+// positions of the queue are the ones in Queue.
+func (s *State) Dequeue(pos int) {
+	if pos < 0 || pos >= len(s.queue) {
+		return
+	}
+
+	s.queue = append(s.queue[:pos], s.queue[pos+1:]...)
+	s.MarkChanged()
+}
+
+// MoveQueued moves the queued track at the given position of the queue to
+// another position.
+func (s *State) MoveQueued(from, to int) {
+	if from < 0 || from >= len(s.queue) || to < 0 || to >= len(s.queue) || from == to {
+		return
+	}
+
+	track := s.queue[from]
+
+	if from < to {
+		copy(s.queue[from:to], s.queue[from+1:to+1])
+	} else {
+		copy(s.queue[to+1:from+1], s.queue[to:from])
+	}
+
+	s.queue[to] = track
+	s.MarkChanged()
+}
+
+// PlayQueued removes the queued track at the given position from the queue and
+// plays it right away. Nil is returned if there's no such track.
+func (s *State) PlayQueued(pos int) *Track {
+	if pos < 0 || pos >= len(s.queue) {
+		return nil
+	}
+
+	track := s.queue[pos]
+	s.queue = append(s.queue[:pos], s.queue[pos+1:]...)
+	s.playing.Queued = track
+
+	s.MarkChanged()
+	return track
+}
+
+// ClearQueue removes all queued tracks.
+func (s *State) ClearQueue() {
+	if len(s.queue) == 0 {
+		return
+	}
+
+	s.queue = nil
+	s.MarkChanged()
+}
+
+// NowPlayingPlaylist returns the playlist of the currently playing track, which
+// is the playing playlist unless the track was queued from another playlist.
+// Nil is returned if nothing is playing.
+func (s *State) NowPlayingPlaylist() *Playlist {
+	if s.playing.Queued != nil {
+		return s.playing.Queued.playlist
+	}
+	return s.playing.Playlist
+}
+
+// popQueue removes the first queued track from the queue and returns it along
+// with its index in its playlist. Nil is returned if the queue is empty.
+func (s *State) popQueue() (int, *Track) {
+	if len(s.queue) == 0 {
+		return -1, nil
+	}
+
+	track := s.queue[0]
+	s.queue = s.queue[1:]
+
+	return s.trackIndex(track), track
+}
+
+// peekQueue returns the first queued track and its index in its playlist
+// without removing it.
+func (s *State) peekQueue() (int, *Track) {
+	if len(s.queue) == 0 {
+		return -1, nil
+	}
+
+	return s.trackIndex(s.queue[0]), s.queue[0]
+}
+
+// pruneQueue removes the queued tracks of the given playlist that were removed
+// from it, or all of them if the playlist was deleted. It's called whenever
+// tracks are removed, so that the queue doesn't need to be checked every time
+// it's read.
+func (s *State) pruneQueue(pl *Playlist) {
+	if len(s.queue) == 0 {
+		return
+	}
+
+	var tracks map[*Track]bool
+	if pl == s.library || s.playlists[pl.Name] == pl {
+		tracks = make(map[*Track]bool, len(pl.Tracks))
+		for _, track := range pl.Tracks {
+			tracks[track] = true
+		}
+	}
+
+	queue := s.queue[:0]
+	for _, track := range s.queue {
+		if track.playlist != pl || tracks[track] {
+			queue = append(queue, track)
+		}
+	}
+
+	// Let the removed tracks be garbage collected.
+	for i := len(queue); i < len(s.queue); i++ {
+		s.queue[i] = nil
+	}
+
+	s.queue = queue
+}
+
+// trackIndex returns the index of the track in its playlist, or -1 if it's not
+// in the playlist anymore or the playlist was deleted.
+func (s *State) trackIndex(track *Track) int {
+	pl := track.playlist
+	if pl != s.library && s.playlists[pl.Name] != pl {
+		return -1
+	}
+
+	for i, t := range pl.Tracks {
+		if t == track {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// queueTrack finds the track with the given path in the playlist with the given
+// name to restore a queued track. Nil is returned if there's no such track.
+func (s *State) queueTrack(plName PlaylistName, path string) *Track {
+	pl, ok := s.Playlist(plName)
+	if !ok {
+		return nil
+	}
+
+	for _, track := range pl.Tracks {
+		if track.Filepath == path {
+			return track
+		}
+	}
+
+	return nil
+}
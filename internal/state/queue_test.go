@@ -0,0 +1,129 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/go-test/deep"
+)
+
+func TestQueue(t *testing.T) {
+	s := NewState()
+	pl := s.AddPlaylist(&playlist.Playlist{
+		Name:   "playing",
+		Tracks: []playlist.Track{{Filepath: "/1"}, {Filepath: "/2"}, {Filepath: "/3"}},
+	})
+	other := s.AddPlaylist(&playlist.Playlist{
+		Name:   "other",
+		Tracks: []playlist.Track{{Filepath: "/a"}, {Filepath: "/b"}, {Filepath: "/c"}},
+	})
+
+	s.SetPlayingPlaylist(pl)
+	s.Play(0)
+
+	s.Enqueue(other.Tracks[1], other.Tracks[2])
+	s.PlayNext(other.Tracks[0])
+	s.MoveQueued(2, 1)
+
+	if diff := deep.Equal([]string{"/a", "/c", "/b"}, trackPaths(s.Queue())); diff != nil {
+		t.Fatal("unexpected queue:", diff)
+	}
+
+	s.Dequeue(1)
+
+	// Queued tracks are played before the rest of the playlist, which then
+	// continues from where it was.
+	var played []string
+	for i := 0; i < 4; i++ {
+		_, track := s.AutoNext()
+		if track == nil {
+			break
+		}
+		played = append(played, track.Filepath)
+
+		if i == 0 && s.NowPlayingPlaylist() != other {
+			t.Error("queued track isn't playing from its playlist")
+		}
+	}
+
+	if diff := deep.Equal([]string{"/a", "/b", "/2", "/3"}, played); diff != nil {
+		t.Fatal("unexpected tracks played:", diff)
+	}
+
+	if len(s.Queue()) != 0 {
+		t.Fatal("queue isn't empty after playing it")
+	}
+}
+
+func TestQueuePrevious(t *testing.T) {
+	s := NewState()
+	pl := s.AddPlaylist(&playlist.Playlist{
+		Name:   "playing",
+		Tracks: []playlist.Track{{Filepath: "/1"}, {Filepath: "/2"}},
+	})
+
+	s.SetPlayingPlaylist(pl)
+	s.Play(1)
+	s.PlayNext(pl.Tracks[0])
+
+	if _, track := s.Peek(); track != pl.Tracks[0] {
+		t.Fatal("queued track isn't peeked")
+	}
+
+	if _, track := s.Next(); track != pl.Tracks[0] {
+		t.Fatal("queued track isn't played")
+	}
+
+	// Going back from the queued track goes back to the playlist's track.
+	if _, track := s.Previous(); track != pl.Tracks[1] {
+		t.Fatalf("previous track = %v, want /2", track)
+	}
+}
+
+func TestQueuePrune(t *testing.T) {
+	s := NewState()
+	pl := s.AddPlaylist(&playlist.Playlist{
+		Name:   "test",
+		Tracks: []playlist.Track{{Filepath: "/1"}, {Filepath: "/2"}},
+	})
+	deleted := s.AddPlaylist(&playlist.Playlist{
+		Name:   "deleted",
+		Tracks: []playlist.Track{{Filepath: "/x"}},
+	})
+
+	s.SetLibraryRoots([]string{"/music"})
+	s.SyncPlaylist(s.Library(), []string{"/music/a", "/music/b"})
+	library := s.Library()
+
+	s.Enqueue(pl.Tracks[0], deleted.Tracks[0], library.Tracks[0], pl.Tracks[1], library.Tracks[1])
+
+	pl.Remove(0)
+	s.DeletePlaylist("deleted")
+	s.SyncPlaylist(library, []string{"/music/b"})
+
+	if diff := deep.Equal([]string{"/2", "/music/b"}, trackPaths(s.Queue())); diff != nil {
+		t.Fatal("removed tracks are still queued:", diff)
+	}
+}
+
+func TestQueueJSON(t *testing.T) {
+	s := NewState()
+	s.SetLibraryRoots([]string{"/music"})
+	s.SyncPlaylist(s.Library(), []string{"/music/a.flac", "/music/b.flac", "/music/c.flac"})
+
+	lib := s.Library()
+	s.SetPlayingPlaylist(lib)
+	s.Play(0)
+	s.Enqueue(lib.Tracks[2], lib.Tracks[1])
+	s.Next()
+
+	restored := makeStateFromJSON(makeJSONState(s, true), newStateIntern())
+
+	if _, track := restored.NowPlaying(); track == nil || track.Filepath != "/music/c.flac" {
+		t.Fatalf("playing queued track isn't restored: %v", track)
+	}
+
+	if diff := deep.Equal([]string{"/music/b.flac"}, trackPaths(restored.Queue())); diff != nil {
+		t.Fatal("unexpected queue:", diff)
+	}
+}
@@ -1,5 +1,7 @@
 package state
 
+import "fmt"
+
 type RepeatMode uint8
 
 const (
@@ -21,3 +23,37 @@ func enableRepeat(playlist bool) RepeatMode {
 func (m RepeatMode) Cycle() RepeatMode {
 	return (m + 1) % repeatLen
 }
+
+var repeatModeNames = [repeatLen]string{
+	RepeatNone:   "none",
+	RepeatAll:    "all",
+	RepeatSingle: "single",
+}
+
+// String returns the name of the repeat mode.
+func (m RepeatMode) String() string {
+	if m < repeatLen {
+		return repeatModeNames[m]
+	}
+	return fmt.Sprintf("RepeatMode(%d)", uint8(m))
+}
+
+// MarshalText marshals the repeat mode by its name, so the saved state doesn't
+// depend on the order of the constants.
+func (m RepeatMode) MarshalText() ([]byte, error) {
+	if m >= repeatLen {
+		return nil, fmt.Errorf("unknown repeat mode %d", uint8(m))
+	}
+	return []byte(repeatModeNames[m]), nil
+}
+
+// UnmarshalText unmarshals the repeat mode from its name.
+func (m *RepeatMode) UnmarshalText(b []byte) error {
+	for mode, name := range repeatModeNames {
+		if name == string(b) {
+			*m = RepeatMode(mode)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown repeat mode %q", b)
+}
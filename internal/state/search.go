@@ -0,0 +1,50 @@
+package state
+
+import "github.com/diamondburned/aqours/internal/muse/playlist"
+
+// SearchResult is a group of search results from one playlist.
+type SearchResult struct {
+	Playlist *Playlist
+	// Indices are the indices of the matching tracks in the playlist.
+	Indices []int
+	// Omitted is the number of matching tracks that were over the limit.
+	Omitted int
+}
+
+// Search returns the tracks that match the given function in the library then
+// in all playlists. Each playlist has at most limit results, or unlimited if
+// limit is 0. Playlists with no matching tracks are skipped.
+func (s *State) Search(match func(playlist.Track) bool, limit int) []SearchResult {
+	var results []SearchResult
+
+	search := func(pl *Playlist) {
+		result := SearchResult{Playlist: pl}
+
+		for i, track := range pl.Tracks {
+			if !match(track.Metadata()) {
+				continue
+			}
+
+			if limit > 0 && len(result.Indices) >= limit {
+				result.Omitted++
+				continue
+			}
+
+			result.Indices = append(result.Indices, i)
+		}
+
+		if len(result.Indices) > 0 {
+			results = append(results, result)
+		}
+	}
+
+	if s.library != nil {
+		search(s.library)
+	}
+
+	for _, name := range s.playlistNames {
+		search(s.playlists[name])
+	}
+
+	return results
+}
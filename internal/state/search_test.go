@@ -0,0 +1,52 @@
+package state
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/go-test/deep"
+)
+
+func TestSearch(t *testing.T) {
+	s := NewState()
+	s.SetLibraryRoots([]string{"/music"})
+	s.SyncPlaylist(s.Library(), []string{"/music/a1", "/music/a2", "/music/b1"})
+
+	s.AddPlaylist(&playlist.Playlist{
+		Name:   "a",
+		Tracks: []playlist.Track{{Filepath: "/music/a2"}, {Filepath: "/x/a3"}},
+	})
+	s.AddPlaylist(&playlist.Playlist{
+		Name:   "b",
+		Tracks: []playlist.Track{{Filepath: "/music/b1"}},
+	})
+
+	isA := func(t playlist.Track) bool { return strings.Contains(t.Filepath, "/a") }
+
+	results := s.Search(isA, 1)
+	expect := []struct {
+		name    string
+		indices []int
+		omitted int
+	}{
+		{LibraryName, []int{0}, 1},
+		{"a", []int{0}, 1},
+	}
+
+	if len(results) != len(expect) {
+		t.Fatalf("expected %d results, got %d", len(expect), len(results))
+	}
+
+	for i, result := range results {
+		if result.Playlist.Name != expect[i].name {
+			t.Errorf("result %d: expected playlist %q, got %q", i, expect[i].name, result.Playlist.Name)
+		}
+		if ineqs := deep.Equal(result.Indices, expect[i].indices); ineqs != nil {
+			t.Errorf("result %d: unexpected indices %v", i, result.Indices)
+		}
+		if result.Omitted != expect[i].omitted {
+			t.Errorf("result %d: expected %d omitted, got %d", i, expect[i].omitted, result.Omitted)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package state
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+)
+
+// ShuffleMode is the way that the playing playlist is shuffled.
+type ShuffleMode uint8
+
+const (
+	// ShuffleTracks shuffles the tracks uniformly.
+	ShuffleTracks ShuffleMode = iota
+	// ShuffleAlbums shuffles the albums, keeping the order of their tracks.
+	ShuffleAlbums
+	// ShuffleSpreadArtists shuffles the tracks while spreading out the tracks
+	// of each artist.
+	ShuffleSpreadArtists
+	// ShuffleWeighted shuffles the tracks while favoring the ones that were
+	// played less or are rated higher.
+	ShuffleWeighted
+	shuffleModeLen
+)
+
+// ShuffleModes are all shuffle modes in the order that they're listed in.
+var ShuffleModes = []ShuffleMode{
+	ShuffleTracks,
+	ShuffleAlbums,
+	ShuffleSpreadArtists,
+	ShuffleWeighted,
+}
+
+var shuffleModeNames = [shuffleModeLen]string{
+	ShuffleTracks:        "tracks",
+	ShuffleAlbums:        "albums",
+	ShuffleSpreadArtists: "spread_artists",
+	ShuffleWeighted:      "weighted",
+}
+
+var shuffleModeLabels = [shuffleModeLen]string{
+	ShuffleTracks:        "Shuffle Tracks",
+	ShuffleAlbums:        "Shuffle Albums",
+	ShuffleSpreadArtists: "Spread Out Artists",
+	ShuffleWeighted:      "Favor Unplayed and Top Rated",
+}
+
+// String returns the name of the shuffle mode.
+func (m ShuffleMode) String() string {
+	if m < shuffleModeLen {
+		return shuffleModeNames[m]
+	}
+	return fmt.Sprintf("ShuffleMode(%d)", uint8(m))
+}
+
+// Label returns the name of the shuffle mode for showing.
+func (m ShuffleMode) Label() string {
+	if m < shuffleModeLen {
+		return shuffleModeLabels[m]
+	}
+	return m.String()
+}
+
+// MarshalText marshals the shuffle mode by its name.
+func (m ShuffleMode) MarshalText() ([]byte, error) {
+	if m >= shuffleModeLen {
+		return nil, fmt.Errorf("unknown shuffle mode %d", uint8(m))
+	}
+	return []byte(shuffleModeNames[m]), nil
+}
+
+// UnmarshalText unmarshals the shuffle mode from its name.
+func (m *ShuffleMode) UnmarshalText(b []byte) error {
+	for mode, name := range shuffleModeNames {
+		if name == string(b) {
+			*m = ShuffleMode(mode)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown shuffle mode %q", b)
+}
+
+// Shuffler returns the shuffler of the mode. The uniform shuffler is returned
+// for unknown modes.
+func (m ShuffleMode) Shuffler() playlist.Shuffler {
+	switch m {
+	case ShuffleAlbums:
+		return playlist.AlbumShuffler{}
+	case ShuffleSpreadArtists:
+		return playlist.ArtistSpreader{}
+	case ShuffleWeighted:
+		return playlist.WeightedShuffler{}
+	default:
+		return playlist.UniformShuffler{}
+	}
+}
+
+// ShuffleMode returns the way that the playing playlist is shuffled.
+func (s *State) ShuffleMode() ShuffleMode {
+	return s.shuffleMode
+}
+
+// SetShuffleMode sets the way that the playing playlist is shuffled. The queue
+// is shuffled again if it's being shuffled, keeping the playing track.
+func (s *State) SetShuffleMode(mode ShuffleMode) {
+	if s.shuffleMode == mode {
+		return
+	}
+
+	defer s.onUpdate()
+
+	s.shuffleMode = mode
+
+	if !s.shuffling || s.playing.Playlist == nil {
+		return
+	}
+
+	_, playing := s.playlistPlaying()
+
+	playlist.ResetQueue(s.playing.Queue)
+	s.shuffleQueue()
+	s.seekQueueTo(playing)
+}
+
+// shuffleQueue shuffles the play queue of the playing playlist by the shuffle
+// mode.
+func (s *State) shuffleQueue() {
+	tracks := make([]playlist.Track, len(s.playing.Playlist.Tracks))
+	for i, track := range s.playing.Playlist.Tracks {
+		tracks[i] = track.Metadata()
+	}
+
+	s.shuffleMode.Shuffler().Shuffle(s.rng(), s.playing.Queue, tracks)
+}
+
+// rng returns a random number generator for the next shuffle, and it advances
+// the shuffle seed. The shuffles are deterministic for a given seed, which is
+// random unless it's restored.
+func (s *State) rng() *rand.Rand {
+	rng := rand.New(rand.NewSource(s.shuffleSeed))
+	s.shuffleSeed = rng.Int63()
+	return rng
+}
+
+// playingOrder returns the paths of the playing playlist's tracks in the order
+// that they're played in. Nil is returned unless the playlist is shuffled,
+// since the order is otherwise the playlist's own.
+func (s *State) playingOrder() []string {
+	if !s.shuffling || s.playing.Playlist == nil {
+		return nil
+	}
+
+	tracks := s.playing.Playlist.Tracks
+
+	order := make([]string, len(s.playing.Queue))
+	for i, ix := range s.playing.Queue {
+		order[i] = tracks[ix].Filepath
+	}
+
+	return order
+}
+
+// restoreOrder restores the saved shuffled order of the playing playlist and the
+// position in it, so the shuffle continues where it was. The tracks are matched
+// by their paths, since the playlist may have changed since the order was
+// saved. Tracks that are gone are dropped, and new tracks are shuffled into the
+// part of the order that hasn't been played yet.
+//
+// If the playing track is gone, then the track after it becomes the current
+// track instead, so it's played next rather than skipped. It isn't counted as
+// played until it's actually played. The order starts over if there's no track
+// after it.
+func (s *State) restoreOrder(order []string, pos int) {
+	tracks := s.playing.Playlist.Tracks
+	rng := s.rng()
+
+	// A path may be in the playlist more than once.
+	ixs := make(map[string][]int, len(tracks))
+	for i, track := range tracks {
+		ixs[track.Filepath] = append(ixs[track.Filepath], i)
+	}
+
+	queue := make([]int, 0, len(tracks))
+	queuePos := 0
+	used := make([]bool, len(tracks))
+
+	for i, path := range order {
+		// If the playing track is gone, then the track after it plays next.
+		if i == pos {
+			queuePos = len(queue)
+		}
+
+		found := ixs[path]
+		if len(found) == 0 {
+			continue
+		}
+
+		queue = append(queue, found[0])
+		used[found[0]] = true
+		ixs[path] = found[1:]
+	}
+
+	// Shuffle the new tracks in after the playing track.
+	start := queuePos + 1
+	if start > len(queue) {
+		start = len(queue)
+	}
+
+	for ix, ok := range used {
+		if ok {
+			continue
+		}
+
+		at := start + rng.Intn(len(queue)-start+1)
+		queue = append(queue, 0)
+		copy(queue[at+1:], queue[at:])
+		queue[at] = ix
+	}
+
+	if queuePos >= len(queue) {
+		queuePos = 0
+	}
+
+	s.playing.Queue = queue
+	s.playing.QueuePos = queuePos
+}
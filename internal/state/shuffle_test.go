@@ -0,0 +1,189 @@
+package state
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/go-test/deep"
+)
+
+func queuePaths(s *State) []string {
+	paths := make([]string, len(s.playing.Queue))
+	for i, ix := range s.playing.Queue {
+		paths[i] = s.playing.Playlist.Tracks[ix].Filepath
+	}
+	return paths
+}
+
+func TestShuffleJSON(t *testing.T) {
+	s := NewState()
+	s.SetLibraryRoots([]string{"/music"})
+	s.SyncPlaylist(s.Library(), []string{
+		"/music/a.flac", "/music/b.flac", "/music/c.flac", "/music/d.flac", "/music/e.flac",
+	})
+
+	s.SetShuffling(true)
+	s.SetPlayingPlaylist(s.Library())
+	s.Next()
+	s.Next()
+
+	restored := makeStateFromJSON(makeJSONState(s, true), newStateIntern())
+
+	if diff := deep.Equal(queuePaths(s), queuePaths(restored)); diff != nil {
+		t.Fatal("shuffled order isn't restored:", diff)
+	}
+
+	_, playing := s.NowPlaying()
+	_, restoredPlaying := restored.NowPlaying()
+	if restoredPlaying == nil || restoredPlaying.Filepath != playing.Filepath {
+		t.Fatalf("playing track = %v, want %s", restoredPlaying, playing.Filepath)
+	}
+}
+
+func TestRestoreOrder(t *testing.T) {
+	s := NewState()
+	pl := s.AddPlaylist(&playlist.Playlist{
+		Name: "test",
+		Tracks: []playlist.Track{
+			{Filepath: "/b"}, {Filepath: "/c"}, {Filepath: "/d"}, {Filepath: "/e"}, {Filepath: "/f"},
+		},
+	})
+
+	s.shuffling = true
+	s.SetPlayingPlaylist(pl)
+
+	// The playlist had /a, which was played, but it's removed, and /f is new.
+	order := []string{"/d", "/a", "/e", "/b", "/x", "/c"}
+	s.restoreOrder(order, 2)
+
+	paths := queuePaths(s)
+	if len(paths) != 5 {
+		t.Fatalf("queue = %v, want 5 tracks", paths)
+	}
+
+	if diff := deep.Equal([]string{"/d", "/e"}, paths[:2]); diff != nil {
+		t.Error("played tracks aren't kept:", diff)
+	}
+
+	if _, track := s.NowPlaying(); track == nil || track.Filepath != "/e" {
+		t.Errorf("playing track = %v, want /e", track)
+	}
+
+	rest := append([]string(nil), paths[2:]...)
+	sort.Strings(rest)
+
+	if diff := deep.Equal([]string{"/b", "/c", "/f"}, rest); diff != nil {
+		t.Error("unexpected unplayed tracks:", diff)
+	}
+
+	// The unplayed tracks that are still there keep their order.
+	pos := make(map[string]int, len(paths))
+	for i, path := range paths {
+		pos[path] = i
+	}
+	if pos["/b"] > pos["/c"] {
+		t.Error("/b is played after /c:", paths)
+	}
+}
+
+func TestRestoreOrderPlayingRemoved(t *testing.T) {
+	s := NewState()
+	pl := s.AddPlaylist(&playlist.Playlist{
+		Name:   "test",
+		Tracks: []playlist.Track{{Filepath: "/a"}, {Filepath: "/c"}, {Filepath: "/d"}},
+	})
+
+	s.shuffling = true
+	s.SetPlayingPlaylist(pl)
+	s.restoreOrder([]string{"/a", "/b", "/c", "/d"}, 1)
+
+	// The track after the removed playing track becomes the current track
+	// without being counted as played.
+	_, track := s.NowPlaying()
+	if track == nil || track.Filepath != "/c" {
+		t.Fatalf("playing track = %v, want /c", track)
+	}
+	if n := track.Metadata().PlayCount; n != 0 {
+		t.Errorf("current track is played %d times, want 0", n)
+	}
+
+	// The rest of the order follows it.
+	if _, track := s.Next(); track == nil || track.Filepath != "/d" {
+		t.Errorf("next track = %v, want /d", track)
+	}
+	if _, track := s.Previous(); track == nil || track.Filepath != "/c" {
+		t.Errorf("previous track = %v, want /c", track)
+	}
+
+	// The order starts over if the removed playing track was the last one.
+	s.restoreOrder([]string{"/a", "/c", "/d", "/b"}, 3)
+
+	if _, track := s.NowPlaying(); track == nil || track.Filepath != "/a" {
+		t.Errorf("playing track = %v, want /a", track)
+	}
+}
+
+func TestShuffleMode(t *testing.T) {
+	s := NewState()
+	pl := s.AddPlaylist(&playlist.Playlist{
+		Name: "test",
+		Tracks: []playlist.Track{
+			{Filepath: "/a/1", Album: "A", Number: 1},
+			{Filepath: "/a/2", Album: "A", Number: 2},
+			{Filepath: "/b/1", Album: "B", Number: 1},
+			{Filepath: "/b/2", Album: "B", Number: 2},
+			{Filepath: "/c/1", Album: "C", Number: 1},
+		},
+	})
+
+	s.shuffleSeed = 1
+	s.SetShuffling(true)
+	s.SetPlayingPlaylist(pl)
+	s.Next()
+
+	_, playing := s.NowPlaying()
+
+	s.SetShuffleMode(ShuffleAlbums)
+
+	// Changing the mode shuffles again without changing the playing track.
+	if _, track := s.NowPlaying(); track != playing {
+		t.Fatalf("playing track = %v, want %s", track, playing.Filepath)
+	}
+
+	paths := queuePaths(s)
+	for i, path := range paths {
+		if path == "/a/2" && (i == 0 || paths[i-1] != "/a/1") {
+			t.Fatal("album isn't played in order:", paths)
+		}
+	}
+
+	restored := makeStateFromJSON(makeJSONState(s, true), newStateIntern())
+
+	if restored.ShuffleMode() != ShuffleAlbums {
+		t.Errorf("shuffle mode = %v, want albums", restored.ShuffleMode())
+	}
+
+	if restored.shuffleSeed != s.shuffleSeed {
+		t.Errorf("shuffle seed = %d, want %d", restored.shuffleSeed, s.shuffleSeed)
+	}
+}
+
+func TestShuffleSeed(t *testing.T) {
+	shuffled := func() []string {
+		s := NewState()
+		s.shuffleSeed = 42
+		s.SetShuffling(true)
+		s.SetPlayingPlaylist(s.AddPlaylist(&playlist.Playlist{
+			Name: "test",
+			Tracks: []playlist.Track{
+				{Filepath: "/1"}, {Filepath: "/2"}, {Filepath: "/3"}, {Filepath: "/4"}, {Filepath: "/5"},
+			},
+		}))
+		return queuePaths(s)
+	}
+
+	if diff := deep.Equal(shuffled(), shuffled()); diff != nil {
+		t.Fatal("shuffles with the same seed differ:", diff)
+	}
+}
@@ -0,0 +1,268 @@
+package state
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// SortField is a metadata field that tracks can be sorted by.
+type SortField string
+
+const (
+	SortTitle       SortField = "title"
+	SortArtist      SortField = "artist"
+	SortAlbum       SortField = "album"
+	SortAlbumArtist SortField = "album_artist"
+	SortComposer    SortField = "composer"
+	SortGenre       SortField = "genre"
+	SortDate        SortField = "date"
+	SortDisc        SortField = "disc"
+	SortNumber      SortField = "number"
+	SortLength      SortField = "length"
+	SortCodec       SortField = "codec"
+	SortSampleRate  SortField = "sample_rate"
+	SortBitrate     SortField = "bitrate"
+	SortFilepath    SortField = "filepath"
+)
+
+// SortFields are all sort fields in the order that they're listed in.
+var SortFields = []SortField{
+	SortTitle,
+	SortArtist,
+	SortAlbum,
+	SortAlbumArtist,
+	SortComposer,
+	SortGenre,
+	SortDate,
+	SortDisc,
+	SortNumber,
+	SortLength,
+	SortCodec,
+	SortSampleRate,
+	SortBitrate,
+	SortFilepath,
+}
+
+var sortFieldNames = map[SortField]string{
+	SortTitle:       "Title",
+	SortArtist:      "Artist",
+	SortAlbum:       "Album",
+	SortAlbumArtist: "Album Artist",
+	SortComposer:    "Composer",
+	SortGenre:       "Genre",
+	SortDate:        "Date",
+	SortDisc:        "Disc",
+	SortNumber:      "Number",
+	SortLength:      "Length",
+	SortCodec:       "Codec",
+	SortSampleRate:  "Sample Rate",
+	SortBitrate:     "Bitrate",
+	SortFilepath:    "File Path",
+}
+
+// Name returns the name of the field for showing.
+func (f SortField) Name() string {
+	if name, ok := sortFieldNames[f]; ok {
+		return name
+	}
+	return string(f)
+}
+
+// text returns the value of a text field. False is returned if the field is a
+// number.
+func (f SortField) text(t *playlist.Track) (string, bool) {
+	switch f {
+	case SortTitle:
+		return t.Title, true
+	case SortArtist:
+		return t.Artist, true
+	case SortAlbum:
+		return t.Album, true
+	case SortAlbumArtist:
+		return t.AlbumArtistOrArtist(), true
+	case SortComposer:
+		return t.Composer, true
+	case SortGenre:
+		return t.Genre, true
+	case SortDate:
+		return t.Date, true
+	case SortCodec:
+		return t.Codec, true
+	case SortFilepath:
+		return t.Filepath, true
+	default:
+		return "", false
+	}
+}
+
+// number returns the value of a number field.
+func (f SortField) number(t *playlist.Track) int64 {
+	switch f {
+	case SortDisc:
+		return int64(t.Disc)
+	case SortNumber:
+		return int64(t.Number)
+	case SortLength:
+		return int64(t.Length)
+	case SortSampleRate:
+		return int64(t.SampleRate)
+	case SortBitrate:
+		return int64(t.Bitrate)
+	default:
+		return 0
+	}
+}
+
+// SortKey is a key of a multi-key sort.
+type SortKey struct {
+	Field      SortField `json:"field"`
+	Descending bool      `json:"descending,omitempty"`
+}
+
+// DefaultSortKeys sorts tracks by album, keeping the albums of an artist in
+// release order.
+var DefaultSortKeys = []SortKey{
+	{Field: SortAlbumArtist},
+	{Field: SortDate},
+	{Field: SortAlbum},
+	{Field: SortDisc},
+	{Field: SortNumber},
+}
+
+// TrackSorter compares tracks by a list of keys. Text is compared naturally, so
+// "Track 2" comes before "Track 10", and by the collation rules of the user's
+// locale. A TrackSorter must not be used concurrently.
+type TrackSorter struct {
+	keys     []SortKey
+	collator *collate.Collator
+}
+
+// NewTrackSorter creates a sorter that compares tracks by the given keys in
+// order. Later keys are only compared if the earlier keys are equal.
+func NewTrackSorter(keys []SortKey) *TrackSorter {
+	return newTrackSorter(keys, collationLanguage())
+}
+
+func newTrackSorter(keys []SortKey, lang language.Tag) *TrackSorter {
+	return &TrackSorter{
+		keys:     append([]SortKey(nil), keys...),
+		collator: collate.New(lang, collate.Numeric, collate.IgnoreCase),
+	}
+}
+
+// Compare returns a negative number if a sorts before b, a positive number if
+// a sorts after b, or 0 if they're equal in all keys.
+func (s *TrackSorter) Compare(a, b *playlist.Track) int {
+	for _, key := range s.keys {
+		n := s.compareField(key.Field, a, b)
+		if n == 0 {
+			continue
+		}
+		if key.Descending {
+			return -n
+		}
+		return n
+	}
+
+	return 0
+}
+
+func (s *TrackSorter) compareField(f SortField, a, b *playlist.Track) int {
+	textA, ok := f.text(a)
+	if !ok {
+		numA := f.number(a)
+		numB := f.number(b)
+
+		switch {
+		case numA < numB:
+			return -1
+		case numA > numB:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	textB, _ := f.text(b)
+	return s.collator.CompareString(textA, textB)
+}
+
+// SortTracks sorts the tracks by the given keys. Tracks that are equal in all
+// keys keep their order.
+func SortTracks(tracks []*Track, keys []SortKey) {
+	sorter := NewTrackSorter(keys)
+
+	metadata := make(map[*Track]playlist.Track, len(tracks))
+	for _, track := range tracks {
+		metadata[track] = track.Metadata()
+	}
+
+	sort.SliceStable(tracks, func(i, j int) bool {
+		a := metadata[tracks[i]]
+		b := metadata[tracks[j]]
+		return sorter.Compare(&a, &b) < 0
+	})
+}
+
+// Sort sorts the tracks at the given indices by the given keys among
+// themselves, so the other tracks stay where they are. The whole playlist is
+// sorted if ixs is empty. The caller should refresh the play queue if the
+// playlist is playing.
+func (pl *Playlist) Sort(ixs []int, keys []SortKey) {
+	if len(ixs) == 0 {
+		SortTracks(pl.Tracks, keys)
+		pl.SetUnsaved()
+		return
+	}
+
+	ixs = append([]int(nil), ixs...)
+	sort.Ints(ixs)
+
+	tracks := make([]*Track, len(ixs))
+	for i, ix := range ixs {
+		tracks[i] = pl.Tracks[ix]
+	}
+
+	SortTracks(tracks, keys)
+
+	for i, ix := range ixs {
+		pl.Tracks[ix] = tracks[i]
+	}
+
+	pl.SetUnsaved()
+}
+
+// collationLanguage returns the language that text is collated in, which is
+// taken from the locale environment variables.
+func collationLanguage() language.Tag {
+	for _, env := range []string{"LC_ALL", "LC_COLLATE", "LANG"} {
+		if v := os.Getenv(env); v != "" {
+			return parseLocale(v)
+		}
+	}
+	return language.Und
+}
+
+// parseLocale parses a POSIX locale such as en_US.UTF-8 into a language tag.
+// The undetermined language is returned if the locale can't be parsed.
+func parseLocale(locale string) language.Tag {
+	if i := strings.IndexAny(locale, ".@"); i != -1 {
+		locale = locale[:i]
+	}
+
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return language.Und
+	}
+
+	tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-"))
+	if err != nil {
+		return language.Und
+	}
+
+	return tag
+}
@@ -0,0 +1,112 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/go-test/deep"
+	"golang.org/x/text/language"
+)
+
+func trackPaths(tracks []*Track) []string {
+	paths := make([]string, len(tracks))
+	for i, track := range tracks {
+		paths[i] = track.Filepath
+	}
+	return paths
+}
+
+func TestSortTracks(t *testing.T) {
+	s := NewState()
+	pl := s.AddPlaylist(&playlist.Playlist{
+		Name: "mixed",
+		Tracks: []playlist.Track{
+			{Filepath: "/b/10", Album: "B", AlbumArtist: "Aqours", Date: "2018", Number: 10},
+			{Filepath: "/a/2", Album: "A", Artist: "aqours", Date: "2017", Number: 2},
+			{Filepath: "/b/2", Album: "B", AlbumArtist: "Aqours", Date: "2018", Number: 2},
+			{Filepath: "/c/1", Album: "C", Artist: "Guilty Kiss", Date: "2018", Number: 1},
+			{Filepath: "/a/1", Album: "A", Artist: "Aqours", Date: "2017", Number: 1},
+			{Filepath: "/b/1/2", Album: "B", AlbumArtist: "Aqours", Date: "2018", Disc: 2, Number: 1},
+		},
+	})
+
+	pl.Sort(nil, DefaultSortKeys)
+
+	expect := []string{"/a/1", "/a/2", "/b/2", "/b/10", "/b/1/2", "/c/1"}
+	if diff := deep.Equal(expect, trackPaths(pl.Tracks)); diff != nil {
+		t.Fatal("unexpected order:", diff)
+	}
+
+	if !pl.IsUnsaved() {
+		t.Fatal("sorted playlist isn't unsaved")
+	}
+
+	pl.Sort(nil, []SortKey{{Field: SortDate, Descending: true}})
+
+	// Tracks with the same date keep their order.
+	expect = []string{"/b/2", "/b/10", "/b/1/2", "/c/1", "/a/1", "/a/2"}
+	if diff := deep.Equal(expect, trackPaths(pl.Tracks)); diff != nil {
+		t.Fatal("unexpected order:", diff)
+	}
+}
+
+func TestSortSelection(t *testing.T) {
+	s := NewState()
+	pl := s.AddPlaylist(&playlist.Playlist{
+		Name: "mixed",
+		Tracks: []playlist.Track{
+			{Filepath: "/3", Title: "3"},
+			{Filepath: "/x", Title: "x"},
+			{Filepath: "/1", Title: "1"},
+			{Filepath: "/y", Title: "y"},
+			{Filepath: "/2", Title: "2"},
+		},
+	})
+
+	pl.Sort([]int{4, 0, 2}, []SortKey{{Field: SortTitle}})
+
+	expect := []string{"/1", "/x", "/2", "/y", "/3"}
+	if diff := deep.Equal(expect, trackPaths(pl.Tracks)); diff != nil {
+		t.Fatal("unexpected order:", diff)
+	}
+}
+
+func TestTrackSorterNatural(t *testing.T) {
+	sorter := newTrackSorter([]SortKey{{Field: SortTitle}}, language.English)
+
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"Track 2", "Track 10", true},
+		{"track 10", "Track 2", false},
+		{"apple", "Banana", true},
+		{"Éclair", "Eggs", true},
+		{"Zebra", "zebra 2", true},
+	}
+
+	for _, test := range tests {
+		a := playlist.Track{Title: test.a}
+		b := playlist.Track{Title: test.b}
+
+		if less := sorter.Compare(&a, &b) < 0; less != test.less {
+			t.Errorf("%q < %q = %v, want %v", test.a, test.b, less, test.less)
+		}
+	}
+}
+
+func TestParseLocale(t *testing.T) {
+	tests := map[string]language.Tag{
+		"en_US.UTF-8":    language.AmericanEnglish,
+		"de_DE@euro":     language.MustParse("de-DE"),
+		"C":              language.Und,
+		"POSIX":          language.Und,
+		"not a locale!!": language.Und,
+	}
+
+	for locale, expect := range tests {
+		if tag := parseLocale(locale); tag != expect {
+			t.Errorf("parseLocale(%q) = %v, want %v", locale, tag, expect)
+		}
+	}
+}
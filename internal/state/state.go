@@ -2,22 +2,32 @@ package state
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/diamondburned/aqours/internal/muse/metadata/pathguess"
 	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/state/mdcache"
+	"github.com/diamondburned/aqours/internal/state/store"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/pkg/errors"
 )
 
-var stateDir, stateFile string
+var stateDir, stateFile, dbFile string
 
 func init() {
-	stateDir = getConfigDir()
-	stateFile = filepath.Join(stateDir, "state.json")
+	setStateDir(getConfigDir())
+}
+
+func setStateDir(dir string) {
+	stateDir = dir
+	stateFile = filepath.Join(dir, "state.json")
+	dbFile = filepath.Join(dir, "state.db")
 }
 
 func getConfigDir() string {
@@ -31,6 +41,12 @@ func getConfigDir() string {
 	return d
 }
 
+// DataDir returns the directory that aqours stores its data in. An empty string
+// is returned if the directory cannot be created.
+func DataDir() string {
+	return stateDir
+}
+
 func assert(b bool, e string) {
 	if b {
 		log.Panicln("BUG: assertion failed:", e)
@@ -42,12 +58,39 @@ type stateIntern struct {
 	onUpdate func(s *State)
 	saving   sync.WaitGroup
 	unsaved  bool
+	// stale is true if the generated playlists need to be regenerated.
+	stale bool
+	// generation is incremented every time stale is set.
+	generation uint64
+	// db persists the state if it's not nil. Otherwise, everything is saved
+	// into the JSON state file.
+	db *store.DB
+	// dirty contains the paths whose metadata has changed since the last save.
+	dirty map[string]struct{}
+	// patterns caches the parsed name patterns. Invalid patterns are nil.
+	patterns map[string]*pathguess.Pattern
 }
 
 func newStateIntern() *stateIntern {
 	return &stateIntern{
 		onUpdate: func(s *State) { s.intern.unsaved = true },
+		dirty:    make(map[string]struct{}),
+		patterns: make(map[string]*pathguess.Pattern),
+	}
+}
+
+// cached returns the cache entry of the given path.
+func (intern *stateIntern) cached(path string) (mdcache.Entry, bool) {
+	if intern.db == nil {
+		return mdcache.Entry{}, false
 	}
+	return intern.db.Metadata.Get(path)
+}
+
+// markDirty marks the metadata of the given path as unsaved.
+func (intern *stateIntern) markDirty(path string) {
+	intern.dirty[path] = struct{}{}
+	intern.unsaved = true
 }
 
 // TODO: State is due for another factor. It should be a fully public structure
@@ -59,37 +102,160 @@ type State struct {
 	metadata      metadataMap
 	playlistNames []PlaylistName
 	playlists     map[PlaylistName]*Playlist
+	library       *Playlist
+	// namePatterns maps library roots to their name patterns.
+	namePatterns map[string]string
+	// columns is the default column layout of the track lists.
+	columns ColumnLayout
+
+	// queue is the user's play queue, which is played before the rest of the
+	// playing playlist.
+	queue []*Track
+	// clipboard is the paths of the tracks that were last copied. Their
+	// metadata is referenced until something else is copied.
+	clipboard []string
 
 	playing struct {
 		Playlist *Playlist
 		Queue    []int // list of indices to playlists[playing.Playlist]
 		QueuePos int   // relative to Queue
+		// Queued is the playing track if it was taken from the user's queue,
+		// or if it was removed from the playing playlist while playing. The
+		// playlist continues from QueuePos once it's done.
+		Queued *Track
 	}
 
-	volume    float64
-	muted     bool
-	shuffling bool
-	repeating RepeatMode
+	volume      float64
+	muted       bool
+	shuffling   bool
+	shuffleMode ShuffleMode
+	// shuffleSeed seeds the next shuffle.
+	shuffleSeed int64
+	repeating   RepeatMode
 }
 
 // NewState creates an empty state.
 func NewState() *State {
-	return &State{
-		metadata:  make(metadataMap),
-		playlists: make(map[PlaylistName]*Playlist),
-		volume:    100,
-		intern:    newStateIntern(),
+	return newState(newStateIntern())
+}
+
+func newState(intern *stateIntern) *State {
+	s := &State{
+		metadata:     make(metadataMap),
+		playlists:    make(map[PlaylistName]*Playlist),
+		namePatterns: make(map[string]string),
+		volume:       100,
+		shuffleSeed:  rand.Int63(),
+		intern:       intern,
 	}
+	s.library = newLibrary(s, nil, nil)
+	return s
 }
 
-// ReadFromFile reads the state from the user's state.
+// ReadFromFile reads the user's state from the state database. If the database
+// has no state yet, then the JSON state file is imported into it and renamed to
+// a backup. If the database can't be opened, then the JSON state file is used
+// instead. A new state is returned if there's no state at all yet.
 func ReadFromFile() (*State, error) {
+	intern := newStateIntern()
+
+	if stateDir != "" {
+		db, err := store.Open(dbFile)
+		if err != nil {
+			log.Println("failed to open state database:", err)
+		} else {
+			intern.db = db
+		}
+	}
+
+	s, err := readState(intern)
+	if err != nil {
+		if intern.db != nil {
+			intern.db.Close()
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func readState(intern *stateIntern) (*State, error) {
+	if intern.db != nil {
+		b, err := intern.db.State()
+		if err != nil {
+			return nil, err
+		}
+
+		if b != nil {
+			migrated, version, err := migrateState(b)
+			if err != nil {
+				return nil, err
+			}
+
+			if version < stateVersion {
+				backup := backupName(dbFile, version)
+				if err := intern.db.Backup(backup); err != nil {
+					return nil, errors.Wrap(err, "failed to back up state database")
+				}
+
+				log.Printf("migrated %s from version %d, backup at %s\n", dbFile, version, backup)
+			}
+
+			s, err := decodeState(migrated)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal saved state")
+			}
+
+			state := makeStateFromJSON(s, intern)
+			// Write the migrated state back on the next save.
+			if version < stateVersion {
+				intern.unsaved = true
+			}
+
+			return state, nil
+		}
+	}
+
 	s, err := fileJSONState(stateFile)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return newState(intern), nil
+		}
 		return nil, errors.Wrap(err, "failed to read state file")
 	}
 
-	return makeStateFromJSON(s, newStateIntern()), nil
+	state := makeStateFromJSON(s, intern)
+
+	if intern.db != nil {
+		if err := state.dbSaver(intern.db)(); err != nil {
+			return nil, errors.Wrap(err, "failed to import state file")
+		}
+
+		// The JSON state file is no longer read nor written once it's
+		// imported, so move it out of the way to not confuse anyone.
+		backup := stateFile + ".bak"
+		if err := os.Rename(stateFile, backup); err != nil {
+			log.Println("failed to back up imported state file:", err)
+		} else {
+			log.Printf("imported %s into %s, backup at %s\n", stateFile, dbFile, backup)
+		}
+	}
+
+	return state, nil
+}
+
+// Close closes the state database. It should be called after the state is
+// saved for the last time.
+func (s *State) Close() {
+	if s.intern.db == nil {
+		return
+	}
+
+	if err := s.intern.db.Close(); err != nil {
+		log.Println("failed to close state database:", err)
+	}
+
+	s.intern.db = nil
 }
 
 // MarkChanged marks the state as changed (unsaved).
@@ -128,6 +294,10 @@ func (s *State) assertCoherentState() {
 func (s *State) Playlist(name string) (*Playlist, bool) {
 	s.assertCoherentState()
 
+	if name == LibraryName {
+		return s.library, true
+	}
+
 	pl, ok := s.playlists[name]
 	return pl, ok
 }
@@ -153,12 +323,21 @@ func (s *State) PlaylistNames() []PlaylistName {
 	return s.playlistNames
 }
 
+// RenamePlaylist renames the playlist with the old name to the name of the
+// given playlist. The playlist isn't renamed if the new name is taken, which
+// includes the reserved LibraryName.
 func (s *State) RenamePlaylist(p *Playlist, oldName string) {
 	pl, ok := s.playlists[oldName]
 	if !ok {
 		return
 	}
 
+	if _, ok := s.Playlist(p.Name); ok {
+		log.Println("Playlist collision while renaming:", p.Name)
+		p.Name = oldName
+		return
+	}
+
 	delete(s.playlists, oldName)
 	s.playlists[p.Name] = pl
 
@@ -174,10 +353,22 @@ func (s *State) RenamePlaylist(p *Playlist, oldName string) {
 	s.onUpdate()
 }
 
+// freeName returns the given playlist name if it's not taken, or the name
+// mangled with a number otherwise.
+func (s *State) freeName(name PlaylistName) PlaylistName {
+	free := name
+	for mangle := 1; ; mangle++ {
+		if _, ok := s.Playlist(free); !ok {
+			return free
+		}
+		free = fmt.Sprintf("%s~%d", name, mangle)
+	}
+}
+
 // AddPlaylist adds a playlist. If a playlist with the same name is added, then
 // the function does nothing.
 func (s *State) AddPlaylist(p *playlist.Playlist) *Playlist {
-	if _, ok := s.playlists[p.Name]; ok {
+	if _, ok := s.Playlist(p.Name); ok {
 		log.Println("Playlist collision while adding:", p.Name)
 		return nil
 	}
@@ -185,6 +376,10 @@ func (s *State) AddPlaylist(p *playlist.Playlist) *Playlist {
 	playlist := convertPlaylist(s, p)
 	playlist.unsaved = 1
 
+	if playlist.IsGenerated() {
+		playlist.regenerate()
+	}
+
 	s.playlists[p.Name] = playlist
 	s.playlistNames = append(s.playlistNames, p.Name)
 
@@ -199,9 +394,18 @@ func (s *State) DeletePlaylist(name string) {
 	for i, playlistName := range s.playlistNames {
 		if playlistName == name {
 			s.playlistNames = append(s.playlistNames[:i], s.playlistNames[i+1:]...)
+
+			pl := s.playlists[name]
+			for _, track := range pl.Tracks {
+				s.metadata.unref(s, track.Filepath)
+			}
 			delete(s.playlists, name)
+			s.pruneQueue(pl)
+
+			// Generated playlists may have the deleted playlist's tracks.
+			s.invalidateGenerated()
 
-			if name == s.playing.Playlist.Name {
+			if s.playing.Playlist != nil && name == s.playing.Playlist.Name {
 				s.SetPlayingPlaylist(nil)
 			}
 
@@ -212,6 +416,137 @@ func (s *State) DeletePlaylist(name string) {
 	}
 }
 
+// invalidateGenerated marks all generated playlists as stale. It is called
+// when any track or its metadata changes.
+func (s *State) invalidateGenerated() {
+	if s.intern != nil {
+		s.intern.stale = true
+		s.intern.generation++
+	}
+}
+
+// Generation returns a number that changes every time any track or its
+// metadata changes. It is useful for lazily rebuilding views of the tracks.
+func (s *State) Generation() uint64 {
+	return s.intern.generation
+}
+
+// RegeneratePlaylists regenerates all generated playlists if any track has
+// changed since the last call. It returns the playlists whose tracks changed.
+func (s *State) RegeneratePlaylists() []*Playlist {
+	if !s.intern.stale {
+		return nil
+	}
+
+	s.intern.stale = false
+
+	var changed []*Playlist
+
+	for _, name := range s.playlistNames {
+		pl := s.playlists[name]
+		if pl.IsGenerated() && s.RegeneratePlaylist(pl) {
+			changed = append(changed, pl)
+		}
+	}
+
+	return changed
+}
+
+// RegeneratePlaylist regenerates the given generated playlist. If the playlist
+// is currently playing, then the play queue is reloaded while keeping the
+// currently playing track. It returns false if the playlist is unchanged.
+func (s *State) RegeneratePlaylist(pl *Playlist) bool {
+	var upcoming []*Track
+	if s.playing.Playlist == pl {
+		upcoming = s.upcomingTracks()
+	}
+
+	if !pl.regenerate() {
+		return false
+	}
+
+	s.pruneQueue(pl)
+
+	if s.playing.Playlist == pl {
+		s.reloadPlayQueueFrom(upcoming)
+	}
+
+	return true
+}
+
+// upcomingTracks returns the current track of the playing playlist followed by
+// the rest of its play queue, in the order that they'd be played in.
+func (s *State) upcomingTracks() []*Track {
+	if s.playing.QueuePos < 0 || s.playing.QueuePos >= len(s.playing.Queue) {
+		return nil
+	}
+
+	queue := s.playing.Queue[s.playing.QueuePos:]
+
+	tracks := make([]*Track, len(queue))
+	for i, ix := range queue {
+		tracks[i] = s.playing.Playlist.Tracks[ix]
+	}
+
+	return tracks
+}
+
+// reloadPlayQueueFrom reloads the play queue of the playing playlist after its
+// tracks have changed, keeping the current track, which is the first of the
+// given upcoming tracks. If the current track was removed from the playlist
+// while it's playing, then it keeps playing as if it was queued, and the first
+// upcoming track that's still in the playlist plays after it.
+func (s *State) reloadPlayQueueFrom(upcoming []*Track) {
+	s.ReloadPlayQueue()
+
+	if len(upcoming) == 0 {
+		s.playing.QueuePos = 0
+		return
+	}
+
+	positions := make(map[*Track]int, len(s.playing.Queue))
+	for i, ix := range s.playing.Queue {
+		positions[s.playing.Playlist.Tracks[ix]] = i
+	}
+
+	if pos, ok := positions[upcoming[0]]; ok {
+		s.playing.QueuePos = pos
+		return
+	}
+
+	// The playlist's current track may not be the playing one if a queued
+	// track is playing, in which case the playlist continues after it anyway.
+	if s.playing.Queued == nil {
+		s.playing.Queued = upcoming[0]
+	}
+
+	// Position the queue right before the next track, which may be before the
+	// first one. The end of the queue is reached if there's no next track.
+	s.playing.QueuePos = len(s.playing.Queue) - 1
+
+	for _, track := range upcoming[1:] {
+		if pos, ok := positions[track]; ok {
+			s.playing.QueuePos = pos - 1
+			break
+		}
+	}
+}
+
+// seekQueueTo sets the queue position to the given track in the playing
+// playlist. It does nothing if the track is not found.
+func (s *State) seekQueueTo(track *Track) {
+	if track == nil {
+		return
+	}
+
+	for i, ix := range s.playing.Queue {
+		if s.playing.Playlist.Tracks[ix] == track {
+			s.playing.QueuePos = i
+			return
+		}
+	}
+}
+
 // SetPlayingPlaylist sets the playing playlist.
 func (s *State) SetPlayingPlaylist(pl *Playlist) {
 	s.assertCoherentState()
@@ -227,11 +562,6 @@ func (s *State) SetPlayingPlaylist(pl *Playlist) {
 	}
 
 	s.ReloadPlayQueue()
-
-	if s.shuffling {
-		// Reshuffle.
-		playlist.ShuffleQueue(s.playing.Queue)
-	}
 }
 
 // PlayingPlaylist returns the playing playlist, or nil if none. It panics if
@@ -255,15 +585,30 @@ func (s *State) PlayingPlaylistName() string {
 	return s.playing.Playlist.Name
 }
 
-// NowPlaying returns the currently playing track. If playingPl is nil, then
-// this method returns (-1, nil).
+// NowPlaying returns the currently playing track, which may have been queued
+// from another playlist. If playingPl is nil and nothing queued is playing,
+// then this method returns (-1, nil).
 func (s *State) NowPlaying() (int, *Track) {
 	s.assertCoherentState()
 
+	if s.playing.Queued != nil {
+		return s.trackIndex(s.playing.Queued), s.playing.Queued
+	}
+
+	return s.playlistPlaying()
+}
+
+// playlistPlaying returns the current track of the playing playlist, which
+// keeps its place while a queued track is playing.
+func (s *State) playlistPlaying() (int, *Track) {
 	if s.playing.Playlist == nil || s.playing.QueuePos < 0 {
 		return -1, nil
 	}
 
+	if s.playing.QueuePos >= len(s.playing.Queue) {
+		return -1, nil
+	}
+
 	ix := s.playing.Queue[s.playing.QueuePos]
 	return ix, s.playing.Playlist.Tracks[ix]
 }
@@ -292,14 +637,16 @@ func (s *State) SetShuffling(shuffling bool) {
 	s.assertCoherentState()
 
 	if shuffling {
-		playlist.ShuffleQueue(s.playing.Queue)
+		s.shuffleQueue()
 		return
 	}
 
 	// Attempt to renew the QueuePos before changing the queue. As Queue holds a
 	// list of actual track indices, we could use the queue position as the key
 	// to get the actual position, then set that to the queue position.
-	s.playing.QueuePos = s.playing.Queue[s.playing.QueuePos]
+	if ix, track := s.playlistPlaying(); track != nil {
+		s.playing.QueuePos = ix
+	}
 
 	playlist.ResetQueue(s.playing.Queue)
 }
@@ -365,7 +712,7 @@ func (s *State) ReloadPlayQueue() {
 
 	// Restore shuffling.
 	if s.shuffling {
-		playlist.ShuffleQueue(s.playing.Queue)
+		s.shuffleQueue()
 	}
 
 	s.onUpdate()
@@ -375,6 +722,12 @@ func (s *State) ReloadPlayQueue() {
 // index relative to the actual play queue, which may be shuffled. It also does
 // not update QueuePos if we're shuffling.
 func (s *State) Play(index int) *Track {
+	// Playing a track from the playlist stops playing the queued track.
+	if s.playing.Queued != nil {
+		s.playing.Queued = nil
+		defer s.onUpdate()
+	}
+
 	// Only update QueuePos if we're not shuffling.
 	if !s.shuffling {
 		s.playing.QueuePos = index
@@ -412,8 +765,9 @@ func (s *State) Previous() (int, *Track) {
 	return s.move(false, true)
 }
 
-// Next returns the next track from the currently playing playlist. Nil is
-// returned if there is no next track.
+// Next returns the next track from the user's queue, or from the currently
+// playing playlist if the queue is empty. Nil is returned if there is no next
+// track.
 func (s *State) Next() (int, *Track) {
 	return s.move(true, true)
 }
@@ -432,9 +786,28 @@ func (s *State) Peek() (int, *Track) {
 
 // move is an abstracted function used by Prev, Next and AutoNext.
 func (s *State) move(forward, force bool) (int, *Track) {
+	if !force && s.repeating == RepeatSingle {
+		return s.NowPlaying()
+	}
+
+	if forward {
+		if ix, track := s.popQueue(); track != nil {
+			s.playing.Queued = track
+			s.onUpdate()
+			return ix, track
+		}
+	} else if s.playing.Queued != nil {
+		// Going back from a queued track goes back to the playlist's track
+		// that was playing before it.
+		s.playing.Queued = nil
+		s.onUpdate()
+		return s.NowPlaying()
+	}
+
 	next, track := s.peek(forward, force)
 	// Only update the progress if we have something else to play.
 	if next > -1 {
+		s.playing.Queued = nil
 		s.playing.QueuePos = next
 		s.onUpdate()
 	}
@@ -448,6 +821,18 @@ func (s *State) peek(forward, force bool) (int, *Track) {
 		return s.NowPlaying()
 	}
 
+	// Queued tracks are played before the rest of the playlist.
+	if forward {
+		if ix, track := s.peekQueue(); track != nil {
+			return ix, track
+		}
+	}
+
+	// Only queued tracks can be played without a playing playlist.
+	if len(s.playing.Queue) == 0 {
+		return -1, nil
+	}
+
 	next, oob := spinIndex(forward, s.playing.QueuePos, len(s.playing.Queue))
 
 	if oob && s.repeating == RepeatNone {
@@ -477,8 +862,9 @@ func spinIndex(fwd bool, i, max int) (int, bool) {
 	return i, false
 }
 
-// SaveState saves the state. It is non-blocking, but the JSON is marshaled in
-// the same thread as the caller.
+// SaveState saves the state. It is non-blocking, but the state is marshaled in
+// the same thread as the caller. Only the changes are written if the state is
+// saved into the database.
 func (s *State) SaveState() {
 	if stateDir == "" {
 		return
@@ -488,40 +874,28 @@ func (s *State) SaveState() {
 		return
 	}
 
-	b, err := json.Marshal(makeJSONState(s))
-	if err != nil {
-		log.Println("failed to JSON marshal state:", err)
-		return
-	}
-
 	s.intern.unsaved = false
 	s.intern.saving.Add(1)
 
+	save := s.saver()
+
 	go func() {
-		if err := ioutil.WriteFile(stateFile, b, os.ModePerm); err != nil {
-			log.Println("failed to save JSON state:", err)
-		}
+		save()
 		s.intern.saving.Done()
 	}()
 }
 
 // SaveAll saves the state and all its playlists. It's asynchronous.
 func (s *State) SaveAll() {
-	b, err := json.Marshal(s)
-	if err != nil {
-		log.Println("Failed to JSON marshal state:", err)
-		return
-	}
-
 	s.intern.unsaved = false
 
 	s.intern.saving.Add(1)
 	s.intern.saving.Add(len(s.playlists))
 
+	save := s.saver()
+
 	go func() {
-		if err := ioutil.WriteFile(stateFile, b, os.ModePerm); err != nil {
-			log.Println("Failed to save JSON state:", err)
-		}
+		save()
 		s.intern.saving.Done()
 	}()
 
@@ -535,6 +909,106 @@ func (s *State) SaveAll() {
 	}
 }
 
+// saver marshals the state and returns a function that writes it, which can be
+// called in another goroutine. The whole state is written into the JSON state
+// file only if there's no database.
+func (s *State) saver() func() {
+	if s.intern.db != nil {
+		save := s.dbSaver(s.intern.db)
+		return func() {
+			if err := save(); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		log.Println("failed to JSON marshal state:", err)
+		return func() {}
+	}
+
+	return func() {
+		if err := writeJSONState(stateFile, b); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// dbSaver marshals the state without the metadata and returns a function that
+// writes it and the changed metadata into the database.
+func (s *State) dbSaver(db *store.DB) func() error {
+	b, err := json.Marshal(makeJSONState(s, false))
+	if err != nil {
+		log.Println("failed to JSON marshal state:", err)
+	}
+
+	entries := s.takeDirty()
+
+	return func() error {
+		// Save the metadata first, since it's no longer in the JSON state
+		// once that's imported.
+		if err := db.Metadata.Put(entries); err != nil {
+			return errors.Wrap(err, "failed to save metadata")
+		}
+
+		if b == nil {
+			return nil
+		}
+
+		if err := db.PutState(b); err != nil {
+			return errors.Wrap(err, "failed to save state")
+		}
+
+		return nil
+	}
+}
+
+// ExportJSON writes the whole state, including the metadata of all tracks, into
+// the given file in the format of the JSON state file. It's only meant for
+// debugging, since the state is otherwise kept in the database.
+func (s *State) ExportJSON(path string) error {
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "failed to JSON marshal state")
+	}
+
+	return writeJSONState(path, b)
+}
+
+func writeJSONState(path string, b []byte) error {
+	if err := ioutil.WriteFile(path, b, os.ModePerm); err != nil {
+		return errors.Wrap(err, "failed to save JSON state")
+	}
+	return nil
+}
+
+// takeDirty returns the cache entries of the metadata changed since the last
+// call. Nil is returned if there's no database.
+func (s *State) takeDirty() map[string]mdcache.Entry {
+	if s.intern.db == nil || len(s.intern.dirty) == 0 {
+		return nil
+	}
+
+	entries := make(map[string]mdcache.Entry, len(s.intern.dirty))
+
+	for path := range s.intern.dirty {
+		// Metadata that isn't referenced anymore is already dropped, but the
+		// cache keeps its last saved entry.
+		if md, ok := s.metadata[path]; ok {
+			entries[path] = mdcache.Entry{
+				Track:       md.Track,
+				Identity:    md.Identity,
+				Overrides:   md.Overrides,
+				ScannedGain: md.ScannedGain,
+			}
+		}
+	}
+
+	s.intern.dirty = make(map[string]struct{})
+	return entries
+}
+
 // WaitUntilSaved waits until all the saving routines are done. This is useful
 // for implementing a loading bar.
 func (s *State) WaitUntilSaved() {
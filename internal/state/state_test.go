@@ -0,0 +1,113 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+)
+
+func TestReadFromFile(t *testing.T) {
+	oldDir := stateDir
+	setStateDir(t.TempDir())
+	t.Cleanup(func() { setStateDir(oldDir) })
+
+	old := NewState()
+	old.SetVolume(42)
+	old.SetRepeatMode(RepeatAll)
+	old.SetLibraryRoots([]string{"/music"})
+	old.SetLibraryNamePattern("/music", "%artist% - %title%")
+	old.SetColumnLayout(ColumnLayout{
+		Columns: []ColumnState{{Name: "genre", Visible: true, Width: 80}},
+		Sort:    "album",
+	})
+	old.SyncPlaylist(old.Library(), []string{"/music/a.flac"})
+	old.Library().Tracks[0].UpdateMetadata(playlist.Track{Title: "A"})
+	old.Library().Tracks[0].MarkPlayed()
+	old.Library().Tracks[0].SetOverrides(playlist.Overrides{Artist: "B"})
+
+	b, err := json.Marshal(old)
+	if err != nil {
+		t.Fatal("failed to marshal:", err)
+	}
+
+	if err := os.WriteFile(stateFile, b, 0644); err != nil {
+		t.Fatal("failed to write state file:", err)
+	}
+
+	// The first read imports the JSON state into the database and moves the
+	// JSON state file out of the way.
+	s, err := ReadFromFile()
+	if err != nil {
+		t.Fatal("failed to import state:", err)
+	}
+	assertRestored(t, s)
+
+	if _, err := os.Stat(stateFile + ".bak"); err != nil {
+		t.Error("imported state file wasn't backed up:", err)
+	}
+
+	// The JSON state file is no longer written.
+	s.SaveAll()
+	s.WaitUntilSaved()
+	s.Close()
+
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Error("state file was written after the import:", err)
+	}
+
+	s, err = ReadFromFile()
+	if err != nil {
+		t.Fatal("failed to read state:", err)
+	}
+	defer s.Close()
+
+	assertRestored(t, s)
+
+	// The debug export can still be read back.
+	export := filepath.Join(t.TempDir(), "export.json")
+	if err := s.ExportJSON(export); err != nil {
+		t.Fatal("failed to export state:", err)
+	}
+
+	exported, err := fileJSONState(export)
+	if err != nil {
+		t.Fatal("failed to read exported state:", err)
+	}
+	assertRestored(t, makeStateFromJSON(exported, newStateIntern()))
+}
+
+func assertRestored(t *testing.T, s *State) {
+	t.Helper()
+
+	if s.Volume() != 42 {
+		t.Errorf("volume = %v, want 42", s.Volume())
+	}
+
+	if s.RepeatMode() != RepeatAll {
+		t.Errorf("repeat mode = %v, want RepeatAll", s.RepeatMode())
+	}
+
+	if p := s.LibraryNamePattern("/music"); p != "%artist% - %title%" {
+		t.Errorf("name pattern = %q", p)
+	}
+
+	if l := s.ColumnLayout(); l.Sort != "album" || len(l.Columns) != 1 || l.Columns[0].Width != 80 {
+		t.Errorf("column layout = %+v", l)
+	}
+
+	tracks := s.Library().Tracks
+	if len(tracks) != 1 {
+		t.Fatalf("library has %d tracks, want 1", len(tracks))
+	}
+
+	if md := tracks[0].Metadata(); md.Title != "A" || md.Artist != "B" || md.PlayCount != 1 {
+		t.Errorf("unexpected metadata: %#v", md)
+	}
+
+	if md := tracks[0].ProbedMetadata(); md.Artist != "" {
+		t.Errorf("override saved as probed metadata: %#v", md)
+	}
+}
@@ -0,0 +1,165 @@
+// Package store implements the database that the state is persisted in. The
+// state is stored as a JSON object whose fields are each kept under their own
+// key, so only the fields that changed are written. The metadata is kept in a
+// separate metadata cache in the same database.
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/state/mdcache"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+var stateBucket = []byte("state")
+
+// DB is a state database. It is safe to use concurrently.
+type DB struct {
+	Metadata *mdcache.Cache
+
+	db *bbolt.DB
+
+	mutex sync.Mutex
+	saved map[string]json.RawMessage
+}
+
+// Open opens the database at the given path, creating it if it doesn't exist.
+func Open(path string) (*DB, error) {
+	// Don't wait forever if another instance is holding the lock.
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(stateBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed to create state bucket")
+	}
+
+	md, err := mdcache.New(db)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed to create metadata cache")
+	}
+
+	return &DB{
+		Metadata: md,
+		db:       db,
+		saved:    map[string]json.RawMessage{},
+	}, nil
+}
+
+// Close closes the database.
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+// State returns the saved state as a JSON object. Nil is returned if no state
+// has been saved yet.
+func (db *DB) State() ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+
+	err := db.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(stateBucket).ForEach(func(k, v []byte) error {
+			// The value is only valid within the transaction.
+			fields[string(k)] = append(json.RawMessage(nil), v...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read state")
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal state")
+	}
+
+	db.mutex.Lock()
+	db.saved = fields
+	db.mutex.Unlock()
+
+	return b, nil
+}
+
+// PutState saves the given state, which must be a JSON object. Only the fields
+// that changed since the last call are written, and fields that are no longer
+// in the object are deleted.
+func (db *DB) PutState(object []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(object, &fields); err != nil {
+		return errors.Wrap(err, "failed to split state into fields")
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	err := db.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(stateBucket)
+
+		for k, v := range fields {
+			if old, ok := db.saved[k]; ok && bytes.Equal(old, v) {
+				continue
+			}
+
+			if err := bucket.Put([]byte(k), v); err != nil {
+				return errors.Wrapf(err, "failed to put %q", k)
+			}
+		}
+
+		for k := range db.saved {
+			if _, ok := fields[k]; ok {
+				continue
+			}
+
+			if err := bucket.Delete([]byte(k)); err != nil {
+				return errors.Wrapf(err, "failed to delete %q", k)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	db.saved = fields
+	return nil
+}
+
+// Backup writes a consistent copy of the database to the given path. Nothing is
+// written if the file already exists.
+func (db *DB) Backup(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to create backup")
+	}
+
+	err = db.db.View(func(tx *bbolt.Tx) error {
+		_, err := tx.WriteTo(f)
+		return err
+	})
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return errors.Wrap(err, "failed to write backup")
+	}
+
+	return errors.Wrap(f.Close(), "failed to close backup")
+}
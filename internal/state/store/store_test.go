@@ -0,0 +1,64 @@
+package store
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("failed to open:", err)
+	}
+
+	b, err := db.State()
+	if err != nil {
+		t.Fatal("failed to get empty state:", err)
+	}
+	if b != nil {
+		t.Fatalf("unexpected state in new database: %s", b)
+	}
+
+	puts := []map[string]interface{}{
+		{"volume": 50, "muted": false, "paths": []string{"a", "b"}},
+		// Changes one field, adds another and removes paths.
+		{"volume": 75, "muted": false, "playing": "a"},
+	}
+
+	for _, put := range puts {
+		b, _ := json.Marshal(put)
+		if err := db.PutState(b); err != nil {
+			t.Fatal("failed to put state:", err)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal("failed to close:", err)
+	}
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal("failed to reopen:", err)
+	}
+	defer db.Close()
+
+	b, err = db.State()
+	if err != nil {
+		t.Fatal("failed to get state:", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal("failed to unmarshal state:", err)
+	}
+
+	expect := map[string]interface{}{"volume": 75.0, "muted": false, "playing": "a"}
+	if ineqs := deep.Equal(got, expect); ineqs != nil {
+		t.Fatal("unexpected state:", ineqs)
+	}
+}
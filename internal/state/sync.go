@@ -0,0 +1,122 @@
+package state
+
+import (
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+)
+
+// SyncChange describes how SyncPlaylist changed a playlist's tracks. Applying
+// the removals then the additions to a copy of the old track list yields the
+// new track list.
+type SyncChange struct {
+	// Removed contains the indices of the removed tracks in the old track
+	// list, sorted from largest to smallest.
+	Removed []int
+	// Added contains the indices of the added tracks in the new track list,
+	// sorted from smallest to largest.
+	Added []int
+}
+
+// IsEmpty returns true if nothing was changed.
+func (c SyncChange) IsEmpty() bool {
+	return len(c.Removed) == 0 && len(c.Added) == 0
+}
+
+// SyncPlaylist replaces the tracks of a synced playlist with the tracks at the
+// given paths while reusing the tracks that are still in it. If the order of
+// the remaining tracks has changed, then the returned change removes and adds
+// back every track. If the playlist is currently playing, then the play queue
+// is reloaded while keeping the currently playing track.
+func (s *State) SyncPlaylist(pl *Playlist, paths []string) SyncChange {
+	old := make(map[string]*Track, len(pl.Tracks))
+	for _, track := range pl.Tracks {
+		old[track.Filepath] = track
+	}
+
+	kept := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if _, ok := old[path]; ok {
+			kept[path] = true
+		}
+	}
+
+	var change SyncChange
+
+	// Keep track of the remaining tracks to check if their order is still the
+	// same.
+	remaining := make([]*Track, 0, len(kept))
+
+	for i := len(pl.Tracks) - 1; i >= 0; i-- {
+		if kept[pl.Tracks[i].Filepath] {
+			remaining = append(remaining, pl.Tracks[i])
+		} else {
+			change.Removed = append(change.Removed, i)
+		}
+	}
+
+	tracks := make([]*Track, len(paths))
+	reordered := false
+
+	for i, path := range paths {
+		if track, ok := old[path]; ok {
+			tracks[i] = track
+
+			// remaining is reversed, so pop the last one off.
+			if len(remaining) == 0 || remaining[len(remaining)-1] != track {
+				reordered = true
+			} else {
+				remaining = remaining[:len(remaining)-1]
+			}
+
+			continue
+		}
+
+		change.Added = append(change.Added, i)
+
+		tracks[i] = &Track{
+			Filepath: path,
+			playlist: pl,
+		}
+
+		placeholder := playlist.Track{Title: playlist.TitleFromPath(path)}
+		s.metadataFor(path, placeholder).reference++
+	}
+
+	if reordered {
+		change.Removed = make([]int, len(pl.Tracks))
+		for i := range change.Removed {
+			change.Removed[i] = len(pl.Tracks) - i - 1
+		}
+
+		change.Added = make([]int, len(tracks))
+		for i := range change.Added {
+			change.Added[i] = i
+		}
+	}
+
+	if change.IsEmpty() {
+		return change
+	}
+
+	// Unreference the removed tracks only after the new tracks have been
+	// referenced.
+	for _, track := range pl.Tracks {
+		if !kept[track.Filepath] {
+			s.metadata.unref(s, track.Filepath)
+		}
+	}
+
+	var upcoming []*Track
+	if s.playing.Playlist == pl {
+		upcoming = s.upcomingTracks()
+	}
+
+	pl.Tracks = tracks
+	s.invalidateGenerated()
+	s.pruneQueue(pl)
+
+	if s.playing.Playlist == pl {
+		s.reloadPlayQueueFrom(upcoming)
+	}
+
+	return change
+}
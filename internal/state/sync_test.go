@@ -0,0 +1,96 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestSyncPlaylist(t *testing.T) {
+	type test struct {
+		name   string
+		old    []string
+		new    []string
+		expect SyncChange
+	}
+
+	var tests = []test{
+		{
+			name:   "unchanged",
+			old:    []string{"0", "1"},
+			new:    []string{"0", "1"},
+			expect: SyncChange{},
+		},
+		{
+			name:   "added",
+			old:    []string{"1", "3"},
+			new:    []string{"0", "1", "2", "3", "4"},
+			expect: SyncChange{Added: []int{0, 2, 4}},
+		},
+		{
+			name:   "removed",
+			old:    []string{"0", "1", "2", "3"},
+			new:    []string{"1", "3"},
+			expect: SyncChange{Removed: []int{2, 0}},
+		},
+		{
+			name: "added and removed",
+			old:  []string{"0", "1", "2"},
+			new:  []string{"1", "1.5", "2", "3"},
+			expect: SyncChange{
+				Removed: []int{0},
+				Added:   []int{1, 3},
+			},
+		},
+		{
+			name: "reordered",
+			old:  []string{"0", "1"},
+			new:  []string{"1", "0", "2"},
+			expect: SyncChange{
+				Removed: []int{1, 0},
+				Added:   []int{0, 1, 2},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &State{
+				intern:    newStateIntern(),
+				metadata:  make(metadataMap),
+				playlists: make(map[PlaylistName]*Playlist),
+			}
+
+			pl := &Playlist{state: s}
+			addTracksAndAssert(t, pl, 0, true, test.old...)
+
+			oldTracks := make(map[string]*Track, len(pl.Tracks))
+			for _, track := range pl.Tracks {
+				oldTracks[track.Filepath] = track
+			}
+
+			change := s.SyncPlaylist(pl, test.new)
+			if ineqs := deep.Equal(change, test.expect); ineqs != nil {
+				t.Errorf("unexpected change: %+v", change)
+				for _, ineq := range ineqs {
+					t.Error("  ", ineq)
+				}
+			}
+
+			assertTracks(t, pl.Tracks, emptyTracks(test.new...))
+
+			for _, track := range pl.Tracks {
+				if old, ok := oldTracks[track.Filepath]; ok && old != track {
+					t.Errorf("track %q was not reused", track.Filepath)
+				}
+				if md := s.metadata[track.Filepath]; md == nil || md.reference != 1 {
+					t.Errorf("track %q has unexpected metadata %v", track.Filepath, md)
+				}
+			}
+
+			if len(s.metadata) != len(test.new) {
+				t.Errorf("expected %d metadata, got %d", len(test.new), len(s.metadata))
+			}
+		})
+	}
+}
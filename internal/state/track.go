@@ -2,8 +2,10 @@ package state
 
 import (
 	"sync"
+	"time"
 
 	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/state/mdcache"
 )
 
 type metadataMap map[string]*metadata
@@ -28,12 +30,66 @@ func (mm metadataMap) unref(s *State, path string) {
 	}
 }
 
+// metadataFor returns the metadata of the given path. If it's not in memory,
+// then it's loaded from the cache, or created from the given track if it's
+// not cached either. No references are taken.
+func (s *State) metadataFor(path string, track playlist.Track) *metadata {
+	if md, ok := s.metadata[path]; ok {
+		return md
+	}
+
+	var md *metadata
+
+	if entry, ok := s.intern.cached(path); ok {
+		md = newMetadata(entry.Track)
+		md.Identity = entry.Identity
+		md.Overrides = entry.Overrides
+		md.ScannedGain = entry.ScannedGain
+	} else {
+		md = newMetadata(track)
+		s.intern.markDirty(path)
+	}
+
+	s.metadata[path] = md
+	return md
+}
+
+// SetClipboard references the metadata of the given copied tracks until the
+// clipboard is set again. Tracks that are cut out of the last playlist that has
+// them then keep their metadata, so they don't need to be probed again once
+// they're pasted.
+func (s *State) SetClipboard(tracks ...*Track) {
+	old := s.clipboard
+
+	s.clipboard = make([]string, len(tracks))
+	for i, track := range tracks {
+		s.clipboard[i] = track.Filepath
+		s.metadataFor(track.Filepath, track.ProbedMetadata()).reference++
+	}
+
+	// Unreference the old clipboard only after the new one has been
+	// referenced.
+	for _, path := range old {
+		s.metadata.unref(s, path)
+	}
+}
+
 // metadata is a metadata state value that is shared across tracks.
 type metadata struct {
 	// DON'T COPY!!
 	_ [0]sync.Mutex
 
 	playlist.Track
+	// Identity is the identity of the file when it was last probed. It is
+	// zero if the file was never probed.
+	Identity mdcache.Identity `json:"identity"`
+	// Overrides are the metadata values set by the user. They're kept apart
+	// from the probed metadata in Track, which they take precedence over.
+	Overrides *playlist.Overrides `json:"overrides,omitempty"`
+	// ScannedGain is the ReplayGain measured by the loudness scanner. It's used
+	// if the file has no ReplayGain tags.
+	ScannedGain *playlist.ReplayGain `json:"scanned_gain,omitempty"`
+
 	reference int32
 }
 
@@ -45,6 +101,20 @@ func newMetadata(t playlist.Track) *metadata {
 	}
 }
 
+// track returns the metadata with the overrides and the scanned ReplayGain
+// applied.
+func (md *metadata) track() playlist.Track {
+	track := md.Track
+	if md.Overrides != nil {
+		md.Overrides.Apply(&track)
+	}
+	if track.ReplayGain == nil && md.ScannedGain != nil {
+		rg := *md.ScannedGain
+		track.ReplayGain = &rg
+	}
+	return track
+}
+
 // Track is a track value that keeps track of a Metadata pointer and a filepath.
 type Track struct {
 	// DON'T COPY!!
@@ -58,23 +128,150 @@ type Track struct {
 // the metadata does not yet exist, it will create a new one and automatically
 // reference it. Else, no references are taken.
 func (t *Track) UpdateMetadata(i playlist.Track) {
+	t.updateMetadata(i)
+}
+
+// UpdateProbedMetadata updates the track's metadata similarly to
+// UpdateMetadata, except the identity of the probed file is also recorded, so
+// the metadata won't be probed again until the file changes.
+func (t *Track) UpdateProbedMetadata(i playlist.Track, id mdcache.Identity) {
+	t.updateMetadata(i).Identity = id
+}
+
+func (t *Track) updateMetadata(i playlist.Track) *metadata {
 	md, ok := t.playlist.state.metadata[t.Filepath]
 	if !ok {
-		md = newMetadata(i)
+		md = t.playlist.state.metadataFor(t.Filepath, i)
 		md.reference = 1
-		t.playlist.state.metadata[t.Filepath] = md
 	}
 
+	// Keep the playback statistics, since they're never probed.
+	i.PlayCount = md.PlayCount
+	i.LastPlayed = md.LastPlayed
+
 	i.Filepath = ""
 	md.Track = i
 
 	// Mark as unsaved.
+	t.playlist.state.intern.markDirty(t.Filepath)
+	t.playlist.state.invalidateGenerated()
+	t.playlist.state.MarkChanged()
+
+	return md
+}
+
+// MarkPlayed increments the track's play count and sets its last played time to
+// now. It does nothing if the track has no metadata.
+func (t *Track) MarkPlayed() {
+	md, ok := t.playlist.state.metadata[t.Filepath]
+	if !ok {
+		return
+	}
+
+	md.PlayCount++
+	md.LastPlayed = time.Now().Unix()
+
+	t.playlist.state.intern.markDirty(t.Filepath)
+	t.playlist.state.invalidateGenerated()
 	t.playlist.state.MarkChanged()
 }
 
+// Identity returns the identity of the track's file when it was last probed.
+// The zero value is returned if it was never probed.
+func (t *Track) Identity() mdcache.Identity {
+	if md, ok := t.playlist.state.metadata[t.Filepath]; ok {
+		return md.Identity
+	}
+	return mdcache.Identity{}
+}
+
+// SetScannedGain sets the ReplayGain measured by the loudness scanner, which is
+// used if the file has no ReplayGain tags. It's kept when the track is probed
+// again. Nil removes it.
+func (t *Track) SetScannedGain(rg *playlist.ReplayGain) {
+	s := t.playlist.state
+
+	md, ok := s.metadata[t.Filepath]
+	if !ok {
+		md = s.metadataFor(t.Filepath, t.Metadata())
+		md.reference = 1
+	}
+
+	md.ScannedGain = rg
+
+	s.intern.markDirty(t.Filepath)
+	s.MarkChanged()
+}
+
+// Overrides returns the metadata values that the user has set for the track.
+func (t *Track) Overrides() playlist.Overrides {
+	if md, ok := t.playlist.state.metadata[t.Filepath]; ok && md.Overrides != nil {
+		return *md.Overrides
+	}
+	return playlist.Overrides{}
+}
+
+// SetOverrides sets the metadata values that take precedence over the probed
+// ones. They're kept when the track is probed again. The zero value removes
+// them. The playlists that write the track's metadata are marked as unsaved,
+// and they're returned.
+func (t *Track) SetOverrides(o playlist.Overrides) []*Playlist {
+	s := t.playlist.state
+
+	md, ok := s.metadata[t.Filepath]
+	if !ok {
+		md = s.metadataFor(t.Filepath, t.Metadata())
+		md.reference = 1
+	}
+
+	if o.IsZero() {
+		md.Overrides = nil
+	} else {
+		md.Overrides = &o
+	}
+
+	s.intern.markDirty(t.Filepath)
+	s.invalidateGenerated()
+	s.MarkChanged()
+
+	var changed []*Playlist
+
+	for _, name := range s.playlistNames {
+		pl := s.playlists[name]
+		if pl.IsReadOnly() {
+			continue
+		}
+
+		for _, track := range pl.Tracks {
+			if track.Filepath == t.Filepath {
+				pl.SetUnsaved()
+				changed = append(changed, pl)
+				break
+			}
+		}
+	}
+
+	return changed
+}
+
 // Metadata returns a copy of the current track's metadata with the filepath
-// filled in. If the metadata is not found, then a placeholder one is returned.
+// filled in and the overrides applied. If the metadata is not found, then a
+// placeholder one is returned.
 func (t *Track) Metadata() (track playlist.Track) {
+	if md, ok := t.playlist.state.metadata[t.Filepath]; ok {
+		track = md.track()
+	} else {
+		track.Title = playlist.TitleFromPath(t.Filepath)
+	}
+
+	track.Filepath = t.Filepath
+
+	return
+}
+
+// ProbedMetadata returns a copy of the current track's metadata similarly to
+// Metadata, except the overrides aren't applied.
+func (t *Track) ProbedMetadata() (track playlist.Track) {
 	if md, ok := t.playlist.state.metadata[t.Filepath]; ok {
 		track = md.Track
 	} else {
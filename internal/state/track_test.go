@@ -0,0 +1,247 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/state/mdcache"
+	"github.com/diamondburned/aqours/internal/state/store"
+)
+
+func TestMetadataCache(t *testing.T) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal("failed to open database:", err)
+	}
+	defer db.Close()
+
+	cached := mdcache.Entry{
+		Track:    playlist.Track{Title: "Cached", Artist: "Artist"},
+		Identity: mdcache.Identity{Size: 10, ModTime: 20},
+	}
+
+	if err := db.Metadata.Put(map[string]mdcache.Entry{"/cached": cached}); err != nil {
+		t.Fatal("failed to put:", err)
+	}
+
+	s := NewState()
+	s.intern.db = db
+
+	pl := s.AddPlaylist(&playlist.Playlist{Name: "test"})
+	pl.AddTracks(0, true,
+		playlist.Track{Filepath: "/cached", Title: "From Playlist"},
+		playlist.Track{Filepath: "/new", Title: "New"},
+	)
+
+	if md := pl.Tracks[0].Metadata(); md.Title != "Cached" {
+		t.Errorf("cached track has title %q, want Cached", md.Title)
+	}
+	if id := pl.Tracks[0].Identity(); id != cached.Identity {
+		t.Errorf("cached track has identity %v, want %v", id, cached.Identity)
+	}
+
+	// Only the new track should be written into the cache.
+	dirty := s.takeDirty()
+	if len(dirty) != 1 || dirty["/new"].Track.Title != "New" {
+		t.Fatalf("unexpected dirty entries: %v", dirty)
+	}
+
+	ident := mdcache.Identity{Size: 1, ModTime: 2}
+	pl.Tracks[0].UpdateProbedMetadata(playlist.Track{Title: "Probed"}, ident)
+	pl.Tracks[1].MarkPlayed()
+
+	dirty = s.takeDirty()
+	if len(dirty) != 2 {
+		t.Fatalf("expected 2 dirty entries, got %v", dirty)
+	}
+	if e := dirty["/cached"]; e.Track.Title != "Probed" || e.Identity != ident {
+		t.Errorf("unexpected probed entry: %#v", e)
+	}
+	if e := dirty["/new"]; e.Track.PlayCount != 1 {
+		t.Errorf("unexpected played entry: %#v", e)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	s := NewState()
+
+	pl := s.AddPlaylist(&playlist.Playlist{Name: "test", Path: "/test.m3u"})
+	pl.AddTracks(0, true, playlist.Track{Filepath: "/a", Title: "A", Artist: "Artist", Number: 1})
+	pl.unsaved = 0
+
+	gen := s.AddPlaylist(&playlist.Playlist{Name: "generated", Generator: titleGenerator("Fixed")})
+	gen.unsaved = 0
+
+	track := pl.Tracks[0]
+
+	changed := track.SetOverrides(playlist.Overrides{Title: "Fixed", Number: 3})
+	if len(changed) != 1 || changed[0] != pl {
+		t.Fatalf("unexpected changed playlists: %v", changed)
+	}
+	if !pl.IsUnsaved() || gen.IsUnsaved() {
+		t.Error("only the playlist with the track should be unsaved")
+	}
+
+	want := playlist.Track{Filepath: "/a", Title: "Fixed", Artist: "Artist", Number: 3}
+	if md := track.Metadata(); md != want {
+		t.Errorf("unexpected metadata:\n got %#v\nwant %#v", md, want)
+	}
+
+	// Generated playlists match the overridden values.
+	s.RegeneratePlaylists()
+	if len(gen.Tracks) != 1 {
+		t.Errorf("generated playlist has %d tracks, want 1", len(gen.Tracks))
+	}
+
+	// Probing again only replaces the probed values.
+	track.UpdateProbedMetadata(playlist.Track{Title: "Probed", Artist: "Probed"}, mdcache.Identity{Size: 1})
+
+	want = playlist.Track{Filepath: "/a", Title: "Fixed", Artist: "Probed", Number: 3}
+	if md := track.Metadata(); md != want {
+		t.Errorf("unexpected metadata after probing:\n got %#v\nwant %#v", md, want)
+	}
+
+	if md := track.ProbedMetadata(); md.Title != "Probed" || md.Number != 0 {
+		t.Errorf("unexpected probed metadata: %#v", md)
+	}
+
+	track.SetOverrides(playlist.Overrides{})
+	if md := track.Metadata(); md.Title != "Probed" {
+		t.Errorf("overrides not removed: %#v", md)
+	}
+	if o := track.Overrides(); !o.IsZero() {
+		t.Errorf("unexpected overrides: %#v", o)
+	}
+}
+
+func TestClipboard(t *testing.T) {
+	s := NewState()
+
+	pl := s.AddPlaylist(&playlist.Playlist{Name: "test", Path: "/test.m3u"})
+	pl.AddTracks(0, true,
+		playlist.Track{Filepath: "/a", Title: "A"},
+		playlist.Track{Filepath: "/b", Title: "B"},
+	)
+
+	// Cut the first track out of its only playlist.
+	s.SetClipboard(pl.Tracks[0])
+	pl.Remove(0)
+
+	other := s.AddPlaylist(&playlist.Playlist{Name: "other", Path: "/other.m3u"})
+	other.AddTracks(0, true, playlist.Track{Filepath: "/a", Title: "a"})
+
+	if md := other.Tracks[0].Metadata(); md.Title != "A" {
+		t.Errorf("cut metadata not kept: %#v", md)
+	}
+	if ref := s.metadata["/a"].reference; ref != 2 {
+		t.Errorf("references = %d, want 2", ref)
+	}
+
+	// Copying something else releases the old clipboard.
+	s.SetClipboard(pl.Tracks[0])
+	other.Remove(0)
+
+	if _, ok := s.metadata["/a"]; ok {
+		t.Error("metadata of the old clipboard is still referenced")
+	}
+	if ref := s.metadata["/b"].reference; ref != 2 {
+		t.Errorf("references = %d, want 2", ref)
+	}
+}
+
+func TestScannedGain(t *testing.T) {
+	s := NewState()
+
+	pl := s.AddPlaylist(&playlist.Playlist{Name: "test", Path: "/test.m3u"})
+	pl.AddTracks(0, true, playlist.Track{Filepath: "/a", Title: "A"})
+
+	track := pl.Tracks[0]
+	scanned := &playlist.ReplayGain{TrackGain: -6, TrackPeak: 0.9, AlbumGain: -7, AlbumPeak: 1}
+
+	track.SetScannedGain(scanned)
+	if rg := track.Metadata().ReplayGain; rg == nil || *rg != *scanned {
+		t.Errorf("expected scanned ReplayGain, got %v", rg)
+	}
+	if rg := track.ProbedMetadata().ReplayGain; rg != nil {
+		t.Errorf("expected no probed ReplayGain, got %v", rg)
+	}
+
+	// Probing again keeps the scan, but the tags take precedence.
+	tagged := &playlist.ReplayGain{TrackGain: 1}
+	track.UpdateProbedMetadata(playlist.Track{Title: "A", ReplayGain: tagged}, mdcache.Identity{Size: 1})
+
+	if rg := track.Metadata().ReplayGain; rg == nil || *rg != *tagged {
+		t.Errorf("expected tagged ReplayGain, got %v", rg)
+	}
+
+	track.UpdateProbedMetadata(playlist.Track{Title: "A"}, mdcache.Identity{Size: 2})
+	if rg := track.Metadata().ReplayGain; rg == nil || *rg != *scanned {
+		t.Errorf("expected scanned ReplayGain after probing, got %v", rg)
+	}
+
+	track.SetScannedGain(nil)
+	if rg := track.Metadata().ReplayGain; rg != nil {
+		t.Errorf("expected scanned ReplayGain to be removed, got %v", rg)
+	}
+}
+
+type titleGenerator string
+
+func (g titleGenerator) Generate(tracks []playlist.Track) []playlist.Track {
+	var matched []playlist.Track
+	for _, track := range tracks {
+		if track.Title == string(g) {
+			matched = append(matched, track)
+		}
+	}
+	return matched
+}
+
+func TestNamePattern(t *testing.T) {
+	s := NewState()
+	s.SetLibraryRoots([]string{"/music", "/music/ripped"})
+	s.SetLibraryNamePattern("/music/ripped", "%artist%/%album%/%number% - %title%")
+	s.SyncPlaylist(s.Library(), []string{
+		"/music/loose.mp3",
+		"/music/ripped/Aqours/Album/01 - Song.flac",
+	})
+
+	pl := s.AddPlaylist(&playlist.Playlist{Name: "test"})
+	pl.Add(0, true, "/music/ripped/Aqours/Album/01 - Song.flac")
+
+	lib := s.Library().Tracks
+	if p := lib[0].NamePattern(); p != nil {
+		t.Errorf("track outside of the root has pattern %q", p)
+	}
+
+	p := lib[1].NamePattern()
+	if p == nil {
+		t.Fatal("track in the root has no pattern")
+	}
+
+	track := lib[1].ProbedMetadata()
+	track.Unprobeable = true
+	track.GuessFromPath(p)
+
+	if track.Artist != "Aqours" || track.Album != "Album" || track.Title != "Song" || track.Number != 1 {
+		t.Errorf("unexpected guessed metadata: %#v", track)
+	}
+
+	// The playlist's own pattern takes precedence.
+	pl.SetNamePattern("%title%")
+	if p := pl.Tracks[0].NamePattern(); p == nil || p.String() != "%title%" {
+		t.Errorf("unexpected playlist pattern %v", p)
+	}
+
+	// Invalid patterns are ignored.
+	pl.SetNamePattern("%invalid%")
+	if p := pl.Tracks[0].NamePattern(); p != nil {
+		t.Errorf("unexpected invalid pattern %v", p)
+	}
+
+	s.SetLibraryRoots([]string{"/music"})
+	if pattern := s.LibraryNamePattern("/music/ripped"); pattern != "" {
+		t.Errorf("pattern of removed root is kept: %q", pattern)
+	}
+}
@@ -54,7 +54,7 @@ func (s *Stateful) LookupAction(label string) gio.Actioner {
 func (s *Stateful) RemoveAction(label string) {
 	for i, l := range s.labels {
 		if l == label {
-			s.labels = append(s.labels[:i], s.labels[:i+1]...)
+			s.labels = append(s.labels[:i], s.labels[i+1:]...)
 			s.SimpleActionGroup.RemoveAction(ActionName(label))
 			return
 		}
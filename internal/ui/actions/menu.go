@@ -79,7 +79,7 @@ func (m *Menu) RemoveAction(label string) {
 
 	for i, l := range labels {
 		if l == label {
-			labels = append(labels[:i], labels[:i+1]...)
+			labels = append(labels[:i], labels[i+1:]...)
 			m.menu.Remove(i)
 
 			m.Stateful.labels = labels
@@ -1,8 +1,10 @@
 package controls
 
 import (
+	"github.com/diamondburned/aqours/internal/gtkutil"
 	"github.com/diamondburned/aqours/internal/state"
 	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 )
@@ -50,11 +52,12 @@ var repeatShuffleButtonCSS = css.PrepareClass("repeat-shuffle", `
 
 type Buttons struct {
 	gtk.Box
-	Shuffle *gtk.ToggleButton
-	Prev    *gtk.Button
-	Play    *PlayPause // Pause
-	Next    *gtk.Button
-	Repeat  *Repeat
+	Shuffle     *gtk.ToggleButton
+	ShuffleMode *gio.SimpleAction
+	Prev        *gtk.Button
+	Play        *PlayPause // Pause
+	Next        *gtk.Button
+	Repeat      *Repeat
 }
 
 func NewButtons(parent ParentController) *Buttons {
@@ -65,6 +68,27 @@ func NewButtons(parent ParentController) *Buttons {
 	playbackButtonCSS(shuf)
 	repeatShuffleButtonCSS(shuf)
 
+	// The shuffle mode is chosen from the shuffle button's menu.
+	mode := gio.NewSimpleActionStateful(
+		"mode", glib.NewVariantType("s"), glib.NewVariantString(state.ShuffleTracks.String()))
+	mode.ConnectActivate(func(v *glib.Variant) {
+		var m state.ShuffleMode
+		if err := m.UnmarshalText([]byte(v.String())); err == nil {
+			parent.SetShuffleMode(m)
+		}
+	})
+
+	modeGroup := gio.NewSimpleActionGroup()
+	modeGroup.AddAction(mode)
+	shuf.InsertActionGroup("shuffle", modeGroup)
+
+	modeMenu := gio.NewMenu()
+	for _, m := range state.ShuffleModes {
+		modeMenu.Append(m.Label(), "shuffle.mode::"+m.String())
+	}
+	gtkutil.BindPopoverMenu(shuf, gtk.PosTop, modeMenu)
+	shuf.SetTooltipText(state.ShuffleTracks.Label())
+
 	prev := gtk.NewButton()
 	prev.SetChild(gtk.NewImageFromIconName("media-skip-backward"))
 	prev.SetVAlign(gtk.AlignCenter)
@@ -95,12 +119,13 @@ func NewButtons(parent ParentController) *Buttons {
 	box.Append(repeat)
 
 	return &Buttons{
-		Box:     *box,
-		Shuffle: shuf,
-		Prev:    prev,
-		Play:    pp,
-		Next:    next,
-		Repeat:  repeat,
+		Box:         *box,
+		Shuffle:     shuf,
+		ShuffleMode: mode,
+		Prev:        prev,
+		Play:        pp,
+		Next:        next,
+		Repeat:      repeat,
 	}
 }
 
@@ -109,6 +134,13 @@ func (b *Buttons) SetShuffle(shuffle bool) {
 	b.Shuffle.SetActive(shuffle)
 }
 
+// SetShuffleMode shows the shuffle mode in the shuffle button's menu. It does
+// NOT trigger a callback to the parent.
+func (b *Buttons) SetShuffleMode(mode state.ShuffleMode) {
+	b.ShuffleMode.SetState(glib.NewVariantString(mode.String()))
+	b.Shuffle.SetTooltipText(mode.Label())
+}
+
 // SetRepeat sets Repeat's mode. It does NOT trigger a callback to the parent.
 func (b *Buttons) SetRepeat(mode state.RepeatMode, callback bool) {
 	b.Repeat.SetRepeat(mode, callback)
@@ -12,6 +12,7 @@ type ParentController interface {
 	SetPlay(playing bool)
 	SetRepeat(repeatMode state.RepeatMode)
 	SetShuffle(shuffle bool)
+	SetShuffleMode(mode state.ShuffleMode)
 }
 
 type Container struct {
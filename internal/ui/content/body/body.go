@@ -3,6 +3,7 @@ package body
 import (
 	"log"
 
+	"github.com/diamondburned/aqours/internal/ui/content/body/library"
 	"github.com/diamondburned/aqours/internal/ui/content/body/sidebar"
 	"github.com/diamondburned/aqours/internal/ui/content/body/tracks"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
@@ -11,6 +12,7 @@ import (
 type ParentController interface {
 	tracks.ParentController
 	sidebar.ParentController
+	library.ParentController
 }
 
 type Container struct {
@@ -21,6 +23,7 @@ type Container struct {
 
 	RightStack *gtk.Stack
 	TracksView *tracks.Container
+	Library    *library.Browser
 }
 
 func NewContainer(parent ParentController) *Container {
@@ -34,6 +37,9 @@ func NewContainer(parent ParentController) *Container {
 	c.TracksView = tracks.NewContainer(c)
 	c.TracksView.SetHExpand(true)
 
+	c.Library = library.NewBrowser(parent)
+	c.Library.SetHExpand(true)
+
 	idleIcon := gtk.NewImageFromIconName("folder-music-symbolic")
 
 	idleBox := gtk.NewBox(gtk.OrientationHorizontal, 0)
@@ -44,6 +50,7 @@ func NewContainer(parent ParentController) *Container {
 	c.RightStack = gtk.NewStack()
 	c.RightStack.AddNamed(idleBox, "idle")
 	c.RightStack.AddNamed(c.TracksView, "tracks")
+	c.RightStack.AddNamed(c.Library, "library")
 
 	c.Box = gtk.NewBox(gtk.OrientationHorizontal, 0)
 	c.Box.Append(c.Sidebar)
@@ -65,5 +72,20 @@ func (c *Container) SelectPlaylist(path string) {
 		c.RightStack.SetVisibleChildName("tracks")
 	}
 
+	// Only one of the sidebar lists may have a selection.
+	c.Sidebar.LibraryList.UnselectAll()
+
 	c.ParentController.SelectPlaylist(path)
 }
+
+// SelectLibrary shows the library browser.
+func (c *Container) SelectLibrary() {
+	c.RightStack.SetVisibleChildName("library")
+	c.Sidebar.SelectLibrary()
+	c.ParentController.SelectLibrary()
+}
+
+// IsLibraryShown returns true if the library browser is shown.
+func (c *Container) IsLibraryShown() bool {
+	return c.RightStack.VisibleChildName() == "library"
+}
@@ -0,0 +1,480 @@
+// Package library is the library browser, which browses the library tracks by
+// artists, albums and genres.
+package library
+
+import (
+	"fmt"
+
+	"github.com/diamondburned/aqours/internal/durafmt"
+	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/muse/library"
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+)
+
+type ParentController interface {
+	// PlayLibraryTrack plays the library track with the given index.
+	PlayLibraryTrack(index int)
+	// AddTracksToPlaylist appends the given tracks to the playlist with the
+	// given name.
+	AddTracksToPlaylist(name string, tracks []playlist.Track)
+	// EditablePlaylists returns the names of the playlists that tracks can be
+	// added to.
+	EditablePlaylists() []string
+	// LibraryRoots returns the root directories of the library.
+	LibraryRoots() []string
+	// SetLibraryRoots sets the root directories of the library.
+	SetLibraryRoots(roots []string)
+	// LibraryNamePattern returns the name pattern of the given library root.
+	LibraryNamePattern(root string) string
+	// SetLibraryNamePattern sets the name pattern of the given library root.
+	SetLibraryNamePattern(root, pattern string)
+	// LibraryPaths returns at most limit paths of the library tracks in the
+	// given root.
+	LibraryPaths(root string, limit int) []string
+	// AnalyzeLoudness measures the loudness of the given tracks to find their
+	// ReplayGain.
+	AnalyzeLoudness(tracks []*state.Track)
+}
+
+var browserCSS = css.PrepareClass("library-browser", `
+	.library-browser > box:first-child {
+		margin: 4px 6px;
+	}
+	.library-browser list {
+		background: @theme_bg_color;
+	}
+	.library-browser list > row > box {
+		margin: 4px 8px;
+	}
+`)
+
+// Browser is the library browser. It has three columns: artists or genres,
+// albums, then tracks.
+type Browser struct {
+	*gtk.Box
+	parent ParentController
+
+	Mode    *gtk.Stack
+	Artists *List
+	Genres  *List
+	Albums  *List
+	Tracks  *List
+	Status  *gtk.Label
+
+	library *state.Playlist
+	index   *library.Index
+
+	artist *library.Artist
+	genre  *library.Genre
+	album  *library.Album
+
+	// menuTracks is the list of tracks that the context menu acts on.
+	menuTracks []int
+}
+
+// List is a scrolled list box of labeled rows.
+type List struct {
+	*gtk.ScrolledWindow
+	ListBox *gtk.ListBox
+	rows    []*gtk.ListBoxRow
+}
+
+func newList() *List {
+	list := gtk.NewListBox()
+	list.SetSelectionMode(gtk.SelectionSingle)
+	list.SetActivateOnSingleClick(false)
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetVExpand(true)
+	scroll.SetHExpand(true)
+	scroll.SetChild(list)
+
+	return &List{
+		ScrolledWindow: scroll,
+		ListBox:        list,
+	}
+}
+
+// Clear removes all rows.
+func (l *List) Clear() {
+	for _, row := range l.rows {
+		l.ListBox.Remove(row)
+	}
+	l.rows = nil
+}
+
+// Append appends a row with the given title and dimmed subtitle.
+func (l *List) Append(title, subtitle string) {
+	titleLabel := gtk.NewLabel(title)
+	titleLabel.SetXAlign(0)
+	titleLabel.SetHExpand(true)
+	titleLabel.SetEllipsize(pango.EllipsizeEnd)
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	box.Append(titleLabel)
+
+	if subtitle != "" {
+		subLabel := gtk.NewLabel(subtitle)
+		subLabel.AddCSSClass("dim-label")
+		box.Append(subLabel)
+	}
+
+	row := gtk.NewListBoxRow()
+	row.SetChild(box)
+
+	l.ListBox.Append(row)
+	l.rows = append(l.rows, row)
+}
+
+// Select selects the row with the given index.
+func (l *List) Select(ix int) {
+	if ix >= 0 && ix < len(l.rows) {
+		l.ListBox.SelectRow(l.rows[ix])
+	}
+}
+
+// rowAt returns the index of the row at the given y coordinate, or -1 if none.
+func (l *List) rowAt(y float64) int {
+	row := l.ListBox.RowAtY(int(y))
+	if row == nil {
+		return -1
+	}
+	return row.Index()
+}
+
+func NewBrowser(parent ParentController) *Browser {
+	b := &Browser{parent: parent}
+
+	b.Artists = newList()
+	b.Genres = newList()
+	b.Albums = newList()
+	b.Tracks = newList()
+
+	b.Mode = gtk.NewStack()
+	b.Mode.AddTitled(b.Artists, "artists", "Artists")
+	b.Mode.AddTitled(b.Genres, "genres", "Genres")
+	b.Mode.SetHExpand(true)
+	b.Mode.Connect("notify::visible-child", func() { b.selectMode() })
+
+	switcher := gtk.NewStackSwitcher()
+	switcher.SetStack(b.Mode)
+
+	b.Status = gtk.NewLabel("")
+	b.Status.SetHExpand(true)
+	b.Status.SetXAlign(1)
+	b.Status.AddCSSClass("dim-label")
+
+	roots := gtk.NewButtonFromIconName("folder-open-symbolic")
+	roots.SetTooltipText("Library Folders")
+	roots.ConnectClicked(func() { spawnRootsDialog(parent) })
+
+	toolbar := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	toolbar.Append(switcher)
+	toolbar.Append(b.Status)
+	toolbar.Append(roots)
+
+	right := gtk.NewPaned(gtk.OrientationHorizontal)
+	right.SetStartChild(b.Albums)
+	right.SetEndChild(b.Tracks)
+	right.SetPosition(220)
+
+	paned := gtk.NewPaned(gtk.OrientationHorizontal)
+	paned.SetVExpand(true)
+	paned.SetStartChild(b.Mode)
+	paned.SetEndChild(right)
+	paned.SetPosition(200)
+
+	b.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	b.Box.Append(toolbar)
+	b.Box.Append(gtk.NewSeparator(gtk.OrientationHorizontal))
+	b.Box.Append(paned)
+	browserCSS(b.Box)
+
+	b.Artists.ListBox.ConnectRowSelected(func(row *gtk.ListBoxRow) {
+		if row != nil && b.index != nil {
+			b.selectArtist(b.index.Artists[row.Index()])
+		}
+	})
+	b.Genres.ListBox.ConnectRowSelected(func(row *gtk.ListBoxRow) {
+		if row != nil && b.index != nil {
+			b.selectGenre(b.index.Genres[row.Index()])
+		}
+	})
+	b.Albums.ListBox.ConnectRowSelected(func(row *gtk.ListBoxRow) {
+		if row != nil {
+			b.selectAlbum(b.albums()[row.Index()])
+		}
+	})
+
+	// Activating any row plays its first track.
+	b.Artists.ListBox.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		b.play(b.index.Artists[row.Index()].Tracks())
+	})
+	b.Genres.ListBox.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		b.play(b.index.Genres[row.Index()].Tracks())
+	})
+	b.Albums.ListBox.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		b.play(b.albums()[row.Index()].Tracks)
+	})
+	b.Tracks.ListBox.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		b.play(b.tracks()[row.Index():])
+	})
+
+	b.bindMenu(b.Artists, func(ix int) []int { return b.index.Artists[ix].Tracks() })
+	b.bindMenu(b.Genres, func(ix int) []int { return b.index.Genres[ix].Tracks() })
+	b.bindMenu(b.Albums, func(ix int) []int { return b.albums()[ix].Tracks })
+	b.bindMenu(b.Tracks, func(ix int) []int { return b.tracks()[ix : ix+1] })
+
+	play := gtkutil.ActionFunc("play", func() { b.play(b.menuTracks) })
+
+	analyze := gtkutil.ActionFunc("analyze-loudness", func() {
+		b.parent.AnalyzeLoudness(b.tracks(b.menuTracks))
+	})
+
+	addTo := gio.NewSimpleAction("add-to", glib.NewVariantType("s"))
+	addTo.ConnectActivate(func(name *glib.Variant) {
+		b.parent.AddTracksToPlaylist(name.String(), b.metadata(b.menuTracks))
+	})
+
+	group := gio.NewSimpleActionGroup()
+	group.AddAction(play)
+	group.AddAction(addTo)
+	group.AddAction(analyze)
+	b.Box.InsertActionGroup("library", group)
+
+	return b
+}
+
+// bindMenu binds the context menu to the given list. tracks returns the tracks
+// of the row with the given index.
+func (b *Browser) bindMenu(list *List, tracks func(ix int) []int) {
+	gtkutil.BindRightClick(list.ListBox, func(x, y float64) {
+		ix := list.rowAt(y)
+		if ix < 0 || b.index == nil {
+			return
+		}
+
+		list.Select(ix)
+		b.menuTracks = tracks(ix)
+
+		playlists := gio.NewMenu()
+		for _, name := range b.parent.EditablePlaylists() {
+			item := gio.NewMenuItem(name, "")
+			item.SetActionAndTargetValue("library.add-to", glib.NewVariantString(name))
+			playlists.AppendItem(item)
+		}
+
+		menu := gio.NewMenu()
+		menu.Append("_Play", "library.play")
+		menu.AppendSubmenu("_Add to Playlist", playlists)
+		menu.Append("Analyze _Loudness...", "library.analyze-loudness")
+
+		p := gtkutil.NewPopoverMenuAt(list.ListBox, gtk.PosBottom, x, y, menu)
+		p.Popup()
+	})
+}
+
+// SetIndex sets the library and its index. The current selection is kept if
+// it's still in the index.
+func (b *Browser) SetIndex(lib *state.Playlist, index *library.Index) {
+	var artistName, genreName string
+	var albumKey [2]string
+
+	if b.artist != nil {
+		artistName = b.artist.Name
+	}
+	if b.genre != nil {
+		genreName = b.genre.Name
+	}
+	if b.album != nil {
+		albumKey = [2]string{b.album.Artist, b.album.Name}
+	}
+
+	b.library = lib
+	b.index = index
+	b.artist = nil
+	b.genre = nil
+	b.album = nil
+
+	b.Status.SetText(fmt.Sprintf(
+		"%d artists, %d tracks", len(index.Artists), len(lib.Tracks),
+	))
+
+	b.Albums.Clear()
+	b.Tracks.Clear()
+
+	b.Artists.Clear()
+	for _, artist := range index.Artists {
+		b.Artists.Append(artist.Name, fmt.Sprintf("%d", len(artist.Albums)))
+	}
+
+	b.Genres.Clear()
+	for _, genre := range index.Genres {
+		b.Genres.Append(genre.Name, fmt.Sprintf("%d", len(genre.Albums)))
+	}
+
+	for i, artist := range index.Artists {
+		if artist.Name == artistName {
+			b.Artists.Select(i)
+			break
+		}
+	}
+
+	for i, genre := range index.Genres {
+		if genre.Name == genreName {
+			b.Genres.Select(i)
+			break
+		}
+	}
+
+	for i, album := range b.albums() {
+		if albumKey == [2]string{album.Artist, album.Name} {
+			b.Albums.Select(i)
+			break
+		}
+	}
+}
+
+func (b *Browser) isGenreMode() bool {
+	return b.Mode.VisibleChildName() == "genres"
+}
+
+// selectMode refreshes the albums after switching between artists and genres.
+func (b *Browser) selectMode() {
+	b.setAlbums(b.albums())
+}
+
+func (b *Browser) selectArtist(artist *library.Artist) {
+	b.artist = artist
+	if !b.isGenreMode() {
+		b.setAlbums(artist.Albums)
+	}
+}
+
+func (b *Browser) selectGenre(genre *library.Genre) {
+	b.genre = genre
+	if b.isGenreMode() {
+		b.setAlbums(genre.Albums)
+	}
+}
+
+func (b *Browser) setAlbums(albums []*library.Album) {
+	b.album = nil
+
+	b.Albums.Clear()
+	for _, album := range albums {
+		subtitle := album.Date
+		if b.isGenreMode() {
+			subtitle = album.Artist
+		}
+		b.Albums.Append(album.Name, subtitle)
+	}
+
+	// Show all tracks until an album is selected.
+	b.setTracks(albumTracks(albums))
+}
+
+func (b *Browser) selectAlbum(album *library.Album) {
+	b.album = album
+	b.setTracks(album.Tracks)
+}
+
+func (b *Browser) setTracks(tracks []int) {
+	b.Tracks.Clear()
+
+	for _, ix := range tracks {
+		md := b.library.Tracks[ix].Metadata()
+
+		title := md.Title
+		if md.Number > 0 {
+			title = fmt.Sprintf("%d. %s", md.Number, md.Title)
+		}
+
+		b.Tracks.Append(title, durafmt.Format(md.Length))
+	}
+}
+
+// albums returns the albums shown in the albums list.
+func (b *Browser) albums() []*library.Album {
+	switch {
+	case b.isGenreMode() && b.genre != nil:
+		return b.genre.Albums
+	case !b.isGenreMode() && b.artist != nil:
+		return b.artist.Albums
+	default:
+		return nil
+	}
+}
+
+// tracks returns the tracks shown in the tracks list.
+func (b *Browser) tracks() []int {
+	if b.album != nil {
+		return b.album.Tracks
+	}
+	return albumTracks(b.albums())
+}
+
+func albumTracks(albums []*library.Album) []int {
+	var tracks []int
+	for _, album := range albums {
+		tracks = append(tracks, album.Tracks...)
+	}
+	return tracks
+}
+
+// play plays the first of the given tracks.
+func (b *Browser) play(tracks []int) {
+	if len(tracks) > 0 {
+		b.parent.PlayLibraryTrack(tracks[0])
+	}
+}
+
+// Reveal selects the artist and album of the library track with the given
+// index, then selects the track.
+func (b *Browser) Reveal(track int) {
+	if b.index == nil {
+		return
+	}
+
+	b.Mode.SetVisibleChildName("artists")
+
+	for i, artist := range b.index.Artists {
+		for j, album := range artist.Albums {
+			for k, ix := range album.Tracks {
+				if ix != track {
+					continue
+				}
+
+				b.Artists.Select(i)
+				b.Albums.Select(j)
+				b.Tracks.Select(k)
+				return
+			}
+		}
+	}
+}
+
+// tracks returns the library tracks with the given indices.
+func (b *Browser) tracks(tracks []int) []*state.Track {
+	library := make([]*state.Track, len(tracks))
+	for i, ix := range tracks {
+		library[i] = b.library.Tracks[ix]
+	}
+	return library
+}
+
+// metadata returns the metadata of the given library tracks.
+func (b *Browser) metadata(tracks []int) []playlist.Track {
+	metadata := make([]playlist.Track, len(tracks))
+	for i, ix := range tracks {
+		metadata[i] = b.library.Tracks[ix].Metadata()
+	}
+	return metadata
+}
@@ -0,0 +1,144 @@
+package library
+
+import (
+	"path/filepath"
+
+	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/aqours/internal/ui/namepattern"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+)
+
+var rootsCSS = css.PrepareClass("library-roots", `
+	.library-roots {
+		margin: 8px;
+	}
+`)
+
+// spawnRootsDialog spawns a dialog for editing the library roots and their name
+// patterns.
+func spawnRootsDialog(parent ParentController) {
+	window := gtkutil.ActiveWindow()
+	dialog := gtk.NewDialogWithFlags(
+		"Library Folders", window, gtk.DialogModal|gtk.DialogUseHeaderBar)
+	dialog.SetDefaultSize(400, -1)
+
+	dialog.AddButton("Save", int(gtk.ResponseApply))
+
+	roots := append([]string(nil), parent.LibraryRoots()...)
+
+	// patterns are the name patterns of the roots, which are only set once the
+	// dialog is saved.
+	patterns := make(map[string]string, len(roots))
+	for _, root := range roots {
+		patterns[root] = parent.LibraryNamePattern(root)
+	}
+
+	list := gtk.NewListBox()
+	list.SetSelectionMode(gtk.SelectionNone)
+
+	var rows []*gtk.ListBoxRow
+
+	var addRow func(root string)
+	addRow = func(root string) {
+		label := gtk.NewLabel(root)
+		label.SetXAlign(0)
+		label.SetHExpand(true)
+		label.SetEllipsize(pango.EllipsizeMiddle)
+
+		pattern := gtk.NewButtonFromIconName("document-edit-symbolic")
+		pattern.SetTooltipText("Guess Metadata from File Names")
+		pattern.ConnectClicked(func() {
+			paths := parent.LibraryPaths(root, namepattern.MaxPreview)
+			namepattern.SpawnDialog(filepath.Base(root), patterns[root], paths, func(p string) {
+				patterns[root] = p
+			})
+		})
+
+		remove := gtk.NewButtonFromIconName("list-remove-symbolic")
+		remove.SetTooltipText("Remove Folder")
+
+		box := gtk.NewBox(gtk.OrientationHorizontal, 4)
+		box.Append(label)
+		box.Append(pattern)
+		box.Append(remove)
+
+		row := gtk.NewListBoxRow()
+		row.SetChild(box)
+
+		remove.ConnectClicked(func() {
+			for i, r := range rows {
+				if r == row {
+					rows = append(rows[:i], rows[i+1:]...)
+					roots = append(roots[:i], roots[i+1:]...)
+					break
+				}
+			}
+			list.Remove(row)
+		})
+
+		list.Append(row)
+		rows = append(rows, row)
+	}
+
+	for _, root := range roots {
+		addRow(root)
+	}
+
+	add := gtk.NewButtonWithLabel("Add Folder...")
+	add.SetHAlign(gtk.AlignStart)
+	add.ConnectClicked(func() {
+		chooser := gtk.NewFileChooserNative(
+			"Add Library Folder", window,
+			gtk.FileChooserActionSelectFolder, "Add", "Cancel",
+		)
+		chooser.SetModal(true)
+		chooser.ConnectResponse(func(resp int) {
+			defer chooser.Destroy()
+
+			if resp != int(gtk.ResponseAccept) {
+				return
+			}
+
+			file := chooser.File()
+			if file == nil || file.Path() == "" {
+				return
+			}
+
+			for _, root := range roots {
+				if root == file.Path() {
+					return
+				}
+			}
+
+			roots = append(roots, file.Path())
+			addRow(file.Path())
+		})
+		chooser.Show()
+	})
+
+	box := gtk.NewBox(gtk.OrientationVertical, 8)
+	box.Append(list)
+	box.Append(add)
+	rootsCSS(box)
+
+	dialog.ContentArea().Append(box)
+
+	dialog.ConnectResponse(func(res int) {
+		defer dialog.Destroy()
+
+		if res != int(gtk.ResponseApply) {
+			return
+		}
+
+		parent.SetLibraryRoots(roots)
+
+		for _, root := range roots {
+			if patterns[root] != parent.LibraryNamePattern(root) {
+				parent.SetLibraryNamePattern(root, patterns[root])
+			}
+		}
+	})
+	dialog.Show()
+}
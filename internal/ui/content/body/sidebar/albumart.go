@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"log"
+	"os"
 	"time"
 
 	"github.com/diamondburned/aqours/internal/muse/albumart"
@@ -13,6 +14,7 @@ import (
 	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/pkg/errors"
 )
 
 var albumArtCSS = css.PrepareClass("album-art", "")
@@ -90,17 +92,27 @@ func FetchAlbumArtScaled(ctx context.Context, track *state.Track, size, scale in
 }
 
 // FetchAlbumArt fetches the track's album art into a pixbuf with the given
-// size.
+// size. The album art is loaded from the thumbnail cache, which makes the
+// thumbnail if it's not cached yet.
 func FetchAlbumArt(ctx context.Context, track *state.Track, size int) *gdkpixbuf.Pixbuf {
-	f := albumart.AlbumArt(ctx, track.Filepath)
-	if f == nil {
+	img, err := albumart.Thumbnail(ctx, track.Filepath, size)
+	if err != nil {
+		if !errors.Is(err, albumart.ErrNotFound) && ctx.Err() == nil {
+			log.Printf("failed to get album art of %q: %v", track.Filepath, err)
+		}
+		return nil
+	}
+
+	f, err := os.Open(img.Path)
+	if err != nil {
+		log.Println("failed to open album art:", err)
 		return nil
 	}
 	defer f.Close()
 
-	l, err := gdkpixbuf.NewPixbufLoaderWithType(f.Extension)
+	l, err := gdkpixbuf.NewPixbufLoaderWithType(img.Extension)
 	if err != nil {
-		log.Printf("PixbufLoaderNewWithType failed with %q: %v\n", f.Extension, err)
+		log.Printf("PixbufLoaderNewWithType failed with %q: %v\n", img.Extension, err)
 		return nil
 	}
 	defer l.Close()
@@ -110,7 +122,7 @@ func FetchAlbumArt(ctx context.Context, track *state.Track, size int) *gdkpixbuf
 	})
 
 	// Trivial error that we can't handle.
-	if _, err := io.Copy(gioutil.PixbufLoaderWriter(l), f.ReadCloser); err != nil {
+	if _, err := io.Copy(gioutil.PixbufLoaderWriter(l), f); err != nil {
 		log.Println("PixbufLoader.Write:", err)
 		return nil
 	}
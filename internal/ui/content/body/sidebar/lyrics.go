@@ -0,0 +1,176 @@
+package sidebar
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/muse/lyrics"
+	"github.com/diamondburned/aqours/internal/muse/lyrics/lrc"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/pkg/errors"
+)
+
+var lyricsCSS = css.PrepareClass("lyrics", `
+	.lyrics > box {
+		margin: 6px 0;
+	}
+	.lyrics label {
+		margin: 2px 8px;
+	}
+	.lyrics label.lyrics-current {
+		font-weight: bold;
+	}
+`)
+
+// LyricsHeight is the height of the lyrics panel.
+const LyricsHeight = 180
+
+// Lyrics is the panel that shows the lyrics of the playing track. It's hidden
+// if the track has no lyrics.
+type Lyrics struct {
+	*gtk.Revealer
+	Path   string
+	Scroll *gtk.ScrolledWindow
+	Lines  *gtk.Box
+
+	lyrics  *lrc.Lyrics
+	labels  []*gtk.Label
+	current int
+
+	stopLoading context.CancelFunc
+}
+
+func NewLyrics() *Lyrics {
+	lines := gtk.NewBox(gtk.OrientationVertical, 0)
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetSizeRequest(-1, LyricsHeight)
+	scroll.SetChild(lines)
+	lyricsCSS(scroll)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(gtk.NewSeparator(gtk.OrientationHorizontal))
+	box.Append(scroll)
+
+	rev := gtk.NewRevealer()
+	rev.SetRevealChild(false)
+	rev.SetTransitionType(gtk.RevealerTransitionTypeSlideUp)
+	rev.SetChild(box)
+
+	return &Lyrics{
+		Revealer:    rev,
+		Scroll:      scroll,
+		Lines:       lines,
+		current:     -1,
+		stopLoading: func() {}, // stub
+	}
+}
+
+// SetTrack loads the lyrics of the given track in the background.
+func (l *Lyrics) SetTrack(track *state.Track) {
+	l.stopLoading()
+	l.setLyrics(nil)
+
+	if track == nil {
+		l.Path = ""
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.stopLoading = cancel
+
+	l.Path = track.Filepath
+
+	go func() {
+		loaded, err := lyrics.Load(track.Filepath)
+		if err != nil {
+			if !errors.Is(err, lyrics.ErrNotFound) {
+				log.Printf("failed to load lyrics of %q: %v", track.Filepath, err)
+			}
+			return
+		}
+
+		glib.IdleAdd(func() {
+			// Make sure that the panel is still showing the same file.
+			if ctx.Err() == nil && l.Path == track.Filepath {
+				l.setLyrics(loaded)
+			}
+		})
+	}()
+}
+
+func (l *Lyrics) setLyrics(lyrics *lrc.Lyrics) {
+	for _, label := range l.labels {
+		l.Lines.Remove(label)
+	}
+
+	l.lyrics = lyrics
+	l.labels = nil
+	l.current = -1
+
+	if lyrics == nil {
+		l.SetRevealChild(false)
+		return
+	}
+
+	l.labels = make([]*gtk.Label, len(lyrics.Lines))
+
+	for i, line := range lyrics.Lines {
+		label := gtk.NewLabel(line.Text)
+		label.SetWrap(true)
+		label.SetJustify(gtk.JustifyCenter)
+		label.SetSelectable(!lyrics.Synced)
+
+		// Only the current line isn't dimmed.
+		if lyrics.Synced {
+			label.AddCSSClass("dim-label")
+		}
+
+		l.labels[i] = label
+		l.Lines.Append(label)
+	}
+
+	l.Scroll.VAdjustment().SetValue(0)
+	l.SetRevealChild(true)
+}
+
+// UpdatePosition highlights the line that is sung at the given position in
+// seconds and scrolls to it.
+func (l *Lyrics) UpdatePosition(pos float64) {
+	if l.lyrics == nil || !l.lyrics.Synced {
+		return
+	}
+
+	i := l.lyrics.LineAt(time.Duration(pos * float64(time.Second)))
+	if i == l.current {
+		return
+	}
+
+	if l.current >= 0 {
+		l.labels[l.current].RemoveCSSClass("lyrics-current")
+		l.labels[l.current].AddCSSClass("dim-label")
+	}
+
+	l.current = i
+
+	if i < 0 {
+		l.Scroll.VAdjustment().SetValue(0)
+		return
+	}
+
+	label := l.labels[i]
+	label.RemoveCSSClass("dim-label")
+	label.AddCSSClass("lyrics-current")
+
+	// Keep the current line in the middle.
+	_, y, ok := label.TranslateCoordinates(l.Lines, 0, 0)
+	if ok {
+		adj := l.Scroll.VAdjustment()
+		adj.SetValue(y + float64(label.AllocatedHeight())/2 - adj.PageSize()/2)
+	}
+}
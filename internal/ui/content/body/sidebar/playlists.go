@@ -26,7 +26,7 @@ func NewPlaylistList(parent ParentController) *PlaylistList {
 	list := &PlaylistList{parent: parent}
 
 	lbox := gtk.NewListBox()
-	lbox.SetSelectionMode(gtk.SelectionBrowse)
+	lbox.SetSelectionMode(gtk.SelectionSingle)
 	lbox.SetActivateOnSingleClick(true)
 	lbox.Connect("row-activated", func(_ *gtk.ListBox, r *gtk.ListBoxRow) {
 		parent.SelectPlaylist(list.Playlists[r.Index()].Name)
@@ -46,6 +46,12 @@ func (l *PlaylistList) AddPlaylist(pl *state.Playlist) *Playlist {
 	}
 
 	playlist := NewPlaylist(pl.Name, len(pl.Tracks))
+	switch {
+	case pl.IsGenerated():
+		playlist.SetIcon(SmartPlaylistIcon)
+	case pl.Source != nil:
+		playlist.SetIcon(FolderPlaylistIcon)
+	}
 
 	l.ListBox.Append(playlist)
 	l.Playlists = append(l.Playlists, playlist)
@@ -85,8 +91,18 @@ func (l *PlaylistList) Playlist(name string) *Playlist {
 	return nil
 }
 
+const (
+	// SmartPlaylistIcon is the icon shown next to smart playlists.
+	SmartPlaylistIcon = "system-search-symbolic"
+	// FolderPlaylistIcon is the icon shown next to folder playlists.
+	FolderPlaylistIcon = "folder-symbolic"
+	// LibraryIcon is the icon shown next to the library.
+	LibraryIcon = "folder-music-symbolic"
+)
+
 type Playlist struct {
 	*gtk.ListBoxRow
+	icon  *gtk.Image
 	name  *gtk.Label
 	total *gtk.Label
 
@@ -98,10 +114,13 @@ var playlistEntryCSS = css.PrepareClass("playlist-entry", `
 	.playlist-entry > box {
 		margin: 6px 8px;
 	}
-	.playlist-entry > box > label:first-child {
+	.playlist-entry > box > image {
+		margin-right: 6px;
+	}
+	.playlist-entry > box > box > label:first-child {
 		font-size: 1.1em;
 	}
-	.playlist-entry > box > label:last-child {
+	.playlist-entry > box > box > label:last-child {
 		font-size: 0.9em;
 		color: alpha(@theme_fg_color, 0.75);
 	}
@@ -116,9 +135,17 @@ func NewPlaylist(name string, total int) *Playlist {
 	pl.total = gtk.NewLabel("")
 	pl.total.SetXAlign(0)
 
-	box := gtk.NewBox(gtk.OrientationVertical, 0)
-	box.Append(pl.name)
-	box.Append(pl.total)
+	pl.icon = gtk.NewImage()
+	pl.icon.SetVisible(false)
+
+	labels := gtk.NewBox(gtk.OrientationVertical, 0)
+	labels.SetHExpand(true)
+	labels.Append(pl.name)
+	labels.Append(pl.total)
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	box.Append(pl.icon)
+	box.Append(labels)
 
 	pl.ListBoxRow = gtk.NewListBoxRow()
 	pl.ListBoxRow.SetChild(box)
@@ -147,3 +174,10 @@ func (pl *Playlist) SetTotal(total int) {
 	pl.total.SetLabel(fmt.Sprintf("%d songs", total))
 	pl.Total = total
 }
+
+// SetIcon sets the icon shown next to the playlist name. The icon is hidden if
+// the name is empty.
+func (pl *Playlist) SetIcon(icon string) {
+	pl.icon.SetFromIconName(icon)
+	pl.icon.SetVisible(icon != "")
+}
@@ -0,0 +1,161 @@
+package sidebar
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+)
+
+var queueCSS = css.PrepareClass("queue", `
+	.queue .queue-header {
+		margin: 4px 4px 4px 8px;
+	}
+	.queue .queue-header > label {
+		font-weight: bold;
+	}
+	.queue list {
+		background: none;
+	}
+	.queue list > row {
+		padding: 2px 4px 2px 8px;
+	}
+`)
+
+// QueueHeight is the height of the queue panel.
+const QueueHeight = 180
+
+// Queue is the panel that shows the tracks that the user has queued, which are
+// played before the rest of the playing playlist. It's hidden if the queue is
+// empty. The tracks are reordered by dragging them.
+type Queue struct {
+	*gtk.Revealer
+	Title  *gtk.Label
+	Clear  *gtk.Button
+	Scroll *gtk.ScrolledWindow
+	List   *gtk.ListBox
+
+	parent ParentController
+	rows   []*gtk.ListBoxRow
+}
+
+func NewQueue(parent ParentController) *Queue {
+	q := &Queue{parent: parent}
+
+	q.Title = gtk.NewLabel("Up Next")
+	q.Title.SetXAlign(0)
+	q.Title.SetHExpand(true)
+
+	q.Clear = gtk.NewButtonFromIconName("edit-clear-all-symbolic")
+	q.Clear.SetTooltipText("Clear Queue")
+	q.Clear.SetHasFrame(false)
+	q.Clear.ConnectClicked(parent.ClearQueue)
+
+	header := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	header.AddCSSClass("queue-header")
+	header.Append(q.Title)
+	header.Append(q.Clear)
+
+	q.List = gtk.NewListBox()
+	q.List.SetSelectionMode(gtk.SelectionNone)
+	q.List.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		parent.PlayQueued(row.Index())
+	})
+
+	q.Scroll = gtk.NewScrolledWindow()
+	q.Scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	q.Scroll.SetSizeRequest(-1, QueueHeight)
+	q.Scroll.SetChild(q.List)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(gtk.NewSeparator(gtk.OrientationHorizontal))
+	box.Append(header)
+	box.Append(q.Scroll)
+	queueCSS(box)
+
+	q.Revealer = gtk.NewRevealer()
+	q.Revealer.SetRevealChild(false)
+	q.Revealer.SetTransitionType(gtk.RevealerTransitionTypeSlideUp)
+	q.Revealer.SetChild(box)
+
+	return q
+}
+
+// SetTracks shows the given queued tracks in their order.
+func (q *Queue) SetTracks(tracks []*state.Track) {
+	for _, row := range q.rows {
+		q.List.Remove(row)
+	}
+
+	q.rows = make([]*gtk.ListBoxRow, len(tracks))
+	for i, track := range tracks {
+		q.rows[i] = q.newRow(i, track)
+		q.List.Append(q.rows[i])
+	}
+
+	q.Title.SetText(fmt.Sprintf("Up Next (%d)", len(tracks)))
+	q.SetRevealChild(len(tracks) > 0)
+}
+
+func (q *Queue) newRow(pos int, track *state.Track) *gtk.ListBoxRow {
+	md := track.Metadata()
+	if md.Title == "" {
+		md.Title = filepath.Base(track.Filepath)
+	}
+
+	title := gtk.NewLabel(md.Title)
+	title.SetXAlign(0)
+	title.SetEllipsize(pango.EllipsizeEnd)
+
+	info := gtk.NewLabel(md.Artist + " — " + track.Playlist().Name)
+	info.SetXAlign(0)
+	info.SetEllipsize(pango.EllipsizeEnd)
+	info.AddCSSClass("dim-label")
+
+	labels := gtk.NewBox(gtk.OrientationVertical, 0)
+	labels.SetHExpand(true)
+	labels.Append(title)
+	labels.Append(info)
+
+	remove := gtk.NewButtonFromIconName("list-remove-symbolic")
+	remove.SetTooltipText("Remove from Queue")
+	remove.SetHasFrame(false)
+	remove.SetVAlign(gtk.AlignCenter)
+	remove.ConnectClicked(func() { q.parent.Dequeue(pos) })
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	box.Append(labels)
+	box.Append(remove)
+
+	row := gtk.NewListBoxRow()
+	row.SetChild(box)
+	row.SetTooltipText(track.Filepath)
+
+	// Dragging a row onto another moves it to the other row's position.
+	drag := gtk.NewDragSource()
+	drag.SetActions(gdk.ActionMove)
+	drag.ConnectPrepare(func(x, y float64) *gdk.ContentProvider {
+		return gdk.NewContentProviderForValue(glib.NewValue(pos))
+	})
+	row.AddController(drag)
+
+	drop := gtk.NewDropTarget(glib.TypeInt, gdk.ActionMove)
+	drop.ConnectDrop(func(value *glib.Value, x, y float64) bool {
+		from, ok := value.GoValue().(int)
+		if !ok || from == pos {
+			return false
+		}
+		// The rows are rebuilt, so don't remove them while they're handling
+		// the drop.
+		glib.IdleAdd(func() { q.parent.MoveQueued(from, pos) })
+		return true
+	})
+	row.AddController(drop)
+
+	return row
+}
@@ -1,41 +1,83 @@
 package sidebar
 
-import "github.com/diamondburned/gotk4/pkg/gtk/v4"
+import (
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
 
 type ParentController interface {
 	SelectPlaylist(name string)
+	SelectLibrary()
+	// PlayQueued plays the queued track at the given position right away.
+	PlayQueued(pos int)
+	Dequeue(pos int)
+	MoveQueued(from, to int)
+	ClearQueue()
 }
 
 type Container struct {
 	gtk.Box
 
 	ListScroll   *gtk.ScrolledWindow
+	LibraryList  *gtk.ListBox
+	LibraryRow   *Playlist
 	PlaylistList *PlaylistList
 
+	Queue    *Queue
+	Lyrics   *Lyrics
 	AlbumArt *AlbumArt
 }
 
 func NewContainer(parent ParentController) *Container {
 	list := NewPlaylistList(parent)
 
+	libraryRow := NewPlaylist(state.LibraryName, 0)
+	libraryRow.SetIcon(LibraryIcon)
+
+	libraryList := gtk.NewListBox()
+	libraryList.SetSelectionMode(gtk.SelectionSingle)
+	libraryList.SetActivateOnSingleClick(true)
+	libraryList.Append(libraryRow)
+	libraryList.Connect("row-activated", func() { parent.SelectLibrary() })
+	playlistsCSS(libraryList)
+
+	lists := gtk.NewBox(gtk.OrientationVertical, 0)
+	lists.Append(libraryList)
+	lists.Append(gtk.NewSeparator(gtk.OrientationHorizontal))
+	lists.Append(list)
+
 	scroll := gtk.NewScrolledWindow()
 	scroll.SetVExpand(true)
 	scroll.SetPolicy(gtk.PolicyAutomatic, gtk.PolicyAutomatic)
-	scroll.SetChild(list)
+	scroll.SetChild(lists)
 
 	separator := gtk.NewSeparator(gtk.OrientationVertical)
 
+	queue := NewQueue(parent)
+	lyrics := NewLyrics()
 	aart := NewAlbumArt()
 
 	box := gtk.NewBox(gtk.OrientationVertical, 0)
 	box.Append(scroll)
 	box.Append(separator)
+	box.Append(queue)
+	box.Append(lyrics)
 	box.Append(aart)
 
 	return &Container{
 		Box:          *box,
 		ListScroll:   scroll,
+		LibraryList:  libraryList,
+		LibraryRow:   libraryRow,
 		PlaylistList: list,
+		Queue:        queue,
+		Lyrics:       lyrics,
 		AlbumArt:     aart,
 	}
 }
+
+// SelectLibrary selects the library row.
+func (c *Container) SelectLibrary() {
+	c.PlaylistList.UnselectAll()
+	c.LibraryList.SelectRow(c.LibraryRow.ListBoxRow)
+}
@@ -0,0 +1,274 @@
+package tracks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/durafmt"
+	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/ui/content/body/sidebar"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+)
+
+// AlbumTileSize is the size of the covers in the album grid.
+const AlbumTileSize = 128
+
+var albumTileCSS = css.PrepareClass("album-tile", `
+	.album-tile {
+		margin: 6px;
+	}
+	.album-tile > label {
+		margin-top: 2px;
+	}
+`)
+
+// AlbumGrid shows the tracks of a playlist grouped by album as a grid of
+// covers. The grid is virtualized, so only the covers on screen are loaded.
+type AlbumGrid struct {
+	gtk.ScrolledWindow
+	parent ParentController
+
+	Grid  *gtk.GridView
+	Model *gtk.StringList
+
+	Playlist *state.Playlist
+
+	albums []state.Album
+	tiles  map[uintptr]*albumTile
+	// menuAlbum is the album that the menu was opened on.
+	menuAlbum state.Album
+
+	// stale is true if the albums have changed since they were last loaded.
+	stale     bool
+	reloading bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewAlbumGrid creates an album grid of the given playlist. The albums are
+// loaded once the grid is shown.
+func NewAlbumGrid(parent ParentController, pl *state.Playlist) *AlbumGrid {
+	g := &AlbumGrid{
+		parent:   parent,
+		Playlist: pl,
+		tiles:    make(map[uintptr]*albumTile),
+		stale:    true,
+	}
+
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+
+	g.Model = gtk.NewStringList(nil)
+
+	menu := gtkutil.MenuPair([][2]string{
+		{"Play _Next", "albumgrid.play-next"},
+		{"Add to _Queue", "albumgrid.enqueue"},
+	})
+
+	factory := gtk.NewSignalListItemFactory()
+	factory.ConnectSetup(func(item *gtk.ListItem) {
+		tile := newAlbumTile()
+		item.SetChild(tile)
+		g.tiles[item.Native()] = tile
+
+		gtkutil.BindRightClick(tile, func(x, y float64) {
+			g.menuAlbum = tile.album
+			p := gtkutil.NewPopoverMenuAt(tile, gtk.PosBottom, x, y, menu)
+			p.Popup()
+		})
+	})
+	factory.ConnectBind(func(item *gtk.ListItem) {
+		tile := g.tiles[item.Native()]
+		pos := int(item.Position())
+
+		if tile != nil && pos < len(g.albums) {
+			tile.bind(g.ctx, g.Playlist, g.albums[pos])
+		}
+	})
+	factory.ConnectUnbind(func(item *gtk.ListItem) {
+		if tile := g.tiles[item.Native()]; tile != nil {
+			tile.unbind()
+		}
+	})
+	factory.ConnectTeardown(func(item *gtk.ListItem) {
+		delete(g.tiles, item.Native())
+	})
+
+	g.Grid = gtk.NewGridView(gtk.NewNoSelection(g.Model), &factory.ListItemFactory)
+	g.Grid.SetMinColumns(2)
+	g.Grid.SetMaxColumns(32)
+	g.Grid.SetSingleClickActivate(true)
+	g.Grid.ConnectActivate(func(pos uint) {
+		if int(pos) < len(g.albums) {
+			g.parent.PlayTrack(g.Playlist, g.albums[pos].Indices[0])
+		}
+	})
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetVExpand(true)
+	scroll.SetChild(g.Grid)
+	scroll.ConnectDestroy(g.cancel)
+	scroll.ConnectMap(func() {
+		if g.stale {
+			g.Reload()
+		}
+	})
+
+	g.ScrolledWindow = *scroll
+
+	gtkutil.BindActionMap(scroll, map[string]func(){
+		"albumgrid.play-next": func() { g.parent.PlayNext(g.albumTracks(g.menuAlbum)) },
+		"albumgrid.enqueue":   func() { g.parent.Enqueue(g.albumTracks(g.menuAlbum)) },
+	})
+
+	return g
+}
+
+// albumTracks returns the tracks of the album in the playlist.
+func (g *AlbumGrid) albumTracks(album state.Album) []*state.Track {
+	tracks := make([]*state.Track, 0, len(album.Indices))
+	for _, ix := range album.Indices {
+		// The playlist may have changed since the albums were loaded.
+		if ix < len(g.Playlist.Tracks) {
+			tracks = append(tracks, g.Playlist.Tracks[ix])
+		}
+	}
+	return tracks
+}
+
+// Reload groups the tracks into albums again.
+func (g *AlbumGrid) Reload() {
+	g.stale = false
+	g.albums = g.Playlist.Albums()
+
+	titles := make([]string, len(g.albums))
+	for i, album := range g.albums {
+		titles[i] = album.Name
+	}
+
+	g.Model.Splice(0, g.Model.NItems(), titles)
+}
+
+// Invalidate marks the albums as changed. They're reloaded shortly if the grid
+// is shown, or once it's shown otherwise. Many calls in a row, such as when the
+// tracks are probed, only reload once.
+func (g *AlbumGrid) Invalidate() {
+	g.stale = true
+
+	if g.reloading || !g.Mapped() {
+		return
+	}
+
+	g.reloading = true
+
+	glib.TimeoutAdd(250, func() bool {
+		g.reloading = false
+		if g.stale && g.ctx.Err() == nil {
+			g.Reload()
+		}
+		return false
+	})
+}
+
+func (g *AlbumGrid) stop() {
+	g.cancel()
+}
+
+// albumTile is a cover in the album grid.
+type albumTile struct {
+	*gtk.Box
+	Image  *gtk.Image
+	Name   *gtk.Label
+	Artist *gtk.Label
+
+	album     state.Album
+	path      string
+	stopFetch context.CancelFunc
+}
+
+func newAlbumTile() *albumTile {
+	img := gtk.NewImage()
+	img.SetSizeRequest(AlbumTileSize, AlbumTileSize)
+	img.SetIconSize(gtk.IconSizeLarge)
+
+	name := gtk.NewLabel("")
+	name.SetEllipsize(pango.EllipsizeEnd)
+	name.SetMaxWidthChars(1)
+	name.SetHExpand(true)
+
+	artist := gtk.NewLabel("")
+	artist.SetEllipsize(pango.EllipsizeEnd)
+	artist.SetMaxWidthChars(1)
+	artist.SetHExpand(true)
+	artist.AddCSSClass("dim-label")
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.SetSizeRequest(AlbumTileSize, -1)
+	box.Append(img)
+	box.Append(name)
+	box.Append(artist)
+	albumTileCSS(box)
+
+	return &albumTile{
+		Box:       box,
+		Image:     img,
+		Name:      name,
+		Artist:    artist,
+		stopFetch: func() {}, // stub
+	}
+}
+
+func (t *albumTile) bind(ctx context.Context, pl *state.Playlist, album state.Album) {
+	name := album.Name
+	if name == "" {
+		name = "Unknown Album"
+	}
+
+	var length time.Duration
+	for _, ix := range album.Indices {
+		length += pl.Tracks[ix].Metadata().Length
+	}
+
+	t.Name.SetText(name)
+	t.Artist.SetText(album.Artist)
+	t.SetTooltipText(fmt.Sprintf(
+		"%s\n%s\n%d tracks, %s", name, album.Artist, len(album.Indices), durafmt.Format(length),
+	))
+
+	track := pl.Tracks[album.Indices[0]]
+	t.album = album
+	t.path = track.Filepath
+	t.Image.SetFromIconName("media-optical-symbolic")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	t.stopFetch = cancel
+
+	go func() {
+		defer cancel()
+
+		p := sidebar.FetchAlbumArt(ctx, track, AlbumTileSize)
+		if p == nil {
+			return
+		}
+
+		glib.IdleAdd(func() {
+			// The tile may have been reused for another album.
+			if t.path == track.Filepath {
+				t.Image.SetFromPixbuf(p)
+			}
+		})
+	}()
+}
+
+func (t *albumTile) unbind() {
+	t.stopFetch()
+	t.stopFetch = func() {}
+	t.album = state.Album{}
+	t.path = ""
+}
@@ -0,0 +1,200 @@
+package tracks
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist/folder"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/pkg/errors"
+)
+
+const uriListMIME = "text/uri-list"
+
+// pasteMIMEs is the list of MIME types that we can paste, sorted by priority.
+var pasteMIMEs = []string{
+	uriListMIME,
+	"text/plain;charset=utf-8",
+	"text/plain",
+}
+
+// copySelected copies the selected tracks into the clipboard as both a URI
+// list and a newline-delimited list of paths. It returns false if nothing is
+// selected.
+//
+// The state keeps the metadata of the copied tracks, so pasting them back into
+// aqours reuses it instead of probing the files again, even if the tracks were
+// cut out of the last playlist that had them.
+func (list *TrackList) copySelected() bool {
+	tracks := list.selectedTracks()
+	if len(tracks) == 0 {
+		return false
+	}
+
+	list.parent.CopyTracks(tracks)
+
+	var uris strings.Builder
+	var paths strings.Builder
+
+	for _, track := range tracks {
+		u := url.URL{Scheme: "file", Path: track.Filepath}
+		uris.WriteString(u.String())
+		uris.WriteString("\r\n")
+
+		paths.WriteString(track.Filepath)
+		paths.WriteByte('\n')
+	}
+
+	content := gdk.NewContentProviderUnion([]gdk.ContentProviderer{
+		gdk.NewContentProviderForBytes(uriListMIME, glib.NewBytes([]byte(uris.String()))),
+		gdk.NewContentProviderForValue(glib.NewValue(paths.String())),
+	})
+
+	list.Clipboard().SetContent(content)
+	return true
+}
+
+// cutSelected copies the selected tracks into the clipboard, then removes them
+// from the playlist. It returns false if nothing is cut.
+func (list *TrackList) cutSelected() bool {
+	if !list.isEditable() || !list.copySelected() {
+		return false
+	}
+
+	list.removeSelected()
+	return true
+}
+
+// pasteAt reads the clipboard asynchronously and inserts the files in it at the
+// given position. It returns false if the clipboard has nothing that can be
+// pasted.
+func (list *TrackList) pasteAt(ix int, before bool) bool {
+	if !list.isEditable() {
+		return false
+	}
+
+	clipboard := list.Clipboard()
+	if !canPaste(clipboard.Formats()) {
+		return false
+	}
+
+	clipboard.ReadAsync(context.Background(), pasteMIMEs, int(glib.PriorityDefault), func(res gio.AsyncResulter) {
+		mime, stream, err := clipboard.ReadFinish(res)
+		if err != nil {
+			log.Println("cannot read clipboard:", err)
+			return
+		}
+
+		// The stream might be written to by ourselves in the main thread, so
+		// reading it here would deadlock.
+		go func() {
+			b, err := readInputStream(stream)
+			if err != nil {
+				log.Println("cannot read clipboard:", err)
+				return
+			}
+
+			var paths []string
+			if mime == uriListMIME {
+				paths = parseURIs(string(b))
+			} else {
+				paths = parsePaths(string(b))
+			}
+
+			paths = folder.Walk(paths...)
+			if len(paths) == 0 {
+				return
+			}
+
+			glib.IdleAdd(func() {
+				list.insertTracks(ix, before, tracksFromPaths(paths))
+			})
+		}()
+	})
+
+	return true
+}
+
+func canPaste(formats *gdk.ContentFormats) bool {
+	for _, mime := range pasteMIMEs {
+		if formats.ContainMIMEType(mime) {
+			return true
+		}
+	}
+	return false
+}
+
+func readInputStream(stream gio.InputStreamer) ([]byte, error) {
+	s := gio.BaseInputStream(stream)
+	defer s.Close(context.Background())
+
+	var buf bytes.Buffer
+	var chunk = make([]byte, 4096)
+
+	for {
+		n, err := s.Read(context.Background(), chunk)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return buf.Bytes(), nil
+		}
+
+		buf.Write(chunk[:n])
+
+		if buf.Len() > maxDataSize {
+			return nil, errors.New("clipboard data too large")
+		}
+	}
+}
+
+// parseURIs parses a text/uri-list as described in RFC 2483. Only local file
+// URIs are returned.
+func parseURIs(list string) []string {
+	var paths []string
+
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		u, err := url.Parse(line)
+		if err != nil {
+			log.Printf("Failed parsing URI %q: %v\n", line, err)
+			continue
+		}
+		if u.Scheme != "file" {
+			log.Printf("Unknown file URI scheme (only locals): %q\n", line)
+			continue
+		}
+
+		paths = append(paths, u.Path)
+	}
+
+	return paths
+}
+
+// parsePaths parses newline-delimited absolute paths, which is what terminals
+// and text editors would give us. File URIs are also accepted.
+func parsePaths(text string) []string {
+	var paths []string
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "/"):
+			paths = append(paths, line)
+		case strings.HasPrefix(line, "file://"):
+			paths = append(paths, parseURIs(line)...)
+		}
+	}
+
+	return paths
+}
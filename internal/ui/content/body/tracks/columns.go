@@ -0,0 +1,490 @@
+package tracks
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/diamondburned/aqours/internal/durafmt"
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/ui/content/body/sidebar"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+)
+
+type columnType = int
+
+const (
+	columnTitle columnType = iota
+	columnArtist
+	columnAlbum
+	columnTime
+	columnAlbumArtist
+	columnComposer
+	columnDisc
+	columnCodec
+	columnSampleRate
+	columnNumber
+	columnGenre
+	columnDate
+	columnBitrate
+)
+
+// trackColumn describes a column of the track list.
+type trackColumn struct {
+	column columnType
+	// id names the column in the saved layout and in its action.
+	id string
+	// name is the title of the column. label is shown in the column chooser
+	// instead if the title is too short to be clear.
+	name  string
+	label string
+	value func(*playlist.Track) string
+	// editable columns override the metadata when their cells are edited.
+	editable bool
+	// hidden columns are hidden until they're shown from the column chooser.
+	hidden bool
+	expand bool
+	width  int
+}
+
+// action returns the name of the action that toggles the column.
+func (col *trackColumn) action() string {
+	return "tracklist.column-" + col.id
+}
+
+// trackColumns are the columns of the track list in their default order.
+var trackColumns = []trackColumn{
+	{
+		column:   columnNumber,
+		id:       "number",
+		name:     "#",
+		label:    "Number",
+		value:    func(t *playlist.Track) string { return formatNonZero(t.Number) },
+		editable: true,
+		width:    50,
+	},
+	{
+		column:   columnTitle,
+		id:       "title",
+		name:     "Title",
+		value:    func(t *playlist.Track) string { return t.Title },
+		editable: true,
+		expand:   true,
+		width:    150,
+	},
+	{
+		column:   columnArtist,
+		id:       "artist",
+		name:     "Artist",
+		value:    func(t *playlist.Track) string { return t.Artist },
+		editable: true,
+		expand:   true,
+		width:    150,
+	},
+	{
+		column:   columnAlbum,
+		id:       "album",
+		name:     "Album",
+		value:    func(t *playlist.Track) string { return t.Album },
+		editable: true,
+		expand:   true,
+		width:    150,
+	},
+	{
+		column: columnAlbumArtist,
+		id:     "album-artist",
+		name:   "Album Artist",
+		value:  func(t *playlist.Track) string { return t.AlbumArtist },
+		hidden: true,
+		expand: true,
+		width:  150,
+	},
+	{
+		column: columnComposer,
+		id:     "composer",
+		name:   "Composer",
+		value:  func(t *playlist.Track) string { return t.Composer },
+		hidden: true,
+		expand: true,
+		width:  150,
+	},
+	{
+		column: columnGenre,
+		id:     "genre",
+		name:   "Genre",
+		value:  func(t *playlist.Track) string { return t.Genre },
+		hidden: true,
+		width:  100,
+	},
+	{
+		column: columnDate,
+		id:     "date",
+		name:   "Date",
+		value:  func(t *playlist.Track) string { return t.Date },
+		hidden: true,
+		width:  80,
+	},
+	{
+		column: columnDisc,
+		id:     "disc",
+		name:   "Disc",
+		value:  func(t *playlist.Track) string { return formatNonZero(t.Disc) },
+		hidden: true,
+		width:  50,
+	},
+	{
+		column: columnCodec,
+		id:     "codec",
+		name:   "Codec",
+		value:  func(t *playlist.Track) string { return t.Codec },
+		hidden: true,
+		width:  50,
+	},
+	{
+		column: columnSampleRate,
+		id:     "sample-rate",
+		name:   "Sample Rate",
+		value:  func(t *playlist.Track) string { return formatSampleRate(t.SampleRate) },
+		hidden: true,
+		width:  50,
+	},
+	{
+		column: columnBitrate,
+		id:     "bitrate",
+		name:   "Bitrate",
+		value:  func(t *playlist.Track) string { return formatBitrate(t.Bitrate) },
+		hidden: true,
+		width:  80,
+	},
+	{
+		column: columnTime,
+		id:     "time",
+		name:   "",
+		label:  "Time",
+		value:  func(t *playlist.Track) string { return durafmt.Format(t.Length) },
+		width:  50,
+	},
+}
+
+// findColumn returns the column with the given ID, or nil if there's none.
+func findColumn(id string) *trackColumn {
+	for i := range trackColumns {
+		if trackColumns[i].id == id {
+			return &trackColumns[i]
+		}
+	}
+	return nil
+}
+
+// columnLabel returns the label of the column in the column chooser.
+func (col *trackColumn) columnLabel() string {
+	if col.label != "" {
+		return col.label
+	}
+	return col.name
+}
+
+// newColumn creates the column view column of the given column. The cells are
+// made and bound by the list.
+func (list *TrackList) newColumn(col *trackColumn) *gtk.ColumnViewColumn {
+	factory := gtk.NewSignalListItemFactory()
+	factory.ConnectSetup(func(item *gtk.ListItem) {
+		cell := list.newCell(col)
+		item.SetChild(cell)
+		list.cells[item.Native()] = cell
+	})
+	factory.ConnectBind(func(item *gtk.ListItem) {
+		if cell, ok := list.cells[item.Native()]; ok {
+			cell.bind(list.model.item(item.Item()))
+		}
+	})
+	factory.ConnectUnbind(func(item *gtk.ListItem) {
+		if cell, ok := list.cells[item.Native()]; ok {
+			cell.bind(nil, nil)
+		}
+	})
+	factory.ConnectTeardown(func(item *gtk.ListItem) {
+		if cell, ok := list.cells[item.Native()]; ok {
+			cell.bind(nil, nil)
+			delete(list.cells, item.Native())
+			delete(list.widgets, cell.Name())
+		}
+	})
+
+	c := gtk.NewColumnViewColumn(col.name, &factory.ListItemFactory)
+	c.SetResizable(true)
+	c.SetExpand(col.expand)
+	c.SetFixedWidth(col.width)
+	c.SetVisible(!col.hidden)
+	list.sorters[col.column] = list.newColumnSorter(col)
+	c.SetSorter(list.sorters[col.column])
+
+	return c
+}
+
+// newColumnSorter creates a sorter that sorts the rows by the values of the
+// column, which is used when the column header is clicked.
+func (list *TrackList) newColumnSorter(col *trackColumn) *gtk.CustomSorter {
+	compare := columnCompare(col)
+
+	return gtk.NewCustomSorter(func(a, b unsafe.Pointer) int {
+		list.sortCompared(col)
+
+		ta := list.model.trackAt(a)
+		tb := list.model.trackAt(b)
+		if ta == nil || tb == nil {
+			return 0
+		}
+
+		ma := ta.Metadata()
+		mb := tb.Metadata()
+
+		switch n := compare(&ma, &mb); {
+		case n < 0:
+			return -1
+		case n > 0:
+			return 1
+		default:
+			return 0
+		}
+	})
+}
+
+// columnCompare returns the function that compares tracks by the values of the
+// column. Numbers are compared by their values.
+func columnCompare(col *trackColumn) func(a, b *playlist.Track) int {
+	switch col.column {
+	case columnNumber:
+		return func(a, b *playlist.Track) int { return a.Number - b.Number }
+	case columnDisc:
+		return func(a, b *playlist.Track) int { return a.Disc - b.Disc }
+	case columnSampleRate:
+		return func(a, b *playlist.Track) int { return a.SampleRate - b.SampleRate }
+	case columnBitrate:
+		return func(a, b *playlist.Track) int { return a.Bitrate - b.Bitrate }
+	case columnTime:
+		return func(a, b *playlist.Track) int { return int(a.Length - b.Length) }
+	default:
+		return func(a, b *playlist.Track) int {
+			return strings.Compare(strings.ToLower(col.value(a)), strings.ToLower(col.value(b)))
+		}
+	}
+}
+
+// cellID is the ID of the last created cell.
+var cellID int
+
+// AlbumHeaderIconSize is the size of the covers in the album header rows.
+const AlbumHeaderIconSize = 32
+
+// trackCell is a cell in the track list. Cells of editable columns are
+// editable labels, which start editing with F2. A cell either shows a track or
+// the album of a header row.
+type trackCell struct {
+	*gtk.Box
+	list   *TrackList
+	column *trackColumn
+	track  *state.Track
+	group  *state.AlbumRun
+
+	label *gtk.Label
+	edit  *gtk.EditableLabel
+	// cover is the cover of the album in header rows. Only title cells have
+	// one.
+	cover     *gtk.Image
+	coverPath string
+	stopFetch context.CancelFunc
+}
+
+func (list *TrackList) newCell(col *trackColumn) *trackCell {
+	cell := &trackCell{
+		Box:       gtk.NewBox(gtk.OrientationHorizontal, 6),
+		list:      list,
+		column:    col,
+		stopFetch: func() {}, // stub
+	}
+
+	// The name identifies the cell when it's picked, since the labels in it
+	// may not be targetable.
+	cellID++
+	name := "track-cell-" + strconv.Itoa(cellID)
+	cell.SetName(name)
+	list.widgets[name] = cell
+
+	if col.column == columnTitle {
+		cell.cover = gtk.NewImage()
+		cell.cover.SetPixelSize(AlbumHeaderIconSize)
+		cell.cover.Hide()
+		cell.Append(cell.cover)
+	}
+
+	if col.editable {
+		cell.edit = gtk.NewEditableLabel("")
+		// Clicking would start editing instead of selecting the row.
+		cell.edit.SetCanTarget(false)
+		cell.edit.Connect("notify::editing", func() {
+			if !cell.edit.Editing() {
+				cell.edit.SetCanTarget(false)
+				cell.edited(cell.edit.Text())
+			}
+		})
+		cell.edit.SetHExpand(true)
+		cell.Append(cell.edit)
+	} else {
+		cell.label = gtk.NewLabel("")
+		cell.label.SetXAlign(0)
+		cell.label.SetEllipsize(pango.EllipsizeEnd)
+		cell.label.SetSingleLineMode(true)
+		cell.label.SetHExpand(true)
+		cell.Append(cell.label)
+	}
+
+	cell.SetHasTooltip(true)
+	cell.ConnectQueryTooltip(func(x, y int, kb bool, t *gtk.Tooltip) bool {
+		if cell.track == nil {
+			return false
+		}
+		list.tooltip.Attach(t, cell.track)
+		return true
+	})
+
+	return cell
+}
+
+// bind shows either the track or the album header in the cell. The cell is
+// unbound if both are nil.
+func (cell *trackCell) bind(track *state.Track, group *state.AlbumRun) {
+	if cell.track != nil {
+		cell.list.unbindCell(cell)
+	}
+
+	if cell.group != nil {
+		cell.unbindGroup()
+	}
+
+	cell.track = track
+	cell.group = group
+
+	switch {
+	case track != nil:
+		cell.list.bindCell(cell)
+
+		md := track.Metadata()
+		cell.setText(cell.column.value(&md))
+
+		if track == cell.list.playing {
+			cell.AddCSSClass("playing-track")
+		} else {
+			cell.RemoveCSSClass("playing-track")
+		}
+
+	case group != nil:
+		cell.bindGroup()
+	}
+}
+
+func (cell *trackCell) setText(text string) {
+	if cell.edit != nil {
+		cell.edit.SetText(text)
+	} else {
+		cell.label.SetText(text)
+	}
+}
+
+// bindGroup shows the album of the header row in the cell. The title cell shows
+// the cover and the name of the album, and the artist, album and time cells
+// show the artist, the year and the total length.
+func (cell *trackCell) bindGroup() {
+	group := cell.group
+
+	cell.AddCSSClass("album-header")
+	cell.RemoveCSSClass("playing-track")
+
+	var text string
+
+	switch cell.column.column {
+	case columnTitle:
+		text = group.Name
+		if text == "" {
+			text = "Unknown Album"
+		}
+		cell.bindCover()
+	case columnArtist:
+		text = group.Artist
+	case columnAlbum:
+		text = group.Year
+	case columnTime:
+		text = durafmt.Format(group.Length)
+	}
+
+	cell.setText(text)
+}
+
+func (cell *trackCell) bindCover() {
+	pl := cell.list.Playlist
+	if cell.group.Start >= len(pl.Tracks) {
+		return
+	}
+
+	track := pl.Tracks[cell.group.Start]
+	cell.coverPath = track.Filepath
+	cell.cover.SetFromIconName("media-optical-symbolic")
+	cell.cover.Show()
+
+	ctx, cancel := context.WithTimeout(cell.list.ctx, time.Minute)
+	cell.stopFetch = cancel
+
+	go func() {
+		defer cancel()
+
+		p := sidebar.FetchAlbumArt(ctx, track, AlbumHeaderIconSize)
+		if p == nil {
+			return
+		}
+
+		glib.IdleAdd(func() {
+			// The cell may have been reused for another album.
+			if cell.coverPath == track.Filepath {
+				cell.cover.SetFromPixbuf(p)
+			}
+		})
+	}()
+}
+
+func (cell *trackCell) unbindGroup() {
+	cell.RemoveCSSClass("album-header")
+
+	if cell.cover != nil {
+		cell.stopFetch()
+		cell.stopFetch = func() {}
+		cell.coverPath = ""
+		cell.cover.Hide()
+	}
+}
+
+// startEditing starts editing the cell if its column is editable.
+func (cell *trackCell) startEditing() {
+	if cell.edit == nil {
+		return
+	}
+
+	cell.edit.SetCanTarget(true)
+	cell.edit.StartEditing()
+	cell.edit.GrabFocus()
+}
+
+func (cell *trackCell) edited(text string) {
+	if cell.track == nil {
+		return
+	}
+
+	md := cell.track.Metadata()
+	if text != cell.column.value(&md) {
+		cell.list.overrideCell(cell.track, cell.column.column, text)
+	}
+}
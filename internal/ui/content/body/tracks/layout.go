@@ -0,0 +1,247 @@
+package tracks
+
+import (
+	"reflect"
+
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// columnDefaults returns the default layout of the columns.
+func columnDefaults() []state.ColumnState {
+	defaults := make([]state.ColumnState, len(trackColumns))
+	for i, col := range trackColumns {
+		defaults[i] = state.ColumnState{
+			Name:    col.id,
+			Visible: !col.hidden,
+			Width:   col.width,
+		}
+	}
+	return defaults
+}
+
+// sameLayout returns true if both layouts lay the columns out the same way.
+func sameLayout(a, b state.ColumnLayout) bool {
+	defaults := columnDefaults()
+
+	return true &&
+		a.Grouped == b.Grouped &&
+		a.Sort == b.Sort &&
+		a.SortDescending == b.SortDescending &&
+		reflect.DeepEqual(a.Apply(defaults), b.Apply(defaults))
+}
+
+// newColumnMenu creates the menu of the column headers, which chooses the
+// columns that are shown.
+func newColumnMenu() (menu, columns *gio.Menu) {
+	columns = gio.NewMenu()
+	for i := range trackColumns {
+		col := &trackColumns[i]
+		columns.Append(col.columnLabel(), col.action())
+	}
+
+	layout := gio.NewMenu()
+	layout.Append("Sort in _Playlist Order", "tracklist.unsort")
+	layout.Append("_Group by Album", "tracklist.group-albums")
+	layout.Append("_Keep Layout for This Playlist", "tracklist.own-layout")
+	layout.Append("Use the _Default Layout", "tracklist.default-layout")
+
+	menu = gio.NewMenu()
+	menu.AppendSection("", columns)
+	menu.AppendSection("", layout)
+
+	return menu, columns
+}
+
+// layoutActions returns the actions of the column menu.
+func (list *TrackList) layoutActions() map[string]func() {
+	actions := map[string]func(){
+		"tracklist.unsort": func() { list.sortBy("", false) },
+		"tracklist.group-albums": func() {
+			list.setGrouped(!list.model.isGrouped())
+			list.layoutChanged()
+		},
+		"tracklist.own-layout": func() {
+			layout := list.layout()
+			list.Playlist.SetColumnLayout(&layout)
+		},
+		"tracklist.default-layout": func() {
+			list.Playlist.SetColumnLayout(nil)
+			list.applyLayout(list.Playlist.ColumnLayout())
+		},
+	}
+
+	for i := range trackColumns {
+		c := list.columns[trackColumns[i].column]
+		actions[trackColumns[i].action()] = func() { c.SetVisible(!c.Visible()) }
+	}
+
+	return actions
+}
+
+// bindLayout saves the layout whenever the columns are changed, and applies the
+// saved layout whenever the list is shown, since the default layout may have
+// been changed by another list.
+func (list *TrackList) bindLayout() {
+	for _, c := range list.columns {
+		c.Connect("notify::visible", list.layoutChanged)
+		c.Connect("notify::fixed-width", list.layoutChanged)
+	}
+
+	list.View.Columns().ConnectItemsChanged(func(_, _, _ uint) {
+		list.layoutChanged()
+	})
+
+	list.Box.ConnectMap(func() {
+		if layout := list.Playlist.ColumnLayout(); !sameLayout(layout, list.layout()) {
+			list.applyLayout(layout)
+		}
+	})
+}
+
+// applyLayout reorders, shows and resizes the columns, then sorts the rows as
+// the layout says.
+func (list *TrackList) applyLayout(layout state.ColumnLayout) {
+	list.applying = true
+	defer func() { list.applying = false }()
+
+	for i, colState := range layout.Apply(columnDefaults()) {
+		c := list.columns[findColumn(colState.Name).column]
+		// Columns that are already in the view are moved.
+		list.View.InsertColumn(uint(i), c)
+		c.SetVisible(colState.Visible)
+		c.SetFixedWidth(colState.Width)
+	}
+
+	list.setGrouped(layout.Grouped)
+	if !layout.Grouped {
+		list.sortBy(layout.Sort, layout.SortDescending)
+	}
+}
+
+// layout returns the current layout of the columns.
+func (list *TrackList) layout() state.ColumnLayout {
+	columns := list.View.Columns()
+	n := columns.NItems()
+
+	layout := state.ColumnLayout{
+		Columns:        make([]state.ColumnState, 0, n),
+		Sort:           list.sortColumn,
+		SortDescending: list.sortDescending,
+		Grouped:        list.model.isGrouped(),
+	}
+
+	for i := uint(0); i < n; i++ {
+		c, ok := columns.Item(i).Cast().(*gtk.ColumnViewColumn)
+		if !ok {
+			continue
+		}
+
+		col, ok := list.columnIDs[c.Native()]
+		if !ok {
+			continue
+		}
+
+		layout.Columns = append(layout.Columns, state.ColumnState{
+			Name:    col.id,
+			Visible: c.Visible(),
+			Width:   c.FixedWidth(),
+		})
+	}
+
+	return layout
+}
+
+// layoutChanged saves the layout shortly after the columns are changed, so
+// resizing a column only saves once.
+func (list *TrackList) layoutChanged() {
+	if list.applying || list.savingLayout {
+		return
+	}
+
+	list.savingLayout = true
+
+	glib.TimeoutAdd(500, func() bool {
+		list.savingLayout = false
+		if list.ctx.Err() == nil {
+			list.Playlist.UpdateColumnLayout(list.layout())
+		}
+		return false
+	})
+}
+
+// sortBy sorts the rows by the column with the given ID. The rows are put back
+// in the order of the playlist if there's no such column.
+func (list *TrackList) sortBy(id string, descending bool) {
+	list.sortColumn = id
+	list.sortDescending = descending
+
+	var c *gtk.ColumnViewColumn
+	if col := findColumn(id); col != nil {
+		c = list.columns[col.column]
+	} else {
+		list.sortColumn = ""
+	}
+
+	direction := gtk.SortAscending
+	if descending {
+		direction = gtk.SortDescending
+	}
+
+	list.View.SortByColumn(c, direction)
+}
+
+// bindSort keeps track of the column that the rows are sorted by. It must be
+// called before the sorter is given to the model, so the handler runs before
+// the rows are sorted.
+func (list *TrackList) bindSort() {
+	// The column view doesn't tell which column it's sorted by, but the sorter
+	// of that column is the first one that compares rows after the sorter
+	// changes.
+	list.View.Sorter().ConnectChanged(func(gtk.SorterChange) {
+		if list.Sorted.NItems() < 2 {
+			return
+		}
+
+		list.sortColumn = ""
+		list.sortDetecting = true
+
+		glib.IdleAdd(func() {
+			list.sortDetecting = false
+			list.sortDescending = list.isSortedDescending()
+			list.layoutChanged()
+		})
+	})
+}
+
+// sortCompared is called by the sorters of the columns whenever they compare
+// rows.
+func (list *TrackList) sortCompared(col *trackColumn) {
+	if list.sortDetecting {
+		list.sortDetecting = false
+		list.sortColumn = col.id
+	}
+}
+
+// isSortedDescending returns true if the rows are sorted by their column in
+// descending order.
+func (list *TrackList) isSortedDescending() bool {
+	col := findColumn(list.sortColumn)
+	n := list.Sorted.NItems()
+	if col == nil || n < 2 {
+		return false
+	}
+
+	first := list.trackAt(0)
+	last := list.trackAt(n - 1)
+	if first == nil || last == nil {
+		return false
+	}
+
+	a := first.Metadata()
+	b := last.Metadata()
+
+	return columnCompare(col)(&a, &b) > 0
+}
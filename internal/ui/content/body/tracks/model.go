@@ -0,0 +1,412 @@
+package tracks
+
+import (
+	"sort"
+	"unsafe"
+
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// trackModel is the list model of a track list. It mirrors the tracks of the
+// playlist in their order, so changes to the playlist are applied to the model
+// as items-changed notifications of only the changed range.
+//
+// gotk4 can't implement GListModel in Go, so the model is a GListStore of
+// placeholder objects, each of which belongs to a row. The rows are kept in the
+// same order in Go, so the positions of the tracks are known without asking
+// the store. Rows are never built from the model by hand; the column view only
+// binds the visible ones.
+//
+// A grouped model has an album header row before each run of tracks of the same
+// album. Changes to a grouped model replace only the rows between the first and
+// the last row that differ, including the header rows.
+type trackModel struct {
+	*gio.ListStore
+	playlist *state.Playlist
+
+	// rows are the rows in the order of the store. objects maps the native
+	// objects of the store to them, and tracks maps the tracks to their rows.
+	rows    []*trackRow
+	objects map[uintptr]*trackRow
+	tracks  map[*state.Track]*trackRow
+	// stale is the position of the first row whose position and index are
+	// outdated.
+	stale   int
+	grouped bool
+
+	// changed are the tracks whose metadata changed since the last flush.
+	changed  map[*state.Track]struct{}
+	flushing bool
+	// update applies the notifications of the changed tracks. It can be
+	// replaced to keep the selection, which is lost when rows are replaced.
+	update func(apply func())
+}
+
+// trackRow is a row of the model, which is either a track or the header of an
+// album run.
+type trackRow struct {
+	obj   *gtk.StringObject
+	track *state.Track
+	album *state.AlbumRun
+	// pos is the position of the row in the model. ix is the index of the
+	// track in the playlist, or of the album's first track for header rows.
+	pos, ix int
+}
+
+func newTrackModel(pl *state.Playlist) *trackModel {
+	m := &trackModel{
+		ListStore: gio.NewListStore(glib.TypeObject),
+		playlist:  pl,
+		objects:   make(map[uintptr]*trackRow, len(pl.Tracks)),
+		tracks:    make(map[*state.Track]*trackRow, len(pl.Tracks)),
+		changed:   make(map[*state.Track]struct{}),
+		update:    func(apply func()) { apply() },
+	}
+
+	m.splice(0, 0, m.trackRows(0, len(pl.Tracks)))
+	return m
+}
+
+// trackRows returns the rows of the tracks in the given range. Tracks that are
+// already in the model keep their rows.
+func (m *trackModel) trackRows(start, end int) []*trackRow {
+	rows := make([]*trackRow, end-start)
+	for i, track := range m.playlist.Tracks[start:end] {
+		rows[i] = m.trackRow(track)
+	}
+	return rows
+}
+
+func (m *trackModel) trackRow(track *state.Track) *trackRow {
+	if row, ok := m.tracks[track]; ok {
+		return row
+	}
+	return &trackRow{track: track}
+}
+
+// splice replaces the given number of rows at the given position with the
+// given rows, which may include some of the replaced ones.
+func (m *trackModel) splice(pos, removed int, added []*trackRow) {
+	if removed == 0 && len(added) == 0 {
+		return
+	}
+
+	for _, row := range m.rows[pos : pos+removed] {
+		delete(m.objects, row.obj.Native())
+		if row.track != nil {
+			delete(m.tracks, row.track)
+		}
+	}
+
+	objs := make([]*glib.Object, len(added))
+	for i, row := range added {
+		if row.obj == nil {
+			row.obj = gtk.NewStringObject("")
+		}
+		m.objects[row.obj.Native()] = row
+		if row.track != nil {
+			m.tracks[row.track] = row
+		}
+		objs[i] = row.obj.Object
+	}
+
+	// https://github.com/golang/go/wiki/SliceTricks
+	n := len(m.rows) - removed + len(added)
+	if grow := n - len(m.rows); grow > 0 {
+		m.rows = append(m.rows, make([]*trackRow, grow)...)
+	}
+	copy(m.rows[pos+len(added):], m.rows[pos+removed:])
+	copy(m.rows[pos:], added)
+	for i := n; i < len(m.rows); i++ {
+		m.rows[i] = nil
+	}
+	m.rows = m.rows[:n]
+
+	if pos < m.stale {
+		m.stale = pos
+	}
+
+	m.Splice(uint(pos), uint(removed), objs)
+}
+
+// reindex updates the positions and indices of the stale rows.
+func (m *trackModel) reindex() {
+	if m.stale >= len(m.rows) {
+		return
+	}
+
+	ix := 0
+	if m.stale > 0 {
+		prev := m.rows[m.stale-1]
+		ix = prev.ix
+		if prev.track != nil {
+			ix++
+		}
+	}
+
+	for pos := m.stale; pos < len(m.rows); pos++ {
+		row := m.rows[pos]
+		row.pos = pos
+		row.ix = ix
+		if row.track != nil {
+			ix++
+		}
+	}
+
+	m.stale = len(m.rows)
+}
+
+// track returns the track of the given model item, or nil if the item isn't a
+// track of the playlist anymore or is a header row.
+func (m *trackModel) track(item *glib.Object) *state.Track {
+	track, _ := m.item(item)
+	return track
+}
+
+// item returns either the track or the album of the header row of the given
+// model item. Both are nil if the item is neither anymore.
+func (m *trackModel) item(item *glib.Object) (*state.Track, *state.AlbumRun) {
+	if item == nil {
+		return nil, nil
+	}
+
+	row, ok := m.objects[item.Native()]
+	if !ok {
+		return nil, nil
+	}
+
+	return row.track, row.album
+}
+
+// trackAt returns the track of the model item at the given pointer, which is
+// what sorters are given.
+func (m *trackModel) trackAt(item unsafe.Pointer) *state.Track {
+	return m.track(glib.Take(item))
+}
+
+// contains returns true if the track is in the model.
+func (m *trackModel) contains(track *state.Track) bool {
+	_, ok := m.tracks[track]
+	return ok
+}
+
+// position returns the position of the track's row in the model.
+func (m *trackModel) position(track *state.Track) (uint, bool) {
+	row, ok := m.tracks[track]
+	if !ok {
+		return 0, false
+	}
+
+	m.reindex()
+	return uint(row.pos), true
+}
+
+// index returns the index of the track in the playlist, or -1 if it's not in
+// the model.
+func (m *trackModel) index(track *state.Track) int {
+	row, ok := m.tracks[track]
+	if !ok {
+		return -1
+	}
+
+	m.reindex()
+	return row.ix
+}
+
+// isGrouped returns true if the model has album header rows.
+func (m *trackModel) isGrouped() bool {
+	return m.grouped
+}
+
+// setGrouped adds or removes the album header rows.
+func (m *trackModel) setGrouped(grouped bool) {
+	if grouped == m.grouped {
+		return
+	}
+
+	m.grouped = grouped
+
+	if grouped {
+		m.regroup()
+	} else {
+		m.splice(0, len(m.rows), m.trackRows(0, len(m.playlist.Tracks)))
+	}
+}
+
+// regroup replaces the rows between the first and the last row that differ
+// from the grouped rows of the playlist. It returns the range of the new rows.
+func (m *trackModel) regroup() (start, end int) {
+	runs := m.playlist.AlbumRuns()
+	want := make([]*trackRow, 0, len(m.playlist.Tracks)+len(runs))
+
+	for i := range runs {
+		want = append(want, &trackRow{album: &runs[i]})
+		want = append(want, m.trackRows(runs[i].Start, runs[i].End)...)
+	}
+
+	old := m.rows
+
+	pre := 0
+	for pre < len(old) && pre < len(want) && sameRow(old[pre], want[pre]) {
+		pre++
+	}
+
+	suf := 0
+	for suf < len(old)-pre && suf < len(want)-pre &&
+		sameRow(old[len(old)-1-suf], want[len(want)-1-suf]) {
+		suf++
+	}
+
+	// The kept header rows still show the same album, but it may have moved.
+	keep := func(oldRow, wantRow *trackRow) {
+		if oldRow.album != nil {
+			*oldRow.album = *wantRow.album
+		}
+	}
+	for i := 0; i < pre; i++ {
+		keep(old[i], want[i])
+	}
+	for i := 1; i <= suf; i++ {
+		keep(old[len(old)-i], want[len(want)-i])
+	}
+
+	m.splice(pre, len(old)-pre-suf, want[pre:len(want)-suf])
+	return pre, len(want) - suf
+}
+
+// sameRow returns true if both rows are of the same track, or if both are
+// header rows that look the same.
+func sameRow(a, b *trackRow) bool {
+	if a.track != nil || b.track != nil {
+		return a.track == b.track
+	}
+
+	// Only compare what's shown, since the indices change whenever tracks
+	// are added or removed before the album.
+	x, y := *a.album, *b.album
+	x.Start, x.End = 0, x.Len()
+	y.Start, y.End = 0, y.Len()
+	return x == y
+}
+
+// inserted notifies the model that the tracks in the given range were
+// inserted.
+func (m *trackModel) inserted(start, end int) {
+	if m.grouped {
+		m.regroup()
+		return
+	}
+
+	m.splice(start, 0, m.trackRows(start, end))
+}
+
+// removed notifies the model that the tracks at the given indices were removed.
+// The indices are of the track list before the removal.
+func (m *trackModel) removed(ixs []int) {
+	if m.grouped {
+		m.regroup()
+		return
+	}
+
+	sorted := append([]int(nil), ixs...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+
+	// Remove contiguous indices at once, starting from the end so the indices
+	// before them stay valid.
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j] == sorted[j-1]-1 {
+			j++
+		}
+
+		m.splice(sorted[j-1], j-i, nil)
+		i = j
+	}
+}
+
+// reordered notifies the model that the tracks in the given range were
+// reordered.
+func (m *trackModel) reordered(start, end int) {
+	if m.grouped {
+		m.regroup()
+		return
+	}
+
+	m.splice(start, end-start, m.trackRows(start, end))
+}
+
+// trackChanged notifies the model that the metadata of the track changed. The
+// notifications are batched until the main loop is idle, so probing many tracks
+// doesn't notify every row one by one.
+func (m *trackModel) trackChanged(track *state.Track) {
+	if !m.contains(track) {
+		return
+	}
+
+	m.changed[track] = struct{}{}
+
+	if m.flushing {
+		return
+	}
+
+	m.flushing = true
+	glib.IdleAdd(m.flush)
+}
+
+func (m *trackModel) flush() {
+	m.flushing = false
+	if len(m.changed) == 0 {
+		return
+	}
+
+	changed := m.changed
+	m.changed = make(map[*state.Track]struct{})
+
+	m.update(func() {
+		// The albums may have changed, which changes the header rows.
+		var start, end int
+		if m.grouped {
+			start, end = m.regroup()
+		}
+
+		m.reindex()
+
+		positions := make([]int, 0, len(changed))
+		for track := range changed {
+			row, ok := m.tracks[track]
+			if ok && (row.pos < start || row.pos >= end) {
+				positions = append(positions, row.pos)
+			}
+		}
+
+		sort.Ints(positions)
+
+		// Replace each run of changed rows with new items, since the rows of
+		// items that stay the same aren't bound again.
+		for i := 0; i < len(positions); {
+			j := i + 1
+			for j < len(positions) && positions[j] == positions[j-1]+1 {
+				j++
+			}
+
+			m.refresh(positions[i], positions[j-1]+1)
+			i = j
+		}
+	})
+}
+
+// refresh replaces the rows in the given range with copies that have new
+// items.
+func (m *trackModel) refresh(start, end int) {
+	rows := make([]*trackRow, end-start)
+	for i, row := range m.rows[start:end] {
+		cpy := *row
+		cpy.obj = nil
+		rows[i] = &cpy
+	}
+
+	m.splice(start, end-start, rows)
+}
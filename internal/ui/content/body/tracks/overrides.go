@@ -0,0 +1,201 @@
+package tracks
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// overrideFields are the fields that can be overridden, both in the cells of
+// their columns and in the metadata editor.
+var overrideFields = []struct {
+	column columnType
+	name   string
+	value  func(*playlist.Track) string
+}{
+	{columnTitle, "Title", func(t *playlist.Track) string { return t.Title }},
+	{columnArtist, "Artist", func(t *playlist.Track) string { return t.Artist }},
+	{columnAlbum, "Album", func(t *playlist.Track) string { return t.Album }},
+	{columnNumber, "Track Number", func(t *playlist.Track) string { return formatNonZero(t.Number) }},
+}
+
+// setOverride sets the override of the given column to value. It returns false
+// if the value is invalid. An empty value or one that is the same as the probed
+// value removes the override.
+func setOverride(o *playlist.Overrides, probed *playlist.Track, col columnType, value string) bool {
+	value = strings.TrimSpace(value)
+
+	switch col {
+	case columnTitle:
+		o.Title = overrideString(probed.Title, value)
+	case columnArtist:
+		o.Artist = overrideString(probed.Artist, value)
+	case columnAlbum:
+		o.Album = overrideString(probed.Album, value)
+	case columnNumber:
+		var n int
+		if value != "" {
+			v, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				return false
+			}
+			n = int(v)
+		}
+		if n == probed.Number {
+			n = 0
+		}
+		o.Number = n
+	}
+
+	return true
+}
+
+func overrideString(probed, value string) string {
+	if value == probed {
+		return ""
+	}
+	return value
+}
+
+// overrideCell overrides the metadata of the track with the text edited into
+// the cell of the given column.
+func (list *TrackList) overrideCell(track *state.Track, col columnType, text string) {
+	probed := track.ProbedMetadata()
+	o := track.Overrides()
+
+	if !setOverride(&o, &probed, col, text) {
+		log.Printf("invalid track number %q", text)
+		return
+	}
+
+	list.setOverrides([]*state.Track{track}, []playlist.Overrides{o})
+}
+
+// setOverrides sets the overrides of the given tracks, then refreshes the
+// tracks and the playlists that are now unsaved.
+func (list *TrackList) setOverrides(tracks []*state.Track, overrides []playlist.Overrides) {
+	changed := make(map[*state.Playlist]struct{})
+
+	for i, track := range tracks {
+		for _, pl := range track.SetOverrides(overrides[i]) {
+			changed[pl] = struct{}{}
+		}
+	}
+
+	for _, track := range tracks {
+		list.parent.RefreshTrack(track)
+	}
+
+	for pl := range changed {
+		list.parent.UpdateTracks(pl)
+	}
+}
+
+// spawnOverrideEditor spawns a dialog for overriding the metadata of the given
+// tracks without changing their files. Fields whose values differ between the
+// tracks are shown empty and are only overridden if they're changed.
+func (list *TrackList) spawnOverrideEditor(tracks []*state.Track) {
+	title := "Edit Metadata"
+	if len(tracks) > 1 {
+		title = fmt.Sprintf("Edit Metadata of %d Tracks", len(tracks))
+	}
+
+	dialog := gtk.NewDialogWithFlags(
+		title, gtkutil.ActiveWindow(), gtk.DialogModal|gtk.DialogUseHeaderBar)
+	dialog.SetDefaultSize(400, -1)
+
+	dialog.AddButton("Reset", int(gtk.ResponseReject))
+	dialog.AddButton("Save", int(gtk.ResponseApply))
+
+	metadata := make([]playlist.Track, len(tracks))
+	for i, track := range tracks {
+		metadata[i] = track.Metadata()
+	}
+
+	grid := gtk.NewGrid()
+	grid.SetRowSpacing(4)
+	grid.SetColumnSpacing(8)
+
+	entries := make(map[columnType]*gtk.Entry, len(overrideFields))
+	changed := make(map[columnType]bool, len(overrideFields))
+
+	for i, f := range overrideFields {
+		entry := gtk.NewEntry()
+		entry.SetHExpand(true)
+
+		if value, ok := commonValue(metadata, f.value); ok {
+			entry.SetText(value)
+		} else {
+			entry.SetPlaceholderText(multipleValues)
+		}
+
+		col := f.column
+		entry.Connect("changed", func() { changed[col] = true })
+		entries[col] = entry
+
+		label := gtk.NewLabel(f.name)
+		label.SetXAlign(0)
+
+		grid.Attach(label, 0, i, 1, 1)
+		grid.Attach(entry, 1, i, 1, 1)
+	}
+
+	hint := gtk.NewLabel("The files are left unchanged. Clear a field to use the value in the file.")
+	hint.SetXAlign(0)
+	hint.SetWrap(true)
+	hint.AddCSSClass("dim-label")
+	grid.Attach(hint, 0, len(overrideFields), 2, 1)
+
+	tagEditorCSS(grid)
+	dialog.ContentArea().Append(grid)
+
+	dialog.ConnectResponse(func(res int) {
+		switch res {
+		case int(gtk.ResponseReject):
+			dialog.Destroy()
+			list.setOverrides(tracks, make([]playlist.Overrides, len(tracks)))
+			return
+		case int(gtk.ResponseApply):
+		default:
+			dialog.Destroy()
+			return
+		}
+
+		overrides := make([]playlist.Overrides, len(tracks))
+		valid := true
+
+		for i, track := range tracks {
+			probed := track.ProbedMetadata()
+			overrides[i] = track.Overrides()
+
+			for col := range changed {
+				entry := entries[col]
+				if setOverride(&overrides[i], &probed, col, entry.Text()) {
+					entry.SetIconFromIconName(gtk.EntryIconSecondary, "")
+					continue
+				}
+
+				entry.SetIconFromIconName(gtk.EntryIconSecondary, "dialog-error-symbolic")
+				entry.SetIconTooltipText(gtk.EntryIconSecondary, "Not a number")
+				valid = false
+			}
+		}
+
+		if !valid {
+			return
+		}
+
+		dialog.Destroy()
+
+		if len(changed) > 0 {
+			list.setOverrides(tracks, overrides)
+		}
+	})
+	dialog.Show()
+}
@@ -0,0 +1,155 @@
+package tracks
+
+import (
+	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+var sortDialogCSS = css.PrepareClass("sort-dialog", `
+	.sort-dialog {
+		margin: 8px;
+	}
+`)
+
+// lastSortKeys are the keys that the sort dialog last sorted by, which it
+// starts with the next time.
+var lastSortKeys = state.DefaultSortKeys
+
+// SpawnSortDialog spawns a dialog that sorts the selected tracks, or the whole
+// playlist, by a list of keys.
+func (list *TrackList) SpawnSortDialog() {
+	if !list.isEditable() {
+		return
+	}
+
+	dialog := gtk.NewDialogWithFlags(
+		"Sort Tracks", gtkutil.ActiveWindow(), gtk.DialogModal|gtk.DialogUseHeaderBar)
+	dialog.SetDefaultSize(350, -1)
+	dialog.AddButton("Sort", int(gtk.ResponseApply))
+
+	names := make([]string, len(state.SortFields))
+	for i, field := range state.SortFields {
+		names[i] = field.Name()
+	}
+
+	var rows []*sortKeyRow
+
+	keyBox := gtk.NewBox(gtk.OrientationVertical, 4)
+
+	addKey := func(key state.SortKey) {
+		row := newSortKeyRow(names, key)
+		row.Remove.ConnectClicked(func() {
+			for i, r := range rows {
+				if r == row {
+					rows = append(rows[:i], rows[i+1:]...)
+					break
+				}
+			}
+			keyBox.Remove(row)
+		})
+
+		rows = append(rows, row)
+		keyBox.Append(row)
+	}
+
+	for _, key := range lastSortKeys {
+		addKey(key)
+	}
+
+	add := gtk.NewButtonFromIconName("list-add-symbolic")
+	add.SetTooltipText("Add Key")
+	add.SetHAlign(gtk.AlignStart)
+	add.ConnectClicked(func() { addKey(state.SortKey{Field: state.SortTitle}) })
+
+	selectIxs := list.selectedIxs()
+
+	whole := gtk.NewCheckButtonWithLabel("Whole playlist")
+	selected := gtk.NewCheckButtonWithLabel("Selected tracks only")
+	selected.SetGroup(whole)
+	selected.SetSensitive(len(selectIxs) > 1)
+	selected.SetActive(len(selectIxs) > 1)
+	whole.SetActive(len(selectIxs) < 2)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 6)
+	box.Append(keyBox)
+	box.Append(add)
+	box.Append(whole)
+	box.Append(selected)
+	sortDialogCSS(box)
+
+	dialog.ContentArea().Append(box)
+
+	dialog.ConnectResponse(func(res int) {
+		dialog.Destroy()
+
+		if res != int(gtk.ResponseApply) || len(rows) == 0 {
+			return
+		}
+
+		keys := make([]state.SortKey, len(rows))
+		for i, row := range rows {
+			keys[i] = row.key()
+		}
+		lastSortKeys = keys
+
+		if whole.Active() {
+			list.sortTracks(nil, keys)
+		} else {
+			list.sortTracks(selectIxs, keys)
+		}
+	})
+	dialog.Show()
+}
+
+// sortKeyRow is a row in the sort dialog that chooses a sort key.
+type sortKeyRow struct {
+	*gtk.Box
+	Field      *gtk.DropDown
+	Descending *gtk.CheckButton
+	Remove     *gtk.Button
+}
+
+func newSortKeyRow(names []string, key state.SortKey) *sortKeyRow {
+	field := gtk.NewDropDownFromStrings(names)
+	field.SetHExpand(true)
+
+	for i, f := range state.SortFields {
+		if f == key.Field {
+			field.SetSelected(uint(i))
+			break
+		}
+	}
+
+	descending := gtk.NewCheckButtonWithLabel("Descending")
+	descending.SetActive(key.Descending)
+
+	remove := gtk.NewButtonFromIconName("list-remove-symbolic")
+	remove.SetTooltipText("Remove Key")
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	box.Append(field)
+	box.Append(descending)
+	box.Append(remove)
+
+	return &sortKeyRow{
+		Box:        box,
+		Field:      field,
+		Descending: descending,
+		Remove:     remove,
+	}
+}
+
+func (row *sortKeyRow) key() state.SortKey {
+	key := state.SortKey{
+		Field:      state.SortTitle,
+		Descending: row.Descending.Active(),
+	}
+
+	if i := int(row.Field.Selected()); i < len(state.SortFields) {
+		key.Field = state.SortFields[i]
+	}
+
+	return key
+}
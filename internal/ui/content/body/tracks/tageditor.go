@@ -0,0 +1,292 @@
+package tracks
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/muse/metadata/tagedit"
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/state/prober"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+)
+
+var tagEditorCSS = css.PrepareClass("tag-editor", `
+	.tag-editor {
+		margin: 8px;
+	}
+`)
+
+// tagFields are the fields shown in the tag editor.
+var tagFields = []struct {
+	field tagedit.Field
+	name  string
+	value func(*playlist.Track) string
+}{
+	{tagedit.Title, "Title", func(t *playlist.Track) string { return t.Title }},
+	{tagedit.Artist, "Artist", func(t *playlist.Track) string { return t.Artist }},
+	{tagedit.Album, "Album", func(t *playlist.Track) string { return t.Album }},
+	{tagedit.AlbumArtist, "Album Artist", func(t *playlist.Track) string { return t.AlbumArtist }},
+	{tagedit.Composer, "Composer", func(t *playlist.Track) string { return t.Composer }},
+	{tagedit.Genre, "Genre", func(t *playlist.Track) string { return t.Genre }},
+	{tagedit.Date, "Date", func(t *playlist.Track) string { return t.Date }},
+	{tagedit.Number, "Track Number", func(t *playlist.Track) string { return formatNonZero(t.Number) }},
+	{tagedit.Disc, "Disc Number", func(t *playlist.Track) string { return formatNonZero(t.Disc) }},
+}
+
+const multipleValues = "(multiple values)"
+
+// spawnTagEditor spawns a dialog for editing the tags of the given tracks.
+// Fields whose values differ between the tracks are shown empty and are only
+// written if they're changed.
+func (list *TrackList) spawnTagEditor(tracks []*state.Track) {
+	title := "Edit Tags"
+	if len(tracks) > 1 {
+		title = fmt.Sprintf("Edit Tags of %d Tracks", len(tracks))
+	}
+
+	window := gtkutil.ActiveWindow()
+	dialog := gtk.NewDialogWithFlags(
+		title, window, gtk.DialogModal|gtk.DialogUseHeaderBar)
+	dialog.SetDefaultSize(400, -1)
+
+	dialog.AddButton("Save", int(gtk.ResponseApply))
+
+	metadata := make([]playlist.Track, len(tracks))
+	for i, track := range tracks {
+		metadata[i] = track.ProbedMetadata()
+	}
+
+	grid := gtk.NewGrid()
+	grid.SetRowSpacing(4)
+	grid.SetColumnSpacing(8)
+
+	entries := make(map[tagedit.Field]*gtk.Entry, len(tagFields))
+	changed := make(map[tagedit.Field]bool, len(tagFields))
+
+	for i, f := range tagFields {
+		entry := gtk.NewEntry()
+		entry.SetHExpand(true)
+
+		if value, ok := commonValue(metadata, f.value); ok {
+			entry.SetText(value)
+		} else {
+			entry.SetPlaceholderText(multipleValues)
+		}
+
+		field := f.field
+		entry.Connect("changed", func() { changed[field] = true })
+		entries[field] = entry
+
+		label := gtk.NewLabel(f.name)
+		label.SetXAlign(0)
+
+		grid.Attach(label, 0, i, 1, 1)
+		grid.Attach(entry, 1, i, 1, 1)
+	}
+
+	var picture *tagedit.Picture
+
+	cover := gtk.NewLabel("Keep the current cover")
+	cover.SetXAlign(0)
+	cover.SetHExpand(true)
+	cover.SetEllipsize(pango.EllipsizeMiddle)
+
+	chooseCover := gtk.NewButtonWithLabel("Choose...")
+	chooseCover.ConnectClicked(func() {
+		chooser := gtk.NewFileChooserNative(
+			"Choose Cover", window, gtk.FileChooserActionOpen, "Choose", "Cancel")
+		chooser.SetModal(true)
+
+		ff := gtk.NewFileFilter()
+		ff.SetName("Images")
+		for _, ext := range []string{"jpg", "jpeg", "png"} {
+			ff.AddPattern("*." + ext)
+		}
+		chooser.SetFilter(ff)
+
+		chooser.ConnectResponse(func(resp int) {
+			defer chooser.Destroy()
+
+			if resp != int(gtk.ResponseAccept) {
+				return
+			}
+
+			file := chooser.File()
+			if file == nil || file.Path() == "" {
+				return
+			}
+
+			p, err := readPicture(file.Path())
+			if err != nil {
+				log.Println("failed to read cover:", err)
+				cover.SetText(err.Error())
+				return
+			}
+
+			picture = p
+			cover.SetText(filepath.Base(file.Path()))
+		})
+		chooser.Show()
+	})
+
+	coverBox := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	coverBox.Append(cover)
+	coverBox.Append(chooseCover)
+
+	coverLabel := gtk.NewLabel("Cover")
+	coverLabel.SetXAlign(0)
+
+	grid.Attach(coverLabel, 0, len(tagFields), 1, 1)
+	grid.Attach(coverBox, 1, len(tagFields), 1, 1)
+	tagEditorCSS(grid)
+
+	dialog.ContentArea().Append(grid)
+
+	dialog.ConnectResponse(func(res int) {
+		if res != int(gtk.ResponseApply) {
+			dialog.Destroy()
+			return
+		}
+
+		edit := tagedit.Edit{
+			Fields:  make(map[tagedit.Field]string, len(changed)),
+			Picture: picture,
+		}
+
+		valid := true
+
+		for field := range changed {
+			entry := entries[field]
+			value := strings.TrimSpace(entry.Text())
+
+			if !validTagNumber(field, value) {
+				entry.SetIconFromIconName(gtk.EntryIconSecondary, "dialog-error-symbolic")
+				entry.SetIconTooltipText(gtk.EntryIconSecondary, "Not a number")
+				valid = false
+				continue
+			}
+
+			entry.SetIconFromIconName(gtk.EntryIconSecondary, "")
+			edit.Fields[field] = value
+		}
+
+		if !valid {
+			return
+		}
+
+		dialog.Destroy()
+
+		if !edit.IsEmpty() {
+			list.writeTags(tracks, edit)
+		}
+	})
+	dialog.Show()
+}
+
+// commonValue returns the value of the field if all tracks have the same one.
+func commonValue(tracks []playlist.Track, value func(*playlist.Track) string) (string, bool) {
+	if len(tracks) == 0 {
+		return "", true
+	}
+
+	v := value(&tracks[0])
+	for i := range tracks[1:] {
+		if value(&tracks[i+1]) != v {
+			return "", false
+		}
+	}
+
+	return v, true
+}
+
+// validTagNumber returns false if the field is a number and the value isn't,
+// which allows the total, such as 1/12.
+func validTagNumber(field tagedit.Field, value string) bool {
+	if value == "" || (field != tagedit.Number && field != tagedit.Disc) {
+		return true
+	}
+
+	for _, part := range strings.SplitN(value, "/", 2) {
+		if _, err := strconv.ParseUint(strings.TrimSpace(part), 10, 16); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readPicture reads the JPEG or PNG image at the given path.
+func readPicture(path string) (*tagedit.Picture, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var mimeType string
+
+	switch {
+	case bytes.HasPrefix(data, []byte("\xFF\xD8\xFF")):
+		mimeType = "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1A\n")):
+		mimeType = "image/png"
+	default:
+		return nil, fmt.Errorf("%s is not a JPEG or PNG image", filepath.Base(path))
+	}
+
+	return &tagedit.Picture{MIMEType: mimeType, Data: data}, nil
+}
+
+// writeTags writes the edit to the files of the given tracks in the
+// background. The files are then probed again, which updates the metadata of
+// every playlist that has them.
+func (list *TrackList) writeTags(tracks []*state.Track, edit tagedit.Edit) {
+	written := make([]bool, len(tracks))
+
+	go func() {
+		done := make(map[string]bool, len(tracks))
+
+		for i, track := range tracks {
+			if done[track.Filepath] {
+				continue
+			}
+			done[track.Filepath] = true
+
+			if err := tagedit.Write(track.Filepath, edit); err != nil {
+				log.Printf("failed to write tags to %q: %v", track.Filepath, err)
+				continue
+			}
+
+			written[i] = true
+		}
+
+		glib.IdleAdd(func() {
+			jobs := make([]prober.Job, 0, len(tracks))
+
+			for i, track := range tracks {
+				if !written[i] {
+					continue
+				}
+
+				track := track
+				job := prober.NewJob(track, func() { list.parent.RefreshTrack(track) })
+				job.Force = true
+
+				jobs = append(jobs, job)
+			}
+
+			// The edited tracks were just shown in the tag editor, so probe them
+			// before the rest of the list.
+			prober.Queue(list.ctx, prober.PriorityVisible, jobs...)
+		})
+	}()
+}
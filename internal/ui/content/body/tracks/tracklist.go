@@ -1,145 +1,190 @@
 package tracks
 
 import (
-	"io/fs"
+	"context"
 	"log"
-	"net/url"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/muse/playlist/folder"
 	"github.com/diamondburned/aqours/internal/state"
 	"github.com/diamondburned/aqours/internal/state/prober"
+	"github.com/diamondburned/aqours/internal/ui/css"
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
 	"github.com/diamondburned/gotk4/pkg/gio/v2"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/lithammer/fuzzysearch/fuzzy"
-	"github.com/pkg/errors"
-	// coreglib "github.com/diamondburned/gotk4/pkg/glib/v2"
 )
 
 type TrackPath = string
 
+var trackListCSS = css.PrepareClass("track-list", `
+	.track-list .playing-track {
+		font-weight: bold;
+	}
+	.track-list .album-header {
+		font-weight: bold;
+		padding: 4px 0;
+	}
+`)
+
+// TrackList shows the tracks of a playlist in a column view. Only the rows on
+// screen are made, so large playlists load instantly.
 type TrackList struct {
-	gtk.ScrolledWindow
+	*gtk.Box
 	parent ParentController
 
-	Tree   *gtk.TreeView
-	Store  *gtk.ListStore
-	Select *gtk.TreeSelection
+	View   *gtk.ColumnView
+	Scroll *gtk.ScrolledWindow
+	Search *gtk.SearchBar
+	// Sorted sorts the rows by the column header that is clicked. It doesn't
+	// change the order of the playlist.
+	Sorted *gtk.SortListModel
+	Select *gtk.MultiSelection
+
+	Playlist *state.Playlist
+
+	model   *trackModel
+	columns map[columnType]*gtk.ColumnViewColumn
+	// columnIDs maps the column view columns to their columns.
+	columnIDs map[uintptr]*trackColumn
+	// sorters are the sorters of the columns, which are removed while the rows
+	// are grouped by album.
+	sorters map[columnType]*gtk.CustomSorter
+
+	// sortColumn is the ID of the column that the rows are sorted by.
+	sortColumn     string
+	sortDescending bool
+	sortDetecting  bool
+	// applying is true while a layout is applied, so it's not saved again.
+	applying     bool
+	savingLayout bool
+	// selectingGroups is true while the tracks of selected header rows are
+	// being selected.
+	selectingGroups bool
+
+	// cells maps the list items to their cells, and widgets maps the names of
+	// the cells to them.
+	cells   map[uintptr]*trackCell
+	widgets map[string]*trackCell
+	// bound are the cells that show each track.
+	bound map[*state.Track][]*trackCell
+
+	tooltip *trackTooltipBox
+	playing *state.Track
 
-	Playlist  *state.Playlist
-	TrackRows map[*state.Track]*TrackRow
+	// albums is the album grid of the playlist. It's nil until the playlist is
+	// first shown as albums.
+	albums *AlbumGrid
 
-	playing *state.Track
+	// found is the position of the last search match.
+	found        uint
+	prioritizing bool
 
-	menu *gtk.PopoverMenu
+	// ctx is cancelled once the list is destroyed, which drops its probe jobs.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-// searchFuzzy implements TreeViewSearchEqualFunc.
-func searchFuzzy(m gtk.TreeModeller, col int, k string, it *gtk.TreeIter) bool {
-	data := m.Value(it, col)
-	return !fuzzy.MatchNormalizedFold(k, data.String())
-}
+const maxDataSize = 10 * 1024 * 1024 // 10MB
+
+func NewTrackList(parent ParentController, pl *state.Playlist) *TrackList {
+	list := &TrackList{
+		parent:    parent,
+		Playlist:  pl,
+		columns:   make(map[columnType]*gtk.ColumnViewColumn, len(trackColumns)),
+		columnIDs: make(map[uintptr]*trackColumn, len(trackColumns)),
+		sorters:   make(map[columnType]*gtk.CustomSorter, len(trackColumns)),
+		cells:     make(map[uintptr]*trackCell),
+		widgets:   make(map[string]*trackCell),
+		bound:     make(map[*state.Track][]*trackCell),
+		tooltip:   newTrackTooltipBox(),
+	}
 
-type columnType = int
+	list.ctx, list.cancel = context.WithCancel(context.Background())
 
-const (
-	columnTitle columnType = iota
-	columnArtist
-	columnAlbum
-	columnTime
-	columnSelected
-	columnSearchData
-)
+	list.model = newTrackModel(pl)
+	list.model.update = list.keepSelection
 
-const maxDataSize = 10 * 1024 * 1024 // 10MB
+	list.Sorted = gtk.NewSortListModel(list.model, nil)
+	list.Select = gtk.NewMultiSelection(list.Sorted)
+	list.Select.ConnectSelectionChanged(list.selectGroups)
 
-func NewTrackList(parent ParentController, pl *state.Playlist) *TrackList {
-	store := gtk.NewListStore([]glib.Type{
-		glib.TypeString, // columnTitle
-		glib.TypeString, // columnArtist
-		glib.TypeString, // columnAlbum
-		glib.TypeString, // columnTime
-		glib.TypeInt,    // columnSelected - pango.Weight
-		glib.TypeString, // columnSearchData
-	})
+	list.View = gtk.NewColumnView(list.Select)
+	list.View.SetReorderable(true)
+	list.View.SetEnableRubberband(true)
+	trackListCSS(list.View)
 
-	tree := gtk.NewTreeViewWithModel(store)
-	tree.SetActivateOnSingleClick(false)
-	tree.SetHasTooltip(true)
-	tree.AppendColumn(newColumn("Title", columnTitle))
-	tree.AppendColumn(newColumn("Artist", columnArtist))
-	tree.AppendColumn(newColumn("Album", columnAlbum))
-	tree.AppendColumn(newColumn("", columnTime))
-	tree.AppendColumn(newColumn("", columnSelected))
-	tree.AppendColumn(newColumn("", columnSearchData))
-	tree.SetSearchColumn(columnSearchData)
-	tree.SetSearchEqualFunc(searchFuzzy)
-
-	s := tree.Selection()
-	s.SetMode(gtk.SelectionMultiple)
-
-	scroll := gtk.NewScrolledWindow()
-	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
-	scroll.SetVExpand(true)
-	scroll.SetChild(tree)
-
-	list := TrackList{
-		ScrolledWindow: *scroll,
-		parent:         parent,
-
-		Tree:   tree,
-		Store:  store,
-		Select: s,
+	columnMenu, columnSection := newColumnMenu()
 
-		Playlist:  pl,
-		TrackRows: make(map[*state.Track]*TrackRow, len(pl.Tracks)),
+	for i := range trackColumns {
+		col := &trackColumns[i]
+		c := list.newColumn(col)
+		c.SetHeaderMenu(columnMenu)
+		list.columns[col.column] = c
+		list.columnIDs[c.Native()] = col
+		list.View.AppendColumn(c)
 	}
 
-	// Create a nil slice and leave the allocation for later.
-	var probeQueue []prober.Job
+	list.bindSort()
+	list.Sorted.SetSorter(list.View.Sorter())
 
-	for _, track := range pl.Tracks {
-		iter := list.Store.Append()
-		path := list.Store.Path(iter)
+	list.Scroll = gtk.NewScrolledWindow()
+	list.Scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	list.Scroll.SetVExpand(true)
+	list.Scroll.SetChild(list.View)
+	list.Scroll.ConnectDestroy(list.cancel)
 
-		row := &TrackRow{Bold: false}
-		row.iter.path = path
-		row.iter.store = list.Store
+	searchEntry := gtk.NewSearchEntry()
+	searchEntry.ConnectSearchChanged(func() { list.find(searchEntry.Text(), 0) })
+	searchEntry.ConnectNextMatch(func() { list.find(searchEntry.Text(), list.found+1) })
+	searchEntry.ConnectActivate(func() { list.find(searchEntry.Text(), list.found+1) })
 
-		row.setListStore(track)
-		list.TrackRows[track] = row
+	list.Search = gtk.NewSearchBar()
+	list.Search.SetChild(searchEntry)
+	list.Search.ConnectEntry(searchEntry)
+	list.Search.SetKeyCaptureWidget(list.View)
 
-		if !track.Metadata().IsProbed() {
-			// Allocate a slice only if we have at least 1.
-			if probeQueue == nil {
-				probeQueue = make([]prober.Job, 0, len(pl.Tracks))
-			}
+	list.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	list.Box.Append(list.Search)
+	list.Box.Append(list.Scroll)
 
-			track := track // copy pointer
+	// Queue every track, since tracks that are already probed may still be
+	// stale. The prober skips the ones that aren't.
+	probeQueue := make([]prober.Job, len(pl.Tracks))
 
-			job := prober.NewJob(track, func() {
-				row.setListStore(track)
-				pl.SetUnsaved()
-			})
+	for i, track := range pl.Tracks {
+		track := track // copy pointer
 
-			probeQueue = append(probeQueue, job)
-		}
+		probeQueue[i] = prober.NewJob(track, func() {
+			list.trackChanged(track)
+			pl.SetUnsaved()
+		})
 	}
 
-	// TODO: this has a cache stampede problem. We need to have a context to
-	// cancel this.
-	prober.Queue(probeQueue...)
+	prober.Queue(list.ctx, prober.PriorityNormal, probeQueue...)
+
+	// Probe the rows on screen first.
+	vadj := list.Scroll.VAdjustment()
+	vadj.ConnectValueChanged(list.prioritizeVisible)
+	vadj.ConnectChanged(list.prioritizeVisible)
 
-	tree.ConnectRowActivated(func(path *gtk.TreePath, _ *gtk.TreeViewColumn) {
-		parent.PlayTrack(pl, path.Indices()[0])
+	list.View.ConnectActivate(func(pos uint) {
+		// Activating an album header plays the album from its first track.
+		if _, group := list.model.item(list.Sorted.Item(pos)); group != nil {
+			parent.PlayTrack(pl, group.Start)
+			return
+		}
+
+		if ix := list.indexAt(pos); ix >= 0 {
+			parent.PlayTrack(pl, ix)
+		}
 	})
 
-	// TODO: Implement TreeView drag-and-drop for reordering. Effectively, the
+	// TODO: Implement drag-and-drop for reordering. Effectively, the
 	// application should use the standardized file URI as the data for
 	// reordering, which should make it work with a range of applications.
 	//
@@ -147,140 +192,108 @@ func NewTrackList(parent ParentController, pl *state.Playlist) *TrackList {
 	// list, we could have a remove track and add path functions. The add
 	// function would simply treat the track as an unprocessed one.
 
-	// TODO: Add this back once we can reliably create bindings for GTK v4.5.0.
-
-	// drop := gtk.NewDropTarget(glib.TypeInvalid, gdk.ActionLink)
-	// drop.SetGTypes([]glib.Type{
-	// 	gio.GTypeFile,
-	// 	// gdk.GTypeF
-	// 	// glib.TypeFromName("GFile"),
-	// 	// glib.TypeFromName("Gdk.FileList"),
-	// })
-	// drop.ConnectDrop(func(value glib.Value, x, y float64) bool {
-	// 	switch v := value.GoValue().(type) {
-	// 	case gio.Filer:
-	// 		log.Println("got path", v.Path())
-	// 	default:
-	// 		log.Printf("dropped unknown value of type %T", v)
-	// 	}
-	// 	return true
-	// })
-	// tree.AddController(drop)
-
 	// Bind the Delete key and such.
-	tree.AddController(list.keyEventController())
+	list.View.AddController(list.keyEventController())
 
-	menu := gtkutil.MenuPair([][2]string{
+	menuPairs := [][2]string{
+		{"Play _Next", "tracklist.play-next"},
+		{"Add to _Queue", "tracklist.enqueue"},
 		{"Add _Tracks...", "tracklist.add-files"},
 		{"Add _Folders...", "tracklist.add-folders"},
+		{"Cu_t", "tracklist.cut"},
+		{"_Copy", "tracklist.copy"},
+		{"_Paste", "tracklist.paste"},
 		{"Refresh _Metadata", "tracklist.refresh"},
+		{"_Edit Tags...", "tracklist.edit-tags"},
+		{"Edit Meta_data...", "tracklist.edit-metadata"},
+		{"Analyze _Loudness...", "tracklist.analyze-loudness"},
 		{"_Sort", "tracklist.sort"},
+		{"Sort _By...", "tracklist.sort-by"},
+		{"_Group by Album", "tracklist.group-albums"},
 		{"Remove", "tracklist.remove"},
-	})
+	}
+
+	// Generated and synced playlists are read-only.
+	if pl.IsReadOnly() {
+		menuPairs = [][2]string{
+			{"Play _Next", "tracklist.play-next"},
+			{"Add to _Queue", "tracklist.enqueue"},
+			{"_Copy", "tracklist.copy"},
+			{"Refresh _Metadata", "tracklist.refresh"},
+			{"_Edit Tags...", "tracklist.edit-tags"},
+			{"Edit Meta_data...", "tracklist.edit-metadata"},
+			{"Analyze _Loudness...", "tracklist.analyze-loudness"},
+			{"_Group by Album", "tracklist.group-albums"},
+		}
+	}
+
+	menu := gtkutil.MenuPair(menuPairs)
+	menu.AppendSubmenu("Co_lumns", columnSection)
 
 	// Hacks.
 	var menuX, menuY float64
-	gtkutil.BindRightClick(tree, func(x, y float64) {
+	gtkutil.BindRightClick(list.View, func(x, y float64) {
 		menuX, menuY = x, y
 
-		// This is supposed to be relative to tree's coords, but that happens to
-		// match with scroll's.
-		p := gtkutil.NewPopoverMenuAt(scroll, gtk.PosBottom, x, y, menu)
+		// The column view scrolls itself, so its coordinates match the scrolled
+		// window's.
+		p := gtkutil.NewPopoverMenuAt(list.Scroll, gtk.PosBottom, x, y, menu)
 		p.Popup()
 	})
 
-	gtkutil.BindActionMap(scroll, map[string]func(){
+	actions := map[string]func(){
 		"tracklist.refresh": list.refreshSelected,
+		"tracklist.play-next": func() {
+			if tracks := list.selectedTracks(); len(tracks) > 0 {
+				list.parent.PlayNext(tracks)
+			}
+		},
+		"tracklist.enqueue": func() {
+			if tracks := list.selectedTracks(); len(tracks) > 0 {
+				list.parent.Enqueue(tracks)
+			}
+		},
+		"tracklist.edit-tags": func() {
+			if tracks := list.selectedTracks(); len(tracks) > 0 {
+				list.spawnTagEditor(tracks)
+			}
+		},
+		"tracklist.edit-metadata": func() {
+			if tracks := list.selectedTracks(); len(tracks) > 0 {
+				list.spawnOverrideEditor(tracks)
+			}
+		},
+		"tracklist.analyze-loudness": func() {
+			if tracks := list.selectedTracks(); len(tracks) > 0 {
+				list.parent.AnalyzeLoudness(tracks)
+			}
+		},
 		"tracklist.sort":    list.SortSelected,
+		"tracklist.sort-by": list.SpawnSortDialog,
 		"tracklist.remove":  list.removeSelected,
+		"tracklist.cut":     func() { list.cutSelected() },
+		"tracklist.copy":    func() { list.copySelected() },
+		"tracklist.paste": func() {
+			list.pasteAt(list.positionAt(menuX, menuY))
+		},
 		"tracklist.add-files": func() {
 			list.promptAddTracks(menuX, menuY, gtk.FileChooserActionOpen)
 		},
 		"tracklist.add-folders": func() {
 			list.promptAddTracks(menuX, menuY, gtk.FileChooserActionSelectFolder)
 		},
-	})
-
-	trackTooltip := newTrackTooltipBox()
-
-	tree.ConnectQueryTooltip(func(x, y int, kb bool, t *gtk.Tooltip) bool {
-		var path *gtk.TreePath
-		if !kb {
-			path, _, _ = tree.DestRowAtPos(x, y)
-		} else {
-			_, iter, _ := list.Select.Selected()
-			if iter != nil {
-				path = list.Store.Path(iter)
-			}
-		}
-
-		if path == nil {
-			return false
-		}
-
-		ix := path.Indices()[0]
-		trackTooltip.Attach(t, list.Playlist.Tracks[ix])
-
-		return true
-	})
-
-	return &list
-}
-
-func parseURIList(list string) []string {
-	// Get the files in form of line-delimited URIs
-	var uris = strings.Fields(list)
-
-	// Create a path slice that we decode URIs into.
-	var paths = make([]string, 0, len(uris))
-
-	// Decode the URIs.
-	for _, uri := range uris {
-		u, err := url.Parse(uri)
-		if err != nil {
-			log.Printf("Failed parsing URI %q: %v\n", uri, err)
-			continue
-		}
-		if u.Scheme != "file" && u.Scheme != "" {
-			log.Printf("Unknown file URI scheme (only locals): %q\n", uri)
-			continue
-		}
-
-		if err := readDirOrFile(u.Path, &paths); err != nil {
-			log.Printf("Failed to read %q: %v\n", u.Path, err)
-		}
 	}
 
-	return paths
-}
-
-func readDirOrFile(path string, dest *[]string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return errors.Wrap(err, "failed to open file")
+	for name, action := range list.layoutActions() {
+		actions[name] = action
 	}
-	defer f.Close()
 
-	s, err := f.Stat()
-	if err != nil {
-		return errors.Wrap(err, "file stat failed while drag-and-drop")
-	}
+	gtkutil.BindActionMap(list.Scroll, actions)
 
-	if !s.IsDir() {
-		*dest = append(*dest, path)
-		return nil
-	}
-
-	files, err := f.Readdirnames(0)
-	if err != nil {
-		return errors.Wrap(err, "failed to read dir names")
-	}
-
-	for _, file := range files {
-		*dest = append(*dest, filepath.Join(path, file))
-	}
+	list.applyLayout(pl.ColumnLayout())
+	list.bindLayout()
 
-	return nil
+	return list
 }
 
 func (list *TrackList) keyEventController() *gtk.EventControllerKey {
@@ -290,6 +303,9 @@ func (list *TrackList) keyEventController() *gtk.EventControllerKey {
 		case gdk.KEY_Delete:
 			list.removeSelected()
 			return true
+		case gdk.KEY_F2:
+			list.editCursor(columnTitle)
+			return true
 		}
 
 		if modIsPressed(keyMod, gdk.ControlMask) {
@@ -297,6 +313,12 @@ func (list *TrackList) keyEventController() *gtk.EventControllerKey {
 			case gdk.KEY_S: // Ctrl+S
 				list.parent.SavePlaylist(list.Playlist)
 				return true
+			case gdk.KEY_c, gdk.KEY_C: // Ctrl+C
+				return list.copySelected()
+			case gdk.KEY_x, gdk.KEY_X: // Ctrl+X
+				return list.cutSelected()
+			case gdk.KEY_v, gdk.KEY_V: // Ctrl+V
+				return list.pasteAt(list.cursorPosition())
 			}
 		}
 
@@ -310,16 +332,81 @@ func modIsPressed(mod, press gdk.ModifierType) bool {
 	return mod&press == press
 }
 
+// positionAt returns the track index and insert direction for the row at the
+// given view coordinates. The end of the list is returned if there is no row.
+func (list *TrackList) positionAt(x, y float64) (ix int, before bool) {
+	cell := list.cellAt(x, y)
+	if cell == nil || cell.track == nil {
+		return len(list.Playlist.Tracks) - 1, false
+	}
+
+	ix = list.indexOf(cell.track)
+	if ix == -1 {
+		return len(list.Playlist.Tracks) - 1, false
+	}
+
+	// Insert before the row if the upper half of it is pointed at.
+	_, cellY, ok := cell.TranslateCoordinates(list.View, 0, 0)
+	before = ok && y < cellY+float64(cell.AllocatedHeight())/2
+
+	return ix, before
+}
+
+// cellAt returns the cell at the given view coordinates, or nil if there is
+// none.
+func (list *TrackList) cellAt(x, y float64) *trackCell {
+	w := list.View.Pick(x, y, gtk.PickDefault)
+
+	for w != nil {
+		base := gtk.BaseWidget(w)
+		if cell, ok := list.widgets[base.Name()]; ok {
+			return cell
+		}
+		w = base.Parent()
+	}
+
+	return nil
+}
+
+// cursorPosition returns the track index of the cursor for inserting after it.
+// The cursor is the last selected track. The end of the list is returned if
+// there is no cursor.
+func (list *TrackList) cursorPosition() (ix int, before bool) {
+	selectIxs := list.selectedIxs()
+	if len(selectIxs) == 0 {
+		return len(list.Playlist.Tracks) - 1, false
+	}
+
+	return selectIxs[len(selectIxs)-1], false
+}
+
+// editCursor starts editing the cell of the given column of the last selected
+// track.
+func (list *TrackList) editCursor(col columnType) {
+	ix, _ := list.cursorPosition()
+	if ix < 0 || ix >= len(list.Playlist.Tracks) {
+		return
+	}
+
+	for _, cell := range list.bound[list.Playlist.Tracks[ix]] {
+		if cell.column.column == col {
+			cell.startEditing()
+			return
+		}
+	}
+}
+
+// isEditable returns true if tracks can be added to or removed from the list.
+func (list *TrackList) isEditable() bool {
+	return !list.Playlist.IsReadOnly()
+}
+
 func (list *TrackList) promptAddTracks(x, y float64, action gtk.FileChooserAction) {
-	path, pos, ok := list.Tree.DestRowAtPos(int(x), int(y))
-	if !ok {
-		log.Printf("no path found at dragged pos (%.0f, %.0f)", x, y)
+	if !list.isEditable() {
 		return
 	}
 
-	before := false ||
-		pos == gtk.TreeViewDropBefore ||
-		pos == gtk.TreeViewDropIntoOrBefore
+	ix, before := list.positionAt(x, y)
 
 	var title string
 	var isDir bool
@@ -353,86 +440,103 @@ func (list *TrackList) promptAddTracks(x, y float64, action gtk.FileChooserActio
 			}
 		}
 
-		list.addTracksAt(path, before, paths, isDir)
+		list.addTracksAt(ix, before, paths, isDir)
 	})
 	chooser.Show()
 }
 
-func (list *TrackList) addTracksAt(path *gtk.TreePath, before bool, paths []string, isDir bool) {
-	addPaths := func() {
-		ix := path.Indices()[0]
-		start, end := list.Playlist.Add(ix, before, paths...)
-		probeQueue := make([]prober.Job, 0, end-start)
-
-		for i := start; i < end; i++ {
-			iter := list.Store.Insert(i)
-			path := list.Store.Path(iter)
-
-			row := &TrackRow{Bold: false}
-			row.iter.path = path
-			row.iter.store = list.Store
+func (list *TrackList) addTracksAt(ix int, before bool, paths []string, isDir bool) {
+	if !isDir {
+		list.insertTracks(ix, before, tracksFromPaths(paths))
+		return
+	}
 
-			track := list.Playlist.Tracks[i]
+	go func() {
+		paths := folder.Walk(paths...)
+		glib.IdleAdd(func() {
+			list.insertTracks(ix, before, tracksFromPaths(paths))
+		})
+	}()
+}
 
-			row.setListStore(track)
-			list.TrackRows[track] = row
+// AppendTracks appends the given tracks to the end of the list.
+func (list *TrackList) AppendTracks(tracks []playlist.Track) {
+	list.insertTracks(len(list.Playlist.Tracks)-1, false, tracks)
+}
 
-			job := prober.NewJob(track, func() {
-				row.setListStore(track)
-			})
+// insertTracks inserts the given tracks into both the playlist and the list
+// model. Only tracks that aren't probed yet are queued for probing.
+func (list *TrackList) insertTracks(ix int, before bool, tracks []playlist.Track) {
+	start, end := list.Playlist.AddTracks(ix, before, tracks...)
+	list.model.inserted(start, end)
 
+	probeQueue := make([]prober.Job, 0, end-start)
+	for _, track := range list.Playlist.Tracks[start:end] {
+		if job, ok := list.probeJob(track); ok {
 			probeQueue = append(probeQueue, job)
 		}
-
-		list.parent.UpdateTracks(list.Playlist)
-		prober.Queue(probeQueue...)
 	}
 
-	if !isDir {
-		addPaths()
-		return
+	list.invalidateAlbums()
+	list.parent.UpdateTracks(list.Playlist)
+	prober.Queue(list.ctx, prober.PriorityNormal, probeQueue...)
+}
+
+// probeJob returns a probe job that refreshes the track's row once it's done.
+// False is returned if the track is already probed.
+func (list *TrackList) probeJob(track *state.Track) (prober.Job, bool) {
+	if track.ProbedMetadata().IsProbed() {
+		return prober.Job{}, false
 	}
 
-	go func() {
-		walkedPaths := make([]string, 0, len(paths))
+	return prober.NewJob(track, func() { list.trackChanged(track) }), true
+}
 
-		for _, path := range paths {
-			s, err := os.Stat(path)
-			if err != nil {
-				log.Println("cannot stat adding path:", err)
-				continue
-			}
+// ApplySync applies the changes done by state.SyncPlaylist to the list model.
+func (list *TrackList) ApplySync(change state.SyncChange) {
+	list.model.removed(change.Removed)
 
-			if !s.IsDir() {
-				walkedPaths = append(walkedPaths, path)
-				continue
-			}
+	// Insert contiguous indices at once.
+	for i := 0; i < len(change.Added); {
+		j := i + 1
+		for j < len(change.Added) && change.Added[j] == change.Added[j-1]+1 {
+			j++
+		}
 
-			err = fs.WalkDir(
-				os.DirFS("/"), strings.TrimPrefix(path, "/"), // fs to os
-				func(path string, s fs.DirEntry, err error) error {
-					if err != nil {
-						return err
-					}
-					if !s.IsDir() {
-						walkedPaths = append(walkedPaths, "/"+path)
-					}
-					return nil
-				},
-			)
-			if err != nil {
-				log.Println("cannot walk adding path:", err)
-				continue
-			}
+		list.model.inserted(change.Added[i], change.Added[j-1]+1)
+		i = j
+	}
+
+	probeQueue := make([]prober.Job, 0, len(change.Added))
+	for _, ix := range change.Added {
+		if job, ok := list.probeJob(list.Playlist.Tracks[ix]); ok {
+			probeQueue = append(probeQueue, job)
 		}
+	}
 
-		paths = walkedPaths
-		glib.IdleAdd(addPaths)
-	}()
+	list.invalidateAlbums()
+	prober.Queue(list.ctx, prober.PriorityNormal, probeQueue...)
+}
+
+// tracksFromPaths creates a list of placeholder tracks from the given paths.
+// The state uses the metadata that it already has for these paths instead.
+func tracksFromPaths(paths []string) []playlist.Track {
+	tracks := make([]playlist.Track, len(paths))
+	for i, path := range paths {
+		tracks[i] = playlist.Track{
+			Title:    playlist.TitleFromPath(path),
+			Filepath: path,
+		}
+	}
+	return tracks
 }
 
 func (list *TrackList) removeSelected() {
-	selectIxs := selectedIxs(list.Select)
+	if !list.isEditable() {
+		return
+	}
+
+	selectIxs := list.selectedIxs()
 	if len(selectIxs) == 0 {
 		return
 	}
@@ -440,91 +544,298 @@ func (list *TrackList) removeSelected() {
 	// Sort the selected indexes in reverse to remove them in that order.
 	sort.Sort(sort.Reverse(sort.IntSlice(selectIxs)))
 
-	for _, ix := range selectIxs {
-		track := list.Playlist.Tracks[ix]
-		trRow := list.TrackRows[track]
+	list.Playlist.Remove(selectIxs...)
+	list.model.removed(selectIxs)
+	list.invalidateAlbums()
+	list.parent.UpdateTracks(list.Playlist)
+}
+
+// SortSelected sorts the selected tracks by album.
+func (list *TrackList) SortSelected() {
+	if selectIxs := list.selectedIxs(); len(selectIxs) > 1 {
+		list.sortTracks(selectIxs, state.DefaultSortKeys)
+	}
+}
+
+// sortTracks sorts the tracks at the given indices among themselves, or the
+// whole playlist if ixs is empty.
+func (list *TrackList) sortTracks(ixs []int, keys []state.SortKey) {
+	if !list.isEditable() {
+		return
+	}
 
-		delete(list.TrackRows, track)
-		if !trRow.Remove() {
-			log.Panicln("cannot remove track", ix)
+	start, end := 0, len(list.Playlist.Tracks)
+	if len(ixs) > 0 {
+		start, end = ixs[0], ixs[0]+1
+		for _, ix := range ixs {
+			if ix < start {
+				start = ix
+			}
+			if ix >= end {
+				end = ix + 1
+			}
 		}
 	}
 
-	list.Playlist.Remove(selectIxs...)
+	list.keepSelection(func() {
+		list.Playlist.Sort(ixs, keys)
+		list.model.reordered(start, end)
+	})
+
+	list.invalidateAlbums()
 	list.parent.UpdateTracks(list.Playlist)
 }
 
-// SortSelected sorts the selected tracks.
-func (list *TrackList) SortSelected() {
-	_, selectedRows := list.Select.SelectedRows()
-	selectMin := -1
-	selectMax := -1
+func (list *TrackList) refreshSelected() {
+	tracks := list.selectedTracks()
+	if len(tracks) == 0 {
+		return
+	}
+
+	probeQueue := make([]prober.Job, len(tracks))
 
-	for _, selected := range selectedRows {
-		ix := selected.Indices()[0]
+	for i, track := range tracks {
+		track := track // copy pointer
+
+		j := prober.NewJob(track, func() { list.trackChanged(track) })
+		j.Force = true
+
+		probeQueue[i] = j
+	}
+
+	prober.Queue(list.ctx, prober.PriorityVisible, probeQueue...)
+}
+
+// trackChanged refreshes the rows of the track after its metadata changes.
+func (list *TrackList) trackChanged(track *state.Track) {
+	list.model.trackChanged(track)
+	list.invalidateAlbums()
+}
+
+// prioritizeVisible raises the priority of the probe jobs of the rows on
+// screen. The rows are only bound once the view is idle, so the tracks are
+// collected then.
+func (list *TrackList) prioritizeVisible() {
+	if list.prioritizing {
+		return
+	}
 
-		// Get max and min bounds without allocating a slice.
-		if selectMin == -1 || ix < selectMin {
-			selectMin = ix
+	list.prioritizing = true
+
+	glib.IdleAdd(func() {
+		list.prioritizing = false
+
+		tracks := make([]*state.Track, 0, len(list.bound))
+		for track := range list.bound {
+			tracks = append(tracks, track)
 		}
-		if selectMax == -1 || ix > selectMax {
-			selectMax = ix
+
+		prober.Prioritize(prober.PriorityVisible, tracks...)
+	})
+}
+
+// stop cancels the probe jobs of the list. It is called when the list is
+// removed.
+func (list *TrackList) stop() {
+	list.cancel()
+
+	if list.albums != nil {
+		list.albums.stop()
+	}
+}
+
+// invalidateAlbums reloads the album grid after the tracks or their metadata
+// change.
+func (list *TrackList) invalidateAlbums() {
+	if list.albums != nil {
+		list.albums.Invalidate()
+	}
+}
+
+// bindCell remembers that the cell shows its track.
+func (list *TrackList) bindCell(cell *trackCell) {
+	list.bound[cell.track] = append(list.bound[cell.track], cell)
+}
+
+// unbindCell forgets that the cell shows its track.
+func (list *TrackList) unbindCell(cell *trackCell) {
+	cells := list.bound[cell.track]
+	for i, c := range cells {
+		if c == cell {
+			cells = append(cells[:i], cells[i+1:]...)
+			break
 		}
 	}
 
-	list.sortTracksBounds(selectMin, selectMax)
+	if len(cells) == 0 {
+		delete(list.bound, cell.track)
+	} else {
+		list.bound[cell.track] = cells
+	}
 }
 
-func (list *TrackList) sortTracksBounds(start, end int) {
-	// Exit if we have nothing.
-	if start == end {
+// find selects the first track from the given row that matches the search
+// text, wrapping around to the top.
+func (list *TrackList) find(text string, from uint) {
+	if text == "" {
 		return
 	}
 
-	sorter := newTrackSorter(list, start, end)
-	sort.Stable(sorter)
-	list.parent.UpdateTracks(list.Playlist)
+	n := list.Sorted.NItems()
+
+	for i := uint(0); i < n; i++ {
+		pos := (from + i) % n
+
+		track := list.trackAt(pos)
+		if track == nil {
+			continue
+		}
+
+		if fuzzy.MatchNormalizedFold(text, searchData(track)) {
+			list.found = pos
+			list.Select.SelectItem(pos, true)
+			list.scrollTo(pos)
+			return
+		}
+	}
 }
 
-func (list *TrackList) refreshSelected() {
-	selectIx := selectedIxs(list.Select)
-	if len(selectIx) == 0 {
+// searchData returns the text that searching matches against.
+func searchData(track *state.Track) string {
+	metadata := track.Metadata()
+
+	var data strings.Builder
+	data.WriteString(metadata.Title)
+	data.WriteByte(' ')
+	data.WriteString(metadata.Artist)
+	data.WriteByte(' ')
+	data.WriteString(metadata.Album)
+	data.WriteByte(' ')
+	data.WriteString(metadata.Filepath)
+
+	return data.String()
+}
+
+// setGrouped groups the rows by album under header rows, or ungroups them.
+// Grouped rows are in the order of the playlist, so the rows can't be sorted by
+// a column while they're grouped.
+func (list *TrackList) setGrouped(grouped bool) {
+	if grouped == list.model.isGrouped() {
 		return
 	}
 
-	probeQueue := make([]prober.Job, len(selectIx))
+	if grouped {
+		list.sortBy("", false)
+	}
 
-	for i, ix := range selectIx {
-		track := list.Playlist.Tracks[ix]
+	for column, c := range list.columns {
+		if grouped {
+			c.SetSorter(nil)
+		} else {
+			c.SetSorter(list.sorters[column])
+		}
+	}
 
-		j := prober.NewJob(track, func() {
-			row := list.TrackRows[track]
-			row.setListStore(track)
-		})
-		j.Force = true
+	list.keepSelection(func() { list.model.setGrouped(grouped) })
+}
 
-		probeQueue[i] = j
+// selectGroups selects the tracks of the album header rows that are selected in
+// the given range, so selecting a header selects its album.
+func (list *TrackList) selectGroups(position, nItems uint) {
+	if !list.model.isGrouped() || list.selectingGroups {
+		return
+	}
+
+	list.selectingGroups = true
+	defer func() { list.selectingGroups = false }()
+
+	for pos := position; pos < position+nItems; pos++ {
+		_, group := list.model.item(list.Sorted.Item(pos))
+		if group != nil && list.Select.IsSelected(pos) {
+			// Grouped rows aren't sorted, so the album's tracks follow its
+			// header.
+			list.Select.SelectRange(pos+1, uint(group.Len()), false)
+		}
+	}
+}
+
+// trackAt returns the track of the row at the given position in the view.
+func (list *TrackList) trackAt(pos uint) *state.Track {
+	return list.model.track(list.Sorted.Item(pos))
+}
+
+// indexAt returns the index in the playlist of the row at the given position in
+// the view, or -1 if there is none.
+func (list *TrackList) indexAt(pos uint) int {
+	track := list.trackAt(pos)
+	if track == nil {
+		return -1
+	}
+	return list.indexOf(track)
+}
+
+// indexOf returns the index of the track in the playlist, or -1 if it's not in
+// the playlist.
+func (list *TrackList) indexOf(track *state.Track) int {
+	return list.model.index(track)
+}
+
+// positionOf returns the position of the track's row in the view.
+func (list *TrackList) positionOf(track *state.Track) (uint, bool) {
+	// The rows are in the order of the model unless they're sorted by a
+	// column.
+	pos, ok := list.model.position(track)
+	if !ok {
+		return 0, false
+	}
+	if list.trackAt(pos) == track {
+		return pos, true
 	}
 
-	prober.Queue(probeQueue...)
+	n := list.Sorted.NItems()
+	for pos := uint(0); pos < n; pos++ {
+		if list.trackAt(pos) == track {
+			return pos, true
+		}
+	}
+
+	return 0, false
+}
+
+// scrollTo scrolls the view to the row at the given position.
+func (list *TrackList) scrollTo(pos uint) {
+	// The column view has no API for this, but its list view has an action.
+	// It's activated on a cell, since actions are looked up from the widget
+	// upwards.
+	for _, cell := range list.cells {
+		cell.ActivateActionVariant("list.scroll-to-item", glib.NewVariantUint32(uint32(pos)))
+		return
+	}
 }
 
 func (list *TrackList) SelectPlaying() {
-	rw, ok := list.TrackRows[list.playing]
+	list.SelectTrack(list.playing)
+}
+
+// SelectTrack selects only the given track and scrolls to it.
+func (list *TrackList) SelectTrack(track *state.Track) {
+	if track == nil {
+		return
+	}
+
+	pos, ok := list.positionOf(track)
 	if !ok {
 		return
 	}
 
-	list.Select.UnselectAll()
-	list.Select.SelectPath(rw.Path())
-	list.Tree.ScrollToCell(rw.Path(), nil, true, 0.5, 0.0)
+	list.Select.SelectItem(pos, true)
+	list.scrollTo(pos)
 }
 
 // SetPlaying unbolds the last track (if any) and bolds the given track. It does
 // not trigger any callback.
 func (list *TrackList) SetPlaying(playing *state.Track) {
-	rw, ok := list.TrackRows[playing]
-	if !ok {
+	if !list.model.contains(playing) {
 		log.Printf("Track not found on (*Tracklist).SetPlaying: %q\n", playing.Filepath)
 		return
 	}
@@ -533,37 +844,106 @@ func (list *TrackList) SetPlaying(playing *state.Track) {
 	// behavior.
 	reselect := list.playing == nil
 
-	if playingRow, ok := list.TrackRows[list.playing]; ok {
-		playingRow.SetBold(list.Store, false)
+	if list.playing != nil && list.model.contains(list.playing) {
+		for _, cell := range list.bound[list.playing] {
+			cell.RemoveCSSClass("playing-track")
+		}
 
 		// Decide if we should move the selection.
-		selectedRows := list.Select.CountSelectedRows()
-		reselect = selectedRows == 1 && list.Select.PathIsSelected(playingRow.Path())
+		selected := list.selectedTracks()
+		reselect = len(selected) == 1 && selected[0] == list.playing
 
 		if reselect {
-			list.Select.UnselectPath(playingRow.Path())
+			list.Select.UnselectAll()
 		}
 	}
 
+	list.playing = playing
+
+	for _, cell := range list.bound[playing] {
+		cell.AddCSSClass("playing-track")
+	}
+
 	if reselect {
-		list.Select.SelectPath(rw.Path())
-		list.Tree.ScrollToCell(rw.Path(), nil, false, 0, 0)
+		list.SelectTrack(playing)
 	}
 
-	list.playing = playing
-	rw.SetBold(list.Store, true)
+	prober.Prioritize(prober.PriorityPlaying, playing)
 }
 
-func selectedIxs(sel *gtk.TreeSelection) []int {
-	_, selectedRows := sel.SelectedRows()
-	if len(selectedRows) == 0 {
+// selectedTracks returns the selected tracks in the order of the playlist.
+func (list *TrackList) selectedTracks() []*state.Track {
+	selectIxs := list.selectedIxs()
+	tracks := make([]*state.Track, len(selectIxs))
+	for i, ix := range selectIxs {
+		tracks[i] = list.Playlist.Tracks[ix]
+	}
+	return tracks
+}
+
+// selectedIxs returns the indices of the selected tracks in the playlist,
+// sorted from smallest to largest.
+func (list *TrackList) selectedIxs() []int {
+	selected := list.selectedSet()
+	if len(selected) == 0 {
 		return nil
 	}
 
-	selectIxs := make([]int, len(selectedRows))
-	for i, selected := range selectedRows {
-		selectIxs[i] = selected.Indices()[0]
+	selectIxs := make([]int, 0, len(selected))
+	for track := range selected {
+		if ix := list.indexOf(track); ix != -1 {
+			selectIxs = append(selectIxs, ix)
+		}
 	}
 
+	sort.Ints(selectIxs)
 	return selectIxs
 }
+
+func (list *TrackList) selectedSet() map[*state.Track]struct{} {
+	bitset := list.Select.Selection()
+	size := bitset.Size()
+	if size == 0 {
+		return nil
+	}
+
+	selected := make(map[*state.Track]struct{}, size)
+	for i := uint64(0); i < size; i++ {
+		if track := list.trackAt(bitset.Nth(uint(i))); track != nil {
+			selected[track] = struct{}{}
+		}
+	}
+
+	return selected
+}
+
+// keepSelection calls apply, which may replace rows, then selects the tracks
+// that were selected before again.
+func (list *TrackList) keepSelection(apply func()) {
+	selected := list.selectedSet()
+	apply()
+
+	if len(selected) == 0 {
+		return
+	}
+
+	list.Select.UnselectAll()
+
+	// Looking up each track would scan the rows if they're sorted by a column,
+	// so scan them only once instead.
+	if list.sortColumn != "" {
+		n := list.Sorted.NItems()
+		for pos := uint(0); pos < n; pos++ {
+			if _, ok := selected[list.trackAt(pos)]; ok {
+				list.Select.SelectItem(pos, false)
+			}
+		}
+		return
+	}
+
+	for track := range selected {
+		if pos, ok := list.positionOf(track); ok {
+			list.Select.SelectItem(pos, false)
+		}
+	}
+}
@@ -7,20 +7,34 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/diamondburned/aqours/internal/durafmt"
 	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/ui/content/body/sidebar"
 	"github.com/diamondburned/aqours/internal/ui/css"
-	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
-	"github.com/diamondburned/gotk4/pkg/pango"
 )
 
 type ParentController interface {
 	PlayTrack(p *state.Playlist, index int)
 	SavePlaylist(p *state.Playlist)
 	UpdateTracks(p *state.Playlist)
+	// RefreshTrack refreshes everything that shows the track's file after its
+	// metadata is changed.
+	RefreshTrack(track *state.Track)
+	// AnalyzeLoudness measures the loudness of the given tracks to find their
+	// ReplayGain.
+	AnalyzeLoudness(tracks []*state.Track)
+	// PlayNext queues the tracks to be played right after the playing track.
+	PlayNext(tracks []*state.Track)
+	// Enqueue adds the tracks to the end of the play queue.
+	Enqueue(tracks []*state.Track)
+	// CopyTracks keeps the metadata of the copied tracks until something else
+	// is copied, so that they can be pasted after being cut.
+	CopyTracks(tracks []*state.Track)
 }
 
 type Container struct {
@@ -31,6 +45,8 @@ type Container struct {
 
 	// current treeview playlist name
 	current string
+	// albumView is true if playlists are shown as album grids.
+	albumView bool
 }
 
 func NewContainer(parent ParentController) *Container {
@@ -54,124 +70,123 @@ func (c *Container) SelectPlaylist(playlist *state.Playlist) *TrackList {
 	}
 
 	c.current = playlist.Name
-	c.Stack.SetVisibleChild(pl)
+	c.showList(pl)
 	return pl
 }
 
-func (c *Container) DeletePlaylist(name string) {
-	pl, ok := c.Lists[name]
-	if !ok {
+// SetAlbumView sets whether playlists are shown as album grids instead of
+// track lists.
+func (c *Container) SetAlbumView(albums bool) {
+	c.albumView = albums
+
+	if pl, ok := c.Lists[c.current]; ok {
+		c.showList(pl)
+	}
+}
+
+// showList shows the track list or the album grid of the playlist, depending
+// on the view.
+func (c *Container) showList(pl *TrackList) {
+	if !c.albumView {
+		c.Stack.SetVisibleChild(pl)
 		return
 	}
 
-	c.current = ""
+	if pl.albums == nil {
+		pl.albums = NewAlbumGrid(c.parent, pl.Playlist)
+		c.Stack.AddChild(pl.albums)
+	}
+
+	c.Stack.SetVisibleChild(pl.albums)
+}
+
+// removeList removes the track list and its album grid from the stack.
+func (c *Container) removeList(pl *TrackList) {
+	pl.stop()
 	c.Stack.Remove(pl)
-	delete(c.Lists, name)
+
+	if pl.albums != nil {
+		c.Stack.Remove(pl.albums)
+	}
 }
 
-func newColumn(text string, col columnType) *gtk.TreeViewColumn {
-	r := gtk.NewCellRendererText()
-	r.SetObjectProperty("weight-set", true)
-	r.SetObjectProperty("ellipsize", pango.EllipsizeEnd)
-	r.SetObjectProperty("ellipsize-set", true)
-
-	c := gtk.NewTreeViewColumn()
-	c.SetTitle(text)
-	c.PackStart(r, false)
-	c.AddAttribute(r, "text", int(col))
-	c.AddAttribute(r, "weight", int(columnSelected))
-	c.SetSizing(gtk.TreeViewColumnFixed)
-	c.SetResizable(true)
-
-	switch col {
-	case columnTime:
-		c.SetMinWidth(50)
-	case columnSelected, columnSearchData:
-		c.SetVisible(false)
-	default:
-		c.SetExpand(true)
-		c.SetMinWidth(150)
+// ReloadPlaylist recreates the track list of the given playlist if it has one,
+// which is needed after its tracks are changed externally, such as when a
+// generated playlist is regenerated. The new track list is returned, or nil if
+// the playlist has none.
+func (c *Container) ReloadPlaylist(playlist *state.Playlist) *TrackList {
+	old, ok := c.Lists[playlist.Name]
+	if !ok {
+		return nil
 	}
 
-	return c
-}
+	c.removeList(old)
 
-type TrackRow struct {
-	Bold bool
-	iter struct {
-		path  *gtk.TreePath
-		store *gtk.ListStore
+	pl := NewTrackList(c.parent, playlist)
+	c.Lists[playlist.Name] = pl
+	c.Stack.AddNamed(pl, playlist.Name)
+
+	if c.current == playlist.Name {
+		c.showList(pl)
 	}
-	// Path *gtk.TreePath
-}
 
-func (row *TrackRow) Iter() (*gtk.TreeIter, bool) {
-	return row.iter.store.Iter(row.iter.path)
+	return pl
 }
 
-func (row *TrackRow) Path() *gtk.TreePath { return row.iter.path }
+// RefreshTrack refreshes the rows of the given file in all track lists.
+func (c *Container) RefreshTrack(path string) {
+	for _, list := range c.Lists {
+		for _, track := range list.Playlist.Tracks {
+			if track.Filepath == path {
+				list.trackChanged(track)
+			}
+		}
+	}
+}
 
-func (row *TrackRow) Remove() bool {
-	if iter, ok := row.Iter(); ok {
-		row.iter.store.Remove(iter)
-		return true
+// RefreshRow refreshes the row of the given track if it's in a track list.
+func (c *Container) RefreshRow(track *state.Track) {
+	for _, list := range c.Lists {
+		if list.model.contains(track) {
+			list.trackChanged(track)
+			return
+		}
 	}
-	return false
 }
 
-func (row *TrackRow) SetBold(store *gtk.ListStore, bold bool) {
-	it, ok := row.Iter()
+func (c *Container) DeletePlaylist(name string) {
+	pl, ok := c.Lists[name]
 	if !ok {
 		return
 	}
 
-	row.Bold = bold
-	store.SetValue(it, columnSelected, glib.NewValue(weight(row.Bold)))
+	c.current = ""
+	c.removeList(pl)
+	delete(c.Lists, name)
 }
 
-func (row *TrackRow) setListStore(t *state.Track) {
-	it, ok := row.Iter()
-	if !ok {
-		return
+// formatNonZero formats n, or returns an empty string if n is 0.
+func formatNonZero(n int) string {
+	if n == 0 {
+		return ""
 	}
+	return strconv.Itoa(n)
+}
 
-	metadata := t.Metadata()
-
-	searchData := strings.Builder{}
-	searchData.WriteString(metadata.Title)
-	searchData.WriteByte(' ')
-	searchData.WriteString(metadata.Artist)
-	searchData.WriteByte(' ')
-	searchData.WriteString(metadata.Album)
-	searchData.WriteByte(' ')
-	searchData.WriteString(metadata.Filepath)
-
-	row.iter.store.Set(
-		it,
-		[]int{
-			columnTitle,
-			columnArtist,
-			columnAlbum,
-			columnTime,
-			columnSelected,
-			columnSearchData,
-		},
-		[]glib.Value{
-			*glib.NewValue(metadata.Title),
-			*glib.NewValue(metadata.Artist),
-			*glib.NewValue(metadata.Album),
-			*glib.NewValue(durafmt.Format(metadata.Length)),
-			*glib.NewValue(weight(row.Bold)),
-			*glib.NewValue(searchData.String()),
-		},
-	)
+// formatSampleRate formats the sample rate in kHz, such as 44.1 kHz.
+func formatSampleRate(hz int) string {
+	if hz == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(hz)/1000, 'f', -1, 64) + " kHz"
 }
 
-func weight(bold bool) pango.Weight {
-	if bold {
-		return pango.WeightBold
+// formatBitrate formats the bitrate in kbits/s.
+func formatBitrate(bits int) string {
+	if bits < 1000 {
+		return ""
 	}
-	return pango.WeightBook
+	return strconv.Itoa(bits/1000) + " kbits/s"
 }
 
 const (
@@ -188,7 +203,7 @@ var trackTooltipImageCSS = css.PrepareClass("track-tooltip-image", `
 `)
 
 type trackTooltipBox struct {
-	image     *gdkpixbuf.Pixbuf
+	image     *gdk.Texture
 	trackPath string
 	stopFetch context.CancelFunc
 }
@@ -208,47 +223,53 @@ func (tt *trackTooltipBox) Attach(t *gtk.Tooltip, track *state.Track) {
 		tt.image = nil
 	}
 
-	// TODO: album art fetchign is very expensive. Until we can reduce the call
-	// frequency, we should absolutely not do this.
-
-	// if tt.image != nil {
-	// 	t.SetIcon(tt.image)
-	// } else {
-	// 	t.SetIconFromIconName("folder-music-symbolic", AlbumIconSize)
-
-	// 	// Gtk is very, VERY dumb, so it'll try and fetch an album art just by
-	// 	// hovering the cursor on things. I simply cannot fix stupidity of this
-	// 	// level, so just deal with the fd spam. At least I have a context to
-	// 	// cancel things.
-	// 	if newTrack {
-	// 		tt.stopFetch()
-	// 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	// 		tt.stopFetch = cancel
-
-	// 		go func() {
-	// 			defer cancel()
-
-	// 			p := sidebar.FetchAlbumArt(ctx, track, PixelIconSize)
-	// 			if p == nil {
-	// 				return
-	// 			}
-
-	// 			glib.IdleAdd(func() {
-	// 				if tt.trackPath == mdata.Filepath {
-	// 					tt.image = p
-	// 					t.SetIcon(p)
-	// 				}
-	// 			})
-	// 		}()
-	// 	}
-	// }
+	// The thumbnails are cached on disk, so hovering over many tracks only
+	// costs a lookup once each album art has been seen.
+	if tt.image != nil {
+		t.SetIcon(tt.image)
+	} else {
+		t.SetIconFromIconName("folder-music-symbolic")
+
+		if newTrack {
+			tt.stopFetch()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			tt.stopFetch = cancel
+
+			go func() {
+				defer cancel()
+
+				p := sidebar.FetchAlbumArt(ctx, track, PixelIconSize)
+				if p == nil {
+					return
+				}
+
+				glib.IdleAdd(func() {
+					if tt.trackPath == mdata.Filepath {
+						tt.image = gdk.NewTextureForPixbuf(p)
+						t.SetIcon(tt.image)
+					}
+				})
+			}()
+		}
+	}
 
 	var builder strings.Builder
 	writeHTMLField(&builder, "<b>Title:</b> %s\n", mdata.Title)
 	writeHTMLField(&builder, "<b>Artist:</b> %s\n", mdata.Artist)
 	writeHTMLField(&builder, "<b>Album:</b> %s\n", mdata.Album)
+	writeHTMLField(&builder, "<b>Album Artist:</b> %s\n", mdata.AlbumArtist)
+	writeHTMLField(&builder, "<b>Composer:</b> %s\n", mdata.Composer)
+	writeHTMLField(&builder, "<b>Genre:</b> %s\n", mdata.Genre)
+	writeHTMLField(&builder, "<b>Date:</b> %s\n", mdata.Date)
+	writeHTMLField(&builder, "<b>Disc:</b> %s\n", formatNonZero(mdata.Disc))
 	writeHTMLField(&builder, "<b>Number:</b> %s\n", strconv.Itoa(mdata.Number))
 	writeHTMLField(&builder, "<b>Length:</b> %s\n", durafmt.Format(mdata.Length))
+	writeHTMLField(&builder, "<b>Codec:</b> %s\n", mdata.Codec)
+	writeHTMLField(&builder, "<b>Sample Rate:</b> %s\n", formatSampleRate(mdata.SampleRate))
+	writeHTMLField(&builder, "<b>Bitrate:</b> %s\n", formatBitrate(mdata.Bitrate))
+	if rg := mdata.ReplayGain; rg != nil {
+		writeHTMLField(&builder, "<b>ReplayGain:</b> %s\n", fmt.Sprintf("%+.2f dB", rg.TrackGain))
+	}
 	writeHTMLField(&builder,
 		"<b>Filepath:</b> <span insert-hyphens=\"false\">%s</span>",
 		mdata.Filepath,
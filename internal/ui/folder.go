@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/muse/playlist/folder"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/pkg/errors"
+)
+
+// AddFolderPlaylist creates a new folder playlist that is kept in sync with the
+// given source.
+func (w *MainWindow) AddFolderPlaylist(name string, src *folder.Source) {
+	dir := filepath.Join(state.DataDir(), "playlists")
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Println("failed to make playlists directory:", err)
+		return
+	}
+
+	pl := w.state.AddPlaylist(&playlist.Playlist{
+		Name:   name,
+		Path:   folder.PathFromName(dir, name),
+		Source: src,
+	})
+	if pl == nil {
+		return
+	}
+
+	uiPl := w.Body.Sidebar.PlaylistList.AddPlaylist(pl)
+	w.Body.Sidebar.PlaylistList.SelectPlaylist(uiPl)
+
+	w.SavePlaylist(pl)
+	w.watchPlaylist(pl, true)
+}
+
+// SetFolderSource changes the source of the given folder playlist.
+func (w *MainWindow) SetFolderSource(pl *state.Playlist, src *folder.Source) {
+	pl.SetSource(src)
+	w.SavePlaylist(pl)
+	w.watchPlaylist(pl, true)
+}
+
+// watchPlaylist starts watching the source of the given synced playlist,
+// stopping the previous watcher if any. If rescan is true, then the source is
+// also scanned once before watching.
+func (w *MainWindow) watchPlaylist(pl *state.Playlist, rescan bool) {
+	if pl.Source == nil {
+		return
+	}
+
+	if cancel, ok := w.watchers[pl]; ok {
+		cancel()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.watchers[pl] = cancel
+
+	src := pl.Source
+
+	go func() {
+		if rescan {
+			w.rescanPlaylist(ctx, pl, src)
+		}
+
+		err := src.Watch(ctx, func() { w.rescanPlaylist(ctx, pl, src) })
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("failed to watch playlist %q: %v\n", pl.Name, err)
+		}
+	}()
+}
+
+// rescanPlaylist scans the given source and syncs the playlist with it in the
+// main thread. It does blocking IO.
+func (w *MainWindow) rescanPlaylist(ctx context.Context, pl *state.Playlist, src playlist.Source) {
+	paths, err := src.Scan()
+	if err != nil {
+		log.Printf("failed to scan playlist %q: %v\n", pl.Name, err)
+		return
+	}
+
+	glib.IdleAdd(func() {
+		// Don't apply stale results if the source was changed in the meantime.
+		if ctx.Err() != nil {
+			return
+		}
+
+		w.syncPlaylist(pl, paths)
+	})
+}
+
+// syncPlaylist syncs the given playlist with the given paths and applies the
+// changes to the track list.
+func (w *MainWindow) syncPlaylist(pl *state.Playlist, paths []string) {
+	change := w.state.SyncPlaylist(pl, paths)
+	if change.IsEmpty() {
+		return
+	}
+
+	if pl == w.state.Library() {
+		added := make([]*state.Track, len(change.Added))
+		for i, ix := range change.Added {
+			added[i] = pl.Tracks[ix]
+		}
+
+		w.probeTracks(added)
+		w.Body.Sidebar.LibraryRow.SetTotal(len(pl.Tracks))
+	}
+
+	if uiPl := w.Body.Sidebar.PlaylistList.Playlist(pl.Name); uiPl != nil {
+		uiPl.SetTotal(len(pl.Tracks))
+	}
+
+	if trackList, ok := w.Body.TracksView.Lists[pl.Name]; ok {
+		trackList.ApplySync(change)
+	}
+
+	w.state.SaveState()
+}
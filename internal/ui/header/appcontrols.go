@@ -12,7 +12,10 @@ import (
 
 type AppControls struct {
 	*gtk.Box
-	OpenPlaylistButton *gtk.Button
+	OpenPlaylistButton   *gtk.Button
+	SmartPlaylistButton  *gtk.Button
+	FolderPlaylistButton *gtk.Button
+	Search               *Search
 }
 
 func NewAppControls(parent ParentController) *AppControls {
@@ -20,12 +23,28 @@ func NewAppControls(parent ParentController) *AppControls {
 	openBtn.ConnectClicked(func() { spawnChooser(parent) })
 	openBtn.SetTooltipMarkup("Add Playlist")
 
+	smartBtn := gtk.NewButtonFromIconName("system-search-symbolic")
+	smartBtn.ConnectClicked(func() { spawnSmartPlaylistDialog(parent) })
+	smartBtn.SetTooltipMarkup("New Smart Playlist")
+
+	folderBtn := gtk.NewButtonFromIconName("folder-symbolic")
+	folderBtn.ConnectClicked(func() { spawnFolderPlaylistDialog(parent) })
+	folderBtn.SetTooltipMarkup("New Folder Playlist")
+
+	search := NewSearch(parent)
+
 	box := gtk.NewBox(gtk.OrientationHorizontal, 5)
 	box.Append(openBtn)
+	box.Append(smartBtn)
+	box.Append(folderBtn)
+	box.Append(search)
 
 	return &AppControls{
-		Box:                box,
-		OpenPlaylistButton: openBtn,
+		Box:                  box,
+		OpenPlaylistButton:   openBtn,
+		SmartPlaylistButton:  smartBtn,
+		FolderPlaylistButton: folderBtn,
+		Search:               search,
 	}
 }
 
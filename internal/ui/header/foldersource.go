@@ -0,0 +1,228 @@
+package header
+
+import (
+	"strings"
+
+	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/muse/playlist/folder"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+var sourceEditorCSS = css.PrepareClass("source-editor", `
+	.source-editor {
+		margin: 8px;
+	}
+`)
+
+var sortOrderNames = map[folder.SortOrder]string{
+	folder.SortPath:     "Path",
+	folder.SortName:     "File Name",
+	folder.SortModified: "Date Modified",
+}
+
+// sourceEditor is a widget that edits the settings of a folder playlist.
+type sourceEditor struct {
+	*gtk.Grid
+	root  *gtk.Button
+	exts  *gtk.Entry
+	sort  *gtk.ComboBoxText
+	desc  *gtk.CheckButton
+	path  string
+	dirty func()
+}
+
+func newSourceEditor(src *folder.Source) *sourceEditor {
+	e := &sourceEditor{dirty: func() {}}
+
+	e.root = gtk.NewButtonWithLabel("Choose Folder...")
+	e.root.SetHExpand(true)
+	e.root.ConnectClicked(e.chooseRoot)
+
+	e.exts = gtk.NewEntry()
+	e.exts.SetPlaceholderText(strings.Join(folder.DefaultExtensions, " "))
+	e.exts.SetTooltipText("Space-separated file extensions to include")
+
+	e.sort = gtk.NewComboBoxText()
+	for _, order := range folder.SortOrders {
+		e.sort.Append(string(order), sortOrderNames[order])
+	}
+
+	e.desc = gtk.NewCheckButtonWithLabel("Descending")
+
+	e.Grid = gtk.NewGrid()
+	e.Grid.SetRowSpacing(4)
+	e.Grid.SetColumnSpacing(8)
+
+	row := 0
+	attachRow := func(label string, widgets ...gtk.Widgetter) {
+		l := gtk.NewLabel(label)
+		l.SetXAlign(0)
+		e.Grid.Attach(l, 0, row, 1, 1)
+
+		for i, w := range widgets {
+			e.Grid.Attach(w, i+1, row, 1, 1)
+		}
+
+		row++
+	}
+
+	attachRow("Folder", e.root)
+	attachRow("Extensions", e.exts)
+	attachRow("Sort By", e.sort, e.desc)
+
+	sourceEditorCSS(e.Grid)
+
+	e.setSource(src)
+
+	return e
+}
+
+func (e *sourceEditor) setSource(src *folder.Source) {
+	e.setRoot(src.Root)
+	e.exts.SetText(strings.Join(src.Extensions, " "))
+
+	if src.Sort == "" {
+		e.sort.SetActiveID(string(folder.SortPath))
+	} else {
+		e.sort.SetActiveID(string(src.Sort))
+	}
+
+	e.desc.SetActive(src.Descending)
+}
+
+func (e *sourceEditor) setRoot(path string) {
+	e.path = path
+
+	if path == "" {
+		e.root.SetLabel("Choose Folder...")
+	} else {
+		e.root.SetLabel(path)
+	}
+
+	e.dirty()
+}
+
+func (e *sourceEditor) chooseRoot() {
+	chooser := gtk.NewFileChooserNative(
+		"Choose Folder", gtkutil.ActiveWindow(),
+		gtk.FileChooserActionSelectFolder, "Choose", "Cancel",
+	)
+	chooser.SetModal(true)
+
+	if e.path != "" {
+		chooser.SetCurrentFolder(gio.NewFileForPath(e.path))
+	}
+
+	chooser.ConnectResponse(func(resp int) {
+		defer chooser.Destroy()
+
+		if resp != int(gtk.ResponseAccept) {
+			return
+		}
+
+		if file := chooser.File(); file != nil && file.Path() != "" {
+			e.setRoot(file.Path())
+		}
+	})
+	chooser.Show()
+}
+
+// source returns the edited source, or nil if no folder is chosen.
+func (e *sourceEditor) source() *folder.Source {
+	if e.path == "" {
+		return nil
+	}
+
+	src := &folder.Source{
+		Root:       e.path,
+		Sort:       folder.SortOrder(e.sort.ActiveID()),
+		Descending: e.desc.Active(),
+	}
+
+	for _, ext := range strings.Fields(e.exts.Text()) {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		src.Extensions = append(src.Extensions, ext)
+	}
+
+	return src
+}
+
+// spawnFolderPlaylistDialog spawns a dialog for creating a new folder playlist.
+func spawnFolderPlaylistDialog(parent ParentController) {
+	window := gtkutil.ActiveWindow()
+	dialog := gtk.NewDialogWithFlags(
+		"New Folder Playlist", window, gtk.DialogModal|gtk.DialogUseHeaderBar)
+
+	dialog.AddButton("Create", int(gtk.ResponseApply))
+	dialog.SetResponseSensitive(int(gtk.ResponseApply), false)
+
+	entry := gtk.NewEntry()
+	entry.SetPlaceholderText("New Folder Playlist")
+	renameEntryCSS(entry)
+
+	editor := newSourceEditor(&folder.Source{})
+
+	validate := func() {
+		t := entry.Text()
+		if t == "" || parent.HasPlaylist(t) {
+			dialog.SetResponseSensitive(int(gtk.ResponseApply), false)
+			markEntryError(entry, nameCollideMsg)
+			return
+		}
+
+		markEntryError(entry, "")
+		dialog.SetResponseSensitive(int(gtk.ResponseApply), editor.path != "")
+	}
+
+	entry.Connect("changed", validate)
+	editor.dirty = validate
+
+	c := dialog.ContentArea()
+	c.Append(entry)
+	c.Append(editor)
+
+	dialog.ConnectResponse(func(res int) {
+		defer dialog.Destroy()
+
+		if res != int(gtk.ResponseApply) {
+			return
+		}
+
+		if src := editor.source(); src != nil {
+			parent.AddFolderPlaylist(entry.Text(), src)
+		}
+	})
+	dialog.Show()
+}
+
+// spawnSourceDialog spawns a dialog for editing the settings of an existing
+// folder playlist.
+func spawnSourceDialog(name string, src *folder.Source, done func(*folder.Source)) {
+	window := gtkutil.ActiveWindow()
+	dialog := gtk.NewDialogWithFlags(
+		"Edit "+name, window, gtk.DialogModal|gtk.DialogUseHeaderBar)
+
+	dialog.AddButton("Save", int(gtk.ResponseApply))
+
+	editor := newSourceEditor(src)
+
+	c := dialog.ContentArea()
+	c.Append(editor)
+
+	dialog.ConnectResponse(func(res int) {
+		defer dialog.Destroy()
+
+		if res != int(gtk.ResponseApply) {
+			return
+		}
+
+		if src := editor.source(); src != nil {
+			done(src)
+		}
+	})
+	dialog.Show()
+}
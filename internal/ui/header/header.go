@@ -6,19 +6,42 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/diamondburned/aqours/internal/muse/playlist/folder"
+	"github.com/diamondburned/aqours/internal/muse/playlist/smart"
+	"github.com/diamondburned/aqours/internal/muse/query"
 	"github.com/diamondburned/aqours/internal/state"
 	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/aqours/internal/ui/namepattern"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 )
 
 type ParentController interface {
 	AddPlaylist(path string)
+	AddSmartPlaylist(name string, rules *smart.Rules)
+	SetSmartRules(pl *state.Playlist, rules *smart.Rules)
+	AddFolderPlaylist(name string, src *folder.Source)
+	SetFolderSource(pl *state.Playlist, src *folder.Source)
+	// SetNamePattern sets the name pattern of the playlist and probes its
+	// tracks again.
+	SetNamePattern(pl *state.Playlist, pattern string)
+	// AnalyzeLoudness measures the loudness of the given tracks to find their
+	// ReplayGain.
+	AnalyzeLoudness(tracks []*state.Track)
+	// SearchTracks searches all playlists with at most limit results each.
+	SearchTracks(q *query.Query, limit int) []state.SearchResult
+	PlayTrack(pl *state.Playlist, index int)
+	RevealTrack(pl *state.Playlist, index int)
+	// Enqueue adds the tracks to the end of the play queue.
+	Enqueue(tracks []*state.Track)
 	// ParentPlaylistController methods.
 	GoBack()
 	HasPlaylist(name string) bool
 	SavePlaylist(pl *state.Playlist)
 	RenamePlaylist(pl *state.Playlist, newName string) bool
 	SortSelectedTracks()
+	// SortTracks spawns a dialog that sorts the tracks of the playlist.
+	SortTracks(pl *state.Playlist)
+	SetAlbumView(albums bool)
 }
 
 var bitrateCSS = css.PrepareClass("bitrate", `
@@ -106,6 +129,12 @@ func (c *Container) SetPlaylist(pl *state.Playlist) {
 	if pl != nil {
 		c.Info.SetPlaylist(pl)
 		c.Right.SetRevealChild(true)
+
+		_, isSmart := pl.Generator.(*smart.Rules)
+		c.Right.SetSmart(isSmart)
+
+		_, isFolder := pl.Source.(*folder.Source)
+		c.Right.SetFolder(isFolder)
 	} else {
 		c.Info.Reset()
 		c.Right.SetRevealChild(false)
@@ -124,6 +153,78 @@ func (c *Container) RenamePlaylist(newName string) {
 	}
 }
 
+// EditSmartRules spawns a dialog to edit the rules of the current playlist if
+// it's a smart playlist.
+func (c *Container) EditSmartRules() {
+	pl := c.current
+	if pl == nil {
+		return
+	}
+
+	rules, ok := pl.Generator.(*smart.Rules)
+	if !ok {
+		return
+	}
+
+	spawnRulesDialog(pl.Name, rules, func(rules *smart.Rules) {
+		c.ParentController.SetSmartRules(pl, rules)
+	})
+}
+
+// EditFolderSource spawns a dialog to edit the settings of the current playlist
+// if it's a folder playlist.
+func (c *Container) EditFolderSource() {
+	pl := c.current
+	if pl == nil {
+		return
+	}
+
+	src, ok := pl.Source.(*folder.Source)
+	if !ok {
+		return
+	}
+
+	spawnSourceDialog(pl.Name, src, func(src *folder.Source) {
+		c.ParentController.SetFolderSource(pl, src)
+	})
+}
+
+// EditNamePattern spawns a dialog to edit the name pattern of the current
+// playlist.
+func (c *Container) EditNamePattern() {
+	pl := c.current
+	if pl == nil {
+		return
+	}
+
+	paths := make([]string, 0, namepattern.MaxPreview)
+	for _, track := range pl.Tracks {
+		if len(paths) == namepattern.MaxPreview {
+			break
+		}
+		paths = append(paths, track.Filepath)
+	}
+
+	namepattern.SpawnDialog(pl.Name, pl.NamePattern, paths, func(pattern string) {
+		c.ParentController.SetNamePattern(pl, pattern)
+	})
+}
+
+// SortTracks spawns a dialog that sorts the tracks of the current playlist.
+func (c *Container) SortTracks() {
+	if c.current != nil {
+		c.ParentController.SortTracks(c.current)
+	}
+}
+
+// AnalyzePlaylistLoudness measures the loudness of the tracks in the current
+// playlist.
+func (c *Container) AnalyzePlaylistLoudness() {
+	if c.current != nil && len(c.current.Tracks) > 0 {
+		c.ParentController.AnalyzeLoudness(c.current.Tracks)
+	}
+}
+
 // PlaylistName returns the current playlist, or an empty string if none.
 func (c *Container) PlaylistName() string {
 	return c.Info.Playlist
@@ -28,12 +28,31 @@ type ParentPlaylistController interface {
 	SaveCurrentPlaylist()
 	// SortSelectedTracks sorts the selected songs.
 	SortSelectedTracks()
+	// SortTracks spawns a dialog that sorts the tracks of the current
+	// playlist.
+	SortTracks()
+	// EditSmartRules edits the rules of the current smart playlist.
+	EditSmartRules()
+	// EditFolderSource edits the settings of the current folder playlist.
+	EditFolderSource()
+	// EditNamePattern edits the name pattern of the current playlist.
+	EditNamePattern()
+	// AnalyzePlaylistLoudness measures the loudness of the tracks in the
+	// current playlist.
+	AnalyzePlaylistLoudness()
+	// SetAlbumView sets whether playlists are shown as album grids.
+	SetAlbumView(albums bool)
 }
 
 type PlaylistControls struct {
 	gtk.Revealer
+	AlbumView *gtk.ToggleButton
 	Hamburger *actions.MenuButton
 	HamMenu   *actions.Menu
+
+	parent ParentPlaylistController
+	smart  bool
+	folder bool
 }
 
 func NewPlaylistControls(parent ParentPlaylistController) *PlaylistControls {
@@ -43,23 +62,68 @@ func NewPlaylistControls(parent ParentPlaylistController) *PlaylistControls {
 	hamburger.SetIconName("open-menu-symbolic")
 	hamburger.Bind(hamMenu)
 
+	albumView := gtk.NewToggleButton()
+	albumView.SetIconName("view-grid-symbolic")
+	albumView.SetTooltipText("Show Albums")
+	albumView.ConnectToggled(func() { parent.SetAlbumView(albumView.Active()) })
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	box.Append(albumView)
+	box.Append(hamburger)
+
 	rev := gtk.NewRevealer()
 	rev.SetRevealChild(false)
 	rev.SetTransitionDuration(50)
 	rev.SetTransitionType(gtk.RevealerTransitionTypeCrossfade)
-	rev.SetChild(hamburger)
+	rev.SetChild(box)
 
 	hamMenu.AddAction("Rename Playlist", func() { spawnRenameDialog(parent) })
 	hamMenu.AddAction("Save Playlist", parent.SaveCurrentPlaylist)
 	hamMenu.AddAction("Sort Selected Tracks", parent.SortSelectedTracks)
+	hamMenu.AddAction("Sort Tracks...", parent.SortTracks)
+	hamMenu.AddAction("Guess Metadata from File Names", parent.EditNamePattern)
+	hamMenu.AddAction("Analyze Loudness", parent.AnalyzePlaylistLoudness)
 
 	return &PlaylistControls{
 		Revealer:  *rev,
+		AlbumView: albumView,
 		Hamburger: hamburger,
 		HamMenu:   hamMenu,
+		parent:    parent,
 	}
 }
 
+const (
+	editSmartRulesLabel   = "Edit Smart Rules"
+	editFolderSourceLabel = "Edit Folder Settings"
+)
+
+// SetSmart shows or hides the actions specific to smart playlists.
+func (c *PlaylistControls) SetSmart(smart bool) {
+	c.smart = c.toggleAction(editSmartRulesLabel, c.parent.EditSmartRules, c.smart, smart)
+}
+
+// SetFolder shows or hides the actions specific to folder playlists.
+func (c *PlaylistControls) SetFolder(folder bool) {
+	c.folder = c.toggleAction(editFolderSourceLabel, c.parent.EditFolderSource, c.folder, folder)
+}
+
+// toggleAction adds or removes the menu action with the given label if shown
+// differs from the current state. It returns the new state.
+func (c *PlaylistControls) toggleAction(label string, fn func(), current, shown bool) bool {
+	if current == shown {
+		return current
+	}
+
+	if shown {
+		c.HamMenu.AddAction(label, fn)
+	} else {
+		c.HamMenu.RemoveAction(label)
+	}
+
+	return shown
+}
+
 const nameCollideMsg = "Playlist already exists with the same name."
 
 func spawnRenameDialog(parent ParentPlaylistController) {
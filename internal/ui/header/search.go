@@ -0,0 +1,220 @@
+package header
+
+import (
+	"fmt"
+	"html"
+
+	"github.com/diamondburned/aqours/internal/durafmt"
+	"github.com/diamondburned/aqours/internal/muse/query"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+)
+
+// searchLimit is the maximum number of results shown per playlist.
+const searchLimit = 50
+
+var searchCSS = css.PrepareClass("search", `
+	.search {
+		margin: 4px;
+	}
+	.search list {
+		background: none;
+	}
+	.search list > row {
+		padding: 2px 4px;
+	}
+	.search .search-header {
+		margin-top: 6px;
+	}
+	.search .search-error {
+		color: @error_color;
+	}
+`)
+
+// searchEntry is an entry in the search results. Headers have a nil playlist.
+type searchEntry struct {
+	playlist *state.Playlist
+	index    int
+}
+
+// Search is a button with a popover that searches all tracks.
+type Search struct {
+	*gtk.MenuButton
+	parent ParentController
+
+	Popover *gtk.Popover
+	Entry   *gtk.SearchEntry
+	Error   *gtk.Label
+	List    *gtk.ListBox
+
+	rows    []*gtk.ListBoxRow
+	entries []searchEntry
+}
+
+func NewSearch(parent ParentController) *Search {
+	s := &Search{parent: parent}
+
+	s.Entry = gtk.NewSearchEntry()
+	s.Entry.SetHExpand(true)
+	s.Entry.SetObjectProperty("placeholder-text", "artist:aqours year:2016.. length:>5m")
+	s.Entry.ConnectSearchChanged(s.search)
+	s.Entry.ConnectActivate(func() { s.activate(0) })
+
+	s.Error = gtk.NewLabel("")
+	s.Error.SetXAlign(0)
+	s.Error.SetWrap(true)
+	s.Error.AddCSSClass("search-error")
+	s.Error.SetVisible(false)
+
+	s.List = gtk.NewListBox()
+	s.List.SetSelectionMode(gtk.SelectionBrowse)
+	s.List.SetActivateOnSingleClick(true)
+	s.List.ConnectRowActivated(func(row *gtk.ListBoxRow) { s.activate(row.Index()) })
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetSizeRequest(450, 400)
+	scroll.SetVExpand(true)
+	scroll.SetChild(s.List)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 4)
+	box.Append(s.Entry)
+	box.Append(s.Error)
+	box.Append(scroll)
+	searchCSS(box)
+
+	s.Popover = gtk.NewPopover()
+	s.Popover.SetChild(box)
+	s.Popover.ConnectShow(func() { s.Entry.GrabFocus() })
+
+	s.MenuButton = gtk.NewMenuButton()
+	s.MenuButton.SetIconName("edit-find-symbolic")
+	s.MenuButton.SetTooltipText("Search (Ctrl+F)")
+	s.MenuButton.SetPopover(s.Popover)
+
+	return s
+}
+
+// Popup shows the search popover.
+func (s *Search) Popup() {
+	s.MenuButton.Popup()
+}
+
+func (s *Search) clear() {
+	for _, row := range s.rows {
+		s.List.Remove(row)
+	}
+	s.rows = nil
+	s.entries = nil
+}
+
+func (s *Search) search() {
+	s.clear()
+
+	q, err := query.Parse(s.Entry.Text())
+	if err != nil {
+		s.Error.SetText(err.Error())
+		s.Error.SetVisible(true)
+		return
+	}
+
+	s.Error.SetVisible(false)
+
+	if q.IsEmpty() {
+		return
+	}
+
+	for _, result := range s.parent.SearchTracks(q, searchLimit) {
+		s.appendHeader(result)
+		for _, ix := range result.Indices {
+			s.appendTrack(result.Playlist, ix)
+		}
+	}
+}
+
+func (s *Search) append(row *gtk.ListBoxRow, entry searchEntry) {
+	s.List.Append(row)
+	s.rows = append(s.rows, row)
+	s.entries = append(s.entries, entry)
+}
+
+func (s *Search) appendHeader(result state.SearchResult) {
+	markup := "<b>" + html.EscapeString(result.Playlist.Name) + "</b>"
+	if result.Omitted > 0 {
+		markup += fmt.Sprintf(` <span size="small">(%d more)</span>`, result.Omitted)
+	}
+
+	label := gtk.NewLabel("")
+	label.SetMarkup(markup)
+	label.SetXAlign(0)
+	label.AddCSSClass("search-header")
+
+	row := gtk.NewListBoxRow()
+	row.SetChild(label)
+	row.SetActivatable(false)
+	row.SetSelectable(false)
+
+	s.append(row, searchEntry{})
+}
+
+func (s *Search) appendTrack(pl *state.Playlist, ix int) {
+	track := pl.Tracks[ix]
+	md := track.Metadata()
+
+	title := gtk.NewLabel(md.Title)
+	title.SetXAlign(0)
+	title.SetEllipsize(pango.EllipsizeEnd)
+
+	info := gtk.NewLabel(md.Artist + " — " + md.Album)
+	info.SetXAlign(0)
+	info.SetEllipsize(pango.EllipsizeEnd)
+	info.AddCSSClass("dim-label")
+
+	labels := gtk.NewBox(gtk.OrientationVertical, 0)
+	labels.SetHExpand(true)
+	labels.Append(title)
+	labels.Append(info)
+
+	length := gtk.NewLabel(durafmt.Format(md.Length))
+	length.AddCSSClass("dim-label")
+
+	reveal := gtk.NewButtonFromIconName("find-location-symbolic")
+	reveal.SetTooltipText("Reveal in " + pl.Name)
+	reveal.SetHasFrame(false)
+	reveal.ConnectClicked(func() {
+		s.Popover.Popdown()
+		s.parent.RevealTrack(pl, ix)
+	})
+
+	enqueue := gtk.NewButtonFromIconName("list-add-symbolic")
+	enqueue.SetTooltipText("Add to Queue")
+	enqueue.SetHasFrame(false)
+	enqueue.ConnectClicked(func() {
+		s.parent.Enqueue([]*state.Track{track})
+	})
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	box.Append(labels)
+	box.Append(length)
+	box.Append(enqueue)
+	box.Append(reveal)
+
+	row := gtk.NewListBoxRow()
+	row.SetChild(box)
+	row.SetTooltipText(md.Filepath)
+
+	s.append(row, searchEntry{playlist: pl, index: ix})
+}
+
+// activate plays the first track result starting from the given row index.
+func (s *Search) activate(from int) {
+	for i := from; i < len(s.entries); i++ {
+		if entry := s.entries[i]; entry.playlist != nil {
+			s.Popover.Popdown()
+			s.parent.PlayTrack(entry.playlist, entry.index)
+			return
+		}
+	}
+}
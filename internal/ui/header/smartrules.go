@@ -0,0 +1,435 @@
+package header
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/muse/playlist/smart"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+var smartRulesCSS = css.PrepareClass("smart-rules", `
+	.smart-rules {
+		margin: 8px;
+	}
+`)
+
+var fieldNames = map[smart.Field]string{
+	smart.FieldTitle:  "Title",
+	smart.FieldArtist: "Artist",
+	smart.FieldAlbum:  "Album",
+	smart.FieldGenre:  "Genre",
+	smart.FieldDate:   "Date",
+}
+
+var opNames = map[smart.Op]string{
+	smart.OpIs:          "is",
+	smart.OpIsNot:       "is not",
+	smart.OpContains:    "contains",
+	smart.OpNotContains: "does not contain",
+	smart.OpStartsWith:  "starts with",
+}
+
+var sortFieldNames = map[smart.SortField]string{
+	smart.SortTitle:      "Title",
+	smart.SortArtist:     "Artist",
+	smart.SortAlbum:      "Album",
+	smart.SortGenre:      "Genre",
+	smart.SortDate:       "Date",
+	smart.SortNumber:     "Track Number",
+	smart.SortLength:     "Length",
+	smart.SortPlayCount:  "Play Count",
+	smart.SortLastPlayed: "Last Played",
+}
+
+// rulesEditor is a widget that edits smart playlist rules.
+type rulesEditor struct {
+	*gtk.Box
+	matchAny *gtk.ComboBoxText
+
+	fieldBox *gtk.Box
+	fields   []*fieldRuleRow
+
+	lengthMin *gtk.Entry
+	lengthMax *gtk.Entry
+	countMin  *gtk.Entry
+	countMax  *gtk.Entry
+	within    *gtk.Entry
+	notWithin *gtk.Entry
+
+	sortField *gtk.ComboBoxText
+	sortDesc  *gtk.CheckButton
+	limit     *gtk.SpinButton
+
+	// extraSort keeps the sort keys that the editor doesn't show.
+	extraSort []smart.SortKey
+}
+
+type fieldRuleRow struct {
+	*gtk.Box
+	field *gtk.ComboBoxText
+	op    *gtk.ComboBoxText
+	value *gtk.Entry
+}
+
+func newRulesEditor(rules *smart.Rules) *rulesEditor {
+	e := &rulesEditor{}
+
+	e.matchAny = gtk.NewComboBoxText()
+	e.matchAny.Append("all", "Match all conditions")
+	e.matchAny.Append("any", "Match any condition")
+
+	e.fieldBox = gtk.NewBox(gtk.OrientationVertical, 4)
+
+	addField := gtk.NewButtonWithLabel("Add Condition")
+	addField.SetHAlign(gtk.AlignStart)
+	addField.ConnectClicked(func() {
+		e.addFieldRule(smart.FieldRule{Field: smart.FieldArtist, Op: smart.OpContains})
+	})
+
+	e.lengthMin = newRuleEntry("3m")
+	e.lengthMax = newRuleEntry("10m")
+	e.countMin = newRuleEntry("0")
+	e.countMax = newRuleEntry("0")
+	e.within = newRuleEntry("168h")
+	e.notWithin = newRuleEntry("720h")
+
+	e.sortField = gtk.NewComboBoxText()
+	e.sortField.Append("", "Path")
+	for _, field := range smart.SortFields {
+		e.sortField.Append(string(field), sortFieldNames[field])
+	}
+
+	e.sortDesc = gtk.NewCheckButtonWithLabel("Descending")
+
+	e.limit = gtk.NewSpinButtonWithRange(0, 100000, 1)
+	e.limit.SetTooltipText("0 means no limit")
+
+	grid := gtk.NewGrid()
+	grid.SetRowSpacing(4)
+	grid.SetColumnSpacing(8)
+
+	row := 0
+	attachRow := func(label string, widgets ...gtk.Widgetter) {
+		l := gtk.NewLabel(label)
+		l.SetXAlign(0)
+		grid.Attach(l, 0, row, 1, 1)
+
+		for i, w := range widgets {
+			grid.Attach(w, i+1, row, 1, 1)
+		}
+
+		row++
+	}
+
+	attachRow("Length", e.lengthMin, e.lengthMax)
+	attachRow("Play Count", e.countMin, e.countMax)
+	attachRow("Last Played", e.within, e.notWithin)
+	attachRow("Sort By", e.sortField, e.sortDesc)
+	attachRow("Limit", e.limit)
+
+	hint := gtk.NewLabel("Ranges are minimum and maximum. Last played is " +
+		"within and not within. Empty fields are ignored.")
+	hint.SetWrap(true)
+	hint.SetXAlign(0)
+	hint.AddCSSClass("dim-label")
+
+	e.Box = gtk.NewBox(gtk.OrientationVertical, 8)
+	e.Box.Append(e.matchAny)
+	e.Box.Append(e.fieldBox)
+	e.Box.Append(addField)
+	e.Box.Append(gtk.NewSeparator(gtk.OrientationHorizontal))
+	e.Box.Append(grid)
+	e.Box.Append(hint)
+	smartRulesCSS(e.Box)
+
+	e.setRules(rules)
+
+	return e
+}
+
+func newRuleEntry(placeholder string) *gtk.Entry {
+	entry := gtk.NewEntry()
+	entry.SetPlaceholderText(placeholder)
+	entry.SetWidthChars(8)
+	return entry
+}
+
+func (e *rulesEditor) setRules(rules *smart.Rules) {
+	if rules.MatchAny {
+		e.matchAny.SetActiveID("any")
+	} else {
+		e.matchAny.SetActiveID("all")
+	}
+
+	for _, field := range rules.Fields {
+		e.addFieldRule(field)
+	}
+
+	if rules.Length != nil {
+		setDurationEntry(e.lengthMin, rules.Length.Min)
+		setDurationEntry(e.lengthMax, rules.Length.Max)
+	}
+
+	if rules.PlayCount != nil {
+		setIntEntry(e.countMin, rules.PlayCount.Min)
+		setIntEntry(e.countMax, rules.PlayCount.Max)
+	}
+
+	if rules.LastPlayed != nil {
+		setDurationEntry(e.within, rules.LastPlayed.Within)
+		setDurationEntry(e.notWithin, rules.LastPlayed.NotWithin)
+	}
+
+	e.sortField.SetActiveID("")
+
+	if len(rules.Sort) > 0 {
+		e.sortField.SetActiveID(string(rules.Sort[0].Field))
+		e.sortDesc.SetActive(rules.Sort[0].Descending)
+		e.extraSort = rules.Sort[1:]
+	}
+
+	e.limit.SetValue(float64(rules.Limit))
+}
+
+func (e *rulesEditor) addFieldRule(rule smart.FieldRule) {
+	row := &fieldRuleRow{}
+
+	row.field = gtk.NewComboBoxText()
+	for _, field := range smart.Fields {
+		row.field.Append(string(field), fieldNames[field])
+	}
+	row.field.SetActiveID(string(rule.Field))
+
+	row.op = gtk.NewComboBoxText()
+	for _, op := range smart.Ops {
+		row.op.Append(string(op), opNames[op])
+	}
+	row.op.SetActiveID(string(rule.Op))
+
+	row.value = gtk.NewEntry()
+	row.value.SetText(rule.Value)
+	row.value.SetHExpand(true)
+
+	remove := gtk.NewButtonFromIconName("list-remove-symbolic")
+	remove.SetTooltipText("Remove Condition")
+	remove.ConnectClicked(func() {
+		for i, r := range e.fields {
+			if r == row {
+				e.fields = append(e.fields[:i], e.fields[i+1:]...)
+				break
+			}
+		}
+		e.fieldBox.Remove(row)
+	})
+
+	row.Box = gtk.NewBox(gtk.OrientationHorizontal, 4)
+	row.Box.Append(row.field)
+	row.Box.Append(row.op)
+	row.Box.Append(row.value)
+	row.Box.Append(remove)
+
+	e.fieldBox.Append(row)
+	e.fields = append(e.fields, row)
+}
+
+// rules returns the edited rules. It returns false if any of the fields are
+// invalid, in which case the invalid fields are marked.
+func (e *rulesEditor) rules() (*smart.Rules, bool) {
+	rules := &smart.Rules{
+		MatchAny: e.matchAny.ActiveID() == "any",
+		Limit:    e.limit.ValueAsInt(),
+	}
+
+	for _, row := range e.fields {
+		rules.Fields = append(rules.Fields, smart.FieldRule{
+			Field: smart.Field(row.field.ActiveID()),
+			Op:    smart.Op(row.op.ActiveID()),
+			Value: row.value.Text(),
+		})
+	}
+
+	ok := true
+	checkDuration := func(entry *gtk.Entry) smart.Duration {
+		d, valid := parseDurationEntry(entry)
+		ok = ok && valid
+		return d
+	}
+	checkInt := func(entry *gtk.Entry) *int {
+		i, valid := parseIntEntry(entry)
+		ok = ok && valid
+		return i
+	}
+
+	length := smart.DurationRange{
+		Min: checkDuration(e.lengthMin),
+		Max: checkDuration(e.lengthMax),
+	}
+	if length != (smart.DurationRange{}) {
+		rules.Length = &length
+	}
+
+	count := smart.PlayCountRange{
+		Min: checkInt(e.countMin),
+		Max: checkInt(e.countMax),
+	}
+	if count.Min != nil || count.Max != nil {
+		rules.PlayCount = &count
+	}
+
+	lastPlayed := smart.LastPlayedRange{
+		Within:    checkDuration(e.within),
+		NotWithin: checkDuration(e.notWithin),
+	}
+	if lastPlayed != (smart.LastPlayedRange{}) {
+		rules.LastPlayed = &lastPlayed
+	}
+
+	if field := e.sortField.ActiveID(); field != "" {
+		rules.Sort = append(rules.Sort, smart.SortKey{
+			Field:      smart.SortField(field),
+			Descending: e.sortDesc.Active(),
+		})
+	}
+	rules.Sort = append(rules.Sort, e.extraSort...)
+
+	return rules, ok
+}
+
+func setDurationEntry(entry *gtk.Entry, d smart.Duration) {
+	if d > 0 {
+		entry.SetText(time.Duration(d).String())
+	}
+}
+
+func setIntEntry(entry *gtk.Entry, i *int) {
+	if i != nil {
+		entry.SetText(strconv.Itoa(*i))
+	}
+}
+
+func parseDurationEntry(entry *gtk.Entry) (smart.Duration, bool) {
+	text := strings.TrimSpace(entry.Text())
+	if text == "" {
+		markEntryError(entry, "")
+		return 0, true
+	}
+
+	d, err := time.ParseDuration(text)
+	if err != nil || d < 0 {
+		markEntryError(entry, "Invalid duration, such as 3m30s.")
+		return 0, false
+	}
+
+	markEntryError(entry, "")
+	return smart.Duration(d), true
+}
+
+func parseIntEntry(entry *gtk.Entry) (*int, bool) {
+	text := strings.TrimSpace(entry.Text())
+	if text == "" {
+		markEntryError(entry, "")
+		return nil, true
+	}
+
+	i, err := strconv.Atoi(text)
+	if err != nil || i < 0 {
+		markEntryError(entry, "Invalid number.")
+		return nil, false
+	}
+
+	markEntryError(entry, "")
+	return &i, true
+}
+
+// markEntryError shows the given error on the entry. The error is cleared if
+// it's empty.
+func markEntryError(entry *gtk.Entry, err string) {
+	if err == "" {
+		entry.SetIconFromIconName(gtk.EntryIconSecondary, "")
+		return
+	}
+
+	entry.SetIconFromIconName(gtk.EntryIconSecondary, "dialog-error-symbolic")
+	entry.SetIconTooltipText(gtk.EntryIconSecondary, err)
+}
+
+// spawnSmartPlaylistDialog spawns a dialog for creating a new smart playlist.
+func spawnSmartPlaylistDialog(parent ParentController) {
+	window := gtkutil.ActiveWindow()
+	dialog := gtk.NewDialogWithFlags(
+		"New Smart Playlist", window, gtk.DialogModal|gtk.DialogUseHeaderBar)
+
+	dialog.AddButton("Create", int(gtk.ResponseApply))
+	dialog.SetResponseSensitive(int(gtk.ResponseApply), false)
+
+	entry := gtk.NewEntry()
+	entry.SetPlaceholderText("New Smart Playlist")
+	entry.Connect("changed", func() {
+		t := entry.Text()
+		if t == "" || parent.HasPlaylist(t) {
+			dialog.SetResponseSensitive(int(gtk.ResponseApply), false)
+			markEntryError(entry, nameCollideMsg)
+		} else {
+			dialog.SetResponseSensitive(int(gtk.ResponseApply), true)
+			markEntryError(entry, "")
+		}
+	})
+	renameEntryCSS(entry)
+
+	editor := newRulesEditor(&smart.Rules{})
+
+	c := dialog.ContentArea()
+	c.Append(entry)
+	c.Append(editor)
+
+	dialog.ConnectResponse(func(res int) {
+		if res != int(gtk.ResponseApply) {
+			dialog.Destroy()
+			return
+		}
+
+		rules, ok := editor.rules()
+		if !ok {
+			return
+		}
+
+		dialog.Destroy()
+		parent.AddSmartPlaylist(entry.Text(), rules)
+	})
+	dialog.Show()
+}
+
+// spawnRulesDialog spawns a dialog for editing the rules of an existing smart
+// playlist.
+func spawnRulesDialog(name string, rules *smart.Rules, done func(*smart.Rules)) {
+	window := gtkutil.ActiveWindow()
+	dialog := gtk.NewDialogWithFlags(
+		"Edit "+name, window, gtk.DialogModal|gtk.DialogUseHeaderBar)
+
+	dialog.AddButton("Save", int(gtk.ResponseApply))
+
+	editor := newRulesEditor(rules)
+
+	c := dialog.ContentArea()
+	c.Append(editor)
+
+	dialog.ConnectResponse(func(res int) {
+		if res != int(gtk.ResponseApply) {
+			dialog.Destroy()
+			return
+		}
+
+		rules, ok := editor.rules()
+		if !ok {
+			return
+		}
+
+		dialog.Destroy()
+		done(rules)
+	})
+	dialog.Show()
+}
@@ -0,0 +1,144 @@
+package ui
+
+import (
+	"context"
+
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/state/prober"
+)
+
+// SelectLibrary shows the library.
+func (w *MainWindow) SelectLibrary() {
+	w.Header.SetPlaylist(nil)
+	w.Window.SetTitle(state.LibraryName + " - Aqours")
+	w.refreshLibrary(true)
+}
+
+// refreshLibrary rebuilds the library index if any track has changed since the
+// last refresh or if force is true.
+func (w *MainWindow) refreshLibrary(force bool) {
+	gen := w.state.Generation()
+	if !force && gen == w.libraryGen {
+		return
+	}
+
+	w.libraryGen = gen
+
+	lib := w.state.Library()
+	w.Body.Library.SetIndex(lib, w.state.LibraryIndex())
+	w.Body.Sidebar.LibraryRow.SetTotal(len(lib.Tracks))
+}
+
+// PlayLibraryTrack plays the library track with the given index.
+func (w *MainWindow) PlayLibraryTrack(index int) {
+	w.PlayTrack(w.state.Library(), index)
+}
+
+// LibraryRoots returns the root directories of the library.
+func (w *MainWindow) LibraryRoots() []string {
+	return w.state.LibraryRoots()
+}
+
+// SetLibraryRoots sets the root directories of the library and rescans it.
+func (w *MainWindow) SetLibraryRoots(roots []string) {
+	w.state.SetLibraryRoots(roots)
+	w.watchPlaylist(w.state.Library(), true)
+	w.state.SaveState()
+}
+
+// LibraryNamePattern returns the name pattern of the given library root.
+func (w *MainWindow) LibraryNamePattern(root string) string {
+	return w.state.LibraryNamePattern(root)
+}
+
+// SetLibraryNamePattern sets the name pattern of the given library root and
+// probes the tracks in it again.
+func (w *MainWindow) SetLibraryNamePattern(root, pattern string) {
+	w.state.SetLibraryNamePattern(root, pattern)
+
+	var tracks []*state.Track
+	for _, track := range w.state.Library().Tracks {
+		if r, ok := w.state.LibraryRootOf(track.Filepath); ok && r == root {
+			tracks = append(tracks, track)
+		}
+	}
+
+	w.reprobeTracks(tracks)
+	w.state.SaveState()
+}
+
+// LibraryPaths returns the paths of the library tracks in the given root.
+// At most limit paths are returned.
+func (w *MainWindow) LibraryPaths(root string, limit int) []string {
+	var paths []string
+	for _, track := range w.state.Library().Tracks {
+		if len(paths) == limit {
+			break
+		}
+		if r, ok := w.state.LibraryRootOf(track.Filepath); ok && r == root {
+			paths = append(paths, track.Filepath)
+		}
+	}
+	return paths
+}
+
+// EditablePlaylists returns the names of the playlists that tracks can be added
+// to.
+func (w *MainWindow) EditablePlaylists() []string {
+	var names []string
+
+	for _, name := range w.state.PlaylistNames() {
+		pl, _ := w.state.Playlist(name)
+		if !pl.IsReadOnly() {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// AddTracksToPlaylist appends the given tracks to the playlist with the given
+// name.
+func (w *MainWindow) AddTracksToPlaylist(name string, tracks []playlist.Track) {
+	pl, ok := w.state.Playlist(name)
+	if !ok || pl.IsReadOnly() {
+		return
+	}
+
+	if trackList, ok := w.Body.TracksView.Lists[name]; ok {
+		trackList.AppendTracks(tracks)
+	} else {
+		pl.AddTracks(len(pl.Tracks)-1, false, tracks...)
+		w.UpdateTracks(pl)
+	}
+
+	if uiPl := w.Body.Sidebar.PlaylistList.Playlist(name); uiPl != nil {
+		uiPl.SetTotal(len(pl.Tracks))
+	}
+}
+
+// probeTracks probes the given tracks that aren't probed yet or whose files
+// have changed. It is used for tracks that aren't shown in any track list,
+// which would otherwise probe them.
+func (w *MainWindow) probeTracks(tracks []*state.Track) {
+	jobs := make([]prober.Job, len(tracks))
+	for i, track := range tracks {
+		jobs[i] = prober.NewJob(track, func() {})
+	}
+
+	prober.Queue(context.Background(), prober.PriorityBackground, jobs...)
+}
+
+// reprobeTracks probes the given tracks again even if they're already probed,
+// such as after their name pattern is changed.
+func (w *MainWindow) reprobeTracks(tracks []*state.Track) {
+	jobs := make([]prober.Job, len(tracks))
+	for i, track := range tracks {
+		track := track
+		jobs[i] = prober.NewJob(track, func() { w.Body.TracksView.RefreshRow(track) })
+		jobs[i].Force = true
+	}
+
+	prober.Queue(context.Background(), prober.PriorityBackground, jobs...)
+}
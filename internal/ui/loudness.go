@@ -0,0 +1,30 @@
+package ui
+
+import (
+	"context"
+
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/state/prober"
+	"github.com/diamondburned/aqours/internal/ui/replaygain"
+)
+
+// AnalyzeLoudness spawns a dialog that measures the loudness of the given
+// tracks to find their ReplayGain. The tracks whose files get ReplayGain tags
+// are probed again.
+func (w *MainWindow) AnalyzeLoudness(tracks []*state.Track) {
+	replaygain.SpawnDialog(tracks, func(scanned, written []*state.Track) {
+		for _, track := range scanned {
+			w.RefreshTrack(track)
+		}
+
+		jobs := make([]prober.Job, len(written))
+		for i, track := range written {
+			track := track
+			jobs[i] = prober.NewJob(track, func() { w.RefreshTrack(track) })
+			jobs[i].Force = true
+		}
+
+		prober.Queue(context.Background(), prober.PriorityBackground, jobs...)
+		w.state.SaveState()
+	})
+}
@@ -0,0 +1,185 @@
+// Package namepattern is the dialog that edits the patterns which guess the
+// metadata of untagged files from their paths.
+package namepattern
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/muse/metadata/pathguess"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+)
+
+var dialogCSS = css.PrepareClass("name-pattern", `
+	.name-pattern {
+		margin: 8px;
+	}
+`)
+
+// MaxPreview is the maximum number of paths in the preview.
+const MaxPreview = 50
+
+const placeholder = "%artist%/%album%/%number% - %title%"
+
+const (
+	columnFile = iota
+	columnTitle
+	columnArtist
+	columnAlbum
+	columnNumber
+)
+
+// SpawnDialog spawns a dialog that edits the name pattern of the given name,
+// such as a playlist or a library folder. The metadata guessed from the given
+// paths is previewed. save is called with the new pattern, which is empty if
+// the pattern is removed.
+func SpawnDialog(name, pattern string, paths []string, save func(pattern string)) {
+	dialog := gtk.NewDialogWithFlags(
+		"File Name Pattern for "+name, gtkutil.ActiveWindow(),
+		gtk.DialogModal|gtk.DialogUseHeaderBar,
+	)
+	dialog.SetDefaultSize(600, 400)
+
+	if pattern != "" {
+		dialog.AddButton("Remove", int(gtk.ResponseReject))
+	}
+	dialog.AddButton("Save", int(gtk.ResponseApply))
+
+	if len(paths) > MaxPreview {
+		paths = paths[:MaxPreview]
+	}
+
+	store := gtk.NewListStore([]glib.Type{
+		glib.TypeString, // columnFile
+		glib.TypeString, // columnTitle
+		glib.TypeString, // columnArtist
+		glib.TypeString, // columnAlbum
+		glib.TypeString, // columnNumber
+	})
+
+	iters := make([]*gtk.TreeIter, len(paths))
+	for i, path := range paths {
+		iters[i] = store.Append()
+		store.SetValue(iters[i], columnFile, glib.NewValue(shortPath(path)))
+	}
+
+	tree := gtk.NewTreeViewWithModel(store)
+	tree.AppendColumn(newColumn("File", columnFile))
+	tree.AppendColumn(newColumn("Title", columnTitle))
+	tree.AppendColumn(newColumn("Artist", columnArtist))
+	tree.AppendColumn(newColumn("Album", columnAlbum))
+	tree.AppendColumn(newColumn("#", columnNumber))
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetVExpand(true)
+	scroll.SetChild(tree)
+
+	fields := make([]string, len(pathguess.Fields))
+	for i, field := range pathguess.Fields {
+		fields[i] = "%" + field + "%"
+	}
+
+	help := gtk.NewLabel("Fields: " + strings.Join(fields, " "))
+	help.SetXAlign(0)
+	help.SetWrap(true)
+	help.AddCSSClass("dim-label")
+
+	entry := gtk.NewEntry()
+	entry.SetText(pattern)
+	entry.SetPlaceholderText(placeholder)
+
+	update := func() {
+		text := strings.TrimSpace(entry.Text())
+
+		var p *pathguess.Pattern
+		if text != "" {
+			var err error
+			p, err = pathguess.Parse(text)
+			if err != nil {
+				entry.SetIconFromIconName(gtk.EntryIconSecondary, "dialog-error-symbolic")
+				entry.SetIconTooltipText(gtk.EntryIconSecondary, err.Error())
+				dialog.SetResponseSensitive(int(gtk.ResponseApply), false)
+				return
+			}
+		}
+
+		entry.SetIconFromIconName(gtk.EntryIconSecondary, "")
+		dialog.SetResponseSensitive(int(gtk.ResponseApply), true)
+
+		for i, path := range paths {
+			var g pathguess.Guess
+			if p != nil {
+				g, _ = p.Guess(path)
+			}
+
+			var number string
+			if g.Number > 0 {
+				number = strconv.Itoa(g.Number)
+			}
+
+			store.Set(
+				iters[i],
+				[]int{columnTitle, columnArtist, columnAlbum, columnNumber},
+				[]glib.Value{
+					*glib.NewValue(g.Title),
+					*glib.NewValue(g.Artist),
+					*glib.NewValue(g.Album),
+					*glib.NewValue(number),
+				},
+			)
+		}
+	}
+
+	entry.Connect("changed", update)
+	update()
+
+	box := gtk.NewBox(gtk.OrientationVertical, 6)
+	box.Append(entry)
+	box.Append(help)
+	box.Append(scroll)
+	dialogCSS(box)
+
+	dialog.ContentArea().Append(box)
+
+	dialog.ConnectResponse(func(res int) {
+		defer dialog.Destroy()
+
+		switch res {
+		case int(gtk.ResponseApply):
+			save(strings.TrimSpace(entry.Text()))
+		case int(gtk.ResponseReject):
+			save("")
+		}
+	})
+	dialog.Show()
+}
+
+func newColumn(title string, col int) *gtk.TreeViewColumn {
+	r := gtk.NewCellRendererText()
+	r.SetObjectProperty("ellipsize", pango.EllipsizeStart)
+
+	c := gtk.NewTreeViewColumn()
+	c.SetTitle(title)
+	c.PackStart(r, true)
+	c.AddAttribute(r, "text", col)
+	c.SetResizable(true)
+	c.SetExpand(col != columnNumber)
+
+	return c
+}
+
+// shortPath returns the last three parts of the path, which are usually enough
+// to see the structure of the folders.
+func shortPath(path string) string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(parts) > 3 {
+		parts = parts[len(parts)-3:]
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,238 @@
+// Package replaygain is the dialog that measures the loudness of tracks and
+// stores their ReplayGain.
+package replaygain
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/diamondburned/aqours/internal/gtkutil"
+	"github.com/diamondburned/aqours/internal/muse/metadata/loudness"
+	"github.com/diamondburned/aqours/internal/muse/metadata/tagedit"
+	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/state"
+	"github.com/diamondburned/aqours/internal/ui/css"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+var dialogCSS = css.PrepareClass("replaygain", `
+	.replaygain {
+		margin: 8px;
+	}
+`)
+
+// SpawnDialog spawns a dialog that measures the loudness of the given tracks,
+// which are grouped into albums by their metadata. The ReplayGain of the
+// measured tracks is then stored in the state, and it's also written to their
+// files if the user chooses to. done is called with the tracks whose
+// ReplayGain was stored and the tracks whose files were written, which should
+// be probed again.
+//
+// The analysis runs in the background, and closing the dialog cancels it.
+func SpawnDialog(tracks []*state.Track, done func(scanned, written []*state.Track)) {
+	albums := groupAlbums(tracks)
+
+	var total int
+	for _, album := range albums {
+		total += len(album)
+	}
+
+	dialog := gtk.NewDialogWithFlags(
+		"Analyze Loudness", gtkutil.ActiveWindow(), gtk.DialogUseHeaderBar,
+	)
+	dialog.SetDefaultSize(400, -1)
+	dialog.AddButton("Analyze", int(gtk.ResponseApply))
+
+	info := gtk.NewLabel(fmt.Sprintf("%d tracks in %d albums", total, len(albums)))
+	info.SetXAlign(0)
+
+	write := gtk.NewCheckButtonWithLabel("Write ReplayGain tags to the files")
+
+	help := gtk.NewLabel("Files that already have ReplayGain tags keep using them unless the tags are written.")
+	help.SetXAlign(0)
+	help.SetWrap(true)
+	help.AddCSSClass("dim-label")
+
+	progress := gtk.NewProgressBar()
+	progress.SetShowText(true)
+	progress.SetText(fmt.Sprintf("0 of %d tracks", total))
+
+	box := gtk.NewBox(gtk.OrientationVertical, 6)
+	box.Append(info)
+	box.Append(write)
+	box.Append(help)
+	box.Append(progress)
+	dialogCSS(box)
+
+	dialog.ContentArea().Append(box)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// finish applies the results. Widgets are only touched if the dialog is
+	// still open, which is when the context isn't cancelled.
+	finish := func(results [][]loudness.Result, written [][]bool) {
+		var scanned, writtenTracks []*state.Track
+		var failed int
+
+		for i, album := range albums {
+			for j, track := range album {
+				r := results[i][j]
+				if r.Err != nil {
+					log.Printf("failed to measure loudness of %q: %v", r.Path, r.Err)
+					failed++
+					continue
+				}
+
+				track.SetScannedGain(&playlist.ReplayGain{
+					TrackGain: r.TrackGain,
+					TrackPeak: r.TrackPeak,
+					AlbumGain: r.AlbumGain,
+					AlbumPeak: r.AlbumPeak,
+				})
+				scanned = append(scanned, track)
+
+				if written[i][j] {
+					writtenTracks = append(writtenTracks, track)
+				}
+			}
+		}
+
+		done(scanned, writtenTracks)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		text := fmt.Sprintf("Analyzed %d tracks", len(scanned))
+		if failed > 0 {
+			text += fmt.Sprintf(", %d failed", failed)
+		}
+
+		progress.SetFraction(1)
+		progress.SetText(text)
+	}
+
+	dialog.ConnectResponse(func(res int) {
+		if res != int(gtk.ResponseApply) {
+			cancel()
+			dialog.Destroy()
+			return
+		}
+
+		dialog.SetResponseSensitive(int(gtk.ResponseApply), false)
+		write.SetSensitive(false)
+
+		writeTags := write.Active()
+
+		go func() {
+			results, written, err := analyze(ctx, albums, writeTags, func(n int) {
+				glib.IdleAdd(func() {
+					if ctx.Err() == nil {
+						progress.SetFraction(float64(n) / float64(total))
+						progress.SetText(fmt.Sprintf("%d of %d tracks", n, total))
+					}
+				})
+			})
+			if err != nil {
+				return
+			}
+
+			glib.IdleAdd(func() { finish(results, written) })
+		}()
+	})
+	dialog.Show()
+}
+
+// analyze measures the albums and writes their tags if writeTags is true. The
+// results are returned along with whether the file of each track was written.
+// An error is returned if the context is cancelled before the albums are
+// measured. If it's cancelled while the tags are written, then the remaining
+// files are left alone.
+func analyze(ctx context.Context, albums [][]*state.Track, writeTags bool, progress func(n int)) ([][]loudness.Result, [][]bool, error) {
+	paths := make([][]string, len(albums))
+	written := make([][]bool, len(albums))
+
+	for i, album := range albums {
+		paths[i] = make([]string, len(album))
+		written[i] = make([]bool, len(album))
+
+		for j, track := range album {
+			paths[i][j] = track.Filepath
+		}
+	}
+
+	results, err := loudness.Analyze(ctx, paths, progress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if writeTags {
+	write:
+		for i, album := range results {
+			for j, r := range album {
+				if ctx.Err() != nil {
+					break write
+				}
+				if r.Err != nil {
+					continue
+				}
+
+				edit := tagedit.Edit{
+					ReplayGain: &tagedit.ReplayGain{
+						TrackGain: r.TrackGain,
+						TrackPeak: r.TrackPeak,
+						AlbumGain: r.AlbumGain,
+						AlbumPeak: r.AlbumPeak,
+					},
+				}
+
+				if err := tagedit.Write(r.Path, edit); err != nil {
+					log.Printf("failed to write ReplayGain tags to %q: %v", r.Path, err)
+					continue
+				}
+
+				written[i][j] = true
+			}
+		}
+	}
+
+	return results, written, nil
+}
+
+// groupAlbums groups the tracks into albums by their album artist and album,
+// keeping the order in which the albums first appear. Tracks that aren't in
+// an album are each in their own album. Duplicate files are dropped.
+func groupAlbums(tracks []*state.Track) [][]*state.Track {
+	var albums [][]*state.Track
+
+	seen := make(map[string]bool, len(tracks))
+	indices := make(map[[2]string]int)
+
+	for _, track := range tracks {
+		if seen[track.Filepath] {
+			continue
+		}
+		seen[track.Filepath] = true
+
+		md := track.Metadata()
+		if md.Album == "" {
+			albums = append(albums, []*state.Track{track})
+			continue
+		}
+
+		key := [2]string{md.AlbumArtistOrArtist(), md.Album}
+
+		i, ok := indices[key]
+		if !ok {
+			i = len(albums)
+			indices[key] = i
+			albums = append(albums, nil)
+		}
+
+		albums[i] = append(albums[i], track)
+	}
+
+	return albums
+}
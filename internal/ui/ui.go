@@ -1,12 +1,17 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/diamondburned/aqours/internal/muse"
 	"github.com/diamondburned/aqours/internal/muse/playlist"
+	"github.com/diamondburned/aqours/internal/muse/playlist/smart"
+	"github.com/diamondburned/aqours/internal/muse/query"
 	"github.com/diamondburned/aqours/internal/state"
 	"github.com/diamondburned/aqours/internal/ui/content"
 	"github.com/diamondburned/aqours/internal/ui/css"
@@ -53,6 +58,11 @@ type MainWindow struct {
 	muse  *muse.Session
 	state *state.State
 
+	// watchers cancels the watchers of synced playlists.
+	watchers map[*state.Playlist]context.CancelFunc
+	// libraryGen is the state generation that the library was last indexed at.
+	libraryGen uint64
+
 	lastPlayed time.Time
 	skipCount  int
 }
@@ -70,8 +80,9 @@ func NewMainWindow(
 	})
 
 	w := &MainWindow{
-		Window: window,
-		muse:   session,
+		Window:   window,
+		muse:     session,
+		watchers: make(map[*state.Playlist]context.CancelFunc),
 	}
 
 	w.Header = header.NewContainer(w)
@@ -82,16 +93,42 @@ func NewMainWindow(
 
 	w.useState(s)
 
+	// Bind Ctrl+F to the search popover before the focused widget gets it.
+	keys := gtk.NewEventControllerKey()
+	keys.SetPropagationPhase(gtk.PhaseCapture)
+	keys.ConnectKeyPressed(func(keyVal, _ uint, keyMod gdk.ModifierType) bool {
+		if keyMod&gdk.ControlMask != 0 && (keyVal == gdk.KEY_f || keyVal == gdk.KEY_F) {
+			w.Header.Left.Search.Popup()
+			return true
+		}
+		return false
+	})
+	window.AddController(keys)
+
 	// Use a low-priority 250ms poller instead of updating live.
 	glib.TimeoutAddPriority(250, glib.PriorityDefaultIdle, func() bool {
 		pos, rem := session.PlayState.PlayTime()
 		w.Bar.Controls.Seek.UpdatePosition(pos, pos+rem)
+		w.Body.Sidebar.Lyrics.UpdatePosition(pos)
 
 		w.Header.SetBitrate(session.PlayState.Bitrate())
 
 		return true
 	})
 
+	// Regenerate the smart playlists at most every second, since a track
+	// change may cause many metadata updates at once.
+	glib.TimeoutAddPriority(1000, glib.PriorityDefaultIdle, func() bool {
+		for _, pl := range w.state.RegeneratePlaylists() {
+			w.reloadPlaylist(pl)
+		}
+		// Only reindex the library if it's shown, since it may be large.
+		if w.Body.IsLibraryShown() {
+			w.refreshLibrary(false)
+		}
+		return true
+	})
+
 	return w, nil
 }
 
@@ -116,22 +153,29 @@ func (w *MainWindow) useState(s *state.State) {
 
 	// Restore the state. These calls will update the observer.
 	w.SetRepeat(w.state.RepeatMode())
+	w.SetShuffleMode(w.state.ShuffleMode())
 	w.SetShuffle(w.state.IsShuffling())
 	// These calls will update MainWindow through signals.
 	w.Bar.SetMute(w.state.IsMuted())
 	w.Bar.Volume.SetVolume(w.state.Volume())
 
+	// The library is rescanned on startup, since files may have changed while
+	// we weren't watching.
+	lib := w.state.Library()
+	w.Body.Sidebar.LibraryRow.SetTotal(len(lib.Tracks))
+	w.watchPlaylist(lib, true)
+	w.probeTracks(lib.Tracks)
+
+	w.refreshQueue()
+
 	var selected *state.Playlist
 
 	playlistNames := w.state.PlaylistNames()
-	if len(playlistNames) == 0 {
-		// First run; can't restore state.
-		return
-	}
 
 	for _, name := range playlistNames {
 		playlist, _ := w.state.Playlist(name)
 		uiPl := w.Body.Sidebar.PlaylistList.AddPlaylist(playlist)
+		w.watchPlaylist(playlist, false)
 
 		if name == w.state.PlayingPlaylistName() {
 			w.Body.Sidebar.PlaylistList.SelectPlaylist(uiPl)
@@ -139,6 +183,16 @@ func (w *MainWindow) useState(s *state.State) {
 		}
 	}
 
+	if w.state.PlayingPlaylist() == lib {
+		w.Body.SelectLibrary()
+		return
+	}
+
+	if len(playlistNames) == 0 {
+		// First run; can't restore state.
+		return
+	}
+
 	// If there's no active selection, then try the first playlist.
 	if selected == nil {
 		w.Body.Sidebar.PlaylistList.SelectFirstPlaylist()
@@ -153,9 +207,9 @@ func (w *MainWindow) useState(s *state.State) {
 	trackList := w.Body.TracksView.SelectPlaylist(selected)
 
 	// Update the playing track if we have one. NowPlaying should return a track
-	// from the given playlist.
+	// from the given playlist unless it was queued from another one.
 	_, track := w.state.NowPlaying()
-	if track != nil {
+	if track != nil && w.state.NowPlayingPlaylist() == selected {
 		trackList.SetPlaying(track)
 	}
 }
@@ -232,11 +286,74 @@ func (w *MainWindow) AddPlaylist(path string) {
 			}
 
 			playlist := w.state.AddPlaylist(p)
+			if playlist == nil {
+				return
+			}
+
 			w.Body.Sidebar.PlaylistList.AddPlaylist(playlist)
+			w.watchPlaylist(playlist, false)
 		})
 	}()
 }
 
+// AddSmartPlaylist creates a new smart playlist with the given rules.
+func (w *MainWindow) AddSmartPlaylist(name string, rules *smart.Rules) {
+	dir := filepath.Join(state.DataDir(), "playlists")
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Println("failed to make playlists directory:", err)
+		return
+	}
+
+	pl := w.state.AddPlaylist(&playlist.Playlist{
+		Name:      name,
+		Path:      smart.PathFromName(dir, name),
+		Generator: rules,
+	})
+	if pl == nil {
+		return
+	}
+
+	uiPl := w.Body.Sidebar.PlaylistList.AddPlaylist(pl)
+	w.Body.Sidebar.PlaylistList.SelectPlaylist(uiPl)
+
+	w.SavePlaylist(pl)
+}
+
+// SetSmartRules changes the rules of the given smart playlist.
+func (w *MainWindow) SetSmartRules(pl *state.Playlist, rules *smart.Rules) {
+	pl.SetGenerator(rules)
+	w.reloadPlaylist(pl)
+	w.SavePlaylist(pl)
+}
+
+// SetNamePattern sets the name pattern of the given playlist and probes its
+// tracks again.
+func (w *MainWindow) SetNamePattern(pl *state.Playlist, pattern string) {
+	pl.SetNamePattern(pattern)
+	w.reprobeTracks(pl.Tracks)
+	w.state.SaveState()
+}
+
+// reloadPlaylist reloads the track list of a playlist whose tracks were changed
+// outside of the track list.
+func (w *MainWindow) reloadPlaylist(pl *state.Playlist) {
+	if uiPl := w.Body.Sidebar.PlaylistList.Playlist(pl.Name); uiPl != nil {
+		uiPl.SetTotal(len(pl.Tracks))
+	}
+
+	w.refreshQueue()
+
+	trackList := w.Body.TracksView.ReloadPlaylist(pl)
+	if trackList == nil || w.state.NowPlayingPlaylist() != pl {
+		return
+	}
+
+	if _, track := w.state.NowPlaying(); track != nil {
+		trackList.SetPlaying(track)
+	}
+}
+
 func (w *MainWindow) HasPlaylist(name string) bool {
 	_, ok := w.state.Playlist(name)
 	return ok
@@ -319,6 +436,12 @@ func (w *MainWindow) SetShuffle(shuffle bool) {
 	w.Bar.Controls.Buttons.SetShuffle(shuffle)
 }
 
+// SetShuffleMode sets the way that the playing playlist is shuffled.
+func (w *MainWindow) SetShuffleMode(mode state.ShuffleMode) {
+	w.state.SetShuffleMode(mode)
+	w.Bar.Controls.Buttons.SetShuffleMode(mode)
+}
+
 func (w *MainWindow) SetRepeat(mode state.RepeatMode) {
 	w.state.SetRepeatMode(mode)
 	w.Bar.Controls.Buttons.SetRepeat(mode, false)
@@ -333,6 +456,52 @@ func (w *MainWindow) PlayTrack(playlist *state.Playlist, n int) {
 	w.playTrack(w.state.Play(n))
 }
 
+// PlayNext queues the given tracks to be played right after the playing track.
+func (w *MainWindow) PlayNext(tracks []*state.Track) {
+	w.state.PlayNext(tracks...)
+	w.refreshQueue()
+}
+
+// Enqueue adds the given tracks to the end of the play queue.
+func (w *MainWindow) Enqueue(tracks []*state.Track) {
+	w.state.Enqueue(tracks...)
+	w.refreshQueue()
+}
+
+// CopyTracks keeps the metadata of the given copied tracks around for pasting.
+func (w *MainWindow) CopyTracks(tracks []*state.Track) {
+	w.state.SetClipboard(tracks...)
+}
+
+// PlayQueued plays the queued track at the given position right away.
+func (w *MainWindow) PlayQueued(pos int) {
+	if track := w.state.PlayQueued(pos); track != nil {
+		w.playTrack(track)
+	}
+}
+
+// Dequeue removes the queued track at the given position.
+func (w *MainWindow) Dequeue(pos int) {
+	w.state.Dequeue(pos)
+	w.refreshQueue()
+}
+
+// MoveQueued moves the queued track at the given position to another position.
+func (w *MainWindow) MoveQueued(from, to int) {
+	w.state.MoveQueued(from, to)
+	w.refreshQueue()
+}
+
+// ClearQueue removes all queued tracks.
+func (w *MainWindow) ClearQueue() {
+	w.state.ClearQueue()
+	w.refreshQueue()
+}
+
+func (w *MainWindow) refreshQueue() {
+	w.Body.Sidebar.Queue.SetTracks(w.state.Queue())
+}
+
 func (w *MainWindow) UpdateTracks(playlist *state.Playlist) {
 	w.Header.SetUnsaved(playlist)
 	w.Body.Sidebar.PlaylistList.SetUnsaved(playlist)
@@ -342,6 +511,21 @@ func (w *MainWindow) UpdateTracks(playlist *state.Playlist) {
 	if w.state.PlayingPlaylist() == playlist {
 		w.state.RefreshQueue()
 	}
+
+	// Removed tracks are also taken out of the user queue.
+	w.refreshQueue()
+}
+
+// RefreshTrack refreshes the track lists and the now playing track after the
+// metadata of the track's file is changed.
+func (w *MainWindow) RefreshTrack(track *state.Track) {
+	w.Body.TracksView.RefreshTrack(track.Filepath)
+
+	if _, playing := w.state.NowPlaying(); playing != nil && playing.Filepath == track.Filepath {
+		w.Bar.NowPlaying.SetTrack(playing)
+		w.Body.Sidebar.AlbumArt.SetTrack(playing)
+		w.Body.Sidebar.Lyrics.SetTrack(playing)
+	}
 }
 
 func (w *MainWindow) playTrack(track *state.Track) {
@@ -350,26 +534,89 @@ func (w *MainWindow) playTrack(track *state.Track) {
 		nextPath = nextTrack.Filepath
 	}
 
+	// mpv only uses the fallback if the file has no ReplayGain tags, which is
+	// when the metadata has the scanned ReplayGain instead.
+	w.muse.SetReplayGainFallback(fallbackGain(track.Metadata()))
 	w.muse.PlayTrack(track.Filepath, nextPath)
-	playing := w.state.PlayingPlaylist()
+	track.MarkPlayed()
+
+	// The track may be queued from another playlist than the playing one.
+	playing := w.state.NowPlayingPlaylist()
+
+	// The library has no track list.
+	if trackList, ok := w.Body.TracksView.Lists[playing.Name]; ok {
+		trackList.SetPlaying(track)
+	}
 
-	trackList, ok := w.Body.TracksView.Lists[playing.Name]
-	assert(ok, "track list not found from name: "+playing.Name)
+	// The track may have been taken from the queue.
+	w.refreshQueue()
 
-	trackList.SetPlaying(track)
 	w.Bar.NowPlaying.SetTrack(track)
 	w.Body.Sidebar.AlbumArt.SetTrack(track)
+	w.Body.Sidebar.Lyrics.SetTrack(track)
 
 	// Save the state asynchronously.
 	w.state.SaveState()
 }
 
+// fallbackGain returns the album gain of the track, or its track gain if it's
+// not in an album. 0 is returned if the track has no ReplayGain.
+func fallbackGain(track playlist.Track) float64 {
+	switch rg := track.ReplayGain; {
+	case rg == nil:
+		return 0
+	case track.Album != "" && rg.AlbumGain != 0:
+		return rg.AlbumGain
+	default:
+		return rg.TrackGain
+	}
+}
+
+// SearchTracks searches the library and all playlists.
+func (w *MainWindow) SearchTracks(q *query.Query, limit int) []state.SearchResult {
+	return w.state.Search(q.Match, limit)
+}
+
+// RevealTrack shows the given track in its playlist.
+func (w *MainWindow) RevealTrack(pl *state.Playlist, index int) {
+	if pl == w.state.Library() {
+		w.Body.SelectLibrary()
+		w.Body.Library.Reveal(index)
+		return
+	}
+
+	uiPl := w.Body.Sidebar.PlaylistList.Playlist(pl.Name)
+	if uiPl == nil {
+		return
+	}
+
+	// The track is only shown in the track list.
+	w.Header.Right.AlbumView.SetActive(false)
+	w.Body.Sidebar.PlaylistList.SelectPlaylist(uiPl)
+
+	if trackList, ok := w.Body.TracksView.Lists[pl.Name]; ok {
+		trackList.SelectTrack(pl.Tracks[index])
+	}
+}
+
 // SortSelectedTracks sorts the selected tracks.
 func (w *MainWindow) SortSelectedTracks() {
 	list := w.Body.TracksView.SelectPlaylist(w.state.PlayingPlaylist())
 	list.SortSelected()
 }
 
+// SortTracks spawns a dialog that sorts the tracks of the playlist.
+func (w *MainWindow) SortTracks(pl *state.Playlist) {
+	if trackList, ok := w.Body.TracksView.Lists[pl.Name]; ok {
+		trackList.SpawnSortDialog()
+	}
+}
+
+// SetAlbumView sets whether playlists are shown as album grids.
+func (w *MainWindow) SetAlbumView(albums bool) {
+	w.Body.TracksView.SetAlbumView(albums)
+}
+
 func (w *MainWindow) SelectPlaylist(name string) {
 	pl, ok := w.state.Playlist(name)
 	if !ok {
@@ -391,7 +638,17 @@ func (w *MainWindow) selectPlaylist(pl *state.Playlist) {
 }
 
 func (w *MainWindow) ScrollToPlaying() {
-	w.selectPlaylist(w.state.PlayingPlaylist())
+	playing := w.state.PlayingPlaylist()
+	if playing == nil {
+		return
+	}
+
+	if playing == w.state.Library() {
+		w.Body.SelectLibrary()
+		return
+	}
+
+	w.selectPlaylist(playing)
 }
 
 func (w *MainWindow) SetVolume(perc float64) {
@@ -12,6 +12,7 @@ import (
 	"github.com/diamondburned/gotk4/pkg/gio/v2"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -46,6 +47,9 @@ func activate(app *gtk.Application) *ui.MainWindow {
 
 	st, err := state.ReadFromFile()
 	if err != nil {
+		if errors.Is(err, state.ErrTooNew) {
+			log.Fatalln("Refusing to overwrite state:", err)
+		}
 		log.Printf("failed to restore state (%v); creating a new one.\n", err)
 		st = state.NewState()
 	}
@@ -84,6 +88,16 @@ func activate(app *gtk.Application) *ui.MainWindow {
 
 		st.SaveAll()
 		st.WaitUntilSaved()
+
+		// The state is kept in a database, so export it as JSON for debugging
+		// only if asked to.
+		if path := os.Getenv("AQOURS_EXPORT_STATE"); path != "" {
+			if err := st.ExportJSON(path); err != nil {
+				log.Println("Failed to export state:", err)
+			}
+		}
+
+		st.Close()
 	})
 
 	return w